@@ -0,0 +1,537 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// --archive=tar|zip streams the selected files into archives in the backup
+// folder (backup-0001.tar, backup-0002.tar, ...) instead of writing each
+// one separately, which is much faster on sticks that handle many small
+// files badly; zip volumes open anywhere without extra tools. A new archive
+// is started before one would pass the size limit (by default the
+// destination's largest file), and --archive-split=tier gives each tier
+// archives of its own.
+//
+// With --zip-password each zip member is sealed with the same AES-256-GCM
+// format as --encrypt (see encrypt.go) and named <name>.enc; the key comes
+// from the password through scrypt, and its salt and check value are kept
+// in the archive comment. The archive still lists and opens anywhere, but
+// only backuper can read the members. Sealed members are stored, not
+// deflated.
+//
+// The manifest keeps each file's logical destination plus its archive and
+// member name, and for tar the offset of the member's data, so restore and
+// verify can go straight to a member. Zip members are found through the
+// archive's central directory instead.
+
+// archiveOut is the archive being written; nil unless --archive is set.
+var archiveOut *archiveWriter
+
+const archivePrefix = "backup-"
+
+// tarOverhead bounds the header blocks of one tar member, including a PAX
+// record for long names. zipOverhead does the same for a zip member's
+// local header, data descriptor, encryption header and directory entry,
+// less the name itself.
+const (
+	tarOverhead = 3 * 512
+	zipOverhead = 256
+)
+
+type archiveWriter struct {
+	mu      sync.Mutex
+	dir     string
+	format  string // "tar" or "zip"
+	limit   int64
+	key     *fileKey          // zip members are sealed with it when set
+	comment string            // zip archive comment recording the key
+	groupOf map[string]string // source -> tier, with --archive-split=tier
+	vols    map[string]*archiveVolume
+	closed  []string
+}
+
+// archiveVolume is one numbered sequence of archives.
+type archiveVolume struct {
+	prefix string
+	next   int
+	name   string // current archive, relative to the backup folder
+	f      *os.File
+	buf    *bufio.Writer
+	cw     *countingWriter
+	tw     *tar.Writer
+	zw     *zip.Writer
+	dirLen int64 // size the zip central directory will take
+}
+
+// countingWriter tracks the position in the archive being written.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func newArchiveWriter(dir, format string, limit int64, password string) (*archiveWriter, error) {
+	if format != "tar" && format != "zip" {
+		return nil, fmt.Errorf("invalid --archive %q (want tar|zip)", format)
+	}
+	a := &archiveWriter{dir: dir, format: format, limit: limit, vols: map[string]*archiveVolume{}}
+	if password != "" {
+		e, k, err := newKeyEntry([]byte(password))
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		a.key, a.comment = k, zipKeyComment+string(b)
+	}
+	return a, nil
+}
+
+// zipKeyComment starts the comment of a password-protected zip archive,
+// followed by its key entry as JSON.
+const zipKeyComment = "backuper key: "
+
+// splitByTier gives each tier of selected its own archives, named after it.
+func (a *archiveWriter) splitByTier(selected []FileInfoRec) {
+	a.groupOf = make(map[string]string, len(selected))
+	for _, f := range selected {
+		a.groupOf[f.Path] = sanitizeLabel(f.Tier)
+	}
+}
+
+// volume returns the archive sequence src goes into, numbering on from any
+// archives left by earlier runs into the same folder.
+func (a *archiveWriter) volume(src string) *archiveVolume {
+	group := a.groupOf[src]
+	v := a.vols[group]
+	if v != nil {
+		return v
+	}
+	v = &archiveVolume{prefix: archivePrefix, next: 1}
+	if group != "" {
+		v.prefix += group + "-"
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(a.dir, v.archiveName(v.next, a.format))); err != nil {
+			break
+		}
+		v.next++
+	}
+	a.vols[group] = v
+	return v
+}
+
+func (v *archiveVolume) archiveName(i int, format string) string {
+	return fmt.Sprintf("%s%04d.%s", v.prefix, i, format)
+}
+
+func (v *archiveVolume) open() bool { return v.f != nil }
+
+// size is what the current archive will take once finished.
+func (v *archiveVolume) size() int64 {
+	if v.zw != nil {
+		return v.cw.n + v.dirLen + 98 // plus the zip64 and plain end records
+	}
+	return v.cw.n + 1024 // plus the tar end blocks
+}
+
+// roll finishes v's current archive and starts the next one.
+func (a *archiveWriter) roll(v *archiveVolume) error {
+	if err := a.finish(v); err != nil {
+		return err
+	}
+	name := v.archiveName(v.next, a.format)
+	f, err := os.OpenFile(filepath.Join(a.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	v.next++
+	v.name, v.f, v.dirLen = name, f, 0
+	v.buf = bufio.NewWriterSize(f, 1<<20)
+	v.cw = &countingWriter{w: v.buf}
+	if a.format == "zip" {
+		v.zw = zip.NewWriter(v.cw)
+		if a.comment != "" {
+			if err := v.zw.SetComment(a.comment); err != nil {
+				return err
+			}
+			v.dirLen = int64(len(a.comment))
+		}
+	} else {
+		v.tw = tar.NewWriter(v.cw)
+	}
+	return nil
+}
+
+// finish completes v's current archive, if any.
+func (a *archiveWriter) finish(v *archiveVolume) error {
+	if !v.open() {
+		return nil
+	}
+	var err error
+	if v.zw != nil {
+		err = v.zw.Close()
+	} else {
+		err = v.tw.Close()
+	}
+	if err == nil {
+		err = v.buf.Flush()
+	}
+	if err == nil {
+		err = v.f.Sync()
+	}
+	if cerr := v.f.Close(); err == nil {
+		err = cerr
+	}
+	a.closed = append(a.closed, v.name)
+	v.f, v.tw, v.zw = nil, nil, nil
+	return err
+}
+
+// Close completes the last archives and reports the archives written.
+func (a *archiveWriter) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	groups := make([]string, 0, len(a.vols))
+	for g := range a.vols {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	var err error
+	for _, g := range groups {
+		if ferr := a.finish(a.vols[g]); err == nil {
+			err = ferr
+		}
+	}
+	if len(a.closed) > 0 {
+		fmt.Printf("Wrote %d archive(s): %s\n", len(a.closed), strings.Join(a.closed, ", "))
+	}
+	return err
+}
+
+// need bounds the bytes a member of size bytes named name adds to an
+// archive.
+func (a *archiveWriter) need(name string, size int64) int64 {
+	if a.format == "zip" {
+		// Deflate can grow incompressible data very slightly, as does
+		// sealing (16 bytes per 64 KiB chunk).
+		return zipOverhead + 2*int64(len(name)+len(encExt)) + size + size/1000
+	}
+	return tarOverhead + (size+511)/512*512
+}
+
+// Add appends src as the member for dst. Members are written one at a
+// time; other workers wait their turn.
+func (a *archiveWriter) Add(ctx context.Context, src, dst string, agg *progressAgg, logsCh chan string, plain bool) (string, string, copyInfo) {
+	info := copyInfo{Strategy: copyArchived}
+	st, err := os.Stat(src)
+	if err != nil {
+		return "error", err.Error(), info.failed(err)
+	}
+	rel, err := filepath.Rel(a.dir, dst)
+	if err != nil {
+		return "error", err.Error(), info.failed(err)
+	}
+	member := filepath.ToSlash(rel)
+	need := a.need(member, st.Size())
+	if a.limit > 0 && need+1024 > a.limit {
+		err := fmt.Errorf("too large for one archive (limit %s)", humanSize(a.limit))
+		return "error", err.Error(), info.failed(err)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "error", err.Error(), info.failed(err)
+	}
+	defer in.Close()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	v := a.volume(src)
+	if !v.open() || (a.limit > 0 && v.size()+need > a.limit) {
+		if err := a.roll(v); err != nil {
+			return "error", err.Error(), info.failed(err)
+		}
+	}
+	progressEvents.Emit(progressEvent{Event: "file_start", Path: src, Dst: dst, Size: st.Size()})
+	fileLog(logsCh, plain, slog.LevelInfo, "Start", "file", filepath.Base(src), "bytes", st.Size(), "archive", v.name)
+	var w io.Writer
+	var sealer *encryptWriter
+	if v.zw != nil {
+		fh, _ := zip.FileInfoHeader(st)
+		fh.Name = member
+		fh.Method = zip.Deflate
+		switch builtinCategory(src) {
+		case "image", "audio", "video", "archive":
+			fh.Method = zip.Store // already compressed
+		}
+		if a.key != nil {
+			member += encExt
+			fh.Name, fh.Method = member, zip.Store
+		}
+		v.dirLen += zipOverhead + int64(len(member))
+		if w, err = v.zw.CreateHeader(fh); err == nil && a.key != nil {
+			sealer, err = newEncryptWriter(w, a.key)
+			w = sealer
+		}
+	} else {
+		var hdr *tar.Header
+		if hdr, err = tar.FileInfoHeader(st, ""); err == nil {
+			hdr.Name = member
+			hdr.Uname, hdr.Gname = "", ""
+			err = v.tw.WriteHeader(hdr)
+		}
+		w, info.Offset = v.tw, v.cw.n
+	}
+	if err != nil {
+		return "error", err.Error(), info.failed(err)
+	}
+	info.Archive, info.Member, info.StoredSize = v.name, member, st.Size()
+	var h hash.Hash
+	var r io.Reader = &ctxReader{ctx: ctx, r: in, agg: agg}
+	if recordChecksums {
+		h, _ = newChecksumHash(checksumAlgo)
+		r = io.TeeReader(r, h)
+	}
+	started := clk.Now()
+	n, err := io.CopyN(w, r, st.Size())
+	if err == nil && sealer != nil {
+		err = sealer.Close()
+	}
+	if err != nil {
+		// A tar header promised st.Size() bytes; pad so the archive stays
+		// readable. A zip member just ends short. Either way the member is
+		// recorded as failed.
+		if v.tw != nil {
+			if _, perr := io.CopyN(w, zeroReader{}, st.Size()-n); perr != nil {
+				_ = v.f.Close() // unusable; the next file starts a new archive
+				v.f, v.tw = nil, nil
+			}
+		}
+		if err == io.EOF {
+			err = fmt.Errorf("file shrank while reading")
+		}
+		return "error", err.Error(), info.failed(err)
+	}
+	if h != nil {
+		info.Checksum = formatChecksum(checksumAlgo, h)
+	}
+	fileLog(logsCh, plain, slog.LevelInfo, "Done", "file", filepath.Base(src), "bytes", n, "duration", since(started))
+	return "copied", "ok", info
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// zipArchive is a zip archive opened by restore or verify.
+type zipArchive struct {
+	members map[string]*zip.File
+	entry   *keyEntry // set when the members are sealed
+	key     *fileKey  // set once unlocked by prepareArchives
+}
+
+// zipArchives caches the zip archives read by restore and verify, by path.
+var (
+	zipMu       sync.Mutex
+	zipArchives = map[string]*zipArchive{}
+)
+
+func openZipArchive(path string) (*zipArchive, error) {
+	zipMu.Lock()
+	defer zipMu.Unlock()
+	if z, ok := zipArchives[path]; ok {
+		return z, nil
+	}
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	z := &zipArchive{members: make(map[string]*zip.File, len(r.File))}
+	for _, f := range r.File {
+		z.members[f.Name] = f
+	}
+	if js, ok := strings.CutPrefix(r.Comment, zipKeyComment); ok {
+		var e keyEntry
+		if err := json.Unmarshal([]byte(js), &e); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("%s: unreadable key in archive comment: %w", path, err)
+		}
+		z.entry = &e
+	}
+	zipArchives[path] = z
+	return z, nil
+}
+
+// prepareArchives opens the zip archives recs refer to and, if any of
+// their members are sealed, asks for the password once up front so
+// workers never prompt.
+func prepareArchives(backupDir string, recs []ManifestRec, passFile string) error {
+	var password []byte
+	for _, rec := range recs {
+		if filepath.Ext(rec.Archive) != ".zip" {
+			continue
+		}
+		z, err := openZipArchive(filepath.Join(backupDir, filepath.FromSlash(rec.Archive)))
+		if err != nil || z.entry == nil || z.key != nil {
+			continue // errors are reported per file
+		}
+		if password == nil {
+			if password, err = readPassphrase(passFile, "Zip password: "); err != nil {
+				return err
+			}
+		}
+		k, ok := z.entry.unlock(password)
+		if !ok {
+			return fmt.Errorf("wrong zip password for %s", rec.Archive)
+		}
+		z.key = k
+	}
+	return nil
+}
+
+// openArchived opens the data of an archived file and returns its size in
+// the archive.
+func openArchived(backupDir string, rec ManifestRec) (io.ReadCloser, int64, error) {
+	path := filepath.Join(backupDir, filepath.FromSlash(rec.Archive))
+	if filepath.Ext(path) == ".zip" {
+		z, err := openZipArchive(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		f := z.members[rec.Member]
+		if f == nil {
+			return nil, 0, fmt.Errorf("%s has no member %s", rec.Archive, rec.Member)
+		}
+		rc, err := f.Open()
+		if err != nil || !strings.HasSuffix(rec.Member, encExt) {
+			return rc, int64(f.UncompressedSize64), err
+		}
+		if z.key == nil {
+			rc.Close()
+			return nil, 0, fmt.Errorf("%s: member %s is sealed and the archive is not unlocked", rec.Archive, rec.Member)
+		}
+		dr, err := newDecryptReader(rc, map[string]*fileKey{z.key.ID(): z.key})
+		if err != nil {
+			rc.Close()
+			return nil, 0, err
+		}
+		size := rec.Size
+		if rec.StoredSize != 0 {
+			size = rec.StoredSize
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{dr, rc}, size, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	size := rec.Size
+	if rec.StoredSize != 0 {
+		size = rec.StoredSize // the member's size, should the file have changed since
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, rec.Offset, size), f}, size, nil
+}
+
+// restoreArchived extracts an archived file to out through a .part file.
+// An existing file of the original size is left alone.
+func restoreArchived(ctx context.Context, rec ManifestRec, backupDir, out string, agg *progressAgg) (string, string) {
+	if st, err := os.Stat(out); err == nil && st.Size() == rec.Size {
+		agg.AddTotal(-rec.Size)
+		return "skipped", "exists-same-size"
+	}
+	member, _, err := openArchived(backupDir, rec)
+	if err != nil {
+		agg.AddTotal(-rec.Size)
+		return "error", err.Error()
+	}
+	defer member.Close()
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return "error", err.Error()
+	}
+	tmp := out + ".part"
+	f, err := openFileSequentialWrite(tmp, 0o644)
+	if err != nil {
+		return "error", err.Error()
+	}
+	bufPtr := bufPoolGet()
+	defer bufPoolPut(bufPtr)
+	_, err = io.CopyBuffer(f, &ctxReader{ctx: ctx, r: member, agg: agg}, *bufPtr)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, out)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "error", err.Error()
+	}
+	return "restored", ""
+}
+
+// verifyArchived reads an archived file's data and checks its size and
+// checksum against the record. Reading a zip member also checks its CRC,
+// and a sealed member's chunks their authentication codes.
+func verifyArchived(rec ManifestRec, backupDir string, agg *progressAgg) verifyResult {
+	member, size, err := openArchived(backupDir, rec)
+	if err != nil {
+		agg.AddTotal(-rec.Size)
+		return verifyResult{Path: rec.Dst, Problem: "cannot open in archive: " + err.Error()}
+	}
+	defer member.Close()
+	algo, want, hasSum := splitChecksum(rec.Checksum)
+	if !hasSum {
+		algo = "sha256"
+	}
+	h, err := newChecksumHash(algo)
+	if err != nil {
+		return verifyResult{Path: rec.Dst, Problem: err.Error()}
+	}
+	bufPtr := bufPoolGet()
+	defer bufPoolPut(bufPtr)
+	n, err := io.CopyBuffer(h, member, *bufPtr)
+	agg.Add(n)
+	agg.AddTotal(n - rec.Size)
+	switch {
+	case err != nil:
+		return verifyResult{Path: rec.Dst, Problem: "read error: " + err.Error(), Corrupted: true}
+	case n != size:
+		return verifyResult{Path: rec.Dst, Problem: fmt.Sprintf("archive holds %d bytes, manifest says %d", n, size)}
+	case hasSum && hex.EncodeToString(h.Sum(nil)) != want:
+		return verifyResult{Path: rec.Dst, Problem: "checksum mismatch", Corrupted: true}
+	}
+	return verifyResult{Path: rec.Dst}
+}
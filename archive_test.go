@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// archiveForTest writes files (relative path -> content) into archives in
+// a new backup folder and returns the folder and the manifest records.
+func archiveForTest(t *testing.T, format, password string, limit int64, files map[string]string) (string, []ManifestRec) {
+	t.Helper()
+	dir := t.TempDir()
+	src, backup := filepath.Join(dir, "src"), filepath.Join(dir, "backup")
+	mkdirAll(t, backup)
+	a, err := newArchiveWriter(backup, format, limit, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agg := &progressAgg{start: clk.Now()}
+	var recs []ManifestRec
+	for rel, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(rel))
+		mkdirAll(t, filepath.Dir(p))
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		dst := filepath.Join(backup, filepath.FromSlash(rel))
+		status, msg, info := a.Add(context.Background(), p, dst, agg, nil, true)
+		if status != "copied" {
+			t.Fatalf("archive %s: %s %s", rel, status, msg)
+		}
+		recs = append(recs, ManifestRec{Src: p, Dst: dst, Size: int64(len(content)), Status: status, Checksum: info.Checksum,
+			StoredSize: info.StoredSize, Archive: info.Archive, Member: info.Member, Offset: info.Offset})
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return backup, recs
+}
+
+// extractForTest restores recs from backup and checks every file comes
+// back as it was written.
+func extractForTest(t *testing.T, backup string, recs []ManifestRec, files map[string]string) {
+	t.Helper()
+	out := t.TempDir()
+	agg := &progressAgg{start: clk.Now()}
+	for _, rec := range recs {
+		rel, _ := filepath.Rel(backup, rec.Dst)
+		if status, msg := restoreArchived(context.Background(), rec, backup, filepath.Join(out, rel), agg); status != "restored" {
+			t.Errorf("extract %s: %s %s", rel, status, msg)
+			continue
+		}
+		if res := verifyArchived(rec, backup, agg); res.Problem != "" {
+			t.Errorf("verify %s: %s", rel, res.Problem)
+		}
+		got, err := os.ReadFile(filepath.Join(out, rel))
+		if want := files[filepath.ToSlash(rel)]; err != nil || string(got) != want {
+			t.Errorf("%s = %d bytes, %v; want %d bytes", rel, len(got), err, len(want))
+		}
+	}
+}
+
+func testArchiveFiles() map[string]string {
+	return map[string]string{
+		"notes.txt":         strings.Repeat("compressible text ", 5000),
+		"photos/a.jpg":      string(bytes.Repeat([]byte{0xff, 0xd8, 7}, 40000)),
+		"empty.txt":         "",
+		"deep/er/name.json": `{"k": "v"}`,
+	}
+}
+
+func TestZipArchiveRoundTrip(t *testing.T) {
+	files := testArchiveFiles()
+	backup, recs := archiveForTest(t, "zip", "", 0, files)
+	extractForTest(t, backup, recs, files)
+}
+
+func TestZipPasswordRoundTrip(t *testing.T) {
+	files := testArchiveFiles()
+	backup, recs := archiveForTest(t, "zip", "s3cret", 0, files)
+	for _, rec := range recs {
+		if !strings.HasSuffix(rec.Member, encExt) {
+			t.Errorf("member %s is not sealed", rec.Member)
+		}
+	}
+	z, err := openZipArchive(filepath.Join(backup, recs[0].Archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing in the archive is readable without the password.
+	for _, rec := range recs {
+		rc, err := z.members[rec.Member].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw := new(bytes.Buffer)
+		_, _ = raw.ReadFrom(rc)
+		rc.Close()
+		if want := files[strings.TrimSuffix(rec.Member, encExt)]; want != "" && strings.Contains(raw.String(), want[:8]) {
+			t.Errorf("sealed member %s holds plain text", rec.Member)
+		}
+	}
+	if _, _, err := openArchived(backup, recs[0]); err == nil {
+		t.Error("sealed member opened before the archive was unlocked")
+	}
+
+	passFile := func(pass string) string {
+		p := filepath.Join(t.TempDir(), "pass")
+		if err := os.WriteFile(p, []byte(pass+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	if err := prepareArchives(backup, recs, passFile("wrong")); err == nil {
+		t.Fatal("wrong password accepted")
+	}
+	if err := prepareArchives(backup, recs, passFile("s3cret")); err != nil {
+		t.Fatal(err)
+	}
+	extractForTest(t, backup, recs, files)
+}
+
+func TestTarArchiveRoundTrip(t *testing.T) {
+	files := testArchiveFiles()
+	// Small enough that the files spread over several volumes.
+	backup, recs := archiveForTest(t, "tar", "", 200<<10, files)
+	archives := map[string]bool{}
+	for _, rec := range recs {
+		archives[rec.Archive] = true
+		if rec.Offset%512 != 0 {
+			t.Errorf("%s: member data at offset %d, not on a tar block", rec.Member, rec.Offset)
+		}
+	}
+	if len(archives) < 2 {
+		t.Errorf("archives %v; want the size limit to start a second one", archives)
+	}
+	for name := range archives {
+		if st, err := os.Stat(filepath.Join(backup, name)); err != nil || st.Size() > 200<<10 {
+			t.Errorf("%s exceeds the size limit: %v", name, err)
+		}
+	}
+	extractForTest(t, backup, recs, files)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// With --atomic-dirs (folders or glob patterns) or --atomic-marker (a file
+// name such as .backup-atomic placed in a folder), a flagged folder is
+// selected whole or not at all: half a thesis folder is no use. Each one
+// enters selection as a single entry as large as all its files together and
+// as important as the most important of them; a flagged folder inside
+// another belongs to the outer one. Once selection is done the entries are
+// expanded back into their files.
+
+// atomicUnits replaces the files of every atomic folder with one entry for
+// the folder (its Path is the folder) and returns those folders' files keyed
+// by that path.
+func atomicUnits(files []FileInfoRec, sources, specs []string, marker string) ([]FileInfoRec, map[string][]FileInfoRec) {
+	var paths, globs, roots []string
+	for _, s := range specs {
+		if strings.ContainsAny(s, "*?[{") {
+			globs = append(globs, s)
+		} else if abs, err := filepath.Abs(expandPath(s)); err == nil {
+			paths = append(paths, filepath.Clean(abs))
+		}
+	}
+	for _, s := range sources {
+		if abs, err := filepath.Abs(expandPath(s)); err == nil {
+			roots = append(roots, filepath.Clean(abs))
+		}
+	}
+	marked := map[string]bool{}
+	if marker != "" {
+		for _, f := range files {
+			if filepath.Base(f.Path) == marker {
+				marked[filepath.Dir(f.Path)] = true
+			}
+		}
+	}
+	isAtomic := func(dir string) bool {
+		return marked[dir] || matchAny(dir, globs) || containsString(paths, dir)
+	}
+	// outermost maps a directory to the outermost atomic folder holding it,
+	// or "" when there is none.
+	outermost := map[string]string{}
+	var unitOf func(dir string) string
+	unitOf = func(dir string) string {
+		if u, ok := outermost[dir]; ok {
+			return u
+		}
+		u := ""
+		// Atomic folders are looked for below the sources, not above.
+		if parent := filepath.Dir(dir); parent != dir && !containsString(roots, dir) {
+			u = unitOf(parent)
+		}
+		if u == "" && isAtomic(dir) {
+			u = dir
+		}
+		outermost[dir] = u
+		return u
+	}
+
+	units := map[string][]FileInfoRec{}
+	out := files[:0:0]
+	index := map[string]int{}
+	for _, f := range files {
+		u := unitOf(filepath.Dir(f.Path))
+		if u == "" {
+			out = append(out, f)
+			continue
+		}
+		units[u] = append(units[u], f)
+		i, ok := index[u]
+		if !ok {
+			index[u] = len(out)
+			out = append(out, FileInfoRec{Path: u, Size: f.Size, MTime: f.MTime, Priority: f.Priority, Tier: f.Tier, Taken: f.Taken})
+			continue
+		}
+		e := &out[i]
+		e.Size += f.Size
+		if f.Priority > e.Priority {
+			e.Priority, e.Tier = f.Priority, f.Tier
+		}
+		if f.MTime.After(e.MTime) {
+			e.MTime = f.MTime
+		}
+	}
+	return out, units
+}
+
+// expandAtomicUnits replaces each selected folder entry with its files.
+func expandAtomicUnits(selected []FileInfoRec, units map[string][]FileInfoRec) []FileInfoRec {
+	out := make([]FileInfoRec, 0, len(selected))
+	for _, f := range selected {
+		if fs, ok := units[f.Path]; ok {
+			out = append(out, fs...)
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// `backuper bench` measures the destination drive: sequential writes with
+// each candidate buffer size, a read back, and small files written (and
+// synced) by 1, 2, 4 and 8 workers. From that it recommends a buffer size,
+// a worker count and the small/large file thresholds, and saves them in the
+// [tuning] section of the job file on the drive:
+//
+//	[tuning]
+//	workers = 4
+//	buffer = "16.00 MB"
+//	small_file = "512.00 KB"
+//	large_file = "16.00 MB"
+//	fast = true
+//
+// Every later backup to that drive starts from these settings instead of
+// tuning itself (see tuning.go); flags given on the command line still win.
+
+// tuningConfig is the [tuning] section of a job file.
+type tuningConfig struct {
+	Workers   int    `toml:"workers" yaml:"workers"`
+	Buffer    string `toml:"buffer" yaml:"buffer"`
+	SmallFile string `toml:"small_file" yaml:"small_file"`
+	LargeFile string `toml:"large_file" yaml:"large_file"`
+	Fast      bool   `toml:"fast" yaml:"fast"`
+}
+
+var (
+	benchBuffers = []int{1 << 20, 4 << 20, 8 << 20, 16 << 20, 32 << 20}
+	benchWorkers = []int{1, 2, 4, 8}
+)
+
+const benchSmallFile = 16 << 10
+
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	dest := fs.String("dest", "", "Drive or folder to measure (default: the USB root)")
+	sizeFlag := fs.String("size", "512M", "Data written by the sequential test, split across the buffer sizes tried")
+	smallN := fs.Int("small-files", 400, "Files written for each worker count by the small-file test")
+	save := fs.Bool("save", true, "Save the recommended settings to the [tuning] section of the job file on the drive")
+	jobPath := fs.String("config", "", "Job file to save to (default: backup.toml or backup.yaml on the drive; backup.toml is created if neither exists)")
+	_ = fs.Parse(args)
+	g.apply()
+
+	root := *dest
+	if root == "" {
+		r, err := usbRoot()
+		mustNoErr(err)
+		root = r
+	}
+	size, err := parseSize(*sizeFlag)
+	if err != nil || size <= 0 {
+		fail(fmt.Errorf("invalid --size %q", *sizeFlag))
+	}
+	if *smallN < 1 {
+		fail(fmt.Errorf("--small-files must be positive"))
+	}
+	dir := filepath.Join(root, fmt.Sprintf(".backuper-bench-%d", os.Getpid()))
+	mustNoErr(os.MkdirAll(dir, 0o755))
+	defer os.RemoveAll(dir)
+	onFatal = func(error) { os.RemoveAll(dir) }
+	fmt.Printf("Benchmarking %s (%s)\n\n", root, detectMedia(root))
+
+	// The pattern is random so compressing or deduplicating controllers
+	// cannot shortcut the writes.
+	pattern := make([]byte, benchBuffers[len(benchBuffers)-1])
+	rand.New(rand.NewSource(1)).Read(pattern)
+
+	fmt.Println("Sequential write (synced):")
+	per := max(size/int64(len(benchBuffers)), 16<<20)
+	var best float64
+	rates := map[int]float64{}
+	last := ""
+	for _, buf := range benchBuffers {
+		path := filepath.Join(dir, fmt.Sprintf("seq-%d", buf))
+		rate, err := benchWrite(path, pattern[:buf], per)
+		mustNoErr(err)
+		rates[buf] = rate
+		best = max(best, rate)
+		fmt.Printf("  buffer %-9s %s/s\n", humanSize(int64(buf)), humanSize(int64(rate)))
+		if last != "" {
+			_ = os.Remove(last)
+		}
+		last = path
+	}
+	// The smallest buffer within 5% of the best does as well with less
+	// memory per worker.
+	buffer := benchBuffers[len(benchBuffers)-1]
+	for _, b := range benchBuffers {
+		if rates[b] >= 0.95*best {
+			buffer = b
+			break
+		}
+	}
+	if rate, err := benchRead(last, buffer); err == nil {
+		fmt.Printf("Sequential read:  %s/s\n", humanSize(int64(rate)))
+	}
+	_ = os.Remove(last)
+
+	fmt.Printf("\nSmall files (%s each, synced):\n", humanSize(benchSmallFile))
+	var bestFiles float64
+	filesPerSec := map[int]float64{}
+	var latency time.Duration
+	for _, w := range benchWorkers {
+		if w > 2*runtime.NumCPU() {
+			break
+		}
+		fps, lat, err := benchSmallFiles(filepath.Join(dir, fmt.Sprintf("small-%d", w)), w, *smallN, pattern[:benchSmallFile])
+		mustNoErr(err)
+		if w == 1 {
+			latency = lat
+		}
+		filesPerSec[w] = fps
+		bestFiles = max(bestFiles, fps)
+		fmt.Printf("  %d worker(s)     %.0f files/s (%s per file)\n", w, fps, lat.Round(time.Microsecond))
+	}
+	workers := 1
+	for _, w := range benchWorkers {
+		if filesPerSec[w] >= 0.9*bestFiles {
+			workers = w
+			break
+		}
+	}
+
+	t := tuneFor(best, latency)
+	cfg := tuningConfig{
+		Workers:   workers,
+		Buffer:    humanSize(int64(buffer)),
+		SmallFile: humanSize(t.small),
+		LargeFile: humanSize(t.large),
+		Fast:      t.fast,
+	}
+	fmt.Printf("\nRecommended: --workers %d, buffer %s, small files up to %s in one write", cfg.Workers, cfg.Buffer, cfg.SmallFile)
+	if cfg.Fast {
+		fmt.Printf(", kernel copy from %s (fast-ssd)", cfg.LargeFile)
+	}
+	fmt.Println()
+	if !*save {
+		return
+	}
+	path, err := findJobFile(root, *jobPath)
+	if err != nil {
+		path = filepath.Join(root, jobFileNames[0])
+	}
+	mustNoErr(saveTuningConfig(path, cfg))
+	fmt.Printf("Saved to the [tuning] section of %s\n", path)
+}
+
+// benchWrite writes n bytes to path in chunks of buf, syncs, and returns
+// the rate in bytes per second.
+func benchWrite(path string, buf []byte, n int64) (float64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	start := clk.Now()
+	for done := int64(0); done < n; {
+		k, err := f.Write(buf[:min(int64(len(buf)), n-done)])
+		if err != nil {
+			return 0, err
+		}
+		done += int64(k)
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	return float64(n) / since(start).Seconds(), nil
+}
+
+// benchRead reads path back with buffers of size buf, past the page cache
+// where the platform allows.
+func benchRead(path string, buf int) (float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	dropCache(f)
+	b := make([]byte, buf)
+	var n int64
+	start := clk.Now()
+	for {
+		k, err := f.Read(b)
+		n += int64(k)
+		if err != nil {
+			break
+		}
+	}
+	return float64(n) / since(start).Seconds(), nil
+}
+
+// benchSmallFiles writes n files of data into dir with the given number of
+// workers, syncing each, and returns files per second and the mean time
+// per file.
+func benchSmallFiles(dir string, workers, n int, data []byte) (float64, time.Duration, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, 0, err
+	}
+	defer os.RemoveAll(dir)
+	jobs := make(chan int)
+	var mu sync.Mutex
+	var busy time.Duration
+	var firstErr error
+	var wg sync.WaitGroup
+	start := clk.Now()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				t := clk.Now()
+				err := writeSynced(filepath.Join(dir, fmt.Sprintf("f%05d", i)), data)
+				mu.Lock()
+				busy += since(t)
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return 0, 0, firstErr
+	}
+	return float64(n) / since(start).Seconds(), busy / time.Duration(n), nil
+}
+
+func writeSynced(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// saveTuningConfig writes cfg as the [tuning] section (tuning: block in
+// YAML) of the job file at path, replacing an existing one and keeping the
+// rest of the file as it is.
+func saveTuningConfig(path string, cfg tuningConfig) error {
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	stamp := "measured by backuper bench on " + clk.Now().Format("2006-01-02 15:04")
+	var section []string
+	isYAML := strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
+	if isYAML {
+		section = []string{
+			"tuning:",
+			"  # " + stamp,
+			fmt.Sprintf("  workers: %d", cfg.Workers),
+			fmt.Sprintf("  buffer: %q", cfg.Buffer),
+			fmt.Sprintf("  small_file: %q", cfg.SmallFile),
+			fmt.Sprintf("  large_file: %q", cfg.LargeFile),
+			fmt.Sprintf("  fast: %t", cfg.Fast),
+		}
+	} else {
+		section = []string{
+			"[tuning]",
+			"# " + stamp,
+			fmt.Sprintf("workers = %d", cfg.Workers),
+			fmt.Sprintf("buffer = %q", cfg.Buffer),
+			fmt.Sprintf("small_file = %q", cfg.SmallFile),
+			fmt.Sprintf("large_file = %q", cfg.LargeFile),
+			fmt.Sprintf("fast = %t", cfg.Fast),
+		}
+	}
+	var lines []string
+	if len(b) > 0 {
+		lines = strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	}
+	start, end := -1, len(lines)
+	for i, l := range lines {
+		t := strings.TrimSpace(l)
+		if start < 0 {
+			if (isYAML && strings.HasPrefix(l, "tuning:")) || (!isYAML && t == "[tuning]") {
+				start = i
+			}
+			continue
+		}
+		if isYAML && l != "" && l[0] != ' ' && l[0] != '\t' && l[0] != '#' {
+			end = i
+			break
+		}
+		if !isYAML && strings.HasPrefix(t, "[") {
+			end = i
+			break
+		}
+	}
+	if start >= 0 {
+		// Keep the blank line that separated the old section from the next.
+		for end > start && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		lines = append(lines[:start], append(section, lines[end:]...)...)
+	} else {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, section...)
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+}
+
+// loadTuningConfig reads the [tuning] section of the job file, if there is
+// one. A missing job file is not an error.
+func loadTuningConfig(dir, path string) (*tuningConfig, error) {
+	p, err := findJobFile(dir, path)
+	if err != nil {
+		if path != "" {
+			return nil, err
+		}
+		return nil, nil
+	}
+	jf, err := loadJobFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return jf.Tuning, nil
+}
+
+// applyTuningConfig starts a backup from the settings bench saved, except
+// those fixed by explicit flags.
+func applyTuningConfig(t *tuningConfig, explicit map[string]bool, g *globalOptions) error {
+	if t.Workers > 0 && !explicit["workers"] {
+		g.workers = t.Workers
+	}
+	if explicit["fast-ssd"] || explicit["boost"] {
+		return nil
+	}
+	if t.Buffer != "" {
+		n, err := parseSize(t.Buffer)
+		if err != nil || n < 64<<10 || n > 1<<30 {
+			return fmt.Errorf("tuning: invalid buffer %q", t.Buffer)
+		}
+		defaultCopyBuffer = int(n)
+	}
+	if t.SmallFile != "" {
+		n, err := parseSize(t.SmallFile)
+		if err != nil || n > 64<<20 {
+			return fmt.Errorf("tuning: invalid small_file %q", t.SmallFile)
+		}
+		smallFileThreshold = int(n)
+	}
+	if t.LargeFile != "" {
+		n, err := parseSize(t.LargeFile)
+		if err != nil {
+			return fmt.Errorf("tuning: invalid large_file %q", t.LargeFile)
+		}
+		largeFileDirectThreshold = n
+	}
+	fastSSDMode = t.Fast
+	if !explicit["adaptive-buffers"] {
+		adaptiveBuffers = false
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// isCaseInsensitiveFS probes whether the filesystem holding dir ignores case
+// by looking up a case-flipped spelling of dir (or of one of its entries) and
+// checking it resolves to the same file.
+func isCaseInsensitiveFS(dir string) bool {
+	candidates := []string{dir}
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, e := range entries {
+			candidates = append(candidates, filepath.Join(dir, e.Name()))
+			if len(candidates) > 8 {
+				break
+			}
+		}
+	}
+	for _, p := range candidates {
+		base := filepath.Base(p)
+		flipped := flipCase(base)
+		if flipped == base {
+			continue
+		}
+		orig, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		alt, err := os.Stat(filepath.Join(filepath.Dir(p), flipped))
+		return err == nil && os.SameFile(orig, alt)
+	}
+	return false
+}
+
+func flipCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// dedupeScanned drops files reached more than once, e.g. through overlapping
+// sources. Paths under a case-insensitive root compare case-folded; the first
+// spelling seen is kept for the destination. It returns the unique files and
+// the paths that collided only by case.
+func dedupeScanned(files []FileInfoRec, insensitiveRoots []string) ([]FileInfoRec, []string) {
+	seen := make(map[string]string, len(files))
+	out := files[:0]
+	var collisions []string
+	for _, f := range files {
+		key := f.Path
+		for _, r := range insensitiveRoots {
+			if prefixOf(strings.ToLower(f.Path), strings.ToLower(r)) {
+				key = strings.ToLower(f.Path)
+				break
+			}
+		}
+		if first, dup := seen[key]; dup {
+			if first != f.Path {
+				collisions = append(collisions, f.Path+" = "+first)
+			}
+			continue
+		}
+		seen[key] = f.Path
+		out = append(out, f)
+	}
+	return out, collisions
+}
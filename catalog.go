@@ -0,0 +1,340 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// The catalog is a SQLite database at the USB root (catalog.db) holding the
+// runs and file records of every backup on the drive, so lookups across
+// backups (the incremental skip checks, list, and queries by path or hash)
+// do not parse every manifest. The JSONL manifests stay the source of
+// truth: the catalog is brought up to date from them whenever it is opened,
+// re-importing only runs whose manifest changed since it was last read, so
+// an interrupted run, a manifest appended to by --watch, a pruned backup or
+// a catalog deleted by hand all sort themselves out.
+
+const catalogName = "catalog.db"
+
+// useCatalog is cleared by --catalog=false.
+var useCatalog = true
+
+const catalogSchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY,
+	dir TEXT NOT NULL UNIQUE,      -- backup folder relative to the USB root, "." for the root
+	manifest_size INTEGER NOT NULL,
+	manifest_mtime INTEGER NOT NULL,
+	label TEXT NOT NULL DEFAULT '',
+	host TEXT NOT NULL DEFAULT '',
+	started INTEGER NOT NULL DEFAULT 0 -- unix seconds
+);
+CREATE TABLE IF NOT EXISTS files (
+	run INTEGER NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+	src TEXT NOT NULL,
+	dst TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	mtime INTEGER NOT NULL,
+	priority INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	message TEXT NOT NULL DEFAULT '',
+	ts REAL NOT NULL,
+	checksum TEXT NOT NULL DEFAULT '',
+	stored_size INTEGER NOT NULL DEFAULT 0,
+	compression TEXT NOT NULL DEFAULT '',
+	encrypted TEXT NOT NULL DEFAULT '',
+	dedup TEXT NOT NULL DEFAULT '',
+	parts INTEGER NOT NULL DEFAULT 0,
+	archive TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS files_run ON files(run);
+CREATE INDEX IF NOT EXISTS files_src ON files(src);
+CREATE INDEX IF NOT EXISTS files_checksum ON files(checksum) WHERE checksum != '';
+`
+
+type catalog struct {
+	db   *sql.DB
+	root string
+}
+
+// openCatalog opens (creating it if needed) the catalog of the USB at root
+// and brings it up to date with the manifests there.
+func openCatalog(root string) (*catalog, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+	path := metaPath(root, catalogName)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+filepath.ToSlash(path)+"?_pragma=busy_timeout(10000)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	c := &catalog{db: db, root: root}
+	if _, err := db.Exec(catalogSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("catalog %s: %w", path, err)
+	}
+	if err := c.sync(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("catalog %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *catalog) Close() error { return c.db.Close() }
+
+// runDirKey is how a backup folder is stored in the runs table.
+func (c *catalog) runDirKey(dir string) string {
+	rel, err := filepath.Rel(c.root, dir)
+	if err != nil {
+		return filepath.ToSlash(dir)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// sync imports the manifests that are new or changed since the catalog last
+// read them and drops runs whose backup is gone.
+func (c *catalog) sync() error {
+	known := map[string][3]int64{} // dir -> id, size, mtime
+	rows, err := c.db.Query(`SELECT id, dir, manifest_size, manifest_mtime FROM runs`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id, size, mtime int64
+		var dir string
+		if err := rows.Scan(&id, &dir, &size, &mtime); err != nil {
+			rows.Close()
+			return err
+		}
+		known[dir] = [3]int64{id, size, mtime}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, m := range findManifests(c.root) {
+		dir := manifestBackupDir(m)
+		st, err := os.Stat(m)
+		if err != nil {
+			continue
+		}
+		key := c.runDirKey(dir)
+		k, ok := known[key]
+		delete(known, key)
+		if ok && k[1] == st.Size() && k[2] == st.ModTime().UnixNano() {
+			continue
+		}
+		if err := c.importRun(key, dir, m, st); err != nil {
+			return err
+		}
+	}
+	for _, k := range known {
+		if _, err := c.db.Exec(`DELETE FROM runs WHERE id = ?`, k[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importRun replaces the catalog's records of the backup in dir with those
+// of its manifest m.
+func (c *catalog) importRun(key, dir, m string, st os.FileInfo) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM runs WHERE dir = ?`, key); err != nil {
+		return err
+	}
+	meta, _ := readRunMeta(dir)
+	var started int64
+	if t := backupTime(dir); !t.IsZero() {
+		started = t.Unix()
+	}
+	res, err := tx.Exec(`INSERT INTO runs (dir, manifest_size, manifest_mtime, label, host, started) VALUES (?, ?, ?, ?, ?, ?)`,
+		key, st.Size(), st.ModTime().UnixNano(), meta.Label, meta.Host, started)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	ins, err := tx.Prepare(`INSERT INTO files (run, src, dst, size, mtime, priority, status, message, ts, checksum, stored_size, compression, encrypted, dedup, parts, archive)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer ins.Close()
+	var insErr error
+	err = readManifest(m, func(r ManifestRec) {
+		if insErr != nil {
+			return
+		}
+		_, insErr = ins.Exec(id, r.Src, r.Dst, r.Size, r.MTime, r.Priority, r.Status, r.Message, r.Ts,
+			r.Checksum, r.StoredSize, r.Compression, r.Encrypted, r.Dedup, r.Parts, r.Archive)
+	})
+	if err != nil {
+		return err
+	}
+	if insErr != nil {
+		return insErr
+	}
+	return tx.Commit()
+}
+
+// lastBackedUp is the catalog's answer to the lastBackedUp function.
+func (c *catalog) lastBackedUp() (map[string]ManifestRec, error) {
+	rows, err := c.db.Query(`SELECT src, dst, size, mtime, priority, status, ts, checksum, stored_size, compression, encrypted, dedup, parts, archive
+		FROM files WHERE status IN ('copied', 'skipped')`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	last := map[string]ManifestRec{}
+	for rows.Next() {
+		var r ManifestRec
+		if err := rows.Scan(&r.Src, &r.Dst, &r.Size, &r.MTime, &r.Priority, &r.Status, &r.Ts, &r.Checksum,
+			&r.StoredSize, &r.Compression, &r.Encrypted, &r.Dedup, &r.Parts, &r.Archive); err != nil {
+			return nil, err
+		}
+		if prev, ok := last[r.Src]; !ok || r.Ts > prev.Ts {
+			last[r.Src] = r
+		}
+	}
+	return last, rows.Err()
+}
+
+// lastBackupTimes is the catalog's answer to the lastBackupTimes function.
+func (c *catalog) lastBackupTimes() (map[string]time.Time, error) {
+	rows, err := c.db.Query(`SELECT src, MAX(ts) FROM files WHERE status = 'copied' GROUP BY src`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	last := map[string]time.Time{}
+	for rows.Next() {
+		var src string
+		var ts float64
+		if err := rows.Scan(&src, &ts); err != nil {
+			return nil, err
+		}
+		last[src] = time.Unix(0, int64(ts*1e9))
+	}
+	return last, rows.Err()
+}
+
+// catalogRun summarizes one backup in the catalog.
+type catalogRun struct {
+	ID      int64
+	Dir     string // relative to the USB root
+	Label   string
+	Host    string
+	Started time.Time
+	Files   int
+	Bytes   int64
+}
+
+// runs lists the backups in the catalog, oldest first. Files and Bytes
+// count the latest successful record per destination.
+func (c *catalog) runs() ([]catalogRun, error) {
+	rows, err := c.db.Query(`SELECT r.id, r.dir, r.label, r.host, r.started, COUNT(f.dst), COALESCE(SUM(f.size), 0)
+		FROM runs r LEFT JOIN (
+			SELECT run, dst, size, MAX(ts) FROM files WHERE status IN ('copied', 'skipped') GROUP BY run, dst
+		) f ON f.run = r.id
+		GROUP BY r.id ORDER BY r.started, r.dir`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []catalogRun
+	for rows.Next() {
+		var r catalogRun
+		var started int64
+		if err := rows.Scan(&r.ID, &r.Dir, &r.Label, &r.Host, &started, &r.Files, &r.Bytes); err != nil {
+			return nil, err
+		}
+		if started != 0 {
+			r.Started = time.Unix(started, 0)
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// catalogFile is a file held by a backup: the latest successful record for
+// its destination.
+type catalogFile struct {
+	Run string // backup folder relative to the USB root
+	Rec ManifestRec
+}
+
+// files returns the files of the backup in folder run (relative to the USB
+// root), or of every backup when run is empty, ordered by backup and
+// source path.
+func (c *catalog) files(run string) ([]catalogFile, error) {
+	rows, err := c.db.Query(`SELECT r.dir, f.src, f.dst, f.size, f.mtime, f.priority, f.status, MAX(f.ts), f.checksum,
+			f.stored_size, f.compression, f.encrypted, f.dedup, f.parts, f.archive
+		FROM files f JOIN runs r ON r.id = f.run
+		WHERE f.status IN ('copied', 'skipped') AND (? = '' OR r.dir = ?)
+		GROUP BY f.run, f.dst ORDER BY r.started, r.dir, f.src`, run, run)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []catalogFile
+	for rows.Next() {
+		var f catalogFile
+		r := &f.Rec
+		if err := rows.Scan(&f.Run, &r.Src, &r.Dst, &r.Size, &r.MTime, &r.Priority, &r.Status, &r.Ts, &r.Checksum,
+			&r.StoredSize, &r.Compression, &r.Encrypted, &r.Dedup, &r.Parts, &r.Archive); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// withCatalog opens the catalog of the USB at root for fn, unless
+// --catalog=false. It reports false when there is no usable catalog, so the
+// caller falls back to reading the manifests.
+func withCatalog(root string, fn func(*catalog) error) bool {
+	if !useCatalog {
+		return false
+	}
+	c, err := openCatalog(root)
+	if err != nil {
+		slog.Debug("catalog unavailable; reading manifests", "error", err)
+		return false
+	}
+	defer c.Close()
+	if err := fn(c); err != nil {
+		slog.Debug("catalog query failed; reading manifests", "error", err)
+		return false
+	}
+	return true
+}
+
+// updateCatalog brings the catalog up to date after a run.
+func updateCatalog(root string) {
+	if !useCatalog {
+		return
+	}
+	c, err := openCatalog(root)
+	if err != nil {
+		slog.Warn("failed to update catalog", "error", err)
+		return
+	}
+	c.Close()
+}
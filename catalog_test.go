@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCatalogFollowsManifests(t *testing.T) {
+	root := t.TempDir()
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeTestBackup(t, root, "old", day, nil, map[string]string{"a.txt": "a", "b.txt": "b"})
+	newer := writeTestBackup(t, root, "new", day.Add(time.Hour), nil, map[string]string{"a.txt": "a2"})
+
+	check := func(name string, wantRuns []string, wantLast map[string]string) {
+		t.Helper()
+		if !withCatalog(root, func(c *catalog) error {
+			runs, err := c.runs()
+			if err != nil {
+				return err
+			}
+			if len(runs) != len(wantRuns) {
+				t.Errorf("%s: %d runs, want %v", name, len(runs), wantRuns)
+			}
+			for i := range runs {
+				if i < len(wantRuns) && runs[i].Dir != wantRuns[i] {
+					t.Errorf("%s: run %d is %s, want %s", name, i, runs[i].Dir, wantRuns[i])
+				}
+			}
+			last, err := c.lastBackedUp()
+			if err != nil {
+				return err
+			}
+			if len(last) != len(wantLast) {
+				t.Errorf("%s: last backed up %v, want %v", name, last, wantLast)
+			}
+			for src, run := range wantLast {
+				if got := filepath.Base(filepath.Dir(last[src].Dst)); got != run {
+					t.Errorf("%s: %s last backed up in %q, want %q", name, src, got, run)
+				}
+			}
+			return nil
+		}) {
+			t.Fatalf("%s: catalog unavailable", name)
+		}
+	}
+	check("first open", []string{"old", "new"}, map[string]string{"/src/a.txt": "new", "/src/b.txt": "old"})
+
+	// A record appended to a manifest is picked up on the next open.
+	f, err := os.OpenFile(filepath.Join(newer, manifestName), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := ManifestRec{Src: "/src/c.txt", Dst: filepath.Join(newer, "c.txt"), Size: 1, Status: "copied", Ts: float64(day.Add(2 * time.Hour).Unix())}
+	if err := json.NewEncoder(f).Encode(rec); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	check("appended", []string{"old", "new"}, map[string]string{"/src/a.txt": "new", "/src/b.txt": "old", "/src/c.txt": "new"})
+
+	// A deleted backup drops out.
+	if err := os.RemoveAll(filepath.Join(root, "old")); err != nil {
+		t.Fatal(err)
+	}
+	check("pruned", []string{"new"}, map[string]string{"/src/a.txt": "new", "/src/c.txt": "new"})
+
+	// Without the catalog the caller is told to read the manifests.
+	useCatalog = false
+	defer func() { useCatalog = true }()
+	if withCatalog(root, func(*catalog) error { return nil }) {
+		t.Error("withCatalog used the catalog with --catalog=false")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+)
+
+// checksumAlgo is the hash recorded in manifest checksums (--checksum-algo).
+// Checksums are stored as "<algo>:<hex>" so verify knows how to recompute
+// them regardless of the setting in effect when it runs.
+var checksumAlgo = "sha256"
+
+var checksumAlgos = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+}
+
+// newChecksumHash returns a fresh hash for algo.
+func newChecksumHash(algo string) (hash.Hash, error) {
+	if fn, ok := checksumAlgos[algo]; ok {
+		return fn(), nil
+	}
+	return nil, fmt.Errorf("unknown checksum algorithm %q (use sha256|sha512|sha1|md5)", algo)
+}
+
+// formatChecksum renders a finished hash the way the manifest stores it.
+func formatChecksum(algo string, h hash.Hash) string {
+	return algo + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// splitChecksum parses a manifest checksum into algorithm and hex digest.
+func splitChecksum(s string) (algo, digest string, ok bool) {
+	algo, digest, ok = strings.Cut(s, ":")
+	if !ok || digest == "" || checksumAlgos[algo] == nil {
+		return "", "", false
+	}
+	return algo, digest, true
+}
+
+// hashFileAlgo is hashFile for an arbitrary supported algorithm.
+func hashFileAlgo(path, algo string) (string, error) {
+	return hashStored(path, 0, algo)
+}
+
+// sumWith returns the hex digest of a source file in algo, taking SHA-256
+// from the checksum cache.
+func sumWith(sums *checksumCache, path string, size int64, mtime time.Time, algo string) (string, error) {
+	if algo == "sha256" && sums != nil {
+		return sums.Sum(path, size, mtime)
+	}
+	return hashFileAlgo(path, algo)
+}
+
+// hashStored hashes a backed-up file, joining its parts when it was split.
+func hashStored(path string, parts int, algo string) (string, error) {
+	h, err := newChecksumHash(algo)
+	if err != nil {
+		return "", err
+	}
+	f, err := openStored(path, parts)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	bufPtr := bufPoolGet()
+	defer bufPoolPut(bufPtr)
+	if _, err := io.CopyBuffer(h, f, *bufPtr); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
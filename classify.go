@@ -0,0 +1,103 @@
+package main
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// Built-in classification used when no profile tier matches a file. It maps a
+// file to a broad category and each category to a priority; extend either
+// table to teach the fallback about more file types.
+
+var categoryPriority = map[string]int{
+	"document": 100,
+	"code":     95,
+	"image":    90,
+	"audio":    60,
+	"video":    50,
+	"archive":  40,
+	"other":    10,
+}
+
+var extCategory = map[string]string{
+	// documents
+	".pdf": "document", ".doc": "document", ".docx": "document", ".odt": "document", ".rtf": "document",
+	".txt": "document", ".md": "document", ".xls": "document", ".xlsx": "document", ".ods": "document",
+	".csv": "document", ".tsv": "document", ".ppt": "document", ".pptx": "document", ".odp": "document",
+	".epub": "document", ".pages": "document", ".numbers": "document", ".key": "document",
+	// code and project files
+	".tex": "code", ".ipynb": "code", ".py": "code", ".r": "code", ".m": "code", ".java": "code",
+	".cs": "code", ".cpp": "code", ".c": "code", ".h": "code", ".hpp": "code", ".ts": "code",
+	".js": "code", ".go": "code", ".rs": "code", ".rb": "code", ".php": "code", ".sh": "code",
+	".ps1": "code", ".bat": "code", ".sql": "code", ".json": "code", ".yaml": "code", ".yml": "code",
+	".toml": "code", ".xml": "code", ".html": "code", ".css": "code",
+	// images
+	".jpg": "image", ".jpeg": "image", ".png": "image", ".gif": "image", ".tiff": "image", ".tif": "image",
+	".bmp": "image", ".heic": "image", ".webp": "image", ".raw": "image", ".cr2": "image", ".nef": "image",
+	".arw": "image", ".dng": "image", ".svg": "image", ".psd": "image",
+	// audio
+	".mp3": "audio", ".m4a": "audio", ".flac": "audio", ".wav": "audio", ".aac": "audio", ".ogg": "audio",
+	".opus": "audio", ".wma": "audio",
+	// video
+	".mp4": "video", ".mov": "video", ".avi": "video", ".mkv": "video", ".webm": "video", ".m4v": "video",
+	".wmv": "video", ".mpg": "video", ".mpeg": "video",
+	// archives
+	".zip": "archive", ".tar": "archive", ".gz": "archive", ".bz2": "archive", ".xz": "archive",
+	".7z": "archive", ".rar": "archive", ".zst": "archive", ".tgz": "archive",
+}
+
+// mimeCategory maps a MIME major type to a category for extensions missing
+// from extCategory.
+var mimeCategory = map[string]string{
+	"text":  "document",
+	"image": "image",
+	"audio": "audio",
+	"video": "video",
+}
+
+// builtinCategory classifies path by extension, then by MIME major type.
+func builtinCategory(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return "other"
+	}
+	if c, ok := extCategory[ext]; ok {
+		return c
+	}
+	if mt := mime.TypeByExtension(ext); mt != "" {
+		major, _, _ := strings.Cut(mt, "/")
+		if c, ok := mimeCategory[major]; ok {
+			return c
+		}
+	}
+	return "other"
+}
+
+// builtinTierPrefix sets the built-in categories apart from profile tiers
+// in FileInfoRec.Tier, so caps, usage and summaries of a profile tier that
+// happens to be called "image" or "other" never pick up fallback files.
+const builtinTierPrefix = "builtin:"
+
+// fallbackPriority is the priority of built-in category c next to the
+// profile tiers: the categories keep their order but are shifted down so the
+// best of them ranks just below the lowest tier, and a file the profile did
+// not name never outranks one it did.
+func fallbackPriority(c string, tiers []Tier) int {
+	pr := categoryPriority[c]
+	if len(tiers) == 0 {
+		return pr
+	}
+	low := tiers[0].Priority
+	for _, t := range tiers[1:] {
+		low = min(low, t.Priority)
+	}
+	top := 0
+	for _, p := range categoryPriority {
+		top = max(top, p)
+	}
+	if top >= low {
+		pr -= top - low + 1
+	}
+	return pr
+}
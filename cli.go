@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// interruptContext returns a context cancelled on the first Ctrl+C/SIGTERM;
+// a second signal exits immediately.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		fmt.Fprintln(os.Stderr, "\nInterrupt received, stopping gracefully...")
+		cancel()
+		<-sigCh
+		fmt.Fprintln(os.Stderr, "Second interrupt, exiting")
+		os.Exit(1)
+	}()
+	return ctx, cancel
+}
+
+// resolveBackupDir maps a backup folder argument to a path: absolute paths
+// are used as-is, anything else is relative to the USB root.
+func resolveBackupDir(usbRoot, dir string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("no backup directory given")
+	}
+	if filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	if strings.Contains(dir, "..") {
+		return "", fmt.Errorf("invalid backup directory %q: path traversal detected", dir)
+	}
+	return filepath.Join(usbRoot, dir), nil
+}
+
+// rebaseDst finds a manifest destination path inside dir. Manifests store
+// absolute paths from backup time, which break when the drive is mounted
+// elsewhere (another machine, another drive letter); the part after the
+// backup folder's own name is re-anchored on dir.
+func rebaseDst(dst, dir string) string {
+	if prefixOf(dst, dir) {
+		return dst
+	}
+	slash := filepath.ToSlash(dst)
+	marker := "/" + filepath.Base(dir) + "/"
+	if i := strings.LastIndex(slash, marker); i >= 0 {
+		return filepath.Join(dir, filepath.FromSlash(slash[i+len(marker):]))
+	}
+	return dst
+}
@@ -0,0 +1,24 @@
+package main
+
+import "time"
+
+// Clock is the time source used by the backup engine: destination names,
+// manifest timestamps, progress and ETA. Tests can swap clk for a fixed or
+// stepping clock to make that output reproducible.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// fixedClock always reports the same instant.
+type fixedClock struct{ t time.Time }
+
+func (c fixedClock) Now() time.Time { return c.t }
+
+var clk Clock = realClock{}
+
+// since is time.Since against clk.
+func since(t time.Time) time.Duration { return clk.Now().Sub(t) }
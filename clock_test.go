@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// withClock runs the rest of the test with clk frozen at t.
+func withClock(t *testing.T, at time.Time) {
+	t.Helper()
+	old := clk
+	clk = fixedClock{at}
+	t.Cleanup(func() { clk = old })
+}
+
+func TestFixedClockManifestTimestamps(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+	withClock(t, at)
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(src, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	noProgress = true
+	manifest := filepath.Join(dir, "usb", manifestName)
+	mkdirAll(t, filepath.Dir(manifest))
+	if copied, _, _ := copyAll(context.Background(), [][2]string{{src, filepath.Join(dir, "usb", "a.txt")}}, manifest, 1, nil); copied != 1 {
+		t.Fatalf("copied %d files, want 1", copied)
+	}
+	var recs []ManifestRec
+	if err := readManifest(manifest, func(rec ManifestRec) { recs = append(recs, rec) }); err != nil {
+		t.Fatal(err)
+	}
+	want := float64(at.UnixNano()) / 1e9
+	if len(recs) != 1 || recs[0].Ts != want {
+		t.Fatalf("manifest = %+v, want one record with ts %v", recs, want)
+	}
+}
+
+func TestFixedClockBackupName(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 45, 0, time.Local)
+	withClock(t, at)
+
+	// The default destination name, as the backup command builds it, is
+	// read back as the backup's start time.
+	dir := filepath.Join(t.TempDir(), "backup_"+clk.Now().Format("20060102_150405"))
+	mkdirAll(t, dir)
+	if got := backupTime(dir); !got.Equal(at) {
+		t.Errorf("backupTime(%s) = %v, want %v", filepath.Base(dir), got, at)
+	}
+	if d := since(at.Add(-time.Hour)); d != time.Hour {
+		t.Errorf("since = %v, want 1h", d)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A command is one `backuper <name>` subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"backup", "Scan the sources and copy the best-fitting selection to the USB (default)", runBackup},
+		{"plan", "Show what backup would copy, without copying (backup --dry-run)", runPlan},
+		{"list", "List the backups on the USB", runList},
+		{"search", "Find backed-up files by path across every backup", runSearch},
+		{"diff", "Show what changed between two backups", runDiff},
+		{"verify", "Check a backup against its manifest", runVerify},
+		{"restore", "Copy a backup back out", runRestore},
+		{"prune", "Delete old backups by retention policy", runPrune},
+		{"rekey", "Add a new current key to an encryption keyring directory", runRekey},
+		{"scrub", "Re-read old backups a slice at a time to catch bit rot", runScrub},
+		{"bench", "Measure the drive and save tuned copy settings for it", runBench},
+	}
+}
+
+// runCommand dispatches to a subcommand. Without one, or when the first
+// argument is a flag, it runs backup so existing invocations keep working.
+func runCommand(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		runBackup(args)
+		return
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			c.run(args[1:])
+			return
+		}
+	}
+	if args[0] != "help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	}
+	printUsage()
+	if args[0] != "help" {
+		os.Exit(2)
+	}
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", filepath.Base(os.Args[0]))
+}
+
+// globalOptions are the flags every subcommand accepts.
+type globalOptions struct {
+	usbRoot string
+	metaDir string
+	workers int
+
+	quiet, verbose, debug bool
+	logFormat             string
+}
+
+func addGlobalFlags(fs *flag.FlagSet) *globalOptions {
+	g := &globalOptions{}
+	fs.StringVar(&g.usbRoot, "usb-root", "", "USB root holding the backups (default: the folder of this executable)")
+	fs.StringVar(&g.metaDir, "meta-dir", "", "Subfolder of a backup for its manifest and other bookkeeping (e.g. .backup-meta)")
+	fs.IntVar(&g.workers, "workers", 0, "Concurrent copy/read workers (0=auto: based on media)")
+	fs.BoolVar(&g.quiet, "quiet", false, "Only log warnings and errors")
+	fs.BoolVar(&g.verbose, "verbose", false, "Also log per-file details such as the copy strategy")
+	fs.BoolVar(&g.debug, "debug", false, "Log everything, including internal decisions")
+	fs.StringVar(&g.logFormat, "log-format", "text", "Log format: text or json (one JSON object per line on stderr)")
+	return g
+}
+
+// apply validates the global options and makes them take effect.
+func (g *globalOptions) apply() {
+	level, err := logLevel(g.quiet, g.verbose, g.debug)
+	mustNoErr(err)
+	if g.logFormat != "text" && g.logFormat != "json" {
+		fail(fmt.Errorf("invalid --log-format %q (want text|json)", g.logFormat))
+	}
+	setupLogging(level, g.logFormat)
+	if g.usbRoot != "" {
+		abs, err := filepath.Abs(g.usbRoot)
+		mustNoErr(err)
+		usbRootOverride = abs
+	}
+	if g.metaDir != "" {
+		if !validMetaDir(filepath.Clean(g.metaDir)) {
+			fail(fmt.Errorf("invalid --meta-dir: must be a relative subfolder"))
+		}
+		metaDirName = filepath.Clean(g.metaDir)
+	}
+}
+
+// parseInterspersed parses args like fs.Parse but also takes flags that
+// follow positional arguments, which it returns.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	_ = fs.Parse(args)
+	var pos []string
+	for fs.NArg() > 0 {
+		pos = append(pos, fs.Arg(0))
+		_ = fs.Parse(fs.Args()[1:])
+	}
+	return pos
+}
+
+func runPlan(args []string) {
+	runBackup(append([]string{"-dry-run"}, args...))
+}
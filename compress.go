@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// With --compress=zstd[:level] compressible files are stored as <name>.zst.
+// Media and archive formats are already compressed and are copied as-is.
+// Selection still budgets for the uncompressed size, so a compressed backup
+// never overruns the drive; it just leaves space unused.
+
+const zstdExt = ".zst"
+
+var compressAlgo string // "" (off) or "zstd"
+var compressLevel = 3
+
+// parseCompress parses a --compress value: "zstd" or "zstd:<1-22>".
+func parseCompress(s string) (string, int, error) {
+	if s == "" {
+		return "", 0, nil
+	}
+	algo, lvl, hasLevel := strings.Cut(strings.ToLower(s), ":")
+	if algo != "zstd" {
+		return "", 0, fmt.Errorf("unsupported --compress %q (use zstd or zstd:<level>)", s)
+	}
+	level := 3
+	if hasLevel {
+		n, err := strconv.Atoi(lvl)
+		if err != nil || n < 1 || n > 22 {
+			return "", 0, fmt.Errorf("invalid zstd level %q (1-22)", lvl)
+		}
+		level = n
+	}
+	return algo, level, nil
+}
+
+// shouldCompress reports whether src will be stored compressed.
+func shouldCompress(src string) bool {
+	if compressAlgo == "" {
+		return false
+	}
+	switch builtinCategory(src) {
+	case "image", "audio", "video", "archive":
+		return false
+	}
+	return true
+}
+
+// storedPath is the destination path for src once the suffixes of the
+// transforms applied to it (.zst, then .enc) are added.
+func storedPath(src, dst string) string {
+	if shouldCompress(src) {
+		dst += zstdExt
+	}
+	if encryptKey != nil {
+		dst += encExt
+	}
+	return dst
+}
+
+// transformedUpToDate decides the skip check for a compressed or encrypted
+// destination, whose size never matches the source: copies carry the source
+// mtime, so an equal mtime means the stored file is current.
+func transformedUpToDate(src, dst os.FileInfo) bool {
+	return src.ModTime().Unix() == dst.ModTime().Unix()
+}
+
+// ctxReader stops a copy once ctx is done, paces it with copyLimiter and
+// reports progress as it reads.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+	agg *progressAgg
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if c.ctx.Err() != nil {
+		return 0, fmt.Errorf("cancelled")
+	}
+	n, err := c.r.Read(p)
+	if c.agg != nil && n > 0 {
+		c.agg.Add(int64(n))
+	}
+	if werr := throttle(c.ctx, n); werr != nil {
+		return n, fmt.Errorf("cancelled")
+	}
+	return n, err
+}
+
+// compressTo streams in through a zstd encoder into out and returns the
+// number of source bytes consumed.
+func compressTo(ctx context.Context, out io.Writer, in io.Reader, agg *progressAgg, buf []byte) (int64, error) {
+	enc, err := zstd.NewWriter(out, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(compressLevel)))
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.CopyBuffer(enc, &ctxReader{ctx: ctx, r: in, agg: agg}, buf)
+	if cerr := enc.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// untransformFile writes the original contents of a stored file to dst,
+// joining parts, decrypting with keys and/or decompressing as needed.
+func untransformFile(ctx context.Context, src string, parts int, dst string, compressed bool, keys map[string]*fileKey, agg *progressAgg) error {
+	in, err := openStored(src, parts)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	var r io.Reader = in
+	if keys != nil {
+		if r, err = newDecryptReader(in, keys); err != nil {
+			return err
+		}
+	}
+	if compressed {
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer dec.Close()
+		r = dec
+	}
+	out, err := openFileSequentialWrite(dst, 0o644)
+	if err != nil {
+		return err
+	}
+	bufPtr := bufPoolGet()
+	defer bufPoolPut(bufPtr)
+	if _, err := io.CopyBuffer(out, &ctxReader{ctx: ctx, r: r, agg: agg}, *bufPtr); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// copyStrategy names the copy path chosen for a single file. It is recorded
+// in the manifest so slow or failed copies can be traced to the path taken.
+type copyStrategy string
+
+const (
+	// copySmall reads the whole file into a pooled buffer and writes it once.
+	copySmall copyStrategy = "small"
+	// copyKernel hands the copy to io.Copy between two *os.File, which lets
+	// the runtime use sendfile or splice instead of a user-space loop. It
+	// is what the kernel path falls back to when neither of the two below
+	// works.
+	copyKernel copyStrategy = "kernel"
+	// copyReflink clones the source's blocks into the copy (FICLONE) on a
+	// copy-on-write filesystem; no data is written.
+	copyReflink copyStrategy = "reflink"
+	// copyRange copies with copy_file_range, inside the kernel.
+	copyRange copyStrategy = "copy_file_range"
+	// copyUring keeps several chunks of the file in flight through
+	// io_uring (--io-uring, Linux).
+	copyUring copyStrategy = "io_uring"
+	// copyDirect is the chunked loop with O_DIRECT, bypassing the page
+	// cache (--direct-io, Linux).
+	copyDirect copyStrategy = "direct"
+	// copyBuffered is the chunked read/write loop with per-file progress.
+	copyBuffered copyStrategy = "buffered"
+	// copyZstd streams the file through a zstd encoder (--compress).
+	copyZstd copyStrategy = "zstd"
+	// copyEncrypted streams the file through the encryptor (--encrypt),
+	// compressing it first when --compress applies.
+	copyEncrypted copyStrategy = "encrypted"
+	// copyDelta rewrites only the changed blocks of an existing copy
+	// (--delta).
+	copyDelta copyStrategy = "delta"
+	// copySplit streams a file too large for the destination filesystem
+	// into numbered parts.
+	copySplit copyStrategy = "split"
+	// copyArchived appends the file to a tar or zip archive (--archive).
+	copyArchived copyStrategy = "archive"
+)
+
+// errNoKernelCopy is returned by kernelCopy when the platform or the
+// filesystems cannot copy in the kernel; nothing has been written yet.
+var errNoKernelCopy = errors.New("no kernel copy path")
+
+// copyRangeChunk is how much one kernel copy call moves, so progress and
+// cancellation are seen between calls.
+const copyRangeChunk = 8 << 20
+
+// copyChunked is io.Copy in copyRangeChunk steps, checking ctx and adding
+// each step to agg. Between two *os.File every step still goes through
+// copy_file_range, sendfile or splice where the platform has them.
+func copyChunked(ctx context.Context, w io.Writer, r io.Reader, agg *progressAgg) (int64, error) {
+	var done int64
+	for {
+		if ctx.Err() != nil {
+			return done, fmt.Errorf("cancelled")
+		}
+		n, err := io.CopyN(w, r, copyRangeChunk)
+		done += n
+		if agg != nil {
+			agg.Add(n)
+		}
+		if err == io.EOF {
+			return done, nil
+		}
+		if err != nil {
+			return done, err
+		}
+	}
+}
+
+// pickCopyStrategy chooses how to copy one file of the given size from src
+// to dst. Encrypted and compressed files are always streamed. Small files
+// take the single read/write path. With --direct-io, files from its
+// threshold up bypass the page cache. Larger files go through the kernel when
+// source and destination share a filesystem (where copy_file_range can avoid
+// moving data at all), or when they are large and fast SSD mode is on,
+// unless --checksums needs to see the data or --limit-rate has to pace it.
+// Everything else uses io_uring when --io-uring is on, or the buffered loop.
+func pickCopyStrategy(src, dst string, size int64) copyStrategy {
+	if encryptKey != nil {
+		return copyEncrypted
+	}
+	if shouldCompress(src) {
+		return copyZstd
+	}
+	t := currentTuning()
+	if size <= t.small {
+		return copySmall
+	}
+	if directIOMin > 0 && size >= directIOMin {
+		return copyDirect
+	}
+	// Checksums need every byte in user space, which copy_file_range
+	// would bypass anyway; so do rate limiting and JSON progress events.
+	if recordChecksums || verifyWrites || copyLimiter != nil || progressEvents.Streaming() {
+		return copyBuffered
+	}
+	if sameFilesystem(src, filepath.Dir(dst)) {
+		return copyKernel
+	}
+	if uringDepth > 0 {
+		return copyUring
+	}
+	if t.fast && size >= t.large {
+		return copyKernel
+	}
+	return copyBuffered
+}
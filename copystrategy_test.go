@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyChunked(t *testing.T) {
+	src := bytes.Repeat([]byte("0123456789abcdef"), (2*copyRangeChunk+12345)/16)
+	var dst bytes.Buffer
+	agg := &progressAgg{total: int64(len(src))}
+	n, err := copyChunked(context.Background(), &dst, bytes.NewReader(src), agg)
+	if err != nil || n != int64(len(src)) || !bytes.Equal(dst.Bytes(), src) {
+		t.Fatalf("copyChunked = %d, %v; want %d bytes copied intact", n, err, len(src))
+	}
+	if agg.Done() != n {
+		t.Errorf("progress %d, want %d", agg.Done(), n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dst.Reset()
+	if n, err := copyChunked(ctx, &dst, bytes.NewReader(src), nil); err == nil || n != 0 {
+		t.Errorf("cancelled copy = %d, %v; want 0 and an error", n, err)
+	}
+}
+
+func TestPickCopyStrategy(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src.bin"), filepath.Join(dir, "dst.bin")
+	if err := os.WriteFile(src, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	large := currentTuning().small + 1
+	key, err := newFileKey("0011223344556677", make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		size int64
+		// set changes the globals the choice depends on.
+		set  func()
+		want copyStrategy
+	}{
+		{"same filesystem", large, func() {}, copyKernel},
+		{"small file", 1, func() {}, copySmall},
+		{"checksums", large, func() { recordChecksums = true }, copyBuffered},
+		{"verify writes", large, func() { verifyWrites = true }, copyBuffered},
+		{"rate limit", large, func() { copyLimiter = newRateLimiter(1 << 20) }, copyBuffered},
+		{"json events", large, func() { progressEvents = &eventStream{enc: json.NewEncoder(io.Discard)} }, copyBuffered},
+		{"direct io", large, func() { directIOMin = large }, copyDirect},
+		{"encrypted", 1, func() { encryptKey = key }, copyEncrypted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				recordChecksums, verifyWrites, copyLimiter, progressEvents, directIOMin, encryptKey = false, false, nil, nil, 0, nil
+			})
+			tt.set()
+			if got := pickCopyStrategy(src, dst, tt.size); got != tt.want {
+				t.Errorf("pickCopyStrategy = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKernelCopyShortSource(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	if err := os.WriteFile(src, []byte("ten bytes!"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := os.Create(filepath.Join(dir, "dst.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	// The file shrank from 20 bytes between the stat and the copy.
+	_, n, err := kernelCopy(context.Background(), out, in, 20, nil)
+	if errors.Is(err, errNoKernelCopy) {
+		t.Skip("no kernel copy on this platform or filesystem")
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) || n != 10 {
+		t.Errorf("kernelCopy = %d, %v; want 10 and io.ErrUnexpectedEOF", n, err)
+	}
+}
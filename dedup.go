@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// With --dedup file contents are kept once in a content-addressed store at
+// the USB root (.store/<first two hex digits>/<sha256>) and each backed-up
+// path becomes a hard link to its object. Where the destination filesystem
+// has no hard links (FAT32, exFAT) a small <name>.ref pointer file is
+// written instead; restore and verify follow it to the object.
+
+const storeDirName = ".store"
+const refExt = ".ref"
+
+var storeTmpSeq uint64
+
+// dedupStore is the content store for this run; nil when --dedup is off.
+var dedupStore *casStore
+
+type casStore struct {
+	root string
+	sums *checksumCache
+}
+
+// refFile is the content of a .ref pointer. Object is relative to the
+// pointer's own directory so the backup survives being mounted elsewhere.
+type refFile struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	Object string `json:"object"`
+}
+
+func newCASStore(usbRoot string, sums *checksumCache) (*casStore, error) {
+	root := filepath.Join(usbRoot, storeDirName)
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &casStore{root: root, sums: sums}, nil
+}
+
+func (s *casStore) objectPath(sum string) string {
+	return filepath.Join(s.root, sum[:2], sum)
+}
+
+// dedupCopy backs src up to dst through the store: the content is copied
+// into the store only if no object with its hash exists yet, then dst is
+// linked (or pointed) to the object.
+func dedupCopy(ctx context.Context, src, dst string, agg *progressAgg, mu *sync.Mutex, logsCh chan string, interactive bool) (string, string, copyInfo) {
+	st, err := os.Stat(src)
+	if err != nil {
+		return "error", err.Error(), copyInfo{}.failed(err)
+	}
+	sum, err := dedupStore.sums.Sum(src, st.Size(), st.ModTime())
+	if err != nil {
+		return "error", err.Error(), copyInfo{}.failed(err)
+	}
+	// Objects are named by SHA-256; the manifest records the configured
+	// algorithm like any other copy.
+	digest, err := sumWith(dedupStore.sums, src, st.Size(), st.ModTime(), checksumAlgo)
+	if err != nil {
+		return "error", err.Error(), copyInfo{}.failed(err)
+	}
+	info := copyInfo{Checksum: checksumAlgo + ":" + digest}
+	if needsSplit(st.Size()) {
+		return "error", "too large for the destination filesystem (files are not split with --dedup)", info
+	}
+	obj := dedupStore.objectPath(sum)
+	msg := "deduplicated"
+	if ost, err := os.Stat(obj); err == nil && ost.Size() == st.Size() {
+		agg.Add(st.Size())
+	} else {
+		if err := os.MkdirAll(filepath.Dir(obj), 0o755); err != nil {
+			return "error", err.Error(), info.failed(err)
+		}
+		// Concurrent workers may store the same content at once; each
+		// writes its own temp file and the identical renames race harmlessly.
+		tmp := fmt.Sprintf("%s.%d.part", obj, atomic.AddUint64(&storeTmpSeq, 1))
+		strategy, err := copyFileWithProgress(ctx, src, tmp, agg, mu, logsCh, interactive, nil, 0)
+		info.Strategy = strategy
+		if err == nil {
+			err = os.Rename(tmp, obj)
+		}
+		if err == nil && verifyWrites {
+			if err = checkWritten(obj, 0, "sha256", sum); err != nil {
+				_ = os.Remove(obj)
+			}
+		}
+		if err != nil {
+			_ = os.Remove(tmp)
+			return "error", err.Error(), info.failed(err)
+		}
+		msg = "stored"
+	}
+	_ = os.Remove(dst)
+	if err := os.Link(obj, dst); err == nil {
+		info.Dedup = "link"
+		return "copied", msg, info
+	}
+	rel, err := filepath.Rel(filepath.Dir(dst), obj)
+	if err != nil {
+		return "error", err.Error(), info.failed(err)
+	}
+	b, _ := json.Marshal(refFile{SHA256: sum, Size: st.Size(), Object: filepath.ToSlash(rel)})
+	if err := os.WriteFile(dst+refExt, b, 0o644); err != nil {
+		return "error", err.Error(), info.failed(err)
+	}
+	info.Dedup = "ref"
+	_ = os.Chtimes(dst+refExt, clk.Now(), st.ModTime())
+	return "copied", msg, info
+}
+
+// resolveRef returns the store object a .ref pointer file refers to.
+func resolveRef(ref string) (string, refFile, error) {
+	var r refFile
+	b, err := os.ReadFile(ref)
+	if err != nil {
+		return "", r, err
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return "", r, fmt.Errorf("%s: %w", ref, err)
+	}
+	if r.Object == "" || !strings.Contains(r.Object, storeDirName) {
+		return "", r, fmt.Errorf("%s: invalid store pointer", ref)
+	}
+	return filepath.Join(filepath.Dir(ref), filepath.FromSlash(r.Object)), r, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Delta transfer (--delta) updates a changed large file in place, writing
+// only the blocks whose content differs. On a USB drive writes are the
+// expensive part, and a block can only be left alone where the new content
+// sits at the same offset, so blocks are compared positionally: data shifted
+// by an insertion has to be rewritten from that point anyway. Block hashes
+// of each delta-updated file are cached in the meta folder, so the next
+// delta only reads the source; without a valid cache the old file is read
+// and compared instead.
+
+const (
+	deltaBlockSize = 128 << 10
+	deltaExt       = ".delta"
+	deltaSigDir    = ".delta-sigs"
+)
+
+// deltaMinSize enables delta transfer for plain files at least this large;
+// 0 disables it. deltaSigRoot is the folder holding block hash caches.
+var (
+	deltaMinSize int64
+	deltaSigRoot string
+)
+
+// useDelta reports whether the existing plain copy dst of src should be
+// updated in place rather than replaced.
+func useDelta(src string, sst, dst os.FileInfo) bool {
+	return deltaMinSize > 0 && sst.Size() >= deltaMinSize && dst.Mode().IsRegular() && resumable(src, sst.Size())
+}
+
+// deltaChanged lets a large file whose size is unchanged but whose mtime
+// moved count as changed under --delta; re-checking it is cheap then. The
+// two-second slack covers FAT timestamp resolution.
+func deltaChanged(sst, dst os.FileInfo) bool {
+	if deltaMinSize <= 0 || sst.Size() < deltaMinSize {
+		return false
+	}
+	d := sst.ModTime().Sub(dst.ModTime())
+	return d > 2*time.Second || d < -2*time.Second
+}
+
+// blockSig is the cached block hashes of a file, valid while its size and
+// mtime are unchanged.
+type blockSig struct {
+	size   int64
+	mtime  int64
+	hashes [][sha256.Size]byte
+}
+
+func sigPath(dst string) string {
+	sum := sha256.Sum256([]byte(filepath.ToSlash(dst)))
+	return filepath.Join(deltaSigRoot, hex.EncodeToString(sum[:16])+".sig")
+}
+
+func loadBlockSig(dst string, st os.FileInfo) *blockSig {
+	b, err := os.ReadFile(sigPath(dst))
+	if err != nil || len(b) < 16 || (len(b)-16)%sha256.Size != 0 {
+		return nil
+	}
+	sig := &blockSig{size: int64(binary.LittleEndian.Uint64(b)), mtime: int64(binary.LittleEndian.Uint64(b[8:]))}
+	if sig.size != st.Size() || sig.mtime != st.ModTime().UnixNano() {
+		return nil
+	}
+	for b = b[16:]; len(b) > 0; b = b[sha256.Size:] {
+		var h [sha256.Size]byte
+		copy(h[:], b)
+		sig.hashes = append(sig.hashes, h)
+	}
+	return sig
+}
+
+func saveBlockSig(dst string, st os.FileInfo, hashes [][sha256.Size]byte) error {
+	if err := os.MkdirAll(deltaSigRoot, 0o755); err != nil {
+		return err
+	}
+	b := make([]byte, 16, 16+len(hashes)*sha256.Size)
+	binary.LittleEndian.PutUint64(b, uint64(st.Size()))
+	binary.LittleEndian.PutUint64(b[8:], uint64(st.ModTime().UnixNano()))
+	for _, h := range hashes {
+		b = append(b, h[:]...)
+	}
+	return os.WriteFile(sigPath(dst), b, 0o644)
+}
+
+// deltaCopy updates dst to the content of src, rewriting only differing
+// blocks, and returns the number of bytes written. dst is renamed to
+// <dst>.delta while it is being modified so an interrupted update is never
+// mistaken for a finished copy; the leftover is discarded by the next run.
+func deltaCopy(ctx context.Context, src, dst string, agg *progressAgg, h hash.Hash) (int64, error) {
+	in, err := openFileSequentialRead(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	sst, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	dst0, err := os.Stat(dst)
+	if err != nil {
+		return 0, err
+	}
+	sig := loadBlockSig(dst, dst0)
+	work := dst + deltaExt
+	if err := os.Rename(dst, work); err != nil {
+		return 0, err
+	}
+	// A copy made read-only by --preserve-metadata must stay writable here.
+	if dst0.Mode().Perm()&0o200 == 0 {
+		_ = os.Chmod(work, dst0.Mode().Perm()|0o200)
+	}
+	out, err := os.OpenFile(work, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	oldSize := dst0.Size()
+	buf := make([]byte, deltaBlockSize)
+	old := make([]byte, deltaBlockSize)
+	var hashes [][sha256.Size]byte
+	var written int64
+	for off, i := int64(0), 0; ; off, i = off+deltaBlockSize, i+1 {
+		if ctx.Err() != nil {
+			return written, fmt.Errorf("cancelled")
+		}
+		n, rerr := io.ReadFull(in, buf)
+		if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			return written, rerr
+		}
+		if n == 0 {
+			break
+		}
+		block := buf[:n]
+		sum := sha256.Sum256(block)
+		hashes = append(hashes, sum)
+		if h != nil {
+			h.Write(block)
+		}
+		if agg != nil {
+			agg.Add(int64(n))
+		}
+		same := false
+		if off+int64(n) <= oldSize && (oldSize-off >= deltaBlockSize || off+int64(n) == oldSize) {
+			if sig != nil && i < len(sig.hashes) {
+				same = sig.hashes[i] == sum
+			} else if _, err := out.ReadAt(old[:n], off); err == nil {
+				same = bytes.Equal(old[:n], block)
+			}
+		}
+		if !same {
+			if err := throttle(ctx, n); err != nil {
+				return written, fmt.Errorf("cancelled")
+			}
+			if _, err := out.WriteAt(block, off); err != nil {
+				return written, err
+			}
+			written += int64(n)
+		}
+		if rerr != nil {
+			break
+		}
+	}
+	if err := out.Truncate(sst.Size()); err != nil {
+		return written, err
+	}
+	if err := out.Close(); err != nil {
+		return written, err
+	}
+	_ = os.Chtimes(work, clk.Now(), sst.ModTime())
+	if err := os.Rename(work, dst); err != nil {
+		return written, err
+	}
+	if st, err := os.Stat(dst); err == nil {
+		if err := saveBlockSig(dst, st, hashes); err != nil {
+			slog.Warn("failed to save block hashes", "file", dst, "error", err)
+		}
+	}
+	return written, nil
+}
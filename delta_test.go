@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeltaCopyRewritesChangedBlocks(t *testing.T) {
+	dir := t.TempDir()
+	deltaSigRoot = filepath.Join(dir, deltaSigDir)
+	t.Cleanup(func() { deltaSigRoot = "" })
+	src, dst := filepath.Join(dir, "src.img"), filepath.Join(dir, "dst.img")
+	data := bytes.Repeat([]byte{1}, 4*deltaBlockSize)
+	if err := os.WriteFile(dst, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	update := func(name string, content []byte, wantWritten int64) {
+		t.Helper()
+		if err := os.WriteFile(src, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		written, err := deltaCopy(context.Background(), src, dst, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if written != wantWritten {
+			t.Errorf("%s: wrote %d bytes, want %d", name, written, wantWritten)
+		}
+		got, err := os.ReadFile(dst)
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("%s: destination differs from the source (%d bytes, %v)", name, len(got), err)
+		}
+		if _, err := os.Stat(dst + deltaExt); !os.IsNotExist(err) {
+			t.Errorf("%s: work file left behind: %v", name, err)
+		}
+	}
+
+	// Compared against the old copy: only the third block is rewritten.
+	data[2*deltaBlockSize+5] = 2
+	update("old copy", data, deltaBlockSize)
+	// Compared against the cached block hashes from that run.
+	if st, err := os.Stat(dst); err != nil || loadBlockSig(dst, st) == nil {
+		t.Fatalf("no block hashes cached after the update: %v", err)
+	}
+	data[7] = 3
+	update("cached hashes", data, deltaBlockSize)
+	// A shorter source truncates the copy without rewriting anything.
+	update("shrunk", data[:3*deltaBlockSize], 0)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+// runDiff implements `backuper diff [<older> <newer>]`: which files were
+// added, removed or modified between two backups, from their catalog
+// records rather than by walking either tree. Files are matched by source
+// path; a file counts as modified when its size, modification time or
+// recorded checksum differs. Without arguments the two newest backups are
+// compared.
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	glob := fs.String("glob", "", "Only compare files whose source path matches this pattern, e.g. '*.pdf'")
+	summaryOnly := fs.Bool("summary", false, "Only print the totals")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: backuper diff [flags] [<older> <newer>]\n\nBackups are folder names as shown by list, or latest/previous (the default).\n\n")
+		fs.PrintDefaults()
+	}
+	names := parseInterspersed(fs, args)
+	g.apply()
+
+	oldName, newName := "previous", "latest"
+	switch len(names) {
+	case 0:
+	case 2:
+		oldName, newName = names[0], names[1]
+	default:
+		fs.Usage()
+		fail(fmt.Errorf("diff needs two backups, or none to compare the two newest"))
+	}
+	root, err := usbRoot()
+	mustNoErr(err)
+	runs := catalogRuns(root)
+	oldDir, err := resolveRun(runs, oldName)
+	mustNoErr(err)
+	newDir, err := resolveRun(runs, newName)
+	mustNoErr(err)
+
+	index := func(dir string) map[string]ManifestRec {
+		m := map[string]ManifestRec{}
+		for _, f := range catalogFiles(root, dir) {
+			if *glob == "" || globMatch(*glob, f.Rec.Src) {
+				m[f.Rec.Src] = f.Rec
+			}
+		}
+		return m
+	}
+	before, after := index(oldDir), index(newDir)
+
+	type change struct {
+		kind  byte // '+', '-' or '~'
+		src   string
+		size  int64
+		delta int64
+	}
+	var changes []change
+	for src, b := range after {
+		a, ok := before[src]
+		switch {
+		case !ok:
+			changes = append(changes, change{'+', src, b.Size, b.Size})
+		case a.Size != b.Size || a.MTime != b.MTime || (a.Checksum != "" && b.Checksum != "" && a.Checksum != b.Checksum):
+			changes = append(changes, change{'~', src, b.Size, b.Size - a.Size})
+		}
+	}
+	for src, a := range before {
+		if _, ok := after[src]; !ok {
+			changes = append(changes, change{'-', src, a.Size, -a.Size})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].src < changes[j].src })
+
+	fmt.Printf("Comparing %s -> %s\n", oldDir, newDir)
+	var count [256]int
+	var bytes [256]int64
+	var net int64
+	for _, c := range changes {
+		count[c.kind]++
+		bytes[c.kind] += c.size
+		net += c.delta
+		if *summaryOnly {
+			continue
+		}
+		if c.kind == '~' {
+			fmt.Printf("~ %s (%s, %s)\n", c.src, humanSize(c.size), formatDelta(c.delta))
+		} else {
+			fmt.Printf("%c %s (%s)\n", c.kind, c.src, humanSize(c.size))
+		}
+	}
+	fmt.Printf("Added %d files (%s), removed %d (%s), modified %d; net change %s\n",
+		count['+'], humanSize(bytes['+']), count['-'], humanSize(bytes['-']), count['~'], formatDelta(net))
+}
+
+// formatDelta renders a byte difference with its sign.
+func formatDelta(n int64) string {
+	if n < 0 {
+		return "-" + humanSize(-n)
+	}
+	return "+" + humanSize(n)
+}
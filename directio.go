@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// --direct-io copies files of at least --direct-io-min with O_DIRECT on
+// Linux, so a large backup (say, 50 GB of video) goes around the page cache
+// instead of evicting everything else from it. Direct I/O needs buffers,
+// offsets and lengths aligned to the device's block size; every chunk but
+// the last is, and the last one is written through the cache.
+
+const (
+	directIOAlign = 4096
+	directIOChunk = 8 << 20
+)
+
+// directIOMin is the size from which files are copied with direct I/O; 0
+// when --direct-io is off.
+var directIOMin int64
+
+var directBufPool = sync.Pool{New: func() any {
+	b := alignedBuffer(directIOChunk)
+	return &b
+}}
+
+// alignedBuffer returns n bytes starting at a directIOAlign boundary.
+func alignedBuffer(n int) []byte {
+	b := make([]byte, n+directIOAlign)
+	off := int(uintptr(unsafe.Pointer(&b[0])) & (directIOAlign - 1))
+	if off != 0 {
+		off = directIOAlign - off
+	}
+	return b[off : off+n]
+}
+
+// directCopy copies in to out with direct I/O, feeding h and agg like the
+// buffered loop. It returns errNoKernelCopy, having copied nothing, when
+// either file cannot be switched to direct I/O (e.g. on tmpfs).
+func directCopy(ctx context.Context, src string, out, in *os.File, size int64, agg *progressAgg, h hash.Hash) (int64, error) {
+	if err := setDirectIO(in, true); err != nil {
+		return 0, errNoKernelCopy
+	}
+	if err := setDirectIO(out, true); err != nil {
+		_ = setDirectIO(in, false)
+		return 0, errNoKernelCopy
+	}
+	bufPtr := directBufPool.Get().(*[]byte)
+	defer directBufPool.Put(bufPtr)
+	buf := *bufPtr
+	var done int64
+	var lastEvent time.Time
+	for {
+		n, er := io.ReadFull(in, buf)
+		if n > 0 {
+			if throttle(ctx, n) != nil {
+				return done, fmt.Errorf("cancelled")
+			}
+			if n%directIOAlign != 0 {
+				// The tail: unaligned, so it goes through the cache.
+				if err := setDirectIO(out, false); err != nil {
+					return done, err
+				}
+			}
+			if _, err := out.Write(buf[:n]); err != nil {
+				return done, err
+			}
+			if h != nil {
+				h.Write(buf[:n])
+			}
+			done += int64(n)
+			if agg != nil {
+				agg.Add(int64(n))
+			}
+			if ctx.Err() != nil {
+				return done, fmt.Errorf("cancelled")
+			}
+			if now := clk.Now(); progressEvents != nil && now.Sub(lastEvent) >= 500*time.Millisecond {
+				progressEvents.Emit(progressEvent{Event: "file_progress", Path: src, Size: size, Bytes: done})
+				lastEvent = now
+			}
+		}
+		if er == io.EOF || er == io.ErrUnexpectedEOF {
+			return done, nil
+		}
+		if er != nil {
+			return done, er
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// setDirectIO is not supported: Windows only offers unbuffered I/O
+// (FILE_FLAG_NO_BUFFERING) when a file is opened.
+func setDirectIO(f *os.File, on bool) error {
+	return errors.New("direct I/O is only available on Linux")
+}
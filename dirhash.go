@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const dirHashName = "dir-hashes.json"
+
+// Directory rollups (--dir-hash) are a coarse incremental shortcut: each
+// scanned directory gets a hash of its files' names, sizes and mtimes. If a
+// directory's rollup equals the one saved by the previous complete run into
+// the same destination, its files are assumed present without checking the
+// destination. Cheaper than per-file checks, but blind to a destination file
+// that was deleted or corrupted since.
+
+var dirHashEnabled bool
+
+var (
+	dirHashMu     sync.Mutex
+	scanDirHashes = map[string]string{}
+)
+
+// dirRollup accumulates one directory's rollup during the scan.
+type dirRollup struct{ h hash.Hash }
+
+func newDirRollup() *dirRollup {
+	if !dirHashEnabled {
+		return nil
+	}
+	return &dirRollup{h: sha256.New()}
+}
+
+func (r *dirRollup) Add(name string, size int64, mtime int64) {
+	if r == nil {
+		return
+	}
+	fmt.Fprintf(r.h, "%s\x00%d\x00%d\n", name, size, mtime)
+}
+
+func (r *dirRollup) Finish(dir string) {
+	if r == nil {
+		return
+	}
+	dirHashMu.Lock()
+	scanDirHashes[dir] = hex.EncodeToString(r.h.Sum(nil))
+	dirHashMu.Unlock()
+}
+
+func loadDirHashes(path string) map[string]string {
+	m := map[string]string{}
+	if b, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(b, &m)
+	}
+	return m
+}
+
+// saveDirHashes stores rollups for directories whose every scanned file was
+// selected; a directory only partly backed up must be rechecked next time.
+func saveDirHashes(path string, files, selected []FileInfoRec) error {
+	partial := map[string]bool{}
+	chosen := make(map[string]bool, len(selected))
+	for _, f := range selected {
+		chosen[f.Path] = true
+	}
+	for _, f := range files {
+		if !chosen[f.Path] {
+			partial[filepath.Dir(f.Path)] = true
+		}
+	}
+	out := map[string]string{}
+	for d, h := range scanDirHashes {
+		if !partial[d] {
+			out[d] = h
+		}
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
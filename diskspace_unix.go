@@ -5,23 +5,34 @@ package main
 import "syscall"
 
 func getUnixFreeSpace(path string, reserve int64) int64 {
+	avail, _ := getUnixDiskSpace(path)
+	free := avail - reserve
+	if free < 0 {
+		free = 0
+	}
+	return free
+}
+
+// getUnixDiskSpace returns the bytes available to this user and the free
+// bytes before any per-user limit. statfs reports no user quotas, and the
+// gap between Bfree and Bavail is only the blocks reserved for root, which
+// are not free to a backup run either, so both are Bavail.
+func getUnixDiskSpace(path string) (int64, int64) {
 	// For Unix systems, use the statvfs system call
 	var stat syscall.Statfs_t
 	err := syscall.Statfs(path, &stat)
 	if err != nil {
-		return 0
+		return 0, 0
 	}
-
-	// Calculate free space
-	free := int64(stat.Bavail) * int64(stat.Bsize)
-	free -= reserve
-	if free < 0 {
-		free = 0
-	}
-	return free
+	avail := int64(stat.Bavail) * int64(stat.Bsize)
+	return avail, avail
 }
 
 // getWindowsFreeSpace is a stub on non-Windows platforms to satisfy references.
 func getWindowsFreeSpace(path string, reserve int64) int64 {
 	return 0
+}
+
+func getWindowsDiskSpace(path string) (int64, int64) {
+	return 0, 0
 }
\ No newline at end of file
@@ -19,49 +19,77 @@ func getUnixFreeSpace(path string, reserve int64) int64 {
 	return 0
 }
 
+func getUnixDiskSpace(path string) (int64, int64) {
+	return 0, 0
+}
+
 func getWindowsFreeSpace(path string, reserve int64) int64 {
+	free, _ := getWindowsDiskSpace(path)
+	free -= reserve
+	if free < 0 {
+		free = 0
+	}
+	return free
+}
+
+// getWindowsDiskSpace returns the bytes available to the calling user (which
+// honours per-user quotas) and the raw free bytes on the volume.
+func getWindowsDiskSpace(path string) (int64, int64) {
 	// Get the root path of the drive
 	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return 0
+		return 0, 0
 	}
 
 	// Get volume name (like "C:")
 	volume := filepath.VolumeName(absPath)
 	if volume == "" {
-		return 0
+		return 0, 0
 	}
 
 	// Ensure we have the root path format (e.g., "C:\\")
 	root := volume + string(os.PathSeparator)
+	if strings.HasPrefix(volume, `\\`) {
+		// A UNC share answers for the folder asked about, which takes
+		// folder quotas on the server into account.
+		root = existingDir(absPath) + string(os.PathSeparator)
+	}
 
 	// Use Windows GetDiskFreeSpaceEx API
-	free, err := getDiskFreeSpaceEx(root)
+	free, raw, err := getDiskFreeSpaceEx(root)
 	if err != nil {
 		// Fallback: try to get space info using alternative method
 		if fallbackFree := getFallbackDiskSpace(root); fallbackFree > 0 {
-			free = fallbackFree
-		} else {
-			// Last resort: return a conservative estimate
-			return 1024 * 1024 * 1024 // 1GB
+			return fallbackFree, fallbackFree
 		}
+		// Last resort: return a conservative estimate
+		return 1024 * 1024 * 1024, 1024 * 1024 * 1024 // 1GB
 	}
+	return free, raw
+}
 
-	free -= reserve
-	if free < 0 {
-		free = 0
+// existingDir returns path or its nearest existing parent directory.
+func existingDir(path string) string {
+	for {
+		if st, err := os.Stat(path); err == nil && st.IsDir() {
+			return strings.TrimRight(path, `\`)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
 	}
-	return free
 }
 
-func getDiskFreeSpaceEx(rootPath string) (int64, error) {
+func getDiskFreeSpaceEx(rootPath string) (int64, int64, error) {
 	kernel32 := syscall.NewLazyDLL("kernel32.dll")
 	getDiskFreeSpaceEx := kernel32.NewProc("GetDiskFreeSpaceExW")
 
 	// Convert path to UTF-16
 	pathPtr, err := syscall.UTF16PtrFromString(rootPath)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
 	var freeBytesAvailable, totalNumberOfBytes, totalNumberOfFreeBytes uint64
@@ -76,11 +104,11 @@ func getDiskFreeSpaceEx(rootPath string) (int64, error) {
 	)
 
 	if r1 == 0 {
-		return 0, fmt.Errorf("GetDiskFreeSpaceEx failed: %w", err)
+		return 0, 0, fmt.Errorf("GetDiskFreeSpaceEx failed: %w", err)
 	}
 
-	// Return free bytes available to the user (considers quotas)
-	return int64(freeBytesAvailable), nil
+	// Free bytes available to the user (considers quotas) and raw free bytes
+	return int64(freeBytesAvailable), int64(totalNumberOfFreeBytes), nil
 }
 
 func getFallbackDiskSpace(rootPath string) int64 {
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// driveInfo is a mounted removable or external volume that can hold backups.
+type driveInfo struct {
+	Path  string
+	Label string
+	Free  int64
+}
+
+// isSystemVolume reports whether path is on the drive holding the operating
+// system or the user's home, which are never sensible backup targets.
+func isSystemVolume(path string) bool {
+	for _, sp := range systemPaths() {
+		if sameFilesystem(path, sp) {
+			return true
+		}
+	}
+	return false
+}
+
+// chooseDestination settles the USB root before a backup. --dest names it
+// directly and must not be the system drive (unless allowFixed). Otherwise,
+// when the executable is not running from a separate drive, the removable
+// drives found are offered in a picker; without a terminal the executable's
+// folder is kept as before, with a warning.
+func chooseDestination(dest string, explicit, allowFixed bool) {
+	if dest != "" {
+		abs, err := filepath.Abs(expandPath(dest))
+		mustNoErr(err)
+		if st, err := os.Stat(abs); err != nil || !st.IsDir() {
+			fail(fmt.Errorf("--dest %s is not a mounted directory", abs))
+		}
+		if isSystemVolume(abs) && !allowFixed {
+			fail(fmt.Errorf("--dest %s is on the system drive; refusing (use --allow-fixed to override)", abs))
+		}
+		usbRootOverride = abs
+		return
+	}
+	if explicit {
+		return
+	}
+	root, err := usbRoot()
+	if err != nil || !isSystemVolume(root) {
+		return
+	}
+	drives := listRemovableDrives()
+	if len(drives) == 0 {
+		slog.Warn("destination is on the system drive and no removable drive was found; backing up there", "dest", root)
+		return
+	}
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		slog.Warn("destination is on the system drive; pass --dest to back up to a removable drive", "dest", root)
+		return
+	}
+	if d, ok := pickDrive(drives, root); ok {
+		usbRootOverride = d
+	}
+}
+
+// pickDrive asks which drive to use; 0 keeps fallback.
+func pickDrive(drives []driveInfo, fallback string) (string, bool) {
+	fmt.Println("The executable is on the system drive. Back up to:")
+	for i, d := range drives {
+		fmt.Printf("  %d) %s  %s  (%s free)\n", i+1, d.Path, d.Label, humanSize(d.Free))
+	}
+	fmt.Printf("  0) %s (system drive)\n", fallback)
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("Choice [1]: ")
+		line, err := in.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if err != nil && line == "" {
+			fail(fmt.Errorf("no destination chosen"))
+		}
+		if line == "" {
+			line = "1"
+		}
+		n, err := strconv.Atoi(line)
+		switch {
+		case err != nil || n < 0 || n > len(drives):
+			fmt.Printf("enter a number from 0 to %d\n", len(drives))
+		case n == 0:
+			return "", false
+		default:
+			return drives[n-1].Path, true
+		}
+	}
+}
@@ -0,0 +1,67 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func systemPaths() []string {
+	return []string{"/", defaultHome()}
+}
+
+// listRemovableDrives returns mounted block devices that sysfs reports as
+// removable or USB-attached, from /proc/self/mountinfo.
+func listRemovableDrives() []driveInfo {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var out []driveInfo
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// id parent major:minor root mountpoint options ... - fstype source super
+		fields := strings.Fields(sc.Text())
+		sep := -1
+		for i, s := range fields {
+			if s == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+		mp, source := unescapeMount(fields[4]), fields[sep+2]
+		if !strings.HasPrefix(source, "/dev/") || seen[source] {
+			continue
+		}
+		if detectMedia(mp) != mediaRemovable || isSystemVolume(mp) {
+			continue
+		}
+		seen[source] = true
+		free, _ := diskSpace(mp)
+		out = append(out, driveInfo{Path: mp, Label: filepath.Base(mp), Free: free})
+	}
+	return out
+}
+
+// unescapeMount decodes the octal escapes (\040 for space) in mountinfo.
+func unescapeMount(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			v := (int(s[i+1]-'0') << 6) | (int(s[i+2]-'0') << 3) | int(s[i+3]-'0')
+			b.WriteByte(byte(v))
+			i += 3
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,54 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func systemPaths() []string {
+	sys := os.Getenv("SystemDrive")
+	if sys == "" {
+		sys = "C:"
+	}
+	return []string{sys + `\`, defaultHome()}
+}
+
+// listRemovableDrives returns drive letters that are removable or sit on a
+// USB bus, with their volume labels.
+func listRemovableDrives() []driveInfo {
+	mask, err := windows.GetLogicalDrives()
+	if err != nil {
+		return nil
+	}
+	var out []driveInfo
+	for i := 0; i < 26; i++ {
+		if mask&(1<<uint(i)) == 0 {
+			continue
+		}
+		root := string(rune('A'+i)) + `:\`
+		if _, err := os.Stat(root); err != nil {
+			continue // e.g. an empty card reader slot
+		}
+		if detectMedia(root) != mediaRemovable || isSystemVolume(root) {
+			continue
+		}
+		free, _ := diskSpace(root)
+		out = append(out, driveInfo{Path: root, Label: volumeLabel(root), Free: free})
+	}
+	return out
+}
+
+func volumeLabel(root string) string {
+	p, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return ""
+	}
+	name := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumeInformation(p, &name[0], uint32(len(name)), nil, nil, nil, nil, 0); err != nil {
+		return ""
+	}
+	return windows.UTF16ToString(name)
+}
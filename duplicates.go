@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// With --skip-duplicates, files with byte-identical content found in several
+// places (the same download in Desktop, Downloads and Documents) are copied
+// once. Candidates are files of equal size, confirmed by SHA-256 from the
+// checksum cache, so only sizes that repeat are ever hashed. The copy that is
+// kept is the highest-priority one (the first scanned on a tie); the others
+// are collapsed out of the scan so they cost no space in the selection, and
+// after the copy they are recorded in the manifest with status "alias" and
+// the kept file's destination in Message. Restore copies that file to each
+// alias path.
+//
+// With --link-duplicates each alias is also created on the destination as a
+// hard link to the kept copy (its record then has Dedup "link"), so the
+// backup folder looks complete while the content is stored once. Where the
+// destination cannot hold hard links (FAT) the aliases are only recorded.
+
+// collapseDuplicates keeps one file of every group with identical content
+// and returns the others, keyed by the kept file's path, with the bytes they
+// no longer take. Extra hard-linked names (groups from collapseHardlinks) of
+// a file that becomes an alias are made aliases too.
+func collapseDuplicates(ctx context.Context, files []FileInfoRec, sums *checksumCache, linkGroups map[string][]string) ([]FileInfoRec, map[string][]string, int64) {
+	bySize := map[int64][]int{}
+	for i, f := range files {
+		if f.Size > 0 {
+			bySize[f.Size] = append(bySize[f.Size], i)
+		}
+	}
+	alias := make([]bool, len(files))
+	groups := map[string][]string{}
+	var saved int64
+	for size, idx := range bySize {
+		if len(idx) < 2 || ctx.Err() != nil {
+			continue
+		}
+		byHash := map[string][]int{}
+		for _, i := range idx {
+			sum, err := sums.Sum(files[i].Path, size, files[i].MTime)
+			if err != nil {
+				continue
+			}
+			byHash[sum] = append(byHash[sum], i)
+		}
+		for _, same := range byHash {
+			if len(same) < 2 {
+				continue
+			}
+			sort.SliceStable(same, func(a, b int) bool { return files[same[a]].Priority > files[same[b]].Priority })
+			keep := files[same[0]].Path
+			for _, i := range same[1:] {
+				p := files[i].Path
+				alias[i] = true
+				groups[keep] = append(groups[keep], p)
+				saved += size
+				if names, ok := linkGroups[p]; ok {
+					groups[keep] = append(groups[keep], names...)
+					delete(linkGroups, p)
+				}
+			}
+		}
+	}
+	out := files[:0]
+	for i, f := range files {
+		if !alias[i] {
+			out = append(out, f)
+		}
+	}
+	for _, names := range groups {
+		sort.Strings(names)
+	}
+	return out, groups, saved
+}
+
+// recordAliases returns the manifest records of the duplicates of every
+// selected file, pointing each at the selected file's destination, and with
+// link set first links them to its copy.
+func recordAliases(selected []FileInfoRec, groups map[string][]string, sources []string, destDir string, link bool) []ManifestRec {
+	var recs []ManifestRec
+	for _, f := range selected {
+		names := groups[f.Path]
+		if len(names) == 0 {
+			continue
+		}
+		primaryPlain := filepath.Join(destDir, relativeDestPath(f.Path, sources))
+		primaryStored := storedPath(f.Path, primaryPlain)
+		parts := storedParts(primaryStored)
+		_, missing := statDest(primaryStored)
+		for _, src := range names {
+			plain, stored := linkedDst(src, sources, destDir, primaryPlain, primaryStored)
+			st, _ := os.Stat(src)
+			rec := ManifestRec{Src: src, Dst: plain, Size: safeSize(st), MTime: safeMTime(st),
+				Status: "alias", Message: primaryPlain, Ts: float64(clk.Now().UnixNano()) / 1e9}
+			switch {
+			case missing != nil:
+				rec.Status, rec.Message = "error", "file with the same content was not copied: "+primaryPlain
+			case link:
+				if err := linkStored(primaryStored, parts, stored); err == nil {
+					rec.Dedup = "link"
+				} else if !cannotLink(err) {
+					rec.Status, rec.Message = "error", err.Error()
+				}
+			}
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
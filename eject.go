@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// ejectDestination implements --eject: flush everything written to the
+// drive holding root, then unmount and eject it. A drive the executable runs
+// from stays busy until this process exits, so the eject is then handed to a
+// detached helper that waits for the exit.
+func ejectDestination(root string) {
+	if detectMedia(root) == mediaNetwork {
+		slog.Info("Destination is a network share; nothing to eject", "dest", root)
+		return
+	}
+	if err := flushVolume(root); err != nil {
+		slog.Warn("flushing failed", "dest", root, "error", err)
+	}
+	exe, _ := os.Executable()
+	onDrive := exe != "" && sameFilesystem(exe, root)
+	cmd, err := ejectCommand(root, onDrive)
+	if err != nil {
+		slog.Warn("cannot eject; data is flushed, remove it safely by hand", "dest", root, "error", err)
+		return
+	}
+	if onDrive {
+		detachCmd(cmd)
+		if err := cmd.Start(); err != nil {
+			slog.Warn("cannot eject", "dest", root, "error", err)
+			return
+		}
+		fmt.Printf("Data flushed; %s will be ejected once backuper exits\n", root)
+		return
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		slog.Warn("eject failed", "error", err, "output", strings.TrimSpace(string(out)))
+		return
+	}
+	fmt.Printf("Ejected %s; it is safe to remove\n", root)
+}
@@ -0,0 +1,100 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// flushVolume writes back dirty pages of the filesystem holding path.
+func flushVolume(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return unix.Syncfs(int(f.Fd()))
+}
+
+// ejectCommand unmounts and powers off the device holding path with
+// udisksctl, which works without root for desktop-mounted drives, falling
+// back to umount. With wait the command first sleeps so this process can
+// exit and release the drive.
+func ejectCommand(path string, wait bool) (*exec.Cmd, error) {
+	mp, dev := mountOf(path)
+	if dev == "" {
+		return nil, fmt.Errorf("no mounted device found")
+	}
+	var script string
+	if _, err := exec.LookPath("udisksctl"); err == nil {
+		script = fmt.Sprintf("udisksctl unmount -b '%s' && udisksctl power-off -b '%s'", dev, dev)
+	} else if _, err := exec.LookPath("umount"); err == nil {
+		script = fmt.Sprintf("umount '%s'", mp)
+	} else {
+		return nil, fmt.Errorf("neither udisksctl nor umount is available")
+	}
+	if wait {
+		script = "sleep 2; " + script
+	}
+	return exec.Command("sh", "-c", script), nil
+}
+
+// detachCmd lets cmd outlive this process.
+func detachCmd(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// mountOf returns the mount point and source device of the innermost
+// mount containing path.
+func mountOf(path string) (string, string) {
+	m := findMount(path)
+	if !strings.HasPrefix(m.source, "/dev/") {
+		return m.point, ""
+	}
+	return m.point, m.source
+}
+
+type mountEntry struct {
+	point  string
+	fstype string
+	source string
+}
+
+// findMount returns the innermost mount containing path, from
+// /proc/self/mountinfo.
+func findMount(path string) mountEntry {
+	var out mountEntry
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return out
+	}
+	defer f.Close()
+	path = canonicalPath(path)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// id parent major:minor root mountpoint options ... - fstype source super
+		fields := strings.Fields(sc.Text())
+		sep := -1
+		for i, s := range fields {
+			if s == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+		m := unescapeMount(fields[4])
+		if (m == "/" || prefixOf(path, m)) && len(m) >= len(out.point) {
+			out = mountEntry{point: m, fstype: fields[sep+1], source: fields[sep+2]}
+		}
+	}
+	return out
+}
@@ -0,0 +1,51 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// flushVolume flushes the file system buffers of the volume holding path.
+// Opening the volume needs administrator rights; without them this is a
+// no-op and the eject, which flushes as well, still applies.
+func flushVolume(path string) error {
+	vol := filepath.VolumeName(path)
+	if vol == "" {
+		return fmt.Errorf("no volume for %s", path)
+	}
+	dev, err := windows.UTF16PtrFromString(`\\.\` + vol)
+	if err != nil {
+		return err
+	}
+	h, err := windows.CreateFile(dev, windows.GENERIC_READ|windows.GENERIC_WRITE, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return nil
+	}
+	defer windows.CloseHandle(h)
+	return windows.FlushFileBuffers(h)
+}
+
+// ejectCommand ejects the drive through the shell's "Eject" verb, the same
+// path as "Safely Remove" in Explorer.
+func ejectCommand(path string, wait bool) (*exec.Cmd, error) {
+	vol := filepath.VolumeName(path)
+	if vol == "" {
+		return nil, fmt.Errorf("no drive letter for %s", path)
+	}
+	script := fmt.Sprintf("(New-Object -ComObject Shell.Application).Namespace(17).ParseName('%s').InvokeVerb('Eject')", vol)
+	if wait {
+		script = "Start-Sleep -Seconds 2; " + script
+	}
+	return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script), nil
+}
+
+// detachCmd lets cmd outlive this process.
+func detachCmd(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: windows.DETACHED_PROCESS | windows.CREATE_NEW_PROCESS_GROUP}
+}
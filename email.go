@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The job file can carry SMTP settings so unattended runs report how they
+// went:
+//
+//	[email]
+//	host = "smtp.example.com"
+//	port = 587
+//	username = "backups@example.com"
+//	password_env = "BACKUP_SMTP_PASSWORD"
+//	from = "backups@example.com"
+//	to = ["me@example.com"]
+//	on = "always"   # or "failure"
+//
+// Port 465 uses implicit TLS; other ports upgrade with STARTTLS when the
+// server offers it. The body is the Markdown run report.
+
+type emailConfig struct {
+	Host     string `toml:"host" yaml:"host"`
+	Port     int    `toml:"port" yaml:"port"`
+	Username string `toml:"username" yaml:"username"`
+	Password string `toml:"password" yaml:"password"`
+	// PasswordEnv names an environment variable holding the password, so
+	// it need not be stored on the USB.
+	PasswordEnv string   `toml:"password_env" yaml:"password_env"`
+	From        string   `toml:"from" yaml:"from"`
+	To          []string `toml:"to" yaml:"to"`
+	// On is "always" (default) or "failure".
+	On string `toml:"on" yaml:"on"`
+}
+
+// emailTimeout bounds each SMTP exchange so a dead server cannot hold up
+// the end of a run.
+const emailTimeout = 30 * time.Second
+
+// onFatal, when set, is called by fail before the process exits.
+var onFatal func(error)
+
+func (c *emailConfig) validate() error {
+	if c.Host == "" || c.From == "" || len(c.To) == 0 {
+		return fmt.Errorf("email: host, from and to are required")
+	}
+	switch c.On {
+	case "", "always", "failure":
+	default:
+		return fmt.Errorf("email: invalid on %q (want always|failure)", c.On)
+	}
+	return nil
+}
+
+// wants reports whether a run ending as ok should be mailed.
+func (c *emailConfig) wants(ok bool) bool {
+	return c != nil && (!ok || c.On != "failure")
+}
+
+// loadEmailConfig reads the [email] section of the job file, if there is
+// one. A missing job file is not an error.
+func loadEmailConfig(dir, path string) (*emailConfig, error) {
+	p, err := findJobFile(dir, path)
+	if err != nil {
+		if path != "" {
+			return nil, err
+		}
+		return nil, nil
+	}
+	jf, err := loadJobFile(p)
+	if err != nil || jf.Email == nil {
+		return nil, err
+	}
+	return jf.Email, jf.Email.validate()
+}
+
+// sendRunEmail mails the run report.
+func sendRunEmail(c *emailConfig, r runReport) error {
+	status := "OK"
+	if !r.OK() {
+		status = "FAILED"
+	}
+	subject := fmt.Sprintf("[backup %s] %s: %s copied, %d error(s)", status, r.Host, humanSize(r.Summary.CopiedBytes), r.Summary.Errors)
+	return sendEmail(c, subject, markdownReport(r))
+}
+
+// sendFailureEmail reports a run that stopped on a fatal error.
+func sendFailureEmail(c *emailConfig, host string, err error) error {
+	subject := fmt.Sprintf("[backup FAILED] %s: %v", host, err)
+	body := fmt.Sprintf("The backup on %s stopped at %s with an error:\n\n    %v\n", host, clk.Now().Format("2006-01-02 15:04:05"), err)
+	return sendEmail(c, subject, body)
+}
+
+func sendEmail(c *emailConfig, subject, body string) error {
+	port := c.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(port))
+	tlsConf := &tls.Config{ServerName: c.Host}
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	if port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConf)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(emailTimeout))
+	cl, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer cl.Close()
+	if port != 465 {
+		if ok, _ := cl.Extension("STARTTLS"); ok {
+			if err := cl.StartTLS(tlsConf); err != nil {
+				return err
+			}
+		}
+	}
+	if c.Username != "" {
+		pass := c.Password
+		if c.PasswordEnv != "" {
+			pass = os.Getenv(c.PasswordEnv)
+		}
+		if err := cl.Auth(smtp.PlainAuth("", c.Username, pass, c.Host)); err != nil {
+			return err
+		}
+	}
+	if err := cl.Mail(c.From); err != nil {
+		return err
+	}
+	for _, to := range c.To {
+		if err := cl.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := cl.Data()
+	if err != nil {
+		return err
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", c.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(c.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", clk.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	if _, err := w.Write([]byte(msg.String())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return cl.Quit()
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// With --encrypt file contents are sealed with AES-256-GCM before they reach
+// the destination and stored as <name>.enc. File names and the manifest stay
+// readable so a backup can be browsed and verified without the passphrase.
+//
+// Keys come from a passphrase through scrypt. Every key has a random ID, and
+// the backup folder keeps a keyring (encryption-keys.json) of the salts and
+// KDF parameters for each ID, never the keys themselves. Each file header
+// names the key it was sealed with, so running with a new passphrase simply
+// adds a key; files sealed under the old one still restore with the old
+// passphrase.
+//
+// With --keyring the keys are instead random and kept as files in a
+// directory off the drive (see keyring.go), and `backuper rekey` rotates
+// them.
+//
+// File layout: "BACKUPE1" | key ID (8 bytes) | nonce prefix (7 bytes),
+// followed by 64 KiB plaintext chunks, each sealed separately. A chunk's
+// nonce is the prefix, a 32-bit counter and a last-chunk flag, so
+// reordered, dropped or truncated chunks fail to open.
+
+const (
+	encExt         = ".enc"
+	encMagic       = "BACKUPE1"
+	encChunkSize   = 64 << 10
+	encKeyringName = "encryption-keys.json"
+	encCheckText   = "backup-key-check"
+)
+
+// encryptKey is the key new files are sealed with; nil when --encrypt is off.
+var encryptKey *fileKey
+
+type fileKey struct {
+	id   [8]byte
+	aead cipher.AEAD
+}
+
+func (k *fileKey) ID() string { return hex.EncodeToString(k.id[:]) }
+
+// keyEntry is one keyring record: enough to re-derive and check a key from
+// its passphrase.
+type keyEntry struct {
+	ID    string `json:"id"`
+	KDF   string `json:"kdf"`
+	Salt  []byte `json:"salt"`
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	Check []byte `json:"check"`
+}
+
+func (e keyEntry) derive(pass []byte) (*fileKey, error) {
+	if e.KDF != "scrypt" {
+		return nil, fmt.Errorf("key %s: unsupported kdf %q", e.ID, e.KDF)
+	}
+	raw, err := scrypt.Key(pass, e.Salt, e.N, e.R, e.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	return newFileKey(e.ID, raw)
+}
+
+// newFileKey sets up AES-256-GCM with a raw 32-byte key.
+func newFileKey(id string, raw []byte) (*fileKey, error) {
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	k := &fileKey{aead: aead}
+	b, err := hex.DecodeString(id)
+	if err != nil || len(b) != len(k.id) {
+		return nil, fmt.Errorf("invalid key id %q", id)
+	}
+	copy(k.id[:], b)
+	return k, nil
+}
+
+// unlock derives the key and checks it against the stored check value.
+func (e keyEntry) unlock(pass []byte) (*fileKey, bool) {
+	k, err := e.derive(pass)
+	if err != nil {
+		return nil, false
+	}
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := k.aead.Open(nil, nonce, e.Check, []byte(e.ID)); err != nil {
+		return nil, false
+	}
+	return k, true
+}
+
+func newKeyEntry(pass []byte) (keyEntry, *fileKey, error) {
+	e := keyEntry{KDF: "scrypt", Salt: make([]byte, 16), N: 1 << 15, R: 8, P: 1}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return e, nil, err
+	}
+	if _, err := rand.Read(e.Salt); err != nil {
+		return e, nil, err
+	}
+	e.ID = hex.EncodeToString(id[:])
+	k, err := e.derive(pass)
+	if err != nil {
+		return e, nil, err
+	}
+	e.Check = k.aead.Seal(nil, make([]byte, k.aead.NonceSize()), []byte(encCheckText), []byte(e.ID))
+	return e, k, nil
+}
+
+func loadKeyring(path string) ([]keyEntry, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []keyEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+func saveKeyring(path string, entries []keyEntry) error {
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".part"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// setupEncryption unlocks the keyring entry matching the passphrase, or adds
+// a new key when none matches (first run, or a changed passphrase).
+func setupEncryption(keyring, passFile string) (*fileKey, error) {
+	entries, err := loadKeyring(keyring)
+	if err != nil {
+		return nil, err
+	}
+	pass, err := readPassphrase(passFile, "Encryption passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if k, ok := e.unlock(pass); ok {
+			fmt.Printf("Encryption: using key %s\n", e.ID)
+			return k, nil
+		}
+	}
+	if len(entries) > 0 {
+		slog.Warn("passphrase does not match the existing keys of this backup; a new key will be added", "keys", len(entries))
+	}
+	if passFile == "" && os.Getenv("BACKUP_PASSPHRASE") == "" {
+		again, err := readPassphrase("", "Repeat passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(pass, again) {
+			return nil, fmt.Errorf("passphrases do not match")
+		}
+	}
+	e, k, err := newKeyEntry(pass)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveKeyring(keyring, append(entries, e)); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Encryption: created key %s\n", e.ID)
+	return k, nil
+}
+
+// unlockKeyring derives every key in the keyring the passphrase opens,
+// keyed by ID, for restore.
+func unlockKeyring(keyring, passFile string) (map[string]*fileKey, error) {
+	entries, err := loadKeyring(keyring)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no encryption keyring at %s", keyring)
+	}
+	pass, err := readPassphrase(passFile, "Decryption passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]*fileKey{}
+	for _, e := range entries {
+		if k, ok := e.unlock(pass); ok {
+			keys[e.ID] = k
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("passphrase does not unlock any key in %s", keyring)
+	}
+	return keys, nil
+}
+
+// readPassphrase takes the passphrase from a file, then $BACKUP_PASSPHRASE,
+// then an echo-free terminal prompt.
+func readPassphrase(file, prompt string) ([]byte, error) {
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.TrimRight(string(b), "\r\n")), nil
+	}
+	if p := os.Getenv("BACKUP_PASSPHRASE"); p != "" {
+		return []byte(p), nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("no passphrase: set BACKUP_PASSPHRASE or use --passphrase-file")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if len(pass) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+	return pass, nil
+}
+
+// encryptWriter seals everything written to it in chunks. Close must be
+// called to seal the final chunk.
+type encryptWriter struct {
+	w       io.Writer
+	k       *fileKey
+	prefix  [7]byte
+	counter uint32
+	buf     []byte
+}
+
+func newEncryptWriter(w io.Writer, k *fileKey) (*encryptWriter, error) {
+	e := &encryptWriter{w: w, k: k, buf: make([]byte, 0, encChunkSize)}
+	if _, err := rand.Read(e.prefix[:]); err != nil {
+		return nil, err
+	}
+	hdr := append([]byte(encMagic), k.id[:]...)
+	hdr = append(hdr, e.prefix[:]...)
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func chunkNonce(prefix [7]byte, counter uint32, last bool) []byte {
+	n := make([]byte, 12)
+	copy(n, prefix[:])
+	binary.BigEndian.PutUint32(n[7:], counter)
+	if last {
+		n[11] = 1
+	}
+	return n
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	if e.counter == ^uint32(0) {
+		return fmt.Errorf("file too large to encrypt")
+	}
+	ct := e.k.aead.Seal(nil, chunkNonce(e.prefix, e.counter, last), e.buf, nil)
+	e.counter++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(ct)
+	return err
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, so the chunk
+		// Close seals is always the one flagged last.
+		if len(e.buf) == encChunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):encChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) Close() error { return e.seal(true) }
+
+// decryptReader opens an encrypted stream chunk by chunk.
+type decryptReader struct {
+	r       *bufio.Reader
+	k       *fileKey
+	prefix  [7]byte
+	counter uint32
+	chunk   []byte
+	plain   []byte
+	done    bool
+}
+
+// readEncHeader parses an encrypted file header: key ID and nonce prefix.
+func readEncHeader(r io.Reader) (id string, prefix [7]byte, err error) {
+	hdr := make([]byte, len(encMagic)+8+7)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return "", prefix, fmt.Errorf("not an encrypted backup file: %w", err)
+	}
+	if string(hdr[:len(encMagic)]) != encMagic {
+		return "", prefix, fmt.Errorf("not an encrypted backup file")
+	}
+	copy(prefix[:], hdr[len(encMagic)+8:])
+	return hex.EncodeToString(hdr[len(encMagic) : len(encMagic)+8]), prefix, nil
+}
+
+func newDecryptReader(r io.Reader, keys map[string]*fileKey) (io.Reader, error) {
+	id, prefix, err := readEncHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	k, ok := keys[id]
+	if !ok {
+		return nil, fmt.Errorf("sealed with key %s, which is not unlocked (wrong passphrase, or missing from the keyring)", id)
+	}
+	return &decryptReader{r: bufio.NewReaderSize(r, encChunkSize+64), k: k, prefix: prefix, chunk: make([]byte, encChunkSize+k.aead.Overhead())}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(d.r, d.chunk)
+		last := false
+		switch {
+		case err == io.ErrUnexpectedEOF || err == io.EOF:
+			last = true
+		case err != nil:
+			return 0, err
+		default:
+			if _, perr := d.r.Peek(1); perr == io.EOF {
+				last = true
+			}
+		}
+		pt, oerr := d.k.aead.Open(d.chunk[:0:0], chunkNonce(d.prefix, d.counter, last), d.chunk[:n], nil)
+		if oerr != nil {
+			return 0, fmt.Errorf("decryption failed (wrong key, corrupted or truncated file)")
+		}
+		d.counter++
+		d.plain, d.done = pt, last
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	entry, key, err := newKeyEntry([]byte("correct horse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, ok := entry.unlock([]byte("correct horse"))
+	if !ok {
+		t.Fatal("passphrase does not unlock its own key")
+	}
+	// Several chunks, the last one partial, plus the edge cases.
+	for _, size := range []int{0, 1, encChunkSize, 2*encChunkSize + 123} {
+		plain := bytes.Repeat([]byte{'x'}, size)
+		sealed := sealForTest(t, key, string(plain))
+		got, err := openForTest(sealed, map[string]*fileKey{entry.ID: k})
+		if err != nil || got != string(plain) {
+			t.Errorf("size %d: round trip = %d bytes, %v", size, len(got), err)
+		}
+	}
+	if _, ok := entry.unlock([]byte("wrong horse")); ok {
+		t.Error("wrong passphrase unlocked the key")
+	}
+}
+
+func TestEncryptDetectsDamage(t *testing.T) {
+	_, key, err := newKeyEntry([]byte("pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]*fileKey{key.ID(): key}
+	sealed := sealForTest(t, key, string(bytes.Repeat([]byte("abcd"), encChunkSize/2)))
+	hdr := len(encMagic) + 8 + 7
+	chunk := encChunkSize + key.aead.Overhead()
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[hdr+chunk+10] ^= 1
+	cases := map[string][]byte{
+		"tampered chunk":  tampered,
+		"dropped chunk":   sealed[:hdr+chunk],
+		"truncated chunk": sealed[:len(sealed)-5],
+		"header only":     sealed[:hdr],
+	}
+	for name, data := range cases {
+		if _, err := openForTest(data, keys); err == nil {
+			t.Errorf("%s: decrypted without error", name)
+		}
+	}
+}
+
+func TestPassphraseKeyring(t *testing.T) {
+	dir := t.TempDir()
+	keyring := filepath.Join(dir, encKeyringName)
+	passFile := func(pass string) string {
+		p := filepath.Join(dir, "pass-"+pass)
+		if err := os.WriteFile(p, []byte(pass+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	first, err := setupEncryption(keyring, passFile("one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := setupEncryption(keyring, passFile("one"))
+	if err != nil || again.ID() != first.ID() {
+		t.Fatalf("same passphrase: key %v, %v; want %s again", again, err, first.ID())
+	}
+	second, err := setupEncryption(keyring, passFile("two"))
+	if err != nil || second.ID() == first.ID() {
+		t.Fatalf("new passphrase: key %v, %v; want a new key", second, err)
+	}
+	if entries, _ := loadKeyring(keyring); len(entries) != 2 {
+		t.Fatalf("keyring holds %d keys, want 2", len(entries))
+	}
+
+	old := sealForTest(t, first, "sealed with one")
+	keys, err := unlockKeyring(keyring, passFile("one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := openForTest(old, keys); err != nil || got != "sealed with one" {
+		t.Errorf("unlock with one: %q, %v", got, err)
+	}
+	keys, err = unlockKeyring(keyring, passFile("two"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openForTest(old, keys); err == nil {
+		t.Error("passphrase two opened a file sealed under one")
+	}
+	if _, err := unlockKeyring(keyring, passFile("three")); err == nil {
+		t.Error("unknown passphrase unlocked the keyring")
+	}
+}
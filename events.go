@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// With --progress=json, progress is reported as newline-delimited JSON
+// events for programs wrapping the backup: scan_progress, copy_start,
+// file_start, file_progress, file_done, copy_done and run_summary. Events go to stdout, or to the
+// file descriptor given by --progress-fd; when they use stdout, the human
+// log moves to stderr so the stream stays parseable.
+
+// progressEvents is nil unless --progress=json is set.
+var progressEvents *eventStream
+
+type eventStream struct {
+	mu  sync.Mutex
+	enc *json.Encoder // nil when only observed (see addEventObserver)
+	// observers also receive every event.
+	observers []func(progressEvent)
+}
+
+// progressEvent is one line of the stream. Fields not relevant to an event
+// are omitted.
+type progressEvent struct {
+	Event   string      `json:"event"`
+	Ts      float64     `json:"ts"`
+	Path    string      `json:"path,omitempty"`
+	Dst     string      `json:"dst,omitempty"`
+	Size    int64       `json:"size,omitempty"`
+	Bytes   int64       `json:"bytes,omitempty"`
+	Files   int64       `json:"files,omitempty"`
+	Errors  int         `json:"errors,omitempty"`
+	Status  string      `json:"status,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Summary *runSummary `json:"summary,omitempty"`
+}
+
+// openEventStream starts the stream on fd. For fd 1 the process's human
+// output is redirected to stderr.
+func openEventStream(fd int) (*eventStream, error) {
+	var out *os.File
+	switch fd {
+	case 1:
+		out = os.Stdout
+		os.Stdout = os.Stderr
+	case 2:
+		out = os.Stderr
+	default:
+		out = os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+		if out == nil {
+			return nil, fmt.Errorf("invalid file descriptor %d", fd)
+		}
+		if _, err := out.Stat(); err != nil {
+			return nil, fmt.Errorf("file descriptor %d: %w", fd, err)
+		}
+	}
+	return &eventStream{enc: json.NewEncoder(out)}, nil
+}
+
+// Emit writes ev with the current time; it is a no-op on a nil stream.
+func (s *eventStream) Emit(ev progressEvent) {
+	if s == nil {
+		return
+	}
+	ev.Ts = float64(clk.Now().UnixNano()) / 1e9
+	ev.Path = livePath(ev.Path)
+	s.mu.Lock()
+	if s.enc != nil {
+		_ = s.enc.Encode(ev)
+	}
+	s.mu.Unlock()
+	for _, fn := range s.observers {
+		fn(ev)
+	}
+}
+
+// addEventObserver has fn called with every event, starting a stream that
+// writes nowhere if --progress=json is not set. Observers must be added
+// before the run starts.
+func addEventObserver(fn func(progressEvent)) {
+	if progressEvents == nil {
+		progressEvents = &eventStream{}
+	}
+	progressEvents.observers = append(progressEvents.observers, fn)
+}
+
+// Streaming reports whether events are written out for another program,
+// which needs byte-level file_progress events.
+func (s *eventStream) Streaming() bool { return s != nil && s.enc != nil }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// With --exif, images get their capture date from EXIF (JPEG and TIFF-based
+// raw formats). Within a priority level photos are then selected newest
+// first, and --photo-layout stores them as Photos/<year>/<month>/<name>
+// instead of mirroring the source folders. Images without a readable date
+// fall back to their modification time for the layout.
+
+// recentPhotosFirst orders photos by capture date within a priority level.
+var recentPhotosFirst bool
+
+// photoDests maps absolute source paths to their --photo-layout
+// destination, relative to the backup folder.
+var photoDests map[string]string
+
+const photoRoot = "Photos"
+
+// exifCache remembers capture dates keyed by path, valid while size and
+// mtime are unchanged, so photos are parsed once rather than every run.
+type exifCache struct {
+	path    string
+	entries map[string]exifEntry
+	dirty   bool
+}
+
+type exifEntry struct {
+	Size  int64 `json:"size"`
+	MTime int64 `json:"mtime"`
+	Taken int64 `json:"taken,omitempty"` // unix seconds; 0 = no EXIF date
+}
+
+func loadExifCache(path string) *exifCache {
+	c := &exifCache{path: path, entries: map[string]exifEntry{}}
+	if b, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(b, &c.entries)
+	}
+	return c
+}
+
+// Taken returns the capture date of f, or the zero time.
+func (c *exifCache) Taken(f FileInfoRec) time.Time {
+	if e, ok := c.entries[f.Path]; ok && e.Size == f.Size && e.MTime == f.MTime.UnixNano() {
+		if e.Taken == 0 {
+			return time.Time{}
+		}
+		return time.Unix(e.Taken, 0)
+	}
+	t := readCaptureTime(f.Path)
+	e := exifEntry{Size: f.Size, MTime: f.MTime.UnixNano()}
+	if !t.IsZero() {
+		e.Taken = t.Unix()
+	}
+	c.entries[f.Path] = e
+	c.dirty = true
+	return t
+}
+
+func (c *exifCache) Save() error {
+	if !c.dirty {
+		return nil
+	}
+	b, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".part"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	c.dirty = false
+	return os.Rename(tmp, c.path)
+}
+
+func readCaptureTime(path string) time.Time {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}
+	}
+	defer f.Close()
+	x, err := exif.Decode(f)
+	if err != nil {
+		return time.Time{}
+	}
+	t, err := x.DateTime()
+	if err != nil || t.Year() < 1900 {
+		return time.Time{}
+	}
+	return t
+}
+
+// isPhoto reports whether path is an image by extension (or content, with
+// --sniff).
+func isPhoto(path string) bool {
+	return builtinCategory(contentPath(path)) == "image"
+}
+
+// applyExif fills in capture dates of the scanned images and, with layout,
+// plans their Photos/<year>/<month> destinations. Name clashes within a
+// month get a " (2)", " (3)" ... suffix in path order.
+func applyExif(files []FileInfoRec, cache *exifCache, layout bool) {
+	dated := 0
+	var photos []int
+	for i := range files {
+		if !isPhoto(files[i].Path) {
+			continue
+		}
+		files[i].Taken = cache.Taken(files[i])
+		if !files[i].Taken.IsZero() {
+			dated++
+		}
+		photos = append(photos, i)
+	}
+	if err := cache.Save(); err != nil {
+		slog.Warn("failed to save EXIF cache", "error", err)
+	}
+	fmt.Printf("EXIF: %d of %d images have a capture date\n", dated, len(photos))
+	if !layout {
+		return
+	}
+	sort.Slice(photos, func(i, j int) bool { return files[photos[i]].Path < files[photos[j]].Path })
+	photoDests = map[string]string{}
+	used := map[string]bool{}
+	for _, i := range photos {
+		f := files[i]
+		t := f.Taken
+		if t.IsZero() {
+			t = f.MTime
+		}
+		dir := filepath.Join(photoRoot, t.Format("2006"), t.Format("01"))
+		name := filepath.Base(f.Path)
+		ext := filepath.Ext(name)
+		rel := filepath.Join(dir, name)
+		for n := 2; used[strings.ToLower(rel)]; n++ {
+			rel = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext))
+		}
+		used[strings.ToLower(rel)] = true
+		if abs, err := filepath.Abs(f.Path); err == nil {
+			photoDests[abs] = rel
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sizeAgeFilter limits scanned files by size and modification time (the
+// --min-size, --max-size, --newer-than and --older-than flags). Zero fields
+// are unbounded.
+type sizeAgeFilter struct {
+	minSize, maxSize int64
+	newer, older     time.Time
+}
+
+// scanLimits is applied to every file the scanner and watch mode see.
+var scanLimits sizeAgeFilter
+
+func (f sizeAgeFilter) keep(size int64, mtime time.Time) bool {
+	if size < f.minSize || f.maxSize > 0 && size > f.maxSize {
+		return false
+	}
+	if !f.newer.IsZero() && mtime.Before(f.newer) {
+		return false
+	}
+	return f.older.IsZero() || mtime.Before(f.older)
+}
+
+func (f sizeAgeFilter) String() string {
+	var parts []string
+	if f.minSize > 0 {
+		parts = append(parts, "at least "+humanSize(f.minSize))
+	}
+	if f.maxSize > 0 {
+		parts = append(parts, "at most "+humanSize(f.maxSize))
+	}
+	if !f.newer.IsZero() {
+		parts = append(parts, "modified after "+f.newer.Format("2006-01-02 15:04"))
+	}
+	if !f.older.IsZero() {
+		parts = append(parts, "modified before "+f.older.Format("2006-01-02 15:04"))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseCutoff turns an age (90d, 2w, 1y, 36h) into the time that long
+// before now; a date (2024-01-31) is taken as is, in local time.
+func parseCutoff(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if n := len(s); n > 1 {
+		day := 24 * time.Hour
+		units := map[byte]time.Duration{'d': day, 'w': 7 * day, 'y': 365 * day}
+		if u, ok := units[s[n-1]]; ok {
+			if v, err := strconv.ParseFloat(s[:n-1], 64); err == nil && v >= 0 {
+				return now.Add(-time.Duration(v * float64(u))), nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid age %q (want e.g. 90d, 2w, 1y, 36h or 2024-01-31)", s)
+	}
+	return now.Add(-d), nil
+}
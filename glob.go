@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// globMatch matches path against a tier or exclude pattern. Patterns use
+// doublestar syntax: "*" stays within one path element, "**" spans any
+// number of them, and "{a,b}" alternates. A pattern without a slash matches
+// the file or directory name; a relative pattern with slashes may match at
+// any depth ("Documents/**/*.pdf"), and an absolute one only from the root.
+// Both sides are compared with forward slashes so patterns work on Windows.
+func globMatch(pattern, path string) bool {
+	pattern, path = filepath.ToSlash(pattern), filepath.ToSlash(path)
+	if !strings.Contains(pattern, "/") {
+		ok, _ := doublestar.Match(pattern, filepath.Base(path))
+		return ok
+	}
+	if !isAbsPattern(pattern) && !strings.HasPrefix(pattern, "**/") {
+		pattern = "**/" + pattern
+	}
+	ok, _ := doublestar.Match(pattern, path)
+	return ok
+}
+
+// isAbsPattern reports whether a slash-separated pattern is anchored at a
+// filesystem root ("/home/..." or "C:/...").
+func isAbsPattern(pattern string) bool {
+	return strings.HasPrefix(pattern, "/") || len(pattern) >= 3 && pattern[1] == ':' && pattern[2] == '/'
+}
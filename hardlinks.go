@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// With --hardlinks, files with several names (link count above one) are
+// copied once. The other names are collapsed out of the scan, so they cost
+// no space in the selection, and after the copy they are recreated as hard
+// links to the copied name. Where the destination cannot link (FAT) they are
+// only recorded in the manifest with status "hardlink", and restore links
+// them to the restored first name.
+
+// inodeKey identifies a file independent of its name.
+type inodeKey struct {
+	dev, ino uint64
+}
+
+// collapseHardlinks keeps the first name of every multiply-linked file and
+// returns the other names, keyed by that first name's path.
+func collapseHardlinks(files []FileInfoRec) ([]FileInfoRec, map[string][]string) {
+	first := map[inodeKey]string{}
+	groups := map[string][]string{}
+	out := files[:0]
+	for _, f := range files {
+		key, ok := linkID(f.Path)
+		if !ok {
+			out = append(out, f)
+			continue
+		}
+		if p, seen := first[key]; seen {
+			groups[p] = append(groups[p], f.Path)
+			continue
+		}
+		first[key] = f.Path
+		out = append(out, f)
+	}
+	return out, groups
+}
+
+// linkedDst returns where the extra name src of a file stored at
+// primaryStored goes: its own destination with the same stored suffix
+// (.zst, .enc) as the copied name.
+func linkedDst(src string, sources []string, destDir, primaryPlain, primaryStored string) (string, string) {
+	plain := filepath.Join(destDir, relativeDestPath(src, sources))
+	return plain, plain + strings.TrimPrefix(primaryStored, primaryPlain)
+}
+
+// recreateHardlinks links the extra names of every selected multiply-linked
+// file to its copy and returns their manifest records.
+func recreateHardlinks(selected []FileInfoRec, groups map[string][]string, sources []string, destDir string) []ManifestRec {
+	var recs []ManifestRec
+	for _, f := range selected {
+		names := groups[f.Path]
+		if len(names) == 0 {
+			continue
+		}
+		primaryPlain := filepath.Join(destDir, relativeDestPath(f.Path, sources))
+		primaryStored := storedPath(f.Path, primaryPlain)
+		parts := storedParts(primaryStored)
+		_, missing := statDest(primaryStored)
+		for _, src := range names {
+			plain, stored := linkedDst(src, sources, destDir, primaryPlain, primaryStored)
+			st, _ := os.Stat(src)
+			rec := ManifestRec{Src: src, Dst: plain, Size: safeSize(st), MTime: safeMTime(st), Status: "hardlink", Message: primaryPlain, Ts: float64(clk.Now().UnixNano()) / 1e9}
+			if missing != nil {
+				rec.Status, rec.Message = "error", "linked file was not copied: "+primaryPlain
+				recs = append(recs, rec)
+				continue
+			}
+			if err := linkStored(primaryStored, parts, stored); err != nil {
+				if cannotLink(err) {
+					rec.Recorded = true
+				} else {
+					rec.Status, rec.Message = "error", err.Error()
+				}
+			}
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+// linkStored links stored to the copy at primaryStored, part by part when
+// that copy was split into parts.
+func linkStored(primaryStored string, parts []string, stored string) error {
+	if len(parts) == 0 {
+		return linkOver(primaryStored, stored)
+	}
+	for i, p := range parts {
+		if err := linkOver(p, partName(stored, i+1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cannotLink reports whether err means the destination cannot hold hard
+// links at all, rather than that one link failed.
+func cannotLink(err error) bool {
+	return errors.Is(err, os.ErrPermission) || errors.Is(err, errors.ErrUnsupported)
+}
+
+// linkOver makes dst a hard link to target, replacing whatever dst was
+// unless it already is that link.
+func linkOver(target, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	if st, err := os.Lstat(dst); err == nil {
+		if tst, err := os.Stat(target); err == nil && os.SameFile(st, tst) {
+			return nil
+		}
+		_ = os.Remove(dst)
+	}
+	return os.Link(target, dst)
+}
@@ -0,0 +1,22 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkID returns the identity of the file at path when it has more than
+// one name.
+func linkID(path string) (inodeKey, bool) {
+	st, err := os.Lstat(path)
+	if err != nil {
+		return inodeKey{}, false
+	}
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok || sys.Nlink < 2 {
+		return inodeKey{}, false
+	}
+	return inodeKey{dev: uint64(sys.Dev), ino: sys.Ino}, true
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// linkID returns the identity of the file at path when it has more than
+// one name.
+func linkID(path string) (inodeKey, bool) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return inodeKey{}, false
+	}
+	h, err := windows.CreateFile(p, 0, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return inodeKey{}, false
+	}
+	defer windows.CloseHandle(h)
+	var info windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(h, &info); err != nil || info.NumberOfLinks < 2 {
+		return inodeKey{}, false
+	}
+	return inodeKey{dev: uint64(info.VolumeSerialNumber), ino: uint64(info.FileIndexHigh)<<32 | uint64(info.FileIndexLow)}, true
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// checksumCache remembers SHA-256 sums keyed by path, valid while the file's
+// size and mtime are unchanged, so repeated runs don't rehash stable files.
+type checksumCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]checksumEntry
+	dirty   bool
+}
+
+type checksumEntry struct {
+	Size  int64  `json:"size"`
+	MTime int64  `json:"mtime"`
+	Sum   string `json:"sha256"`
+}
+
+func loadChecksumCache(path string) *checksumCache {
+	c := &checksumCache{path: path, entries: map[string]checksumEntry{}}
+	if b, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(b, &c.entries)
+	}
+	return c
+}
+
+// Sum returns the SHA-256 of path, from the cache when size and mtime match.
+func (c *checksumCache) Sum(path string, size int64, mtime time.Time) (string, error) {
+	c.mu.Lock()
+	e, ok := c.entries[path]
+	c.mu.Unlock()
+	if ok && e.Size == size && e.MTime == mtime.UnixNano() {
+		return e.Sum, nil
+	}
+	sum, err := hashFile(path)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.entries[path] = checksumEntry{Size: size, MTime: mtime.UnixNano(), Sum: sum}
+	c.dirty = true
+	c.mu.Unlock()
+	return sum, nil
+}
+
+// SumStat is Sum for a path that has not been stat'ed yet.
+func (c *checksumCache) SumStat(path string) (string, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return c.Sum(path, st.Size(), st.ModTime())
+}
+
+// Save writes the cache back if anything changed.
+func (c *checksumCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	b, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	// Sync before the rename so a crash never leaves an empty or partial
+	// cache in place of the old one.
+	tmp := c.path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	c.dirty = false
+	return os.Rename(tmp, c.path)
+}
+
+func hashFile(path string) (string, error) {
+	return hashFileAlgo(path, "sha256")
+}
+
+// scanHasher hashes files as the scanner finds them so sums are ready by the
+// time the skip decision needs them. Submissions never block the scan: when
+// the queue is full the file is left to be hashed on demand later.
+type scanHasher struct {
+	ch    chan FileInfoRec
+	wg    sync.WaitGroup
+	cache *checksumCache
+}
+
+func startScanHasher(ctx context.Context, cache *checksumCache, workers int) *scanHasher {
+	h := &scanHasher{ch: make(chan FileInfoRec, 4096), cache: cache}
+	for i := 0; i < workers; i++ {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			for f := range h.ch {
+				if ctx.Err() != nil {
+					continue
+				}
+				_, _ = h.cache.Sum(f.Path, f.Size, f.MTime)
+			}
+		}()
+	}
+	return h
+}
+
+func (h *scanHasher) Submit(f FileInfoRec) {
+	if h == nil {
+		return
+	}
+	select {
+	case h.ch <- f:
+	default:
+	}
+}
+
+// Wait closes the queue and waits for in-flight hashes to finish.
+func (h *scanHasher) Wait() {
+	if h == nil {
+		return
+	}
+	close(h.ch)
+	h.wg.Wait()
+}
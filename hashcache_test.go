@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChecksumCacheInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "a.txt")
+	cachePath := filepath.Join(dir, "sums.json")
+	write := func(content string, mtime time.Time) os.FileInfo {
+		t.Helper()
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		st, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+	sum := func(c *checksumCache, st os.FileInfo) string {
+		t.Helper()
+		s, err := c.Sum(p, st.Size(), st.ModTime())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	hash := func() string {
+		t.Helper()
+		s, err := hashFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := loadChecksumCache(cachePath)
+	first := sum(c, write("one", day))
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cachePath + ".part"); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind: %v", err)
+	}
+
+	// Reloaded, the sum is served from the cache while size and mtime
+	// match: same-size content put back under the old mtime goes unnoticed.
+	c = loadChecksumCache(cachePath)
+	if got := sum(c, write("two", day)); got != first {
+		t.Errorf("unchanged size and mtime: sum %s, want the cached %s", got, first)
+	}
+	// A new mtime or a new size means the file is hashed again.
+	if got := sum(c, write("two", day.Add(time.Second))); got != hash() || got == first {
+		t.Errorf("changed mtime: sum %s, want %s", got, hash())
+	}
+	if got := sum(c, write("three", day.Add(time.Second))); got != hash() {
+		t.Errorf("changed size: sum %s, want %s", got, hash())
+	}
+}
+
+// benchTree writes n files of size bytes spread over 20 directories and
+// returns them as scan records.
+func benchTree(b *testing.B, n, size int) []FileInfoRec {
+	b.Helper()
+	dir := b.TempDir()
+	data := make([]byte, size)
+	files := make([]FileInfoRec, 0, n)
+	for i := 0; i < n; i++ {
+		p := filepath.Join(dir, fmt.Sprintf("d%02d", i%20), fmt.Sprintf("f%05d.bin", i))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			b.Fatal(err)
+		}
+		data[0] = byte(i)
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			b.Fatal(err)
+		}
+		st, err := os.Stat(p)
+		if err != nil {
+			b.Fatal(err)
+		}
+		files = append(files, FileInfoRec{Path: p, Size: st.Size(), MTime: st.ModTime()})
+	}
+	return files
+}
+
+// BenchmarkScanHasher compares hashing after the scan with hashing while the
+// scan runs. The scan is stood in for by a stat of every file.
+func BenchmarkScanHasher(b *testing.B) {
+	files := benchTree(b, 2000, 64<<10)
+	scan := func(submit func(FileInfoRec)) {
+		for _, f := range files {
+			if _, err := os.Stat(f.Path); err == nil {
+				submit(f)
+			}
+		}
+	}
+	b.Run("after-scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			cache := loadChecksumCache(filepath.Join(b.TempDir(), "sums.json"))
+			var found []FileInfoRec
+			scan(func(f FileInfoRec) { found = append(found, f) })
+			for _, f := range found {
+				if _, err := cache.Sum(f.Path, f.Size, f.MTime); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("during-scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			cache := loadChecksumCache(filepath.Join(b.TempDir(), "sums.json"))
+			h := startScanHasher(context.Background(), cache, 4)
+			scan(h.Submit)
+			h.Wait()
+		}
+	})
+}
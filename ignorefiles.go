@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// ignoreFileNames lists the per-directory ignore files the scanner reads, in
+// order of precedence (later files override earlier ones).
+var ignoreFileNames = []string{".backupignore"}
+
+// ignoreRule is one line of an ignore file, in gitignore syntax.
+type ignoreRule struct {
+	pattern string // doublestar pattern relative to the file's directory
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreSet holds the rules of one directory's ignore files, chained to
+// the nearest ancestor that has any.
+type ignoreSet struct {
+	base   string
+	rules  []ignoreRule
+	parent *ignoreSet
+}
+
+// ignorer answers whether a path is excluded by the ignore files of its
+// ancestors, up to the source root. Rules are read once per directory.
+type ignorer struct {
+	names []string
+	roots map[string]bool
+	sets  map[string]*ignoreSet
+}
+
+// newIgnorer returns nil when no ignore files are configured; a nil ignorer
+// ignores nothing.
+func newIgnorer(names []string, roots ...string) *ignorer {
+	if len(names) == 0 {
+		return nil
+	}
+	g := &ignorer{names: names, roots: map[string]bool{}, sets: map[string]*ignoreSet{}}
+	for _, r := range roots {
+		g.AddRoot(r)
+	}
+	return g
+}
+
+// AddRoot stops rule lookup at dir: ignore files above a source don't apply.
+func (g *ignorer) AddRoot(dir string) {
+	if g != nil {
+		g.roots[dir] = true
+	}
+}
+
+// Forget drops every cached rule so edited ignore files are read again.
+func (g *ignorer) Forget() {
+	if g != nil {
+		g.sets = map[string]*ignoreSet{}
+	}
+}
+
+// Names returns the ignore file names read, or none for a nil ignorer.
+func (g *ignorer) Names() []string {
+	if g == nil {
+		return nil
+	}
+	return g.names
+}
+
+// Ignored reports whether path matches the ignore files above it. As in git,
+// the last matching rule wins, and deeper files are consulted after
+// shallower ones.
+func (g *ignorer) Ignored(path string, isDir bool) bool {
+	if g == nil {
+		return false
+	}
+	var chain []*ignoreSet
+	for s := g.set(filepath.Dir(path)); s != nil; s = s.parent {
+		chain = append(chain, s)
+	}
+	ignored := false
+	for i := len(chain) - 1; i >= 0; i-- {
+		s := chain[i]
+		rel, err := filepath.Rel(s.base, path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, r := range s.rules {
+			if r.dirOnly && !isDir {
+				continue
+			}
+			if ok, _ := doublestar.Match(r.pattern, rel); ok {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+func (g *ignorer) set(dir string) *ignoreSet {
+	if s, ok := g.sets[dir]; ok {
+		return s
+	}
+	var parent *ignoreSet
+	if up := filepath.Dir(dir); !g.roots[dir] && up != dir {
+		parent = g.set(up)
+	}
+	var rules []ignoreRule
+	for _, name := range g.names {
+		rules = append(rules, readIgnoreFile(filepath.Join(dir, name))...)
+	}
+	s := parent
+	if len(rules) > 0 {
+		s = &ignoreSet{base: dir, rules: rules, parent: parent}
+	}
+	g.sets[dir] = s
+	return s
+}
+
+// readIgnoreFile parses a gitignore-style file; a missing file has no rules.
+func readIgnoreFile(path string) []ignoreRule {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var rules []ignoreRule
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if r, ok := parseIgnoreLine(sc.Text()); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line, " \t")
+	}
+	if line == "" || line[0] == '#' {
+		return ignoreRule{}, false
+	}
+	var r ignoreRule
+	switch {
+	case line[0] == '!':
+		r.negate, line = true, line[1:]
+	case strings.HasPrefix(line, `\#`), strings.HasPrefix(line, `\!`):
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly, line = true, strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	// A slash anywhere but the end anchors the pattern to the file's
+	// directory; otherwise it matches a name at any depth.
+	if strings.Contains(line, "/") {
+		r.pattern = strings.TrimPrefix(line, "/")
+	} else {
+		r.pattern = "**/" + line
+	}
+	return r, true
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// A job file (backup.toml or backup.yaml on the USB) defines named jobs:
+//
+//	[jobs.documents]
+//	sources = ["~/Documents", "~/Desktop"]
+//	excludes = ["*/node_modules/*"]
+//	objective = "priority"
+//	dest = "{job}_{date}"
+//	[jobs.documents.options]
+//	checksums = "true"
+//
+// --job <name> applies one of them. Each value only fills in a flag that was
+// not given on the command line, so explicit flags always win.
+
+var jobFileNames = []string{"backup.toml", "backup.yaml", "backup.yml"}
+
+type jobFile struct {
+	Jobs map[string]jobSpec `toml:"jobs" yaml:"jobs"`
+	// Email, when set, mails a summary when a run finishes (see email.go).
+	Email *emailConfig `toml:"email" yaml:"email"`
+	// Tuning holds the settings `backuper bench` measured for the drive.
+	Tuning *tuningConfig `toml:"tuning" yaml:"tuning"`
+}
+
+type jobSpec struct {
+	Sources   []string `toml:"sources" yaml:"sources"`
+	Excludes  []string `toml:"excludes" yaml:"excludes"`
+	Profile   string   `toml:"profile" yaml:"profile"`
+	Objective string   `toml:"objective" yaml:"objective"`
+	Workers   int      `toml:"workers" yaml:"workers"`
+	// Dest is a destination folder template; see expandDestTemplate.
+	Dest string `toml:"dest" yaml:"dest"`
+	// Options sets any other flag by name, e.g. {"checksums": "true"}.
+	Options map[string]string `toml:"options" yaml:"options"`
+}
+
+// findJobFile returns the job file to use: path when given, otherwise the
+// first of jobFileNames present in dir.
+func findJobFile(dir, path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	for _, name := range jobFileNames {
+		p := filepath.Join(dir, name)
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no job file (%s) in %s", strings.Join(jobFileNames, ", "), dir)
+}
+
+func loadJobFile(path string) (jobFile, error) {
+	var jf jobFile
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return jf, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		_, err = toml.Decode(string(b), &jf)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &jf)
+	default:
+		err = fmt.Errorf("unknown job file format %q (use .toml or .yaml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return jf, fmt.Errorf("%s: %w", path, err)
+	}
+	return jf, nil
+}
+
+// applyJob sets the flags of fs that were not given explicitly from the
+// named job.
+func applyJob(fs *flag.FlagSet, jf jobFile, name string) error {
+	job, ok := jf.Jobs[name]
+	if !ok {
+		names := make([]string, 0, len(jf.Jobs))
+		for n := range jf.Jobs {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown job %q (have: %s)", name, strings.Join(names, ", "))
+	}
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	values := map[string]string{}
+	for k, v := range job.Options {
+		values[k] = v
+	}
+	if len(job.Sources) > 0 {
+		values["sources"] = strings.Join(job.Sources, ",")
+	}
+	if len(job.Excludes) > 0 {
+		values["exclude"] = strings.Join(job.Excludes, ",")
+	}
+	if job.Profile != "" {
+		values["profile"] = job.Profile
+	}
+	if job.Objective != "" {
+		values["objective"] = job.Objective
+	}
+	if job.Workers != 0 {
+		values["workers"] = strconv.Itoa(job.Workers)
+	}
+	if job.Dest != "" {
+		values["dest-subdir"] = expandDestTemplate(job.Dest, name)
+	}
+	if _, ok := values["label"]; !ok {
+		values["label"] = name
+	}
+	for k, v := range values {
+		if explicit[k] {
+			continue
+		}
+		if fs.Lookup(k) == nil {
+			return fmt.Errorf("job %q: unknown option %q", name, k)
+		}
+		if err := fs.Set(k, v); err != nil {
+			return fmt.Errorf("job %q: %s: %w", name, k, err)
+		}
+	}
+	return nil
+}
+
+// expandDestTemplate fills in {job}, {date} (YYYYMMDD), {time} (HHMMSS)
+// and {host} in a job's destination folder template.
+func expandDestTemplate(tmpl, job string) string {
+	now := clk.Now()
+	host, _ := os.Hostname()
+	return strings.NewReplacer(
+		"{job}", job,
+		"{date}", now.Format("20060102"),
+		"{time}", now.Format("150405"),
+		"{host}", sanitizeLabel(host),
+	).Replace(tmpl)
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// kernelCopy copies size bytes from in to out without passing them
+// through user space. It tries, in order, a reflink (FICLONE), which
+// shares the blocks on CoW filesystems such as btrfs and XFS,
+// copy_file_range, which copies inside the kernel (and within one
+// filesystem may also share blocks or offload the copy to the server),
+// and finally io.Copy. It returns the path that did the copy, and
+// io.ErrUnexpectedEOF when the source ends before size bytes.
+func kernelCopy(ctx context.Context, out, in *os.File, size int64, agg *progressAgg) (copyStrategy, int64, error) {
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err == nil {
+		if st, err := out.Stat(); err == nil && st.Size() < size {
+			return copyReflink, st.Size(), io.ErrUnexpectedEOF
+		}
+		if agg != nil {
+			agg.Add(size)
+		}
+		return copyReflink, size, nil
+	}
+	var done int64
+	for done < size {
+		if ctx.Err() != nil {
+			return copyRange, done, fmt.Errorf("cancelled")
+		}
+		n, err := unix.CopyFileRange(int(in.Fd()), nil, int(out.Fd()), nil, int(min(size-done, copyRangeChunk)), 0)
+		if err != nil {
+			if done == 0 && copyRangeUnsupported(err) {
+				return copyKernel, 0, errNoKernelCopy
+			}
+			return copyRange, done, err
+		}
+		if n == 0 {
+			// The source shrank since it was opened; what is left of the
+			// copy would be padding.
+			return copyRange, done, io.ErrUnexpectedEOF
+		}
+		done += int64(n)
+		if agg != nil {
+			agg.Add(int64(n))
+		}
+	}
+	return copyRange, done, nil
+}
+
+// copyRangeUnsupported reports whether copy_file_range failed because the
+// kernel or the filesystems cannot do it, rather than because of an I/O
+// error.
+func copyRangeUnsupported(err error) bool {
+	return errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EOPNOTSUPP) ||
+		errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EBADF) || errors.Is(err, unix.EPERM)
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"os"
+)
+
+// kernelCopy leaves the copy to io.Copy; Windows has no reflink or
+// copy_file_range equivalent for ordinary NTFS volumes.
+func kernelCopy(ctx context.Context, out, in *os.File, size int64, agg *progressAgg) (copyStrategy, int64, error) {
+	return copyKernel, 0, errNoKernelCopy
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A keyring directory (--keyring) holds one file per encryption key,
+// <id>.key, so keys can be rotated without re-encrypting old backups: new
+// runs seal with the newest key, and restore picks whichever key a file's
+// header names. The directory belongs off the backup drive; anyone holding
+// it can read every backup it encrypted.
+
+const keyFileExt = ".key"
+
+type keyFile struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Key     []byte    `json:"key"`
+}
+
+// loadKeyDir reads every key file in dir, oldest first.
+func loadKeyDir(dir string) ([]keyFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []keyFile
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != keyFileExt {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var k keyFile
+		if err := json.Unmarshal(b, &k); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		if k.ID+keyFileExt != e.Name() || len(k.Key) != 32 {
+			return nil, fmt.Errorf("%s: not a valid key file", e.Name())
+		}
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Created.Before(keys[j].Created) })
+	return keys, nil
+}
+
+// addKeyFile creates a new random key in dir, which becomes its current
+// key.
+func addKeyFile(dir string) (keyFile, error) {
+	k := keyFile{Created: clk.Now().UTC(), Key: make([]byte, 32)}
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return k, err
+	}
+	if _, err := rand.Read(k.Key); err != nil {
+		return k, err
+	}
+	k.ID = hex.EncodeToString(id[:])
+	b, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return k, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return k, err
+	}
+	path := filepath.Join(dir, k.ID+keyFileExt)
+	tmp := path + ".part"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return k, err
+	}
+	return k, os.Rename(tmp, path)
+}
+
+// currentKey returns the newest key in dir, creating the first one if the
+// directory has none.
+func currentKey(dir string) (*fileKey, error) {
+	keys, err := loadKeyDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		k, err := addKeyFile(dir)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Encryption: created key %s in %s\n", k.ID, dir)
+		return newFileKey(k.ID, k.Key)
+	}
+	k := keys[len(keys)-1]
+	fmt.Printf("Encryption: using key %s from %s\n", k.ID, dir)
+	return newFileKey(k.ID, k.Key)
+}
+
+// keyDirKeys loads every key in dir, keyed by ID, for restore.
+func keyDirKeys(dir string) (map[string]*fileKey, error) {
+	files, err := loadKeyDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no keys in keyring %s", dir)
+	}
+	keys := map[string]*fileKey{}
+	for _, f := range files {
+		k, err := newFileKey(f.ID, f.Key)
+		if err != nil {
+			return nil, err
+		}
+		keys[f.ID] = k
+	}
+	return keys, nil
+}
+
+// missingKeys lists the key IDs recs were sealed with that keys lacks.
+func missingKeys(recs []ManifestRec, keys map[string]*fileKey) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, rec := range recs {
+		if rec.Encrypted == "" || keys[rec.Encrypted] != nil || seen[rec.Encrypted] {
+			continue
+		}
+		seen[rec.Encrypted] = true
+		out = append(out, rec.Encrypted)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// runRekey implements `backuper rekey`: add a new current key to a keyring
+// directory. Older keys stay so earlier backups still restore.
+func runRekey(args []string) {
+	fs := flag.NewFlagSet("rekey", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	dir := fs.String("keyring", "", "Keyring directory to add the new key to")
+	_ = fs.Parse(args)
+	g.apply()
+
+	if *dir == "" {
+		fail(fmt.Errorf("rekey needs --keyring"))
+	}
+	keys, err := loadKeyDir(expandPath(*dir))
+	if err != nil && !os.IsNotExist(err) {
+		fail(err)
+	}
+	k, err := addKeyFile(expandPath(*dir))
+	mustNoErr(err)
+	var old []string
+	for _, o := range keys {
+		old = append(old, o.ID)
+	}
+	fmt.Printf("New current key %s; new backups are sealed with it\n", k.ID)
+	if len(old) > 0 {
+		fmt.Printf("Kept %d older key(s) for restoring earlier backups: %s\n", len(old), strings.Join(old, ", "))
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRekeyKeepsOldBackupsReadable(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, err := currentKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldFile := sealForTest(t, oldKey, "sealed before the rekey")
+	oldRing, err := keyDirKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := addKeyFile(dir); err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := currentKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newKey.ID() == oldKey.ID() {
+		t.Fatal("rekey did not change the current key")
+	}
+	newFile := sealForTest(t, newKey, "sealed after the rekey")
+
+	// The rotated keyring opens both.
+	ring, err := keyDirKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for content, sealed := range map[string][]byte{"sealed before the rekey": oldFile, "sealed after the rekey": newFile} {
+		if got, err := openForTest(sealed, ring); err != nil || got != content {
+			t.Errorf("rotated keyring: %q, %v; want %q", got, err, content)
+		}
+	}
+
+	// A copy of the keyring from before the rekey still opens old files but
+	// names the key it lacks for new ones.
+	if got, err := openForTest(oldFile, oldRing); err != nil || got != "sealed before the rekey" {
+		t.Errorf("old keyring on old file: %q, %v", got, err)
+	}
+	if _, err := openForTest(newFile, oldRing); err == nil || !strings.Contains(err.Error(), newKey.ID()) {
+		t.Errorf("old keyring on new file: %v, want an error naming key %s", err, newKey.ID())
+	}
+	recs := []ManifestRec{{Encrypted: oldKey.ID()}, {Encrypted: newKey.ID()}, {}}
+	if missing := missingKeys(recs, oldRing); len(missing) != 1 || missing[0] != newKey.ID() {
+		t.Errorf("missingKeys = %v, want [%s]", missing, newKey.ID())
+	}
+}
+
+func sealForTest(t *testing.T, k *fileKey, content string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := newEncryptWriter(&buf, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func openForTest(sealed []byte, keys map[string]*fileKey) (string, error) {
+	r, err := newDecryptReader(bytes.NewReader(sealed), keys)
+	if err != nil {
+		return "", err
+	}
+	b, err := io.ReadAll(r)
+	return string(b), err
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"sort"
+)
+
+// --objective value treats selection as a 0/1 knapsack: every file is worth
+// its priority, and the chosen set maximizes the total worth that fits in
+// the available space instead of filling tier by tier. Files are ranked by
+// worth per byte; those well inside the greedy boundary are taken, those
+// well outside it are not, and the contested files around it (the "core")
+// are solved exactly by dynamic programming over sizes rounded up to a
+// fraction of the remaining space, so the result always fits. Space the
+// solution leaves over is then filled with whatever else fits, including
+// files of priority zero or below, which add no worth.
+
+const (
+	// knapsackCore is how many files around the greedy boundary are solved
+	// exactly.
+	knapsackCore = 2048
+	// knapsackUnits is the resolution of the space the core is solved over.
+	knapsackUnits = 1 << 15
+)
+
+// knapsackValue is what one file is worth to --objective value.
+func knapsackValue(f FileInfoRec) int64 {
+	if f.Priority < 1 {
+		return 0
+	}
+	return int64(f.Priority)
+}
+
+// selectByValue picks the files of greatest total priority that fit in
+// capacity, then applies the tier caps and fills the space left over.
+func selectByValue(files []FileInfoRec, capacity int64, caps map[string]tierCap, units map[string][]FileInfoRec) ([]FileInfoRec, int64, []string) {
+	var cand []FileInfoRec
+	for _, f := range files {
+		if f.Size > 0 && knapsackValue(f) > 0 {
+			cand = append(cand, f)
+		}
+	}
+	sort.SliceStable(cand, func(i, j int) bool {
+		// v_i/s_i > v_j/s_j without dividing.
+		return float64(knapsackValue(cand[i]))*float64(cand[j].Size) > float64(knapsackValue(cand[j]))*float64(cand[i].Size)
+	})
+	// The greedy boundary: the first file that no longer fits.
+	b, prefix := 0, int64(0)
+	for b < len(cand) && prefix+cand[b].Size <= capacity {
+		prefix += cand[b].Size
+		b++
+	}
+	lo, hi := b-knapsackCore/2, b+knapsackCore/2
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > len(cand) {
+		hi = len(cand)
+	}
+	var fixed int64
+	for _, f := range cand[:lo] {
+		fixed += f.Size
+	}
+	chosen := make([]bool, len(cand))
+	for i := 0; i < lo; i++ {
+		chosen[i] = true
+	}
+	for i, in := range solveKnapsack(cand[lo:hi], capacity-fixed) {
+		chosen[lo+i] = in
+	}
+
+	var selected []FileInfoRec
+	var used int64
+	usage := newTierUsage(caps, units)
+	take := func(f FileInfoRec) bool {
+		if !usage.fits(f) || used+f.Size > capacity {
+			return false
+		}
+		selected = append(selected, f)
+		used += f.Size
+		usage.add(f)
+		return true
+	}
+	taken := map[string]bool{}
+	for i, f := range cand {
+		if chosen[i] && take(f) {
+			taken[f.Path] = true
+		}
+	}
+	// Fill: empty files, files worth nothing, and whatever the rounding or
+	// the caps left room for, most important and then smallest first.
+	rest := make([]FileInfoRec, 0, len(files)-len(taken))
+	for _, f := range files {
+		if f.Size >= 0 && !taken[f.Path] {
+			rest = append(rest, f)
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		if rest[i].Priority != rest[j].Priority {
+			return rest[i].Priority > rest[j].Priority
+		}
+		return rest[i].Size < rest[j].Size
+	})
+	for _, f := range rest {
+		take(f)
+	}
+	sort.SliceStable(selected, func(i, j int) bool { return selected[i].Priority > selected[j].Priority })
+	return selected, used, usage.capped
+}
+
+// solveKnapsack returns which of items to take for the greatest total value
+// within capacity. Sizes are rounded up to units of capacity/knapsackUnits,
+// so the chosen items always fit.
+func solveKnapsack(items []FileInfoRec, capacity int64) []bool {
+	in := make([]bool, len(items))
+	if len(items) == 0 || capacity <= 0 {
+		return in
+	}
+	unit := (capacity + knapsackUnits - 1) / knapsackUnits
+	limit := int(capacity / unit)
+	weight := make([]int, len(items))
+	for i, f := range items {
+		weight[i] = int((f.Size + unit - 1) / unit)
+	}
+	// best[c] is the greatest value within c units; keep[i] marks the
+	// capacities at which item i improved it, for the walk back.
+	best := make([]int64, limit+1)
+	words := (limit + 64) / 64
+	keep := make([][]uint64, len(items))
+	for i, f := range items {
+		keep[i] = make([]uint64, words)
+		w, v := weight[i], knapsackValue(f)
+		for c := limit; c >= w; c-- {
+			if best[c-w]+v > best[c] {
+				best[c] = best[c-w] + v
+				keep[i][c/64] |= 1 << (c % 64)
+			}
+		}
+	}
+	c := limit
+	for i := len(items) - 1; i >= 0; i-- {
+		if keep[i][c/64]&(1<<(c%64)) != 0 {
+			in[i] = true
+			c -= weight[i]
+		}
+	}
+	return in
+}
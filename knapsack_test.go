@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSelectByValueBeatsGreedy(t *testing.T) {
+	// By worth per byte a.bin comes first, but once it is in neither b nor c
+	// fits; b and c together are worth more. d is worth nothing and only
+	// fills the space left over.
+	files := []FileInfoRec{
+		{Path: "a.bin", Size: 60, Priority: 7},
+		{Path: "b.bin", Size: 50, Priority: 5},
+		{Path: "c.bin", Size: 50, Priority: 5},
+		{Path: "d.bin", Size: 5, Priority: 0},
+	}
+	selected, used, capped := selectByValue(files, 105, nil, nil)
+	var names []string
+	for _, f := range selected {
+		names = append(names, f.Path)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "b.bin,c.bin,d.bin" || used != 105 || len(capped) != 0 {
+		t.Errorf("selected %v using %d (capped %v); want b.bin,c.bin,d.bin using 105", names, used, capped)
+	}
+
+	// A tier cap is honoured even where the solution would exceed it.
+	for i := range files {
+		files[i].Tier = "media"
+	}
+	files[0].Tier = "docs"
+	selected, used, capped = selectByValue(files, 105, map[string]tierCap{"media": {Files: 1}}, nil)
+	media := 0
+	for _, f := range selected {
+		if f.Tier == "media" {
+			media++
+		}
+	}
+	if media != 1 || used > 105 || len(capped) != 1 || capped[0] != "media" {
+		t.Errorf("with a cap of one media file: %d media files using %d, capped %v", media, used, capped)
+	}
+}
+
+func TestSolveKnapsackFits(t *testing.T) {
+	var items []FileInfoRec
+	for i := 1; i <= 40; i++ {
+		items = append(items, FileInfoRec{Size: int64(i*7919%1000 + 1), Priority: i%9 + 1})
+	}
+	const capacity = 5000
+	var size int64
+	for i, in := range solveKnapsack(items, capacity) {
+		if in {
+			size += items[i].Size
+		}
+	}
+	if size > capacity || size < capacity*9/10 {
+		t.Errorf("chosen items take %d of %d bytes", size, capacity)
+	}
+}
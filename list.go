@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runList implements `backuper list`: one line per backup on the USB, or
+// with --run, --tier or --glob the files backed up, with when, from where
+// and how big.
+func runList(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	run := fs.String("run", "", "List the files of this backup: its folder name as listed, or \"latest\"")
+	tier := fs.String("tier", "", "List only files of this tier, by name or priority (across all backups unless --run)")
+	glob := fs.String("glob", "", "List only files whose source path matches this pattern, e.g. '*.pdf' or 'Documents/**' (across all backups unless --run)")
+	profile := fs.String("profile", "importance_profile.json", "Importance profile naming the tiers for --tier (on USB or absolute)")
+	_ = fs.Parse(args)
+	g.apply()
+
+	root, err := usbRoot()
+	mustNoErr(err)
+	runs := catalogRuns(root)
+	if len(runs) == 0 {
+		fmt.Printf("No backups found in %s\n", root)
+		return
+	}
+	if *run == "" && *tier == "" && *glob == "" {
+		for _, r := range runs {
+			fmt.Printf("%-40s %-16s %8d files %10s  %s\n", r.Dir, formatRunTime(r.Started), r.Files, humanSize(r.Bytes), r.Label)
+		}
+		return
+	}
+
+	var dir string
+	if *run != "" {
+		dir, err = resolveRun(runs, *run)
+		mustNoErr(err)
+	}
+	profilePath := *profile
+	if !filepath.IsAbs(profilePath) {
+		profilePath = filepath.Join(root, profilePath)
+	}
+	tiers, _ := loadImportanceProfile(profilePath)
+
+	var n int
+	var total int64
+	for _, f := range catalogFiles(root, dir) {
+		name, prio := classifyFile(f.Rec.Src, tiers)
+		if *tier != "" && !strings.EqualFold(name, *tier) && *tier != strconv.Itoa(prio) {
+			continue
+		}
+		if *glob != "" && !globMatch(*glob, f.Rec.Src) {
+			continue
+		}
+		when := time.Unix(0, int64(f.Rec.Ts*1e9))
+		fmt.Printf("%-30s %-16s %10s  %-14s %s\n", f.Run, formatRunTime(when), humanSize(f.Rec.Size), name, f.Rec.Src)
+		n++
+		total += f.Rec.Size
+	}
+	fmt.Printf("%d files, %s\n", n, humanSize(total))
+}
+
+// resolveRun maps a backup named on the command line to its folder in
+// runs: the folder as listed, "latest" for the newest backup or "previous"
+// for the one before it.
+func resolveRun(runs []catalogRun, name string) (string, error) {
+	byTime := append([]catalogRun(nil), runs...)
+	sort.SliceStable(byTime, func(i, j int) bool { return byTime[i].Started.Before(byTime[j].Started) })
+	switch n := len(byTime); {
+	case name == "latest" && n > 0:
+		return byTime[n-1].Dir, nil
+	case name == "previous" && n > 1:
+		return byTime[n-2].Dir, nil
+	}
+	dir := filepath.ToSlash(filepath.Clean(name))
+	for _, r := range runs {
+		if r.Dir == dir {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("no backup %q on the USB (see backuper list)", name)
+}
+
+func formatRunTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// catalogRuns lists the backups on the USB from the catalog, or from their
+// manifests when the catalog is off or unusable.
+func catalogRuns(root string) []catalogRun {
+	var runs []catalogRun
+	if withCatalog(root, func(c *catalog) (err error) {
+		runs, err = c.runs()
+		return err
+	}) {
+		return runs
+	}
+	for _, m := range findManifests(root) {
+		dir := manifestBackupDir(m)
+		name, _ := filepath.Rel(root, dir)
+		r := catalogRun{Dir: filepath.ToSlash(name), Started: backupTime(dir)}
+		if meta, err := readRunMeta(dir); err == nil {
+			r.Label, r.Host = meta.Label, meta.Host
+		}
+		if recs, err := backupRecords(dir); err == nil {
+			for _, rec := range recs {
+				r.Files++
+				r.Bytes += rec.Size
+			}
+		}
+		runs = append(runs, r)
+	}
+	return runs
+}
+
+// catalogFiles returns the files of the backup in folder run, or of every
+// backup when run is empty, from the catalog or else the manifests.
+func catalogFiles(root, run string) []catalogFile {
+	var files []catalogFile
+	if withCatalog(root, func(c *catalog) (err error) {
+		files, err = c.files(run)
+		return err
+	}) {
+		return files
+	}
+	for _, r := range catalogRuns(root) {
+		if run != "" && r.Dir != run {
+			continue
+		}
+		recs, err := backupRecords(filepath.Join(root, filepath.FromSlash(r.Dir)))
+		if err != nil {
+			continue
+		}
+		for _, rec := range recs {
+			files = append(files, catalogFile{Run: r.Dir, Rec: rec})
+		}
+	}
+	return files
+}
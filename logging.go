@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Diagnostics go through log/slog with consistent fields (file, bytes,
+// duration, error), so they can be filtered by level and, with
+// --log-format json, by machine. Reports the user asked for (plans, lists,
+// summaries) are still printed directly.
+//
+// Levels: --quiet shows warnings and errors only, the default adds
+// progress messages and per-file lines, --verbose adds per-file details
+// such as the copy strategy, and --debug everything.
+
+const levelVerbose = slog.Level(-2)
+
+func init() {
+	setupLogging(slog.LevelInfo, "text")
+}
+
+// setupLogging installs the default logger.
+func setupLogging(level slog.Level, format string) {
+	var h slog.Handler
+	if format == "json" {
+		h = slog.NewJSONHandler(stderrWriter{}, &slog.HandlerOptions{Level: level, ReplaceAttr: jsonLevelNames})
+	} else {
+		h = &consoleHandler{level: level, mu: &sync.Mutex{}}
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// jsonLevelNames names the custom verbose level in JSON output.
+func jsonLevelNames(_ []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey {
+		if l, ok := a.Value.Any().(slog.Level); ok && l == levelVerbose {
+			a.Value = slog.StringValue("VERBOSE")
+		}
+	}
+	return a
+}
+
+// logLevel picks the level from --quiet, --verbose and --debug.
+func logLevel(quiet, verbose, debug bool) (slog.Level, error) {
+	n := 0
+	for _, b := range []bool{quiet, verbose, debug} {
+		if b {
+			n++
+		}
+	}
+	switch {
+	case n > 1:
+		return 0, fmt.Errorf("use only one of --quiet, --verbose and --debug")
+	case quiet:
+		return slog.LevelWarn, nil
+	case verbose:
+		return levelVerbose, nil
+	case debug:
+		return slog.LevelDebug, nil
+	}
+	return slog.LevelInfo, nil
+}
+
+// stderrWriter writes to whatever os.Stderr is at the time, so output
+// captured by --log-file after setup is still seen.
+type stderrWriter struct{}
+
+func (stderrWriter) Write(p []byte) (int, error) { return os.Stderr.Write(p) }
+
+// consoleHandler prints records the way the tool always has: warnings and
+// errors on stderr with a "warning:"/"error:" prefix, everything else on
+// stdout, followed by the record's fields as key=value.
+type consoleHandler struct {
+	level slog.Level
+	attrs []slog.Attr
+	group string
+	mu    *sync.Mutex
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, l slog.Level) bool { return l >= h.level }
+
+func (h *consoleHandler) Handle(_ context.Context, r slog.Record) error {
+	line := formatRecord(r.Level, r.Message, h.attrs, h.group, r)
+	var out io.Writer = os.Stdout
+	if r.Level >= slog.LevelWarn {
+		out = os.Stderr
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(out, line+"\n")
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(as []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range as {
+		if h.group != "" {
+			a.Key = h.group + "." + a.Key
+		}
+		c.attrs = append(c.attrs, a)
+	}
+	return &c
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	if c.group != "" {
+		name = c.group + "." + name
+	}
+	c.group = name
+	return &c
+}
+
+// formatRecord renders a record as one console line.
+func formatRecord(level slog.Level, msg string, pre []slog.Attr, group string, r slog.Record) string {
+	var b strings.Builder
+	switch {
+	case level >= slog.LevelError:
+		b.WriteString("error: ")
+	case level >= slog.LevelWarn:
+		b.WriteString("warning: ")
+	case level < levelVerbose:
+		b.WriteString("debug: ")
+	}
+	b.WriteString(msg)
+	write := func(a slog.Attr) bool {
+		if a.Equal(slog.Attr{}) {
+			return true
+		}
+		key := a.Key
+		if group != "" {
+			key = group + "." + key
+		}
+		b.WriteString(" " + key + "=" + formatValue(a.Value))
+		return true
+	}
+	for _, a := range pre {
+		b.WriteString(" " + a.Key + "=" + formatValue(a.Value))
+	}
+	r.Attrs(write)
+	return b.String()
+}
+
+func formatValue(v slog.Value) string {
+	v = v.Resolve()
+	var s string
+	switch v.Kind() {
+	case slog.KindDuration:
+		s = v.Duration().Round(time.Millisecond).String()
+	case slog.KindString:
+		s = v.String()
+	default:
+		if err, ok := v.Any().(error); ok {
+			s = err.Error()
+		} else {
+			s = v.String()
+		}
+	}
+	if s == "" || strings.ContainsAny(s, " \t\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// fileLog reports a per-file event: to the TUI's activity log when logsCh
+// is set (never blocking a worker), otherwise through slog when this
+// file's lines are sampled (see --log-every).
+func fileLog(logsCh chan string, plain bool, level slog.Level, msg string, args ...any) {
+	if logsCh != nil {
+		if !slog.Default().Enabled(context.Background(), level) {
+			return
+		}
+		r := slog.NewRecord(time.Time{}, level, msg, 0)
+		r.Add(args...)
+		select {
+		case logsCh <- formatRecord(level, msg, nil, "", r):
+		default:
+		}
+		return
+	}
+	if plain {
+		slog.Log(context.Background(), level, msg, args...)
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
-	"io/fs"
+	"log/slog"
+	"math"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -23,12 +26,40 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/term"
 )
 
 type Tier struct {
 	Name     string   `json:"name"`
 	Priority int      `json:"priority"`
 	Patterns []string `json:"patterns"`
+	MaxFiles int      `json:"max_files,omitempty"` // 0 = unlimited
+	// MaxBytes and MaxPercent cap the tier's total size, absolutely or as a
+	// share of the space available to the run; the smaller one applies.
+	MaxBytes   byteSize `json:"max_bytes,omitempty"`
+	MaxPercent float64  `json:"max_percent,omitempty"`
+}
+
+// byteSize is a size in a profile, given as a number of bytes or as a
+// string like "200G".
+type byteSize int64
+
+func (b *byteSize) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("size must be a number of bytes or a string like \"200G\": %s", data)
+		}
+		*b = byteSize(n)
+		return nil
+	}
+	n, err := parseSize(s)
+	if err != nil {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = byteSize(n)
+	return nil
 }
 
 type FileInfoRec struct {
@@ -36,6 +67,8 @@ type FileInfoRec struct {
 	Size     int64
 	MTime    time.Time
 	Priority int
+	Tier     string
+	Taken    time.Time // EXIF capture date, with --exif
 }
 
 type ManifestRec struct {
@@ -47,6 +80,42 @@ type ManifestRec struct {
 	Status   string  `json:"status"`
 	Message  string  `json:"message"`
 	Ts       float64 `json:"ts"`
+	// DurationMs is the wall time spent copying the file (--record-durations).
+	DurationMs int64 `json:"duration_ms,omitempty"`
+	// Strategy is the copy path pickCopyStrategy chose for a copied file.
+	Strategy copyStrategy `json:"strategy,omitempty"`
+	// Checksum is "<algo>:<hex>" of the bytes written (--checksums).
+	Checksum string `json:"checksum,omitempty"`
+	// Compression, StoredSize and Ratio describe a file stored compressed
+	// (--compress); Size stays the original size.
+	Compression string  `json:"compression,omitempty"`
+	StoredSize  int64   `json:"stored_size,omitempty"`
+	Ratio       float64 `json:"ratio,omitempty"`
+	// Encrypted is the ID of the key the file was sealed with (--encrypt).
+	Encrypted string `json:"encrypted,omitempty"`
+	// Dedup is "link" (hard link) or "ref" (pointer file) for files stored
+	// in the content-addressed store (--dedup).
+	Dedup string `json:"dedup,omitempty"`
+	// Parts is the number of <dst>.NNN parts a file too large for the
+	// destination filesystem was split into.
+	Parts int `json:"parts,omitempty"`
+	// Attempt numbers the tries of a file retried after transient errors
+	// (--retries): each failed try is a "retry" record, and the final
+	// record carries the attempt that settled it.
+	Attempt int `json:"attempt,omitempty"`
+	// Preserved lists the metadata carried over (--preserve-metadata):
+	// "mode", "owner", "xattrs" on Linux, "attributes" on Windows.
+	Preserved []string `json:"preserved,omitempty"`
+	// Recorded marks a symlink kept only in the manifest (Message holds
+	// its target) because the destination cannot hold links.
+	Recorded bool `json:"recorded,omitempty"`
+	// Archive, Member and Offset locate a file stored in an archive
+	// (--archive): the archive's path relative to the backup folder, the
+	// member's name and, in a tar, the byte offset of its data. Dst is then
+	// the file's logical path.
+	Archive string `json:"archive,omitempty"`
+	Member  string `json:"member,omitempty"`
+	Offset  int64  `json:"offset,omitempty"`
 }
 
 var (
@@ -67,23 +136,252 @@ var fastSSDMode bool
 var noProgress bool
 var boostMode bool
 
+// portablePaths writes manifest paths with forward slashes regardless of OS.
+var portablePaths bool
+
+// manifestEOL is the line terminator used for manifest and report lines.
+var manifestEOL = nativeEOL()
+
+// logEvery samples per-file log lines in non-interactive mode: 1 logs every
+// file, N every Nth file, 0 none. The periodic [TOTAL] line is unaffected.
+var logEvery = 1
+var fileLogSeq int64
+
+func sampleFileLog() bool {
+	if logEvery <= 0 {
+		return false
+	}
+	return (atomic.AddInt64(&fileLogSeq, 1)-1)%int64(logEvery) == 0
+}
+
+// recentDirBoost is added to the priority of files whose directory was
+// modified within recentDirWindow.
+var recentDirBoost int
+var recentDirWindow = 7 * 24 * time.Hour
+
+// includeEmptyDirs makes the scan collect empty source directories into
+// scanEmptyDirs so they can be recreated on the destination.
+var includeEmptyDirs bool
+var scanEmptyDirs []string
+
+// touchSkipped refreshes mtimes of destination files skipped as same-size.
+var touchSkipped bool
+
+// recordDurations adds per-file copy times to manifest records.
+var recordDurations bool
+
+// recordChecksums hashes each copied file as it is written and stores the
+// digest in the manifest, so verify can detect corruption later.
+var recordChecksums bool
+
 func main() {
-	// Flags
-	sourcesFlag := flag.String("sources", defaultHome(), "Comma-separated source directories to scan")
-	objective := flag.String("objective", "count", "Selection objective: count|space")
-	excludeFlag := flag.String("exclude", "", "Comma-separated extra exclude glob patterns (full path)")
-	profile := flag.String("profile", "importance_profile.json", "Importance profile JSON path (on USB or absolute)")
-	destSubdir := flag.String("dest-subdir", "", "Destination subfolder on USB; if empty, auto-named unless --resume")
-	dryRun := flag.Bool("dry-run", false, "Plan only, do not copy")
-	resume := flag.Bool("resume", false, "Resume into existing dest-subdir (no new dir)")
-	workers := flag.Int("workers", 0, "Concurrent copy workers (0=auto: all CPU cores)")
-	reserve := flag.Int64("reserve", 0, "Reserve bytes to leave free on USB (default 0 for maximum space)")
-	noProg := flag.Bool("no-progress", false, "Disable progress UI/log updates (max throughput mode)")
-	fastSSD := flag.Bool("fast-ssd", false, "Optimize copy heuristics for very fast SSD/NVMe (fewer syscalls on large files)")
-	boost := flag.Bool("boost", false, "High-performance mode: raise process priority, enable fast-ssd heuristics, keep GUI")
-	noOneDrive := flag.Bool("no-onedrive", false, "Exclude OneDrive folders and variations from scan")
-	flag.Parse()
+	runCommand(os.Args[1:])
+}
 
+// runBackup implements `backuper backup`, the default command.
+func runBackup(args []string) {
+	if err := backup(args); err != nil {
+		fail(err)
+	}
+}
+
+// backup runs one backup. An error it returns has been through the deferred
+// teardown already: the TUI is closed and the summary written.
+func backup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	sourcesFlag := fs.String("sources", defaultHome(), "Comma-separated source directories to scan")
+	objective := fs.String("objective", "count", "Selection objective: count|space|priority|value")
+	excludeFlag := fs.String("exclude", "", "Comma-separated extra exclude glob patterns (** spans directories; patterns without / match names)")
+	profile := fs.String("profile", "importance_profile.json", "Importance profile JSON path (on USB or absolute)")
+	destSubdir := fs.String("dest-subdir", "", "Destination subfolder on USB; if empty, auto-named unless --resume")
+	dryRun := fs.Bool("dry-run", false, "Plan only, do not copy")
+	resume := fs.Bool("resume", false, "Resume into existing dest-subdir (no new dir)")
+	reserve := fs.Int64("reserve", 0, "Reserve bytes to leave free on USB (default 0 for maximum space)")
+	noProg := fs.Bool("no-progress", false, "Disable progress UI/log updates (max throughput mode)")
+	logFile := fs.String("log-file", "", "Append everything the run prints to this file (default: logs/backuper.log on the USB; \"off\" disables)")
+	logMaxSize := fs.String("log-max-size", "10M", "Rotate the log file when it reaches this size, keeping 5 old files")
+	progressFmt := fs.String("progress", "", "Progress format: json emits newline-delimited JSON events instead of the TUI")
+	listen := fs.String("listen", "", "Serve a JSON status API (status, recent log, pause/resume/cancel) on this address, e.g. 127.0.0.1:8799")
+	metricsAddr := fs.String("metrics-addr", "", "Serve Prometheus metrics at http://<addr>/metrics while --watch or --schedule runs (e.g. :9184)")
+	progressFD := fs.Int("progress-fd", 1, "File descriptor for --progress=json events (1 = stdout; the human log then goes to stderr)")
+	fastSSD := fs.Bool("fast-ssd", false, "Optimize copy heuristics for very fast SSD/NVMe (fewer syscalls on large files)")
+	directIO := fs.Bool("direct-io", false, "Linux: copy large files with O_DIRECT so they do not push everything else out of the page cache")
+	directMin := fs.String("direct-io-min", "256M", "With --direct-io, the size from which files bypass the page cache")
+	adaptive := fs.Bool("adaptive-buffers", true, "Tune the copy buffer size and small/large file thresholds to the throughput measured on the destination (off with --fast-ssd or --boost)")
+	ioUring := fs.Bool("io-uring", false, "Linux: copy large files through io_uring with several chunks in flight, for NVMe-to-NVMe backups (falls back to the read/write loop on kernels without it)")
+	uringQD := fs.Int("io-uring-depth", 16, "With --io-uring, 1 MiB chunks each worker keeps in flight")
+	boost := fs.Bool("boost", false, "High-performance mode: raise process priority, enable fast-ssd heuristics, keep GUI")
+	noOneDrive := fs.Bool("no-onedrive", false, "Exclude OneDrive folders and variations from scan")
+	portable := fs.Bool("portable-paths", false, "Write manifest paths with forward slashes for cross-OS tooling")
+	lineEndings := fs.String("line-endings", "native", "Manifest/report line endings: native|lf|crlf")
+	resumableScan := fs.Bool("resumable-scan", false, "Periodically checkpoint scan progress so an interrupted scan can resume")
+	assumeYes := fs.Bool("yes", false, "Do not ask for confirmation before overwriting existing destination files")
+	skipWithin := fs.Duration("skip-if-backed-up-within", 0, "Skip files copied by any backup on the USB within this duration, even if changed (e.g. 30m)")
+	notifyFlag := fs.Bool("notify", false, "Show desktop notifications when the run starts, finishes or fails (for watch and scheduled runs)")
+	report := fs.String("report", "html", "Save a readable end-of-run report next to the manifest: html|md|both|off")
+	summaryJSON := fs.String("summary-json", "", "Write a JSON summary of the run to this file ('-' for stdout)")
+	hashSkip := fs.Bool("hash-skip", false, "Skip existing destination files only when their SHA-256 matches (sources hashed during scan)")
+	treeDepth := fs.Int("tree", -1, "After copying, print a tree of the destination down to this depth (0=unlimited, -1=off)")
+	label := fs.String("label", "", "Label stored with this backup and appended to auto-named destination folders")
+	assumeFree := fs.String("assume-free", "", "Plan against this much free space instead of the detected amount (e.g. 500G); needs --dry-run or --force")
+	force := fs.Bool("force", false, "Allow --assume-free on a real (non dry-run) copy")
+	readOrder := fs.String("read-order", "selection", "Copy dispatch order: selection|path (path improves read locality on HDD sources)")
+	recordDur := fs.Bool("record-durations", false, "Record each file's copy duration (duration_ms) in the manifest")
+	logEveryN := fs.Int("log-every", 1, "Non-interactive mode: log per-file lines for every Nth file (0=none; [TOTAL] lines still printed)")
+	dirBoost := fs.Int("recent-dir-boost", 0, "Add this to the priority of files in recently modified directories (0=off)")
+	dirWindow := fs.Duration("recent-dir-window", 7*24*time.Hour, "How recent a directory change must be for --recent-dir-boost")
+	emptyDirs := fs.Bool("include-empty-dirs", false, "Recreate empty source directories on the destination")
+	touchSkip := fs.Bool("touch-on-skip", false, "Set the mtime of skipped same-size destination files (incl. empty files) from the source")
+	dirHash := fs.Bool("dir-hash", false, "Skip files in directories unchanged (names/sizes/mtimes) since the last complete run into this destination")
+	noBackupIgnore := fs.Bool("no-backupignore", false, "Don't read .backupignore files in source directories")
+	gitIgnore := fs.Bool("gitignore", false, "Also honor .gitignore files in source directories")
+	review := fs.Bool("review", false, "Before copying, review the selection as a tree in the TUI and toggle files or folders on and off")
+	useExif := fs.Bool("exif", false, "Read EXIF capture dates of images and select recent photos first within their tier")
+	photoLayout := fs.Bool("photo-layout", false, "With --exif, store images as Photos/<year>/<month>/<name> by capture date")
+	sniff := fs.Bool("sniff", false, "Classify files without a known extension by their content (magic bytes, shebang, text)")
+	minSize := fs.String("min-size", "", "Skip files smaller than this, e.g. 1K")
+	maxSize := fs.String("max-size", "", "Skip files larger than this, e.g. 2G")
+	newerThan := fs.String("newer-than", "", "Only back up files modified within this age (90d, 2w, 1y, 36h) or since a date (2024-01-31)")
+	olderThan := fs.String("older-than", "", "Only back up files last modified before this age or date")
+	atomicDirs := fs.String("atomic-dirs", "", "Comma-separated folders or glob patterns whose files are selected all together or not at all")
+	atomicMarker := fs.String("atomic-marker", "", "Also treat every folder containing a file of this name (e.g. .backup-atomic) as --atomic-dirs")
+	useScanIndex := fs.Bool("scan-index", false, "Keep an index of scanned directories on the USB and skip re-reading directories whose mtime is unchanged")
+	hardlinks := fs.Bool("hardlinks", false, "Copy files with several hard-linked names once and recreate the other names as hard links")
+	skipDups := fs.Bool("skip-duplicates", false, "Copy files with identical content found in several places once and record the other paths as aliases in the manifest")
+	linkDups := fs.Bool("link-duplicates", false, "Like --skip-duplicates, and also create each duplicate on the destination as a hard link to the kept copy where the filesystem supports hard links")
+	symlinks := fs.String("symlinks", "skip", "Symlink handling: skip|follow (copy the target, cycles detected)|preserve (recreate the link; recorded in the manifest where the destination cannot hold links)")
+	keepLinks := fs.Bool("preserve-relative-symlinks", false, "Same as --symlinks=preserve")
+	skipDangling := fs.Bool("skip-dangling-symlinks", false, "With --symlinks=preserve, skip links whose target does not exist")
+	requireRemovable := fs.Bool("require-removable", false, "Refuse to run unless the destination is on removable media")
+	allowFixed := fs.Bool("allow-fixed", false, "Override --require-removable for an intentional non-removable destination")
+	checksums := fs.Bool("checksums", false, "Record a SHA-256 of every copied file in the manifest (computed while copying) so verify can detect corruption")
+	checksumAlgoFlag := fs.String("checksum-algo", "", "Hash for --checksums: sha256|sha512|sha1|md5 (implies --checksums; default sha256)")
+	incremental := fs.Bool("incremental", false, "Only copy files whose size or mtime changed since their last backup on the USB (from the manifests)")
+	encrypt := fs.Bool("encrypt", false, "Encrypt file contents with AES-256-GCM (passphrase from --passphrase-file, $BACKUP_PASSPHRASE or a prompt); stored as <name>.enc")
+	passFile := fs.String("passphrase-file", "", "Read the --encrypt or --zip-password passphrase from this file")
+	keyringDir := fs.String("keyring", "", "With --encrypt, seal with the newest key file in this directory instead of a passphrase (created if empty; see the rekey command)")
+	splitSize := fs.String("split-size", "", "Split files larger than this into <name>.001, .002, ... (default: detected, 4G-1 on FAT32)")
+	mirror := fs.Bool("mirror", false, "After copying, delete files in the backup folder that no selected source file maps to (asks for confirmation)")
+	span := fs.Bool("span", false, "Spread a selection larger than the drive over several drives, prompting for each next drive")
+	dedup := fs.Bool("dedup", false, "Store each distinct file content once in .store/ on the USB, hard-linking (or pointing) backed-up paths to it")
+	compress := fs.String("compress", "", "Store compressible files compressed: zstd or zstd:<level 1-22> (written as <name>.zst)")
+	warnDominant := fs.Float64("warn-dominant", 0.5, "Warn when one selected file uses more than this fraction of capacity (0=off)")
+	watch := fs.Bool("watch", false, "After the initial pass, keep running and copy files as they change (Ctrl+C to stop)")
+	watchDebounce := fs.Duration("watch-debounce", 2*time.Second, "With --watch, wait until a file has been quiet this long before copying it")
+	catalogFlag := fs.Bool("catalog", true, "Keep catalog.db, a SQLite index of every backup on the USB, up to date and use it for lookups across backups")
+	verifyWritesFlag := fs.Bool("verify-writes", false, "Read each file back once it is in place (past the page cache where possible) and compare it with the hash taken while writing; mismatches are retried")
+	retries := fs.Int("retries", 3, "Retry a file this many times after a transient I/O error (EIO, device gone) before giving up")
+	retryDelay := fs.Duration("retry-delay", time.Second, "Wait before the first retry; doubled for each further retry (max 30s)")
+	preserveMeta := fs.Bool("preserve-metadata", false, "Carry permissions, ownership (as root) and extended attributes over to the copies (Windows: hidden/system/archive attributes)")
+	archive := fs.String("archive", "", "Stream the selected files into archives in the backup folder instead of separate files: tar|zip")
+	archiveSplit := fs.String("archive-split", "size", "How files are grouped into archives: size (one sequence, split at --archive-size) or tier (separate archives per tier)")
+	zipPassword := fs.Bool("zip-password", false, "Seal --archive=zip members with AES-256-GCM (password from --passphrase-file, $BACKUP_PASSPHRASE or a prompt)")
+	archiveSize := fs.String("archive-size", "", "Start a new archive before one would exceed this size (default: the destination's file size limit, e.g. 4G-1 on FAT32)")
+	delta := fs.Bool("delta", false, "Update changed large files in place, rewriting only the blocks that differ")
+	deltaMin := fs.String("delta-min-size", "64M", "With --delta, only files at least this large are updated in place")
+	limitRate := fs.String("limit-rate", "", "Cap total copy bandwidth across all workers, e.g. 50M (bytes per second)")
+	eject := fs.Bool("eject", false, "When done, flush the destination drive and unmount/eject it")
+	vss := fs.Bool("vss", false, "Windows: read sources from Volume Shadow Copies so open or locked files (Outlook, browsers, databases) copy consistently; needs administrator rights")
+	snapshot := fs.Bool("snapshot", false, "Linux: snapshot the source filesystems (LVM or btrfs) when the scan starts and read from the snapshots; needs root")
+	snapSize := fs.String("snapshot-size", snapshotSize, "With --snapshot on LVM, room for changes while the backup runs: 20%ORIGIN, or a size like 10G")
+	s3URL := fs.String("s3", "", "Back up to an S3-compatible bucket instead of a drive: s3://bucket/prefix (credentials from AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY or ~/.aws/credentials)")
+	s3Endpoint := fs.String("s3-endpoint", "", "S3 endpoint URL for MinIO, Backblaze B2 and other S3-compatible services (default https://s3.amazonaws.com)")
+	s3Region := fs.String("s3-region", "", "S3 region (default: detected from the bucket)")
+	s3Quota := fs.String("s3-quota", "", "With --s3, select files to fit this much space, e.g. 500G (default: everything)")
+	rcloneRemote := fs.String("rclone", "", "Back up through rclone to a remote set up with rclone config: remote:path")
+	rcloneBin := fs.String("rclone-bin", "rclone", "The rclone program to run for --rclone")
+	rcloneQuota := fs.String("rclone-quota", "", "With --rclone, select files to fit this much space, e.g. 500G (default: the free space rclone reports, else everything)")
+	dest := fs.String("dest", "", "Mount point of the drive, or network share (UNC path), to back up to (default: the executable's drive, or a picker when that is the system drive)")
+	schedule := fs.String("schedule", "", "Keep running and start a backup on this cron schedule (e.g. \"0 22 * * *\"), skipping runs while the drive is missing")
+	jobName := fs.String("job", "", "Run a named job from backup.toml/backup.yaml on the USB; flags given here override it")
+	jobPath := fs.String("config", "", "Job file to read --job, [email] and [tuning] settings from (default: backup.toml or backup.yaml on the USB)")
+	_ = fs.Parse(args)
+
+	if *jobName != "" {
+		root, err := usbRoot()
+		mustNoErr(err)
+		path, err := findJobFile(root, *jobPath)
+		mustNoErr(err)
+		jf, err := loadJobFile(path)
+		mustNoErr(err)
+		mustNoErr(applyJob(fs, jf, *jobName))
+		slog.Info("Job", "name", *jobName, "file", path)
+	}
+	g.apply()
+	if *schedule != "" {
+		if *watch {
+			fail(fmt.Errorf("--schedule cannot be combined with --watch"))
+		}
+		if (*incremental || *mirror) && !*assumeYes {
+			slog.Warn("scheduled runs stop instead of overwriting or deleting files in the backup; add --yes to allow it")
+		}
+		// Each run checks --dest itself; the drive may be absent for now.
+		if *dest != "" {
+			abs, err := filepath.Abs(expandPath(*dest))
+			mustNoErr(err)
+			usbRootOverride = abs
+		}
+		var metrics *backupMetrics
+		if *metricsAddr != "" {
+			m, err := serveMetrics(*metricsAddr)
+			if err != nil {
+				fail(fmt.Errorf("--metrics-addr: %w", err))
+			}
+			metrics = m
+		}
+		ctx, cancel := interruptContext()
+		defer cancel()
+		runSchedule(ctx, *schedule, args, metrics)
+		return nil
+	}
+	if *s3URL != "" && *rcloneRemote != "" {
+		fail(fmt.Errorf("--s3 cannot be combined with --rclone"))
+	}
+	if *s3URL != "" || *rcloneRemote != "" {
+		if *dest != "" || *requireRemovable {
+			fail(fmt.Errorf("--s3 and --rclone cannot be combined with --dest or --require-removable"))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		var t *remoteTarget
+		var err error
+		if *s3URL != "" {
+			t, err = newS3Target(ctx, *s3URL, *s3Endpoint, *s3Region, *retries)
+		} else {
+			t, err = newRcloneTarget(ctx, *rcloneBin, *rcloneRemote, *retries)
+		}
+		cancel()
+		mustNoErr(err)
+		remoteOut = t
+		// Logs and bookkeeping are staged locally, as if on a USB.
+		usbRootOverride = t.root
+	} else {
+		chooseDestination(*dest, g.usbRoot != "", *allowFixed)
+	}
+
+	switch *progressFmt {
+	case "":
+	case "json":
+		// The event stream replaces the TUI and per-file progress lines.
+		ev, err := openEventStream(*progressFD)
+		if err != nil {
+			fail(fmt.Errorf("--progress-fd: %w", err))
+		}
+		progressEvents = ev
+		*noProg = true
+	default:
+		fail(fmt.Errorf("invalid --progress %q (want json)", *progressFmt))
+	}
+	if *metricsAddr != "" {
+		if !*watch {
+			fail(fmt.Errorf("--metrics-addr needs --watch or --schedule"))
+		}
+		m, err := serveMetrics(*metricsAddr)
+		if err != nil {
+			fail(fmt.Errorf("--metrics-addr: %w", err))
+		}
+		addEventObserver(m.Observe)
+	}
 	if *noProg {
 		noProgress = true
 	}
@@ -92,6 +390,59 @@ func main() {
 		boostMode = true
 	}
 
+	switch *objective {
+	case "count", "space", "priority", "value":
+	default:
+		fail(fmt.Errorf("invalid --objective %q (want count|space|priority|value)", *objective))
+	}
+
+	if *readOrder != "selection" && *readOrder != "path" {
+		fail(fmt.Errorf("invalid --read-order %q (want selection|path)", *readOrder))
+	}
+
+	portablePaths = *portable
+	recordDurations = *recordDur
+	recordChecksums = *checksums || *checksumAlgoFlag != ""
+	verifyWrites = *verifyWritesFlag
+	useCatalog = *catalogFlag
+	if algo, level, err := parseCompress(*compress); err != nil {
+		fail(err)
+	} else {
+		compressAlgo, compressLevel = algo, level
+	}
+	if *checksumAlgoFlag != "" {
+		if _, err := newChecksumHash(*checksumAlgoFlag); err != nil {
+			fail(err)
+		}
+		checksumAlgo = *checksumAlgoFlag
+	}
+	logEvery = *logEveryN
+	includeEmptyDirs = *emptyDirs
+	touchSkipped = *touchSkip
+	dirHashEnabled = *dirHash
+	mode := *symlinks
+	if *keepLinks {
+		mode = "preserve"
+	}
+	switch mode {
+	case "skip":
+	case "follow":
+		followSymlinks = true
+	case "preserve":
+		preserveSymlinks = true
+	default:
+		fail(fmt.Errorf("invalid --symlinks %q (want skip|follow|preserve)", mode))
+	}
+	skipDanglingSymlinks = *skipDangling
+	recentDirBoost, recentDirWindow = *dirBoost, *dirWindow
+	eol, err := parseLineEndings(*lineEndings)
+	mustNoErr(err)
+	manifestEOL = eol
+	desktopNotify = *notifyFlag
+	reportKinds, err := reportFormats(*report)
+	mustNoErr(err)
+
+	adaptiveBuffers = *adaptive && !*fastSSD && !boostMode
 	if *fastSSD || boostMode {
 		fastSSDMode = true
 		// Adjust thresholds for high-throughput media: treat more files as "small" to collapse loop overhead
@@ -99,6 +450,21 @@ func main() {
 		smallFileThreshold = 512 << 10      // 512 KiB
 		largeFileDirectThreshold = 16 << 20 // 16 MiB
 	}
+	if *directIO {
+		if runtime.GOOS != "linux" {
+			slog.Warn("--direct-io is only available on Linux; ignoring it")
+		} else if directIOMin, err = parseSize(*directMin); err != nil || directIOMin <= 0 {
+			fail(fmt.Errorf("invalid --direct-io-min %q", *directMin))
+		}
+	}
+	if *ioUring {
+		if *uringQD < 1 || *uringQD > 4096 {
+			fail(fmt.Errorf("--io-uring-depth must be between 1 and 4096"))
+		}
+		if err := probeUring(*uringQD); err != nil {
+			slog.Warn("io_uring unavailable; using the read/write loop", "error", err)
+		}
+	}
 	if boostMode {
 		// Slightly aggressive: ensure direct threshold not above 16 MiB
 		if largeFileDirectThreshold > 16<<20 {
@@ -110,11 +476,60 @@ func main() {
 
 	usbRoot, err := usbRoot()
 	mustNoErr(err)
+	if *logFile != "off" {
+		path := *logFile
+		if path == "" {
+			path = metaPath(usbRoot, filepath.Join(logDirName, logFileName))
+		}
+		maxSize, err := parseSize(*logMaxSize)
+		if err != nil {
+			fail(fmt.Errorf("invalid --log-max-size %q", *logMaxSize))
+		}
+		if l, err := openRunLog(path, maxSize); err != nil {
+			slog.Warn("cannot open log file", "error", err)
+		} else {
+			activeLog = l
+		}
+	}
+	if activeLog == nil && *listen != "" {
+		// Keep recent lines in memory for the status API.
+		activeLog = &runLog{}
+	}
+	if l := activeLog; l != nil {
+		if err := l.Capture(); err != nil {
+			l.Close()
+			activeLog = nil
+			slog.Warn("cannot capture output to log file", "error", err)
+		} else {
+			defer l.Close()
+			l.Line(fmt.Sprintf("=== backup started: %s", strings.Join(os.Args, " ")))
+		}
+	}
 
 	free := usableFreeSpace(usbRoot, *reserve)
+	if remoteOut != nil {
+		free = math.MaxInt64 / 2
+		quota, quotaFlag := *s3Quota, "--s3-quota"
+		if rs, ok := remoteOut.store.(*rcloneStore); ok {
+			quota, quotaFlag = *rcloneQuota, "--rclone-quota"
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if n, ok := rs.free(ctx); ok {
+				free = n
+			}
+			cancel()
+		}
+		if quota != "" {
+			if free, err = parseSize(quota); err != nil || free <= 0 {
+				fail(fmt.Errorf("invalid %s %q", quotaFlag, quota))
+			}
+		}
+	}
 	destDir := *destSubdir
 	if destDir == "" && !*resume {
-		destDir = "backup_" + time.Now().Format("20060102_150405")
+		destDir = "backup_" + clk.Now().Format("20060102_150405")
+		if l := sanitizeLabel(*label); l != "" {
+			destDir += "_" + l
+		}
 	}
 	if destDir != "" {
 		// Validate destSubdir to prevent path traversal attacks
@@ -122,17 +537,138 @@ func main() {
 		if strings.Contains(destDir, "..") || strings.HasPrefix(destDir, string(os.PathSeparator)) || strings.HasPrefix(destDir, "/") {
 			fail(fmt.Errorf("invalid destination subdirectory: path traversal detected"))
 		}
-		destDir = filepath.Join(usbRoot, destDir)
-		// Verify the result is still under usbRoot after joining
-		realDestDir, err := filepath.Abs(destDir)
-		realUsbRoot, err2 := filepath.Abs(usbRoot)
-		if err != nil || err2 != nil || !strings.HasPrefix(realDestDir, realUsbRoot) {
+		// Clean first so "X/" or "./X" are not reported as changed.
+		destDir = filepath.Clean(destDir)
+		if clean := sanitizePathName(destDir); clean != filepath.ToSlash(destDir) {
+			slog.Warn("destination subdirectory contains characters invalid on some filesystems", "dest", destDir, "using", clean)
+			destDir = clean
+		}
+		destDir = filepath.Join(usbRoot, filepath.FromSlash(destDir))
+		// Verify the result is still under usbRoot after joining. Symlinks are
+		// resolved on both sides first (e.g. /media -> /run/media) so the check
+		// neither rejects valid paths nor lets a link inside the USB escape it.
+		if !prefixOf(canonicalPath(destDir), canonicalPath(usbRoot)) {
 			fail(fmt.Errorf("destination directory is outside USB root"))
 		}
 	} else {
 		destDir = usbRoot
 	}
 	mustNoErr(os.MkdirAll(destDir, 0o755))
+	if remoteOut != nil {
+		mustNoErr(os.MkdirAll(metaPath(destDir, ""), 0o755))
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		err := remoteOut.load(ctx, destDir)
+		cancel()
+		mustNoErr(err)
+	}
+	if *delta {
+		n, err := parseSize(*deltaMin)
+		if err != nil || n <= 0 {
+			fail(fmt.Errorf("invalid --delta-min-size %q", *deltaMin))
+		}
+		deltaMinSize, deltaSigRoot = n, metaPath(destDir, deltaSigDir)
+	}
+	if metaDirName != "" {
+		mustNoErr(recordMetaDir(destDir))
+		mustNoErr(os.MkdirAll(metaPath(destDir, ""), 0o755))
+	}
+	copyRetries, retryBaseDelay = *retries, *retryDelay
+	explicit := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if remoteOut == nil {
+		t, err := loadTuningConfig(usbRoot, *jobPath)
+		mustNoErr(err)
+		if t != nil {
+			mustNoErr(applyTuningConfig(t, explicit, g))
+			slog.Info("Using settings from bench", "workers", g.workers, "buffer", humanSize(int64(defaultCopyBuffer)),
+				"small_file", humanSize(int64(smallFileThreshold)), "fast", fastSSDMode)
+		}
+	}
+	if remoteOut == nil && detectMedia(destDir) == mediaNetwork {
+		if !explicit["retries"] {
+			copyRetries = max(copyRetries, networkRetries)
+		}
+		if !explicit["retry-delay"] {
+			retryBaseDelay = max(retryBaseDelay, networkRetryDelay)
+		}
+		slog.Info("Destination is a network share", "retries", copyRetries, "retry_delay", retryBaseDelay)
+	}
+	preserveMetadata = *preserveMeta
+	sniffContent = *sniff
+	if *photoLayout && !*useExif {
+		fail(fmt.Errorf("--photo-layout needs --exif"))
+	}
+	if *photoLayout && *watch {
+		fail(fmt.Errorf("--photo-layout cannot be combined with --watch"))
+	}
+	recentPhotosFirst = *useExif
+	scanLimits = sizeAgeFilter{}
+	for _, sf := range []struct {
+		name, val string
+		dst       *int64
+	}{{"min-size", *minSize, &scanLimits.minSize}, {"max-size", *maxSize, &scanLimits.maxSize}} {
+		if sf.val == "" {
+			continue
+		}
+		n, err := parseSize(sf.val)
+		if err != nil {
+			fail(fmt.Errorf("invalid --%s %q", sf.name, sf.val))
+		}
+		*sf.dst = n
+	}
+	for _, af := range []struct {
+		name, val string
+		dst       *time.Time
+	}{{"newer-than", *newerThan, &scanLimits.newer}, {"older-than", *olderThan, &scanLimits.older}} {
+		if af.val == "" {
+			continue
+		}
+		t, err := parseCutoff(af.val, clk.Now())
+		if err != nil {
+			fail(fmt.Errorf("--%s: %w", af.name, err))
+		}
+		*af.dst = t
+	}
+	if scanLimits.maxSize > 0 && scanLimits.minSize > scanLimits.maxSize {
+		fail(fmt.Errorf("--min-size is larger than --max-size"))
+	}
+	if f := scanLimits.String(); f != "" {
+		fmt.Printf("Only files %s\n", f)
+	}
+	ignoreFileNames = nil
+	if *gitIgnore {
+		ignoreFileNames = append(ignoreFileNames, ".gitignore")
+	}
+	if !*noBackupIgnore {
+		ignoreFileNames = append(ignoreFileNames, ".backupignore")
+	}
+	if *limitRate != "" {
+		n, err := parseSize(*limitRate)
+		if err != nil || n <= 0 {
+			fail(fmt.Errorf("invalid --limit-rate %q", *limitRate))
+		}
+		copyLimiter = newRateLimiter(n)
+		fmt.Printf("Copy bandwidth limited to %s/s\n", humanSize(n))
+	}
+	if *splitSize != "" {
+		maxFileSize, err = parseSize(*splitSize)
+		mustNoErr(err)
+	} else if remoteOut != nil {
+		maxFileSize = 0
+	} else if maxFileSize = detectMaxFileSize(destDir); maxFileSize > 0 {
+		fmt.Printf("Destination limits files to %s; larger files will be split into parts\n", humanSize(maxFileSize))
+	}
+	if *keyringDir != "" && !*encrypt {
+		fail(fmt.Errorf("--keyring needs --encrypt"))
+	}
+	if *keyringDir != "" {
+		encryptKey, err = currentKey(expandPath(*keyringDir))
+		mustNoErr(err)
+	} else if *encrypt {
+		_ = os.MkdirAll(metaPath(destDir, ""), 0o755)
+		encryptKey, err = setupEncryption(metaPath(destDir, encKeyringName), *passFile)
+		mustNoErr(err)
+	}
 
 	// Load importance tiers
 	profilePath := *profile
@@ -142,18 +678,110 @@ func main() {
 	// Validate profile path to prevent path traversal when used with USB root
 	if !filepath.IsAbs(*profile) {
 		// If relative path, ensure it doesn't escape usbRoot
-		realProfilePath, err := filepath.Abs(profilePath)
-		realUsbRoot, err2 := filepath.Abs(usbRoot)
-		if err != nil || err2 != nil || !strings.HasPrefix(realProfilePath, realUsbRoot) {
-			fmt.Fprintf(os.Stderr, "warning: profile path escapes USB root, using default\n")
+		if !prefixOf(canonicalPath(profilePath), canonicalPath(usbRoot)) {
+			slog.Warn("profile path escapes USB root, using default")
 			profilePath = filepath.Join(usbRoot, "importance_profile.json")
 		}
 	}
-	tiers, _ := loadImportanceProfile(profilePath)
+	tiers, err := loadImportanceProfile(profilePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("invalid importance profile; using the default tiers", "path", profilePath, "error", err)
+	}
+	if scoreRule != nil {
+		slog.Info("Scoring files with the profile's expression", "score", scoreRule.src)
+	}
+
+	runStart := clk.Now()
+	host, _ := os.Hostname()
+	mail, err := loadEmailConfig(usbRoot, *jobPath)
+	mustNoErr(err)
+	if !*dryRun && (mail != nil || desktopNotify) {
+		onFatal = func(err error) {
+			notify("Backup failed", err.Error())
+			if mail == nil {
+				return
+			}
+			if err := sendFailureEmail(mail, host, err); err != nil {
+				slog.Warn("failed to send email", "error", err)
+			}
+		}
+	}
+	var meta runMeta
+	if !*dryRun {
+		meta = runMeta{Label: *label, Started: runStart, Host: host, Sources: splitNonEmpty(*sourcesFlag), Objective: *objective}
+		if encryptKey != nil {
+			meta.EncryptionKey = encryptKey.ID()
+		}
+		if err := writeRunMeta(destDir, meta); err != nil {
+			slog.Warn("failed to write run metadata", "error", err)
+		}
+		notify("Backup started", fmt.Sprintf("%s → %s", *sourcesFlag, destDir))
+	}
+	// Registered before the summary so they run after it is written.
+	if *eject && !*dryRun {
+		defer ejectDestination(usbRoot)
+	}
+	if remoteOut != nil && !*dryRun {
+		defer remoteOut.saveMeta(destDir)
+	}
+	summary := runSummary{Destination: destDir, Objective: *objective, ExitReason: "completed"}
+	defer func() {
+		summary.DurationSec = since(runStart).Seconds()
+		if *summaryJSON != "" {
+			if err := writeSummaryJSON(*summaryJSON, summary); err != nil {
+				slog.Warn("failed to write summary", "error", err)
+			}
+		}
+		progressEvents.Emit(progressEvent{Event: "run_summary", Summary: &summary})
+		if summary.ExitReason == "dry-run" {
+			return
+		}
+		title := "Backup finished"
+		if summary.ExitReason != "completed" {
+			title = "Backup finished with problems"
+		}
+		notify(title, fmt.Sprintf("Copied %d files (%s), %d error(s); %s", summary.Copied, humanSize(summary.CopiedBytes), summary.Errors, summary.ExitReason))
+		if summary.Selected == 0 && summary.ExitReason == "completed" {
+			return
+		}
+		r := runReport{Summary: summary, Label: *label, Host: host, Started: runStart, Finished: clk.Now(),
+			Sources: splitNonEmpty(*sourcesFlag), Free: usableFreeSpace(destDir, *reserve),
+			Failed: runFailures(metaPath(destDir, manifestName), runStart)}
+		if err := writeReports(destDir, reportKinds, r); err != nil {
+			slog.Warn("failed to write report", "error", err)
+		}
+		if mail.wants(r.OK()) {
+			if err := sendRunEmail(mail, r); err != nil {
+				slog.Warn("failed to send email", "error", err)
+			} else {
+				slog.Info("Emailed run summary", "to", strings.Join(mail.To, ", "))
+			}
+		}
+	}()
 
-	fmt.Printf("USB root: %s\n", usbRoot)
-	fmt.Printf("Destination: %s\n", destDir)
-	fmt.Printf("Free space (usable): %s\n", humanSize(free))
+	slog.Info("USB root", "path", usbRoot)
+	slog.Info("Destination", "path", destDir)
+	slog.Info("Free space (usable)", "bytes", free, "human", humanSize(free))
+	if *requireRemovable {
+		if m := detectMedia(usbRoot); m != mediaRemovable {
+			if !*allowFixed {
+				fail(fmt.Errorf("destination %s is on %s media, not removable; refusing because of --require-removable (use --allow-fixed to override)", usbRoot, m))
+			}
+			fmt.Printf("Destination media: %s (allowed by --allow-fixed)\n", m)
+		}
+	}
+	if *assumeFree != "" {
+		n, err := parseSize(*assumeFree)
+		mustNoErr(err)
+		if !*dryRun && !*force {
+			fail(fmt.Errorf("--assume-free overrides detected free space; use it with --dry-run (or --force to copy anyway)"))
+		}
+		fmt.Printf("Free space (assumed): %s — overrides detected %s for selection\n", humanSize(n), humanSize(free))
+		free = n
+	}
+	if avail, raw := diskSpace(usbRoot); raw > avail && remoteOut == nil {
+		fmt.Printf("Free space (raw): %s; a user quota limits usable space to %s\n", humanSize(raw), humanSize(avail))
+	}
 
 	// Parse sources and excludes
 	sources := splitNonEmpty(*sourcesFlag)
@@ -189,6 +817,14 @@ func main() {
 		}
 	}()
 
+	if *listen != "" {
+		api, err := serveStatus(ctx, *listen, destDir, cancel)
+		if err != nil {
+			fail(fmt.Errorf("--listen: %w", err))
+		}
+		addEventObserver(api.Observe)
+	}
+
 	// Initialize TUI early so nicer output is visible from the start
 	var tui *TUI
 	if !*noProg {
@@ -198,44 +834,251 @@ func main() {
 	}
 
 	// Scan
-	t0 := time.Now()
+	t0 := clk.Now()
 	if tui != nil {
 		tui.AppendLog("Starting scan...")
 	}
-	files := scanSources(ctx, sources, tiers, excludes, usbRoot, tui)
-	t1 := time.Since(t0)
+	var ckpt *scanCheckpointer
+	if *resumableScan {
+		_ = os.MkdirAll(metaPath(usbRoot, ""), 0o755)
+		ckpt = newScanCheckpointer(metaPath(usbRoot, ".scan-checkpoint.json"), sources, excludes)
+	}
+	var sums *checksumCache
+	var hasher *scanHasher
+	if *hashSkip || *dedup || *skipDups || *linkDups {
+		_ = os.MkdirAll(metaPath(usbRoot, ""), 0o755)
+		sums = loadChecksumCache(metaPath(usbRoot, ".checksum-cache.json"))
+	}
+	if *hashSkip || *dedup {
+		hasher = startScanHasher(ctx, sums, 4)
+	}
+	if *review && (*atomicDirs != "" || *atomicMarker != "") {
+		return fmt.Errorf("--review toggles single files and cannot be combined with --atomic-dirs or --atomic-marker")
+	}
+	if *review && (*noProg || *watch || *span) {
+		return fmt.Errorf("--review needs the TUI and cannot be combined with --no-progress, --watch or --span")
+	}
+	if *watch && (*span || *dryRun) {
+		return fmt.Errorf("--watch cannot be combined with --span or --dry-run")
+	}
+	if *watchDebounce <= 0 {
+		return fmt.Errorf("--watch-debounce must be positive")
+	}
+	if *vss && (runtime.GOOS != "windows" || *watch) {
+		return fmt.Errorf("--vss is only available on Windows and cannot be combined with --watch")
+	}
+	if *snapshot && (runtime.GOOS != "linux" || *watch) {
+		return fmt.Errorf("--snapshot is only available on Linux and cannot be combined with --watch")
+	}
+	if *hardlinks && (*span || *dedup) {
+		return fmt.Errorf("--hardlinks cannot be combined with --span or --dedup")
+	}
+	if *linkDups && *dedup {
+		return fmt.Errorf("--link-duplicates cannot be combined with --dedup, which already stores identical files once")
+	}
+	if (*skipDups || *linkDups) && (*span || *archive != "" || remoteOut != nil) {
+		dupFlag := "--skip-duplicates"
+		if *linkDups {
+			dupFlag = "--link-duplicates"
+		}
+		return fmt.Errorf("%s cannot be combined with --span, --archive, --s3 or --rclone", dupFlag)
+	}
+	// --link-duplicates implies --skip-duplicates.
+	*skipDups = *skipDups || *linkDups
+	if *mirror && (destDir == usbRoot || *span) {
+		return fmt.Errorf("--mirror needs a backup folder of its own (--dest-subdir) and cannot be combined with --span")
+	}
+	if *archive != "" {
+		if *span || *dedup || *mirror || *watch || *hardlinks || *delta || compressAlgo != "" || encryptKey != nil {
+			return fmt.Errorf("--archive cannot be combined with --span, --dedup, --mirror, --watch, --hardlinks, --delta, --compress or --encrypt")
+		}
+		limit := maxFileSize
+		if *archiveSize != "" {
+			if limit, err = parseSize(*archiveSize); err != nil || limit <= 0 {
+				return fmt.Errorf("invalid --archive-size %q", *archiveSize)
+			}
+		}
+		if *archiveSplit != "size" && *archiveSplit != "tier" {
+			return fmt.Errorf("invalid --archive-split %q (want size|tier)", *archiveSplit)
+		}
+		if *zipPassword && *archive != "zip" {
+			return fmt.Errorf("--zip-password needs --archive=zip")
+		}
+		if !*dryRun {
+			var password string
+			if *zipPassword {
+				pass, err := readPassphrase(*passFile, "Zip password: ")
+				if err != nil {
+					return err
+				}
+				password = string(pass)
+			}
+			archiveOut, err = newArchiveWriter(destDir, *archive, limit, password)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if verifyWrites && (*archive != "" || remoteOut != nil) {
+		return fmt.Errorf("--verify-writes cannot be combined with --archive, --s3 or --rclone")
+	}
+	if remoteOut != nil {
+		if *archive != "" || *span || *dedup || *mirror || *watch || *hardlinks || *delta || *hashSkip || compressAlgo != "" || encryptKey != nil || *eject {
+			return fmt.Errorf("--s3 and --rclone cannot be combined with --archive, --span, --dedup, --mirror, --watch, --hardlinks, --delta, --hash-skip, --compress, --encrypt or --eject")
+		}
+	}
+	if *dedup {
+		if compressAlgo != "" || encryptKey != nil {
+			return fmt.Errorf("--dedup stores plain content and cannot be combined with --compress or --encrypt")
+		}
+		if *span {
+			return fmt.Errorf("--dedup keeps one store per drive and cannot be combined with --span")
+		}
+		dedupStore, err = newCASStore(usbRoot, sums)
+		if err != nil {
+			return err
+		}
+	}
+	// Dedup needs source hashes but does not change the skip rule.
+	skipSums := sums
+	if !*hashSkip {
+		skipSums = nil
+	}
+	releaseSnapshots := func() {}
+	if (*vss || *snapshot) && !*dryRun {
+		snapshotSize = *snapSize
+		release, err := snapshotSources(sources)
+		if err != nil {
+			return err
+		}
+		releaseSnapshots = release
+		defer releaseSnapshots()
+	}
+	autoExclude, overlaps := overlapExcludes(sources, []string{usbRoot, destDir})
+	for _, o := range overlaps {
+		slog.Warn("source contains the backup destination; excluding it", "source", o[0], "excluded", o[1])
+	}
+	autoExclude = append(autoExclude, snapshotDirs()...)
+	var idx *scanIndex
+	if *useScanIndex {
+		idx = newScanIndex(metaPath(usbRoot, scanIndexDir))
+	}
+	files := scanSources(ctx, sources, tiers, excludes, autoExclude, tui, ckpt, hasher, idx)
+	if idx != nil {
+		slog.Info("Scan index", "unchanged_dirs", idx.reused, "read_dirs", idx.read)
+	}
+	hasher.Wait()
+	// Overlapping sources, or differently-cased spellings on case-insensitive
+	// filesystems, can reach the same file twice.
+	var insensitive []string
+	for _, src := range sources {
+		if abs, err := filepath.Abs(expandPath(src)); err == nil && isCaseInsensitiveFS(abs) {
+			insensitive = append(insensitive, abs)
+		}
+	}
+	scannedN := len(files)
+	files, collisions := dedupeScanned(files, insensitive)
+	for _, c := range collisions {
+		slog.Warn("case-duplicate path skipped", "file", c)
+	}
+	if n := scannedN - len(files); n > 0 {
+		fmt.Printf("Ignored %d duplicate paths (%d differing only by case)\n", n, len(collisions))
+	}
+	var linkGroups map[string][]string
+	if *hardlinks {
+		before := len(files)
+		files, linkGroups = collapseHardlinks(files)
+		fmt.Printf("Hardlinks: %d extra names of %d files will be linked instead of copied\n", before-len(files), len(linkGroups))
+	}
+	var dupGroups map[string][]string
+	if *skipDups {
+		before := len(files)
+		var saved int64
+		files, dupGroups, saved = collapseDuplicates(ctx, files, sums, linkGroups)
+		fmt.Printf("Duplicates: %d files (%s) have the same content as one of %d others and will be recorded as aliases\n", before-len(files), humanSize(saved), len(dupGroups))
+	}
+	if *useExif {
+		_ = os.MkdirAll(metaPath(usbRoot, ""), 0o755)
+		applyExif(files, loadExifCache(metaPath(usbRoot, ".exif-cache.json")), *photoLayout)
+	}
+	t1 := since(t0)
 	var totalBytes int64
 	for _, f := range files {
 		totalBytes += f.Size
 	}
-	fmt.Printf("Scanned %d files in %.2fs (%s total)\n", len(files), t1.Seconds(), humanSize(totalBytes))
+	slog.Info("Scanned", "files", len(files), "bytes", totalBytes, "human", humanSize(totalBytes), "duration", t1)
+	progressEvents.Emit(progressEvent{Event: "scan_progress", Files: int64(len(files)), Bytes: totalBytes, Status: "done"})
+	summary.Scanned, summary.ScannedBytes = len(files), totalBytes
+	if *skipWithin > 0 {
+		var n int
+		files, n = skipRecentlyBackedUp(files, lastBackupTimes(usbRoot), clk.Now().Add(-*skipWithin))
+		fmt.Printf("Skipped %d files backed up within the last %s\n", n, *skipWithin)
+	}
+	if *incremental {
+		var unchanged []ManifestRec
+		files, unchanged = skipUnchanged(files, lastBackedUp(usbRoot), skipSums)
+		fmt.Printf("Incremental: skipped %d files unchanged since their last backup\n", len(unchanged))
+		if !*dryRun {
+			// Prune and restore follow this to the runs holding the skipped
+			// files.
+			meta.Parents = parentRuns(usbRoot, destDir, unchanged)
+			if err := writeRunMeta(destDir, meta); err != nil {
+				slog.Warn("failed to write run metadata", "error", err)
+			}
+		}
+	}
 
 	// Select
-	selected, used := selectFiles(files, free, *objective)
-	fmt.Printf("Selected %d files totalling %s (objective: %s)\n", len(selected), humanSize(used), *objective)
+	// Leave room for the manifest itself so it can be written on a full drive.
+	budget := free - manifestReserveSize(len(files))
+	if budget < 0 {
+		budget = 0
+	}
+	if *span {
+		// Later drives take what the first cannot hold.
+		budget = totalBytes
+	}
+	selected, used, ok := selectPhase(files, sources, tiers, budget, selectOptions{
+		objective: *objective, atomicDirs: splitNonEmpty(*atomicDirs), atomicMarker: *atomicMarker, review: *review,
+	}, tui)
+	if !ok {
+		fmt.Println("Aborted at review: no files were copied.")
+		summary.ExitReason = "aborted"
+		return nil
+	}
+	summary.Selected, summary.SelectedBytes = len(selected), used
+	summary.Tiers = summarizeTiers(selected, tiers)
+	if big, ok := dominantFile(selected, free, *warnDominant); ok {
+		slog.Warn(fmt.Sprintf("file uses %.0f%% of available space; consider --objective count or excluding it", percent(big.Size, free)),
+			"file", big.Path, "bytes", big.Size)
+	}
 
 	// Plans
 	plans := make([][2]string, 0, len(selected)) // [src, dst]
 	for _, fi := range selected {
 		rel := relativeDestPath(fi.Path, sources)
-		dst := filepath.Join(destDir, rel)
+		dst := storedPath(fi.Path, filepath.Join(destDir, rel))
 		plans = append(plans, [2]string{fi.Path, dst})
 	}
 
 	// Filter existing same-size
-	toCopy := make([][2]string, 0, len(plans))
-	skippedExisting := 0
-	for _, p := range plans {
-		src, dst := p[0], p[1]
-		if st, err := os.Stat(dst); err == nil {
-			if st.Mode().IsRegular() {
-				if sst, err2 := os.Stat(src); err2 == nil && sst.Size() == st.Size() {
-					skippedExisting++
-					continue
-				}
+	toCopy, skippedExisting, unchangedDirs, changes := pendingChanges(plans, destDir, skipSums)
+
+	if sums != nil {
+		if err := sums.Save(); err != nil {
+			slog.Warn("failed to save checksum cache", "error", err)
+		}
+	}
+	var extraneous []string
+	if *mirror {
+		extraneous, changes.DeletedBytes = mirrorExtraneous(plans, selected, sources, destDir, linkGroups, dupGroups, *linkDups)
+		changes.Deleted = len(extraneous)
+		fmt.Printf("Mirror: %d files (%s) in the backup are not in the selection and will be deleted\n", changes.Deleted, humanSize(changes.DeletedBytes))
+		if *dryRun {
+			for _, p := range extraneous {
+				fmt.Printf("  delete %s\n", p)
 			}
 		}
-		toCopy = append(toCopy, p)
 	}
 
 	var toCopyBytes int64
@@ -245,9 +1088,13 @@ func main() {
 		}
 	}
 	fmt.Printf("Already present (same size): %d files\n", skippedExisting)
+	if dirHashEnabled {
+		fmt.Printf("  of which in unchanged directories (--dir-hash): %d files\n", unchangedDirs)
+	}
+	summary.Skipped = skippedExisting
 	fmt.Printf("To copy now: %d files, %s\n", len(toCopy), humanSize(toCopyBytes))
 
-	manifestPath := filepath.Join(destDir, "backup-manifest.jsonl")
+	manifestPath := metaPath(destDir, manifestName)
 	if *dryRun {
 		// summarize by top priorities
 		counts := map[int]int{}
@@ -265,21 +1112,209 @@ func main() {
 		}
 		fmt.Printf("Plan by priority (top 5): %v\n", list)
 		fmt.Println("Dry run complete. No files were copied.")
-		return
+		summary.ExitReason = "dry-run"
+		return nil
 	}
 
-	// Copy concurrently
-	w := *workers
-	if w <= 0 {
-		w = runtime.NumCPU()
+	// Incremental and mirrored runs change a backup that is meant to stay as
+	// it is, so overwriting or deleting there needs consent from someone at
+	// the terminal; anywhere else a refreshed copy is the point of the run.
+	if (changes.Updated > 0 || changes.Deleted > 0) && (*incremental || *mirror) && !*assumeYes {
+		ok, err := confirmChanges(tui, changes)
+		if err != nil || !ok {
+			fmt.Println("Aborted: no files were changed.")
+			summary.ExitReason = "aborted"
+			return err
+		}
+	}
+
+	if archiveOut != nil && *archiveSplit == "tier" {
+		archiveOut.splitByTier(selected)
 	}
-	if w < 1 {
+
+	if *readOrder == "path" {
+		sortByPath(toCopy)
+	}
+
+	// Copy concurrently
+	w := g.workers
+	if w <= 0 && remoteOut != nil {
+		w = remoteWorkers
+	} else if w <= 0 {
+		media := detectMedia(destDir)
+		w = autoWorkers(media)
+		slog.Info("Destination media", "media", media, "workers", w)
+	}
+	if w < 1 || archiveOut != nil {
 		w = 1
 	}
-	fmt.Printf("Starting copy with %d worker(s)...\n", w)
-	start := time.Now()
-	copied, errorsN := copyAll(ctx, toCopy, manifestPath, w, tui)
-	fmt.Printf("Copy complete in %.2fs: copied=%d, skipped=%d, errors=%d\n", time.Since(start).Seconds(), copied, skippedExisting, errorsN)
+	slog.Info("Starting copy", "workers", w)
+	start := clk.Now()
+	var copied, errorsN int
+	var copiedBytes int64
+	if *span {
+		copied, errorsN, copiedBytes = copySpanned(ctx, toCopy, usbRoot, destDir, *reserve, w, tui)
+	} else {
+		copied, errorsN, copiedBytes = copyAll(ctx, toCopy, manifestPath, w, tui)
+	}
+	releaseSnapshots()
+	if err := archiveOut.Close(); err != nil {
+		slog.Warn("failed to finish archive", "error", err)
+		errorsN++
+	}
+	if dedupStore != nil {
+		if err := sums.Save(); err != nil {
+			slog.Warn("failed to save checksum cache", "error", err)
+		}
+	}
+	slog.Info("Copy complete", "duration", since(start), "copied", copied, "skipped", skippedExisting, "errors", errorsN, "bytes", copiedBytes)
+	summary.Copied, summary.CopiedBytes, summary.Errors = copied, copiedBytes, errorsN
+	if dirHashEnabled && ctx.Err() == nil && errorsN == 0 {
+		if err := saveDirHashes(metaPath(destDir, dirHashName), files, selected); err != nil {
+			slog.Warn("failed to save directory hashes", "error", err)
+		}
+	}
+	if len(linkGroups) > 0 && ctx.Err() == nil {
+		recs := recreateHardlinks(selected, linkGroups, sources, destDir)
+		linked, recorded := 0, 0
+		for _, r := range recs {
+			switch {
+			case r.Status == "error":
+				slog.Warn("hardlink failed", "file", r.Src, "error", r.Message)
+			case r.Recorded:
+				recorded++
+			default:
+				linked++
+			}
+		}
+		if err := appendManifest(manifestPath, recs); err != nil {
+			slog.Warn("failed to record hardlinks in manifest", "error", err)
+		}
+		fmt.Printf("Linked %d of %d hardlinked names", linked, len(recs))
+		if recorded > 0 {
+			fmt.Printf("; %d recorded in the manifest only (the destination cannot hold hard links)", recorded)
+		}
+		fmt.Println()
+	}
+	if len(dupGroups) > 0 && ctx.Err() == nil {
+		recs := recordAliases(selected, dupGroups, sources, destDir, *linkDups)
+		linked := 0
+		for _, r := range recs {
+			if r.Status == "error" {
+				slog.Warn("duplicate not recorded", "file", r.Src, "error", r.Message)
+			} else if r.Dedup == "link" {
+				linked++
+			}
+		}
+		if err := appendManifest(manifestPath, recs); err != nil {
+			slog.Warn("failed to record duplicates in manifest", "error", err)
+		}
+		fmt.Printf("Recorded %d duplicates as aliases", len(recs))
+		if *linkDups {
+			fmt.Printf("; %d linked to their kept copy", linked)
+			if linked < len(recs) {
+				fmt.Printf(" (the destination cannot hold hard links, or some failed)")
+			}
+		}
+		fmt.Println()
+	}
+	if preserveSymlinks && ctx.Err() == nil && len(scanSymlinks) > 0 {
+		recs := recreateSymlinks(scanSymlinks, sources, destDir)
+		created, recorded := 0, 0
+		for _, r := range recs {
+			if r.Status == "symlink" && r.Recorded {
+				recorded++
+			} else if r.Status == "symlink" {
+				created++
+			} else if r.Status == "error" {
+				slog.Warn("symlink failed", "file", r.Src, "error", r.Message)
+			}
+		}
+		if err := appendManifest(manifestPath, recs); err != nil {
+			slog.Warn("failed to record symlinks in manifest", "error", err)
+		}
+		fmt.Printf("Recreated %d of %d symlinks\n", created, len(recs))
+		if recorded > 0 {
+			fmt.Printf("The destination cannot hold symlinks; %d were recorded in the manifest for restore\n", recorded)
+		}
+	}
+	if len(extraneous) > 0 && ctx.Err() == nil {
+		recs := deleteExtraneous(extraneous, destDir)
+		deleted := 0
+		for _, r := range recs {
+			if r.Status == "deleted" {
+				deleted++
+			} else {
+				slog.Warn("mirror could not delete", "file", r.Dst, "error", r.Message)
+			}
+		}
+		if err := appendManifest(manifestPath, recs); err != nil {
+			slog.Warn("failed to record deletions in manifest", "error", err)
+		}
+		fmt.Printf("Mirror: deleted %d files\n", deleted)
+	}
+	if includeEmptyDirs && ctx.Err() == nil {
+		created := 0
+		for _, d := range scanEmptyDirs {
+			dst := filepath.Join(destDir, relativeDestPath(d, sources))
+			if _, err := os.Stat(dst); err == nil {
+				continue
+			}
+			if err := os.MkdirAll(dst, 0o755); err == nil {
+				created++
+			}
+		}
+		fmt.Printf("Created %d empty directories\n", created)
+	}
+	if remoteOut == nil {
+		updateCatalog(usbRoot)
+	}
+	if *treeDepth >= 0 {
+		if root, err := buildDestTree(destDir); err == nil {
+			renderTree(os.Stdout, root, *treeDepth)
+		}
+	}
+	switch {
+	case ctx.Err() != nil:
+		summary.ExitReason = "cancelled"
+	case errorsN > 0:
+		summary.ExitReason = "completed-with-errors"
+	}
+	if *watch && ctx.Err() == nil {
+		// The initial pass closed the TUI; watch batches log plain lines.
+		noProgress = true
+		minPr := 0
+		for i, f := range selected {
+			if i == 0 || f.Priority < minPr {
+				minPr = f.Priority
+			}
+		}
+		notify("Initial backup finished", fmt.Sprintf("Copied %d files (%s); now watching for changes", copied, humanSize(copiedBytes)))
+		filter := watchFilter{tiers: tiers, excludes: excludes, autoExclude: autoExclude, minPriority: minPr, ignore: newIgnorer(ignoreFileNames)}
+		if err := watchSources(ctx, sources, destDir, manifestPath, w, *watchDebounce, *reserve, filter); err != nil {
+			return fmt.Errorf("watch: %w", err)
+		}
+	}
+	return nil
+}
+
+func nativeEOL() string {
+	if runtime.GOOS == "windows" {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+func parseLineEndings(mode string) (string, error) {
+	switch strings.ToLower(mode) {
+	case "", "native":
+		return nativeEOL(), nil
+	case "lf":
+		return "\n", nil
+	case "crlf":
+		return "\r\n", nil
+	}
+	return "", fmt.Errorf("invalid --line-endings %q (want native|lf|crlf)", mode)
 }
 
 func defaultHome() string {
@@ -289,7 +1324,13 @@ func defaultHome() string {
 	return "/"
 }
 
+// usbRootOverride is set by --usb-root.
+var usbRootOverride string
+
 func usbRoot() (string, error) {
+	if usbRootOverride != "" {
+		return usbRootOverride, nil
+	}
 	exe, err := os.Executable()
 	if err != nil {
 		return "", err
@@ -305,6 +1346,15 @@ func usableFreeSpace(path string, reserve int64) int64 {
 	return getUnixFreeSpace(path, reserve)
 }
 
+// diskSpace reports bytes available to this user and raw free bytes on the
+// volume holding path. They differ when a user quota applies.
+func diskSpace(path string) (int64, int64) {
+	if runtime.GOOS == "windows" {
+		return getWindowsDiskSpace(path)
+	}
+	return getUnixDiskSpace(path)
+}
+
 func loadImportanceProfile(path string) ([]Tier, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -313,10 +1363,20 @@ func loadImportanceProfile(path string) ([]Tier, error) {
 	defer f.Close()
 	var raw struct {
 		Tiers []Tier `json:"tiers"`
+		// Score optionally replaces tier priorities; see score.go.
+		Score string `json:"score,omitempty"`
 	}
 	if err := json.NewDecoder(f).Decode(&raw); err != nil {
 		return defaultProfile(), err
 	}
+	scoreRule = nil
+	if strings.TrimSpace(raw.Score) != "" {
+		rule, err := compileScore(raw.Score)
+		if err != nil {
+			return defaultProfile(), err
+		}
+		scoreRule = rule
+	}
 	sort.Slice(raw.Tiers, func(i, j int) bool { return raw.Tiers[i].Priority > raw.Tiers[j].Priority })
 	return raw.Tiers, nil
 }
@@ -329,7 +1389,7 @@ func defaultProfile() []Tier {
 		{Name: "Audio", Priority: 60, Patterns: []string{"*.mp3", "*.m4a", "*.flac", "*.wav", "*.aac", "*.ogg"}},
 		{Name: "Videos", Priority: 50, Patterns: []string{"*.mp4", "*.mov", "*.avi", "*.mkv", "*.webm"}},
 		{Name: "Archives", Priority: 40, Patterns: []string{"*.zip", "*.tar", "*.gz", "*.bz2", "*.xz", "*.7z", "*.rar"}},
-		{Name: "Everything else", Priority: 10, Patterns: []string{"*"}},
+		// Anything unmatched falls through to the built-in classification (see classify.go).
 	}
 }
 
@@ -348,6 +1408,34 @@ func splitNonEmpty(s string) []string {
 	return out
 }
 
+// parseSize parses a byte count with an optional binary unit suffix:
+// 1048576, 512K, 100MB, 2G, 1.5TiB.
+func parseSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "B"), "I")
+	mult := float64(1)
+	if t != "" {
+		switch t[len(t)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			t = t[:len(t)-1]
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * mult), nil
+}
+
 func humanSize(n int64) string {
 	units := []string{"B", "KB", "MB", "GB", "TB"}
 	i := 0
@@ -359,16 +1447,30 @@ func humanSize(n int64) string {
 	return fmt.Sprintf("%.2f %s", x, units[i])
 }
 
-func scanSources(ctx context.Context, sources []string, tiers []Tier, excludes []string, autoExcludeRoot string, tui *TUI) []FileInfoRec {
+func scanSources(ctx context.Context, sources []string, tiers []Tier, excludes []string, autoExclude []string, tui *TUI, ckpt *scanCheckpointer, hasher *scanHasher, idx *scanIndex) []FileInfoRec {
 	if len(tiers) == 0 {
 		tiers = defaultProfile()
 	}
-	autoExcludeRoot, _ = filepath.Abs(autoExcludeRoot)
 	var out []FileInfoRec
 	lowers := lowerAll(excludes)
 	// progress counters for scan
 	var scanned int64
-	lastReport := time.Now()
+	lastReport := clk.Now()
+	// resumable scan state
+	var doneSources []string
+	var resumeStack []string
+	resumeFrom := ""
+	if ckpt != nil && ckpt.resumed != nil {
+		out = append(out, ckpt.resumed.Files...)
+		doneSources = append(doneSources, ckpt.resumed.Done...)
+		resumeFrom, resumeStack = ckpt.resumed.Current, ckpt.resumed.Stack
+		scanned = int64(len(out))
+		slog.Info("Resuming scan from checkpoint", "files", len(out))
+	}
+	completed := false
+	defer func() { ckpt.Finish(completed) }()
+	followed := map[string]bool{}
+	ign := newIgnorer(ignoreFileNames)
 	for _, src := range sources {
 		select {
 		case <-ctx.Done():
@@ -383,18 +1485,48 @@ func scanSources(ctx context.Context, sources []string, tiers []Tier, excludes [
 			continue
 		}
 		absSrc, _ := filepath.Abs(src)
-		if prefixOf(absSrc, autoExcludeRoot) {
-			fmt.Printf("Auto-excluded (USB): %s\n", src)
+		if anyPrefixOf(absSrc, autoExclude) || anyPrefixOf(canonicalPath(absSrc), autoExclude) {
+			slog.Info("Auto-excluded (USB)", "source", src)
 			continue
 		}
+		if containsString(doneSources, absSrc) {
+			continue
+		}
+		idx.Begin(absSrc)
+		ign.AddRoot(absSrc)
 		stack := []string{absSrc}
+		if absSrc == resumeFrom && len(resumeStack) > 0 {
+			stack = append([]string(nil), resumeStack...)
+		}
 		for len(stack) > 0 {
+			ckpt.Maybe(func() scanCheckpoint {
+				return scanCheckpoint{
+					Sources:  sources,
+					Excludes: excludes,
+					Done:     append([]string(nil), doneSources...),
+					Current:  absSrc,
+					Stack:    append([]string(nil), stack...),
+					Files:    out[:len(out):len(out)],
+				}
+			})
 			cur := stack[len(stack)-1]
 			stack = stack[:len(stack)-1]
-			entries, err := os.ReadDir(cur)
+			entries, err := idx.List(cur)
 			if err != nil {
 				continue
 			}
+			if includeEmptyDirs && len(entries) == 0 && cur != absSrc {
+				scanEmptyDirs = append(scanEmptyDirs, cur)
+			}
+			rollup := newDirRollup()
+			// A freshly changed directory (new download, extracted archive)
+			// signals importance even when its files keep old mtimes.
+			dirBoost := 0
+			if recentDirBoost != 0 {
+				if dst, err := os.Stat(cur); err == nil && since(dst.ModTime()) <= recentDirWindow {
+					dirBoost = recentDirBoost
+				}
+			}
 			for _, e := range entries {
 				select {
 				case <-ctx.Done():
@@ -404,44 +1536,84 @@ func scanSources(ctx context.Context, sources []string, tiers []Tier, excludes [
 					return out
 				default:
 				}
-				name := e.Name()
+				name := e.Name
 				full := filepath.Join(cur, name)
-				if e.IsDir() {
+				if e.Kind == 'd' {
 					if _, skip := excludedDirNames[name]; skip {
 						continue
 					}
 					if matchAny(full, excludes) {
 						continue
 					}
+					if containsString(autoExclude, full) || ign.Ignored(full, true) {
+						continue
+					}
 					stack = append(stack, full)
 				} else {
-					if (e.Type() & fs.ModeSymlink) != 0 {
+					size, mtime := e.Size, time.Unix(0, e.MTime)
+					if ign.Ignored(full, false) {
 						continue
 					}
-					info, err := e.Info()
-					if err != nil {
-						continue
+					if e.Kind == 'l' {
+						if preserveSymlinks && !matchAny(strings.ToLower(full), lowers) {
+							scanSymlinks = append(scanSymlinks, full)
+						}
+						if !followSymlinks {
+							continue
+						}
+						target, err := os.Stat(full)
+						if err != nil {
+							continue // dangling
+						}
+						if target.IsDir() {
+							if !matchAny(full, excludes) && !ign.Ignored(full, true) && followLinkedDir(full, cur, followed, autoExclude) {
+								stack = append(stack, full)
+							}
+							continue
+						}
+						if !target.Mode().IsRegular() {
+							continue
+						}
+						size, mtime = target.Size(), target.ModTime()
 					}
-					if !info.Mode().IsRegular() {
+					if matchAny(strings.ToLower(full), lowers) || !scanLimits.keep(size, mtime) {
 						continue
 					}
-					if matchAny(strings.ToLower(full), lowers) {
-						continue
+					tier, pr := classifyFile(contentPath(full), tiers)
+					pr += dirBoost
+					if scoreRule != nil {
+						pr = scoreRule.Priority(contentPath(full), tier, pr, size, mtime)
 					}
-					pr := priorityFor(full, tiers)
-					out = append(out, FileInfoRec{Path: full, Size: info.Size(), MTime: info.ModTime(), Priority: pr})
+					rec := FileInfoRec{Path: full, Size: size, MTime: mtime, Priority: pr, Tier: tier}
+					rollup.Add(name, size, mtime.UnixNano())
+					out = append(out, rec)
+					hasher.Submit(rec)
 					scanned++
-					if tui != nil && time.Since(lastReport) > 500*time.Millisecond {
+					if (tui != nil || progressEvents != nil) && since(lastReport) > 500*time.Millisecond {
 						tui.AppendLog(fmt.Sprintf("Scanning: %d files found...", scanned))
-						lastReport = time.Now()
+						progressEvents.Emit(progressEvent{Event: "scan_progress", Path: cur, Files: scanned})
+						lastReport = clk.Now()
 					}
 				}
 			}
+			rollup.Finish(cur)
 		}
+		idx.End()
+		doneSources = append(doneSources, absSrc)
 	}
+	completed = true
 	return out
 }
 
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func lowerAll(in []string) []string {
 	out := make([]string, len(in))
 	for i, s := range in {
@@ -453,39 +1625,172 @@ func lowerAll(in []string) []string {
 func matchAny(path string, patterns []string) bool {
 	p := path
 	for _, pat := range patterns {
-		if ok, _ := filepath.Match(pat, p); ok {
+		if globMatch(pat, p) {
 			return true
 		}
 	}
-	return false
+	return false
+}
+
+// classifyFile returns the name and priority of the first tier matching path,
+// or the built-in category when no tier does.
+func classifyFile(path string, tiers []Tier) (string, int) {
+	p := strings.ToLower(path)
+	for _, t := range tiers {
+		for _, pat := range t.Patterns {
+			if globMatch(strings.ToLower(pat), p) {
+				return t.Name, t.Priority
+			}
+		}
+	}
+	c := builtinCategory(path)
+	return builtinTierPrefix + c, fallbackPriority(c, tiers)
+}
+
+// selectAllIfFits short-circuits selection when everything fits: with no
+// per-tier caps the result is simply every non-empty file, ordered by
+// priority and otherwise in scan order, so the per-tier sorts are skipped.
+func selectAllIfFits(files []FileInfoRec, capacity int64, caps map[string]tierCap) ([]FileInfoRec, int64, bool) {
+	if len(caps) > 0 {
+		return nil, 0, false
+	}
+	var total int64
+	n := 0
+	for _, f := range files {
+		if f.Size >= 0 {
+			total += f.Size
+			n++
+		}
+	}
+	if total > capacity {
+		return nil, 0, false
+	}
+	all := make([]FileInfoRec, 0, n)
+	for _, f := range files {
+		if f.Size >= 0 {
+			all = append(all, f)
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Priority > all[j].Priority })
+	return all, total, true
+}
+
+// tierCap limits how much of one tier is selected; zero fields are unlimited.
+type tierCap struct {
+	Files int
+	Bytes int64
+}
+
+func (c tierCap) String() string {
+	var parts []string
+	if c.Files > 0 {
+		parts = append(parts, fmt.Sprintf("at most %d files", c.Files))
+	}
+	if c.Bytes > 0 {
+		parts = append(parts, "at most "+humanSize(c.Bytes))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// tierCaps collects the max_files, max_bytes and max_percent limits
+// configured in the profile, with percentages taken of capacity.
+func tierCaps(tiers []Tier, capacity int64) map[string]tierCap {
+	caps := map[string]tierCap{}
+	for _, t := range tiers {
+		c := tierCap{Files: t.MaxFiles, Bytes: int64(t.MaxBytes)}
+		if t.MaxPercent > 0 {
+			if b := int64(float64(capacity) * t.MaxPercent / 100); c.Bytes <= 0 || b < c.Bytes {
+				c.Bytes = b
+			}
+		}
+		if c.Files > 0 || c.Bytes > 0 {
+			caps[t.Name] = c
+		}
+	}
+	return caps
+}
+
+// tierUsage tracks how much of each capped tier has been selected. An atomic
+// folder entry (see atomicdirs.go) is charged to the tiers of its files.
+type tierUsage struct {
+	caps   map[string]tierCap
+	units  map[string][]FileInfoRec
+	counts map[string]int
+	sizes  map[string]int64
+	capped []string
+}
+
+func newTierUsage(caps map[string]tierCap, units map[string][]FileInfoRec) *tierUsage {
+	return &tierUsage{caps: caps, units: units, counts: map[string]int{}, sizes: map[string]int64{}}
+}
+
+// members returns the files f stands for: itself, or an atomic folder's files.
+func (u *tierUsage) members(f FileInfoRec) []FileInfoRec {
+	if m, ok := u.units[f.Path]; ok {
+		return m
+	}
+	return []FileInfoRec{f}
+}
+
+// fits reports whether taking f keeps every tier within its cap, and records
+// the tiers that would overflow as capped.
+func (u *tierUsage) fits(f FileInfoRec) bool {
+	if len(u.caps) == 0 {
+		return true
+	}
+	n := map[string]int{}
+	b := map[string]int64{}
+	for _, m := range u.members(f) {
+		n[m.Tier]++
+		b[m.Tier] += m.Size
+	}
+	ok := true
+	for tier := range n {
+		c, capped := u.caps[tier]
+		if !capped {
+			continue
+		}
+		if (c.Files > 0 && u.counts[tier]+n[tier] > c.Files) || (c.Bytes > 0 && u.sizes[tier]+b[tier] > c.Bytes) {
+			if !containsString(u.capped, tier) {
+				u.capped = append(u.capped, tier)
+			}
+			ok = false
+		}
+	}
+	return ok
 }
 
-func priorityFor(path string, tiers []Tier) int {
-	p := strings.ToLower(path)
-	base := strings.ToLower(filepath.Base(path))
-	for _, t := range tiers {
-		for _, pat := range t.Patterns {
-			pl := strings.ToLower(pat)
-			if ok, _ := filepath.Match(pl, base); ok {
-				return t.Priority
-			}
-			if ok, _ := filepath.Match(pl, p); ok {
-				return t.Priority
-			}
-		}
+// add charges f to its tiers.
+func (u *tierUsage) add(f FileInfoRec) {
+	if len(u.caps) == 0 {
+		return
+	}
+	for _, m := range u.members(f) {
+		u.counts[m.Tier]++
+		u.sizes[m.Tier] += m.Size
 	}
-	return 0
 }
 
-func selectFiles(files []FileInfoRec, capacity int64, objective string) ([]FileInfoRec, int64) {
+// selectFiles greedily fills capacity tier by tier. Tiers named in caps stop
+// taking files once they reach their file limit, and skip files that would
+// take them past their size limit; those tiers are returned as capped. units
+// holds the files of atomic folder entries, or is nil.
+func selectFiles(files []FileInfoRec, capacity int64, objective string, caps map[string]tierCap, units map[string][]FileInfoRec) ([]FileInfoRec, int64, []string) {
+	if all, used, ok := selectAllIfFits(files, capacity, caps); ok {
+		return all, used, nil
+	}
+	if objective == "value" {
+		return selectByValue(files, capacity, caps, units)
+	}
 	byPr := map[int][]FileInfoRec{}
 	for _, f := range files {
-		if f.Size > 0 {
+		if f.Size >= 0 {
 			byPr[f.Priority] = append(byPr[f.Priority], f)
 		}
 	}
 	var selected []FileInfoRec
 	var used int64
+	usage := newTierUsage(caps, units)
 	var prs []int
 	for p := range byPr {
 		prs = append(prs, p)
@@ -493,23 +1798,267 @@ func selectFiles(files []FileInfoRec, capacity int64, objective string) ([]FileI
 	sort.Slice(prs, func(i, j int) bool { return prs[i] > prs[j] })
 	for _, pr := range prs {
 		items := byPr[pr]
-		if objective == "count" {
+		switch objective {
+		case "count":
 			sort.Slice(items, func(i, j int) bool { return items[i].Size < items[j].Size })
-		} else {
+		case "priority":
+			// Size plays no part: within a tier files go in path order, so a
+			// folder is taken front to back as far as space allows.
+			sort.Slice(items, func(i, j int) bool { return items[i].Path < items[j].Path })
+		default:
 			sort.Slice(items, func(i, j int) bool { return items[i].Size > items[j].Size })
 		}
+		if recentPhotosFirst {
+			// Dated photos go first, newest first; the rest keep the
+			// objective's order behind them.
+			sort.SliceStable(items, func(i, j int) bool { return items[i].Taken.After(items[j].Taken) })
+		}
 		for _, f := range items {
+			if !usage.fits(f) {
+				continue
+			}
 			if used+f.Size <= capacity {
 				selected = append(selected, f)
 				used += f.Size
+				usage.add(f)
+			}
+		}
+	}
+	return selected, used, usage.capped
+}
+
+// skipRecentlyBackedUp drops files whose last successful copy is after since.
+// This is a coarse throttle: changes made inside the window are not noticed.
+func skipRecentlyBackedUp(files []FileInfoRec, last map[string]time.Time, since time.Time) ([]FileInfoRec, int) {
+	out := files[:0]
+	skipped := 0
+	for _, f := range files {
+		if ts, ok := last[f.Path]; ok && ts.After(since) {
+			skipped++
+			continue
+		}
+		out = append(out, f)
+	}
+	return out, skipped
+}
+
+// skipUnchanged drops files whose size and mtime match their last backup
+// record (--incremental) and returns those records. With --hash-skip, a
+// file whose mtime moved but whose content still matches the recorded
+// checksum is unchanged as well.
+func skipUnchanged(files []FileInfoRec, last map[string]ManifestRec, sums *checksumCache) ([]FileInfoRec, []ManifestRec) {
+	out := files[:0]
+	var skipped []ManifestRec
+	for _, f := range files {
+		if rec, ok := last[f.Path]; ok && rec.Size == f.Size {
+			if rec.MTime == f.MTime.Unix() {
+				skipped = append(skipped, rec)
+				continue
+			}
+			if algo, want, ok := splitChecksum(rec.Checksum); ok && sums != nil {
+				if sum, err := sumWith(sums, f.Path, f.Size, f.MTime, algo); err == nil && sum == want {
+					skipped = append(skipped, rec)
+					continue
+				}
+			}
+		}
+		out = append(out, f)
+	}
+	return out, skipped
+}
+
+// upToDate reports whether an existing destination file can be skipped.
+func upToDate(sums *checksumCache, src, dst string, sst, dst0 os.FileInfo) bool {
+	if dst != strings.TrimSuffix(strings.TrimSuffix(dst, encExt), zstdExt) {
+		return transformedUpToDate(sst, dst0)
+	}
+	return sst.Size() == dst0.Size() && !deltaChanged(sst, dst0) && sameContent(sums, src, dst)
+}
+
+// sameContent reports whether a same-size destination file can be skipped.
+// Without a checksum cache size equality is trusted; with one the contents
+// must hash identically.
+func sameContent(sums *checksumCache, src, dst string) bool {
+	if sums == nil {
+		return true
+	}
+	a, err := sums.SumStat(src)
+	if err != nil {
+		return false
+	}
+	b, err := sums.SumStat(dst)
+	return err == nil && a == b
+}
+
+// changeSummary counts what a run will do to files already on the destination.
+type changeSummary struct {
+	New, Updated, Deleted                int
+	NewBytes, UpdatedBytes, DeletedBytes int64
+}
+
+func (c changeSummary) String() string {
+	return fmt.Sprintf("New:     %d files, %s\nUpdated: %d files, %s\nDeleted: %d files, %s",
+		c.New, humanSize(c.NewBytes), c.Updated, humanSize(c.UpdatedBytes), c.Deleted, humanSize(c.DeletedBytes))
+}
+
+// selectOptions are the backup flags that shape selection.
+type selectOptions struct {
+	objective    string
+	atomicDirs   []string
+	atomicMarker string
+	review       bool
+}
+
+// selectPhase picks the files to back up within budget, honouring the
+// per-tier caps and taking atomic folders whole or not at all, then lets
+// the user adjust the result with --review. ok is false when the run was
+// abandoned at review.
+func selectPhase(files []FileInfoRec, sources []string, tiers []Tier, budget int64, o selectOptions, tui *TUI) (selected []FileInfoRec, used int64, ok bool) {
+	caps := tierCaps(tiers, budget)
+	candidates := files
+	var units map[string][]FileInfoRec
+	if len(o.atomicDirs) > 0 || o.atomicMarker != "" {
+		candidates, units = atomicUnits(files, sources, o.atomicDirs, o.atomicMarker)
+		fmt.Printf("Atomic folders: %d, selected whole or not at all\n", len(units))
+	}
+	selected, used, capped := selectFiles(candidates, budget, o.objective, caps, units)
+	if units != nil {
+		chosen := make(map[string]bool, len(selected))
+		for _, f := range selected {
+			chosen[f.Path] = true
+		}
+		for _, f := range candidates {
+			if _, ok := units[f.Path]; ok && !chosen[f.Path] {
+				fmt.Printf("Atomic folder %s (%d files, %s) was not selected\n", f.Path, len(units[f.Path]), humanSize(f.Size))
+			}
+		}
+		selected = expandAtomicUnits(selected, units)
+	}
+	fmt.Printf("Selected %d files totalling %s (objective: %s)\n", len(selected), humanSize(used), o.objective)
+	for _, name := range capped {
+		fmt.Printf("Tier %q reached its cap (%s); remaining files were not selected\n", name, caps[name])
+	}
+	if o.review {
+		tree := newReviewTree(files, selected, sources, budget)
+		if !tui.Review(tree) {
+			return nil, 0, false
+		}
+		selected, used = tree.Selected()
+		fmt.Printf("Reviewed selection: %d files totalling %s\n", len(selected), humanSize(used))
+	}
+	return selected, used, true
+}
+
+// pendingChanges compares the planned [src, dst] pairs with the
+// destination. Up-to-date files, and with --dir-hash every file of an
+// unchanged directory, are skipped; the rest are returned to copy and
+// counted as new or updated in changes.
+func pendingChanges(plans [][2]string, destDir string, skipSums *checksumCache) (toCopy [][2]string, skipped, unchangedDirs int, changes changeSummary) {
+	toCopy = make([][2]string, 0, len(plans))
+	var prevDirHashes map[string]string
+	if dirHashEnabled {
+		prevDirHashes = loadDirHashes(metaPath(destDir, dirHashName))
+	}
+	for _, p := range plans {
+		src, dst := p[0], p[1]
+		if d := filepath.Dir(src); prevDirHashes != nil && prevDirHashes[d] != "" && prevDirHashes[d] == scanDirHashes[d] {
+			skipped++
+			unchangedDirs++
+			continue
+		}
+		sst, serr := os.Stat(src)
+		if st, err := statDest(dst); err == nil {
+			if st.Mode().IsRegular() {
+				if serr == nil && upToDate(skipSums, src, dst, sst, st) {
+					touchOnSkip(dst, sst)
+					skipped++
+					continue
+				}
+				changes.Updated++
+				changes.UpdatedBytes += safeSize(sst)
 			}
+		} else {
+			changes.New++
+			changes.NewBytes += safeSize(sst)
+		}
+		toCopy = append(toCopy, p)
+	}
+	return toCopy, skipped, unchangedDirs, changes
+}
+
+// mirrorExtraneous lists the files in destDir a --mirror run deletes, with
+// their total size: everything but the plans, recreated symlinks and the
+// extra names of hard links and (with --link-duplicates) duplicates.
+func mirrorExtraneous(plans [][2]string, selected []FileInfoRec, sources []string, destDir string, linkGroups, dupGroups map[string][]string, linkDups bool) ([]string, int64) {
+	keep := mirrorKeep(plans, scanSymlinks, sources, destDir)
+	for _, f := range selected {
+		primaryPlain := filepath.Join(destDir, relativeDestPath(f.Path, sources))
+		for _, src := range linkGroups[f.Path] {
+			_, stored := linkedDst(src, sources, destDir, primaryPlain, storedPath(f.Path, primaryPlain))
+			keep[stored] = true
+		}
+		if !linkDups {
+			continue
+		}
+		for _, src := range dupGroups[f.Path] {
+			_, stored := linkedDst(src, sources, destDir, primaryPlain, storedPath(f.Path, primaryPlain))
+			keep[stored] = true
+		}
+	}
+	return findExtraneous(destDir, keep)
+}
+
+// confirmChanges shows the change summary and asks whether to go ahead, using
+// the TUI when it is running and stdin otherwise. Unattended runs never wait
+// for an answer: without a terminal to ask it is an error.
+func confirmChanges(tui *TUI, c changeSummary) (bool, error) {
+	if !stdinIsTerminal() {
+		return false, fmt.Errorf("refusing to overwrite or delete existing files without confirmation; re-run with --yes")
+	}
+	text := "This run will modify the existing backup:\n\n" + c.String()
+	if ok, shown := tui.Confirm(text); shown {
+		return ok, nil
+	}
+	fmt.Println(text)
+	fmt.Print("Continue? [y/N] ")
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// stdinIsTerminal reports whether someone can answer a prompt. /dev/null, as
+// given to scheduled runs, is a character device but not a terminal.
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// dominantFile returns the largest selected file when it alone consumes more
+// than frac of capacity. The greedy space objective happily spends most of the
+// budget on one huge file, squeezing out many small important ones.
+func dominantFile(selected []FileInfoRec, capacity int64, frac float64) (FileInfoRec, bool) {
+	if frac <= 0 || capacity <= 0 {
+		return FileInfoRec{}, false
+	}
+	var big FileInfoRec
+	for _, f := range selected {
+		if f.Size > big.Size {
+			big = f
 		}
 	}
-	return selected, used
+	if float64(big.Size) > frac*float64(capacity) {
+		return big, true
+	}
+	return FileInfoRec{}, false
 }
 
 func relativeDestPath(src string, bases []string) string {
 	srcAbs, _ := filepath.Abs(src)
+	if rel, ok := photoDests[srcAbs]; ok {
+		return rel
+	}
 	best := ""
 	for _, b := range bases {
 		bAbs, _ := filepath.Abs(expandPath(b))
@@ -527,6 +2076,15 @@ func relativeDestPath(src string, bases []string) string {
 	return rel
 }
 
+func anyPrefixOf(path string, bases []string) bool {
+	for _, b := range bases {
+		if prefixOf(path, b) {
+			return true
+		}
+	}
+	return false
+}
+
 func prefixOf(path, base string) bool {
 	if path == base {
 		return true
@@ -545,21 +2103,26 @@ func prefixOf(path, base string) bool {
 	return false
 }
 
-func copyAll(ctx context.Context, pairs [][2]string, manifestPath string, workers int, tui *TUI) (int, int) {
+func copyAll(ctx context.Context, pairs [][2]string, manifestPath string, workers int, tui *TUI) (int, int, int64) {
 	jobs := make(chan [2]string, workers*2)
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	copied := 0
 	errorsN := 0
-	// Compute total bytes to copy
+	// Compute total bytes to copy; remember each file's planned size so the
+	// total can be corrected once the file's real outcome is known.
 	var totalBytes int64
+	planned := make(map[string]int64, len(pairs))
 	for _, p := range pairs {
 		if st, err := os.Stat(p[0]); err == nil {
 			totalBytes += st.Size()
+			planned[p[0]] = st.Size()
 		}
 	}
+	progressEvents.Emit(progressEvent{Event: "copy_start", Files: int64(len(pairs)), Bytes: totalBytes})
 	// Progress aggregator
-	agg := &progressAgg{total: totalBytes, start: time.Now()}
+	agg := &progressAgg{total: totalBytes, start: clk.Now()}
+	beginTuning(filepath.Dir(manifestPath), agg)
 	// UI / ticker setup
 	stopCh := make(chan struct{})
 	interactive := !noProgress && isTTY()
@@ -612,18 +2175,19 @@ func copyAll(ctx context.Context, pairs [][2]string, manifestPath string, worker
 					return
 				case <-ticker.C:
 					done := agg.Done()
-					elapsed := time.Since(agg.start).Seconds()
+					elapsed := activeSince(agg.start).Seconds()
 					speed := float64(0)
 					if elapsed > 0 {
 						speed = float64(done) / elapsed
 					}
-					remaining := agg.total - done
+					total := agg.Total()
+					remaining := total - done
 					eta := "--:--:--"
 					if speed > 1 {
 						eta = formatETA(float64(remaining) / speed)
 					}
 					mu.Lock()
-					fmt.Printf("[TOTAL] %s / %s (%.1f%%) | %s/s | ETA %s\n", humanSize(done), humanSize(agg.total), percent(done, agg.total), humanSize(int64(speed)), eta)
+					fmt.Printf("[TOTAL] %s / %s (%.1f%%) | %s/s | ETA %s\n", humanSize(done), humanSize(total), percent(done, total), humanSize(int64(speed)), eta)
 					mu.Unlock()
 				}
 			}
@@ -632,23 +2196,27 @@ func copyAll(ctx context.Context, pairs [][2]string, manifestPath string, worker
 	mf, err := os.OpenFile(manifestPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
 	if err != nil {
 		// Log error but continue - manifest is optional
-		fmt.Fprintf(os.Stderr, "warning: failed to open manifest file: %v\n", err)
-		return copied, errorsN
+		slog.Warn("failed to open manifest file", "error", err)
+		return copied, errorsN, 0
 	}
-	mw := bufio.NewWriter(mf)
+	mw := newManifestWriter(mf, manifestPath+".reserve", manifestReserveSize(len(pairs)))
 	writeManifest := func(rec ManifestRec) {
+		if portablePaths {
+			rec.Src = filepath.ToSlash(rec.Src)
+			rec.Dst = filepath.ToSlash(rec.Dst)
+		}
 		b, err := json.Marshal(rec)
 		if err != nil {
 			// Log JSON marshaling error but continue
-			fmt.Fprintf(os.Stderr, "warning: failed to marshal manifest record: %v\n", err)
+			slog.Warn("failed to marshal manifest record", "error", err)
 			return
 		}
 		if _, err := mw.Write(b); err != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to write manifest: %v\n", err)
+			slog.Warn("failed to write manifest", "error", err)
 			return
 		}
-		if err := mw.WriteByte('\n'); err != nil {
-			fmt.Fprintf(os.Stderr, "warning: failed to write manifest newline: %v\n", err)
+		if _, err := mw.WriteString(manifestEOL); err != nil {
+			slog.Warn("failed to write manifest newline", "error", err)
 			return
 		}
 	}
@@ -656,28 +2224,78 @@ func copyAll(ctx context.Context, pairs [][2]string, manifestPath string, worker
 		defer wg.Done()
 		for p := range jobs {
 			src, dst := p[0], p[1]
+			_ = copyPause.Wait(ctx)
 			select {
 			case <-ctx.Done():
 				// interrupted
+				agg.AddTotal(-planned[src])
 				mu.Lock()
 				errorsN++
-				rec := ManifestRec{Src: src, Dst: dst, Size: 0, MTime: 0, Priority: 0, Status: "cancelled", Message: "interrupted", Ts: float64(time.Now().UnixNano()) / 1e9}
+				rec := ManifestRec{Src: src, Dst: dst, Size: 0, MTime: 0, Priority: 0, Status: "cancelled", Message: "interrupted", Ts: float64(clk.Now().UnixNano()) / 1e9}
 				writeManifest(rec)
 				mu.Unlock()
 				continue
 			default:
 			}
-			status, msg := copyOneWithProgress(ctx, src, dst, agg, &mu, logsCh, interactive)
-			st, _ := os.Stat(src)
+			// With --vss the file is read from its shadow copy.
+			read := snapshotPath(src)
+			fileAgg := &progressAgg{start: clk.Now(), parent: agg}
+			status, msg, info := copyOneWithProgress(ctx, read, dst, fileAgg, &mu, logsCh, interactive)
+			attempt := 1
+			for ; status == "error" && attempt <= copyRetries && ctx.Err() == nil && (isTransient(info.Err) || errors.Is(info.Err, errWriteMismatch)); attempt++ {
+				st, _ := os.Stat(read)
+				wait := retryBackoff(attempt)
+				mu.Lock()
+				writeManifest(ManifestRec{Src: src, Dst: dst, Size: safeSize(st), MTime: safeMTime(st), Status: "retry", Message: msg, Attempt: attempt, Ts: float64(clk.Now().UnixNano()) / 1e9})
+				mu.Unlock()
+				fileLog(logsCh, true, slog.LevelWarn, "copy failed; retrying", "file", src, "error", msg, "wait", wait, "attempt", attempt, "retries", copyRetries)
+				// Bytes of the failed try count as done; keep the total in step.
+				agg.AddTotal(fileAgg.Done())
+				if !sleepCtx(ctx, wait) {
+					break
+				}
+				fileAgg = &progressAgg{start: clk.Now(), parent: agg}
+				status, msg, info = copyOneWithProgress(ctx, read, dst, fileAgg, &mu, logsCh, interactive)
+			}
+			// Skipped, failed or resized files would otherwise leave the bar short of 100%.
+			agg.AddTotal(fileAgg.Done() - planned[src])
+			st, _ := os.Stat(read)
 			mu.Lock()
 			if status == "copied" {
 				copied++
 			} else if status == "error" {
 				errorsN++
 			}
-			rec := ManifestRec{Src: src, Dst: dst, Size: safeSize(st), MTime: safeMTime(st), Priority: 0, Status: status, Message: msg, Ts: float64(time.Now().UnixNano()) / 1e9}
+			rec := ManifestRec{Src: src, Dst: dst, Size: safeSize(st), MTime: safeMTime(st), Priority: 0, Status: status, Message: msg, Ts: float64(clk.Now().UnixNano()) / 1e9}
+			rec.Strategy, rec.Checksum = info.Strategy, info.Checksum
+			if status == "copied" && info.StoredSize > 0 {
+				rec.StoredSize = info.StoredSize
+			}
+			if status == "copied" && shouldCompress(src) {
+				rec.Compression = compressAlgo
+				if info.StoredSize > 0 {
+					rec.Ratio = math.Round(float64(rec.Size)/float64(info.StoredSize)*100) / 100
+				}
+			}
+			if status == "copied" && encryptKey != nil {
+				rec.Encrypted = encryptKey.ID()
+			}
+			if info.Dedup == "ref" {
+				rec.Dst += refExt
+			}
+			rec.Dedup, rec.Parts, rec.Preserved = info.Dedup, info.Parts, info.Preserved
+			if status == "copied" {
+				rec.Archive, rec.Member, rec.Offset = info.Archive, info.Member, info.Offset
+			}
+			if attempt > 1 {
+				rec.Attempt = attempt
+			}
+			if recordDurations && status == "copied" {
+				rec.DurationMs = since(fileAgg.start).Milliseconds()
+			}
 			writeManifest(rec)
 			mu.Unlock()
+			progressEvents.Emit(progressEvent{Event: "file_done", Path: src, Dst: rec.Dst, Size: rec.Size, Bytes: fileAgg.Done(), Status: status, Message: msg})
 		}
 	}
 	for i := 0; i < workers; i++ {
@@ -690,13 +2308,33 @@ func copyAll(ctx context.Context, pairs [][2]string, manifestPath string, worker
 	close(jobs)
 	wg.Wait()
 	close(stopCh)
-	if err := mw.Flush(); err != nil {
-		fmt.Fprintf(os.Stderr, "warning: failed to flush manifest: %v\n", err)
+	if used, err := mw.Close(); err != nil {
+		slog.Warn("failed to flush manifest", "error", err)
+	} else if used {
+		fmt.Println("Destination filled up; the manifest reserve kept the manifest complete")
 	}
 	if err := mf.Close(); err != nil {
-		fmt.Fprintf(os.Stderr, "warning: failed to close manifest file: %v\n", err)
+		slog.Warn("failed to close manifest file", "error", err)
+	}
+	progressEvents.Emit(progressEvent{Event: "copy_done", Files: int64(copied), Bytes: agg.Done(), Errors: errorsN})
+	return copied, errorsN, agg.Done()
+}
+
+// sortByPath orders copy jobs by source path (--read-order path). It changes
+// the dispatch order only; selection is unaffected. Keeping reads from one
+// directory together matches on-disk layout closely enough to cut seeks on
+// spinning or USB sources.
+func sortByPath(pairs [][2]string) {
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+}
+
+// touchOnSkip refreshes a skipped destination file's mtime from its source
+// when --touch-on-skip is set. Same-size files, including two empty ones,
+// are skipped, so without it their mtimes can drift from the source.
+func touchOnSkip(dst string, src os.FileInfo) {
+	if touchSkipped {
+		_ = os.Chtimes(dst, clk.Now(), src.ModTime())
 	}
-	return copied, errorsN
 }
 
 func safeSize(fi os.FileInfo) int64 {
@@ -712,71 +2350,171 @@ func safeMTime(fi os.FileInfo) int64 {
 	return fi.ModTime().Unix()
 }
 
-func copyOneWithProgress(ctx context.Context, src, dst string, agg *progressAgg, mu *sync.Mutex, logsCh chan string, interactive bool) (string, string) {
+// deltaCopyOne is copyOneWithProgress for a file updated by deltaCopy.
+func deltaCopyOne(ctx context.Context, src, dst string, agg *progressAgg, logsCh chan string, plain bool) (string, string, copyInfo) {
+	h := writeHash()
+	info := copyInfo{Strategy: copyDelta}
+	written, err := deltaCopy(ctx, src, dst, agg, h)
+	if err != nil {
+		return "error", err.Error(), info.failed(err)
+	}
+	if err := verifyWritten(dst, 0, h); err != nil {
+		_ = os.Remove(dst)
+		return "error", err.Error(), info.failed(err)
+	}
+	if h != nil {
+		info.Checksum = formatChecksum(checksumAlgo, h)
+	}
+	if preserveMetadata {
+		info.Preserved = preserveOn(src, dst, 0)
+	}
+	msg := fmt.Sprintf("delta: rewrote %s of %s", humanSize(written), humanSize(agg.Done()))
+	fileLog(logsCh, plain, slog.LevelInfo, "Delta", "file", filepath.Base(src), "written", written, "bytes", agg.Done())
+	return "copied", msg, info
+}
+
+// copyInfo describes how a file was copied, for its manifest record.
+type copyInfo struct {
+	Strategy   copyStrategy
+	Checksum   string
+	StoredSize int64  // size on the destination, for compressed or encrypted copies
+	Dedup      string // "link" or "ref" when stored through --dedup
+	Parts      int    // number of parts when the file was split
+	Preserved  []string
+	Archive    string // archive holding the file (--archive)
+	Member     string // its member name there
+	Offset     int64  // offset of its data in a tar archive
+	Err        error  // the failure behind status "error"
+}
+
+func (c copyInfo) failed(err error) copyInfo {
+	c.Err = err
+	return c
+}
+
+func copyOneWithProgress(ctx context.Context, src, dst string, agg *progressAgg, mu *sync.Mutex, logsCh chan string, interactive bool) (string, string, copyInfo) {
+	if archiveOut != nil {
+		return archiveOut.Add(ctx, src, dst, agg, logsCh, !interactive && sampleFileLog())
+	}
+	if remoteOut != nil {
+		if dstSt, err := remoteOut.Stat(dst); err == nil {
+			if srcSt, err := os.Stat(src); err == nil && srcSt.Size() == dstSt.Size() {
+				return "skipped", "exists-same-size", copyInfo{}
+			}
+		}
+		return remoteOut.Upload(ctx, src, dst, agg, logsCh, !interactive && sampleFileLog())
+	}
 	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
-		return "error", err.Error()
+		return "error", err.Error(), copyInfo{}.failed(err)
 	}
-	if dstSt, err := os.Stat(dst); err == nil {
+	if dstSt, err := statDest(dst); err == nil {
 		if srcSt, err2 := os.Stat(src); err2 == nil {
-			if dstSt.Size() == srcSt.Size() {
-				return "skipped", "exists-same-size"
+			if upToDate(nil, src, dst, srcSt, dstSt) {
+				touchOnSkip(dst, srcSt)
+				return "skipped", "exists-same-size", copyInfo{}
 			}
 		}
 	}
+	// Plain per-file lines can be sampled (--log-every) in non-interactive
+	// mode; a file that is not logged is copied as if the UI owned the output.
+	plain := !interactive && sampleFileLog()
+	if dedupStore != nil {
+		return dedupCopy(ctx, src, dst, agg, mu, logsCh, !plain)
+	}
+	_ = os.Remove(dst + deltaExt)
+	if sst, err := os.Stat(src); err == nil {
+		if dst0, err := os.Stat(dst); err == nil && useDelta(src, sst, dst0) {
+			return deltaCopyOne(ctx, src, dst, agg, logsCh, plain)
+		}
+	}
 	tmp := dst + ".part"
-	_ = os.Remove(tmp)
+	// A .part left by an interrupted or failed plain copy is continued
+	// when its content still matches the source.
+	var offset int64
+	if srcSt, err := os.Stat(src); err == nil && resumable(src, srcSt.Size()) {
+		offset = resumeOffset(src, tmp)
+	}
+	if offset == 0 {
+		_ = os.Remove(tmp)
+	}
+	removeParts(tmp)
 	// announce start
-	if logsCh != nil {
-		name := filepath.Base(src)
-		if st, err := os.Stat(src); err == nil {
-			select {
-			case logsCh <- fmt.Sprintf("Start: %s (%s)", name, humanSize(st.Size())):
-			default:
-			}
-		} else {
-			select {
-			case logsCh <- fmt.Sprintf("Start: %s", name):
-			default:
-			}
+	srcSt, _ := os.Stat(src)
+	progressEvents.Emit(progressEvent{Event: "file_start", Path: src, Dst: dst, Size: safeSize(srcSt), Bytes: offset})
+	fileLog(logsCh, plain, slog.LevelInfo, "Start", "file", filepath.Base(src), "bytes", safeSize(srcSt))
+	if offset > 0 {
+		fileLog(logsCh, plain, slog.LevelInfo, "Resume", "file", filepath.Base(src), "offset", offset)
+	}
+	h := writeHash()
+	strategy, err := copyFileWithProgress(ctx, src, tmp, agg, mu, logsCh, !plain, h, offset)
+	info := copyInfo{Strategy: strategy}
+	if err != nil {
+		// The buffered loop trims its .part to the bytes written, so the
+		// next run (or retry) can pick up from there.
+		if strategy != copyBuffered {
+			_ = os.Remove(tmp)
 		}
-	} else if !interactive {
-		fmt.Printf("Start: %s\n", filepath.Base(src))
+		removeParts(tmp)
+		return "error", err.Error(), info.failed(err)
 	}
-	if err := copyFileWithProgress(ctx, src, tmp, agg, mu, logsCh, interactive); err != nil {
-		_ = os.Remove(tmp)
-		return "error", err.Error()
+	if len(storedParts(tmp)) > 0 {
+		srcSt, _ := os.Stat(src)
+		n, err := finishSplit(tmp, dst, srcSt.ModTime())
+		if err != nil {
+			removeParts(tmp)
+			return "error", err.Error(), info.failed(err)
+		}
+		info.Parts = n
+	} else {
+		removeParts(dst)
+		if err := os.Rename(tmp, dst); err != nil {
+			_ = os.Remove(tmp)
+			return "error", err.Error(), info.failed(err)
+		}
 	}
-	if err := os.Rename(tmp, dst); err != nil {
-		_ = os.Remove(tmp)
-		return "error", err.Error()
+	if err := verifyWritten(dst, info.Parts, h); err != nil {
+		// Left in place, the bad copy would be skipped as same-size.
+		_ = os.Remove(dst)
+		removeParts(dst)
+		return "error", err.Error(), info.failed(err)
 	}
-	if logsCh != nil {
-		select {
-		case logsCh <- fmt.Sprintf("Done: %s", filepath.Base(src)):
-		default:
+	fileLog(logsCh, plain, slog.LevelInfo, "Done", "file", filepath.Base(src), "bytes", agg.Done(), "duration", since(agg.start))
+	fileLog(logsCh, plain, levelVerbose, "Strategy", "file", filepath.Base(src), "strategy", strategy)
+	if h != nil {
+		info.Checksum = formatChecksum(checksumAlgo, h)
+	}
+	if strategy == copyZstd || strategy == copyEncrypted {
+		if st, err := statDest(dst); err == nil {
+			info.StoredSize = st.Size()
 		}
-	} else if !interactive {
-		fmt.Printf("Done: %s\n", filepath.Base(src))
 	}
-	return "copied", "ok"
+	if preserveMetadata {
+		info.Preserved = preserveOn(src, dst, info.Parts)
+	}
+	return "copied", "ok", info
 }
 
 // copyFileWithProgress used instead of legacy copyFile
 
 type progressAgg struct {
-	total int64
-	done  int64 // atomic
-	start time.Time
+	total  int64 // atomic
+	done   int64 // atomic
+	start  time.Time
+	parent *progressAgg // per-file counters also feed the run total
 }
 
 // --- Copy performance helpers ---
 // Large reusable buffers significantly reduce syscalls and improve throughput on HDD/USB.
 var copyBufPool = sync.Pool{New: func() any {
-	// 8 MiB buffer strikes a good balance for spinning disks and USB drives
-	b := make([]byte, 8<<20)
+	b := make([]byte, currentTuning().buf)
 	return &b
 }}
 
+// defaultCopyBuffer is the buffer size before (or without) adaptive tuning;
+// 8 MiB strikes a good balance for spinning disks and USB drives. A
+// [tuning] section saved by bench replaces it.
+var defaultCopyBuffer = 8 << 20
+
 // Threshold under which we treat a file as "small" and copy via a single read/write.
 // Default 256 KiB; may be increased at runtime (fast SSD mode) for further syscall reduction.
 var smallFileThreshold = 256 << 10 // 256 KiB (runtime adjustable)
@@ -793,7 +2531,15 @@ var smallCopyBufPool = sync.Pool{New: func() any {
 	return &b
 }}
 
-func bufPoolGet() *[]byte { return copyBufPool.Get().(*[]byte) }
+func bufPoolGet() *[]byte {
+	b := copyBufPool.Get().(*[]byte)
+	if size := currentTuning().buf; len(*b) != size {
+		// Tuning changed the size; buffers of the old size are dropped.
+		nb := make([]byte, size)
+		return &nb
+	}
+	return b
+}
 func bufPoolPut(b *[]byte) {
 	if b != nil {
 		copyBufPool.Put(b)
@@ -809,36 +2555,128 @@ func smallBufPoolPut(b *[]byte) {
 // Platform-specific openFileSequentialRead/openFileSequentialWrite are implemented
 // in open_unix.go and open_windows.go.
 
-func (p *progressAgg) Add(n int64) { atomic.AddInt64(&p.done, n) }
-func (p *progressAgg) Done() int64 { return atomic.LoadInt64(&p.done) }
+func (p *progressAgg) Add(n int64) {
+	atomic.AddInt64(&p.done, n)
+	if p.parent != nil {
+		p.parent.Add(n)
+	}
+}
+func (p *progressAgg) Done() int64          { return atomic.LoadInt64(&p.done) }
+func (p *progressAgg) Total() int64         { return atomic.LoadInt64(&p.total) }
+func (p *progressAgg) AddTotal(delta int64) { atomic.AddInt64(&p.total, delta) }
 
-func copyFileWithProgress(ctx context.Context, src, dst string, agg *progressAgg, mu *sync.Mutex, logsCh chan string, interactive bool) error {
+// copyFileWithProgress copies src to dst. A non-zero offset continues a
+// partial dst of that length (see resumeOffset) with the buffered loop.
+func copyFileWithProgress(ctx context.Context, src, dst string, agg *progressAgg, mu *sync.Mutex, logsCh chan string, interactive bool, h hash.Hash, offset int64) (copyStrategy, error) {
 	// Use OS-optimized open for better throughput
 	in, err := openFileSequentialRead(src)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer in.Close()
 	st, err := in.Stat()
 	if err != nil {
-		return err
+		return "", err
 	}
-	out, err := openFileSequentialWrite(dst, st.Mode().Perm())
-	if err != nil {
-		return err
+	strategy := pickCopyStrategy(src, dst, st.Size())
+	if offset > 0 {
+		strategy = copyBuffered
+	}
+	// Files too large for the destination filesystem are streamed into
+	// parts next to dst instead of into dst itself.
+	split := needsSplit(st.Size())
+	var out *os.File
+	var sink io.WriteCloser
+	if split {
+		if strategy != copyZstd && strategy != copyEncrypted {
+			strategy = copySplit
+		}
+		sink = &splitWriter{base: dst, limit: maxFileSize, perm: st.Mode().Perm()}
+	} else if offset > 0 {
+		if out, err = openResume(in, dst, offset, h); err != nil {
+			return "", err
+		}
+		sink = out
+		if agg != nil {
+			agg.Add(offset)
+		}
+	} else {
+		if out, err = openFileSequentialWrite(dst, st.Mode().Perm()); err != nil {
+			return "", err
+		}
+		sink = out
 	}
-	defer out.Close()
+	defer sink.Close()
 	// Preallocate destination size when possible to reduce fragmentation.
-	_ = out.Truncate(st.Size())
+	// Compressed or encrypted output differs from the source size, so it is
+	// not preallocated.
+	if strategy != copyZstd && strategy != copyEncrypted && strategy != copySplit && offset == 0 {
+		_ = out.Truncate(st.Size())
+	}
+
+	if strategy == copyZstd || strategy == copyEncrypted || strategy == copySplit {
+		started := clk.Now()
+		bufPtr := bufPoolGet()
+		defer bufPoolPut(bufPtr)
+		// Checksums cover the bytes as stored, which is what verify reads.
+		var w io.Writer = sink
+		if h != nil {
+			w = io.MultiWriter(sink, h)
+		}
+		var enc *encryptWriter
+		if strategy == copyEncrypted {
+			if enc, err = newEncryptWriter(w, encryptKey); err != nil {
+				return strategy, err
+			}
+			w = enc
+		}
+		var n int64
+		if shouldCompress(src) {
+			n, err = compressTo(ctx, w, in, agg, *bufPtr)
+		} else {
+			n, err = io.CopyBuffer(w, &ctxReader{ctx: ctx, r: in, agg: agg}, *bufPtr)
+		}
+		if err == nil && enc != nil {
+			err = enc.Close()
+		}
+		if err == nil {
+			err = sink.Close()
+		}
+		if err != nil {
+			return strategy, err
+		}
+		if !split {
+			_ = os.Chtimes(dst, clk.Now(), st.ModTime())
+		}
+		dur := since(started).Seconds()
+		spd := float64(0)
+		if dur > 0 {
+			spd = float64(n) / dur
+		}
+		if !noProgress {
+			final := fmt.Sprintf("%s done: %s in %0.2fs (%s/s, %s)", filepath.Base(src), humanSize(n), dur, humanSize(int64(spd)), strategy)
+			if logsCh != nil {
+				select {
+				case logsCh <- final:
+				default:
+				}
+			} else if !interactive {
+				mu.Lock()
+				fmt.Printf("[FILE] %s\n", final)
+				mu.Unlock()
+			}
+		}
+		return strategy, nil
+	}
 
 	// Fast path for small files: single read + single write.
-	if st.Size() <= int64(smallFileThreshold) {
-		started := time.Now()
+	if strategy == copySmall {
+		started := clk.Now()
 		name := filepath.Base(src)
 		// Zero-sized file fast path
 		if st.Size() == 0 {
 			// Nothing to read/write; still finalize times for consistency
-			_ = os.Chtimes(dst, time.Now(), st.ModTime())
+			_ = os.Chtimes(dst, clk.Now(), st.ModTime())
 			if agg != nil {
 				agg.Add(0)
 			}
@@ -854,7 +2692,7 @@ func copyFileWithProgress(ctx context.Context, src, dst string, agg *progressAgg
 				fmt.Printf("[FILE] %s\n", final)
 				mu.Unlock()
 			}
-			return nil
+			return strategy, nil
 		}
 		// Acquire small buffer sized for threshold; only use first n bytes
 		bufPtr := smallBufPoolGet()
@@ -865,21 +2703,29 @@ func copyFileWithProgress(ctx context.Context, src, dst string, agg *progressAgg
 			buf = make([]byte, n)
 		}
 		if _, err := io.ReadFull(in, buf[:n]); err != nil {
-			return err
+			return strategy, err
+		}
+		if throttle(ctx, n) != nil {
+			return strategy, fmt.Errorf("cancelled")
 		}
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("cancelled")
+			return strategy, fmt.Errorf("cancelled")
 		default:
 		}
+		ws := clk.Now()
 		if _, err := out.Write(buf[:n]); err != nil {
-			return err
+			return strategy, err
+		}
+		if h != nil {
+			h.Write(buf[:n])
 		}
 		if agg != nil {
 			agg.Add(int64(n))
 		}
-		_ = os.Chtimes(dst, time.Now(), st.ModTime())
-		dur := time.Since(started).Seconds()
+		observeWrite(since(ws))
+		_ = os.Chtimes(dst, clk.Now(), st.ModTime())
+		dur := since(started).Seconds()
 		spd := float64(0)
 		if dur > 0 {
 			spd = float64(n) / dur
@@ -897,34 +2743,82 @@ func copyFileWithProgress(ctx context.Context, src, dst string, agg *progressAgg
 				mu.Unlock()
 			}
 		}
-		return nil
+		return strategy, nil
 	}
 
-	// Large fast path (fast SSD mode only): rely on io.Copy to exploit optimized kernel paths.
-	if fastSSDMode && st.Size() >= largeFileDirectThreshold {
-		started := time.Now()
+	// Direct I/O path; filesystems that refuse O_DIRECT get the buffered loop.
+	if strategy == copyDirect {
+		started := clk.Now()
+		name := filepath.Base(src)
+		n, err := directCopy(ctx, src, out, in, st.Size(), agg, h)
+		if errors.Is(err, errNoKernelCopy) {
+			strategy = copyBuffered
+		} else {
+			if err != nil {
+				return strategy, err
+			}
+			_ = os.Chtimes(dst, clk.Now(), st.ModTime())
+			dur := since(started).Seconds()
+			spd := float64(0)
+			if dur > 0 {
+				spd = float64(n) / dur
+			}
+			if !noProgress {
+				final := fmt.Sprintf("%s done: %s in %0.2fs (%s/s, %s)", name, humanSize(n), dur, humanSize(int64(spd)), strategy)
+				if logsCh != nil {
+					select {
+					case logsCh <- final:
+					default:
+					}
+				} else if !interactive {
+					mu.Lock()
+					fmt.Printf("[FILE] %s\n", final)
+					mu.Unlock()
+				}
+			}
+			return strategy, nil
+		}
+	}
+	// Kernel path: reflink or copy_file_range where they work, else io.Copy in
+	// chunks, which still picks sendfile or splice over a user-space loop. The
+	// io_uring engine falls back the same way when no ring can be set up.
+	if strategy == copyKernel || strategy == copyUring {
+		started := clk.Now()
 		name := filepath.Base(src)
-		// Perform copy in one call; io.Copy will attempt to use optimized syscalls.
-		n, err := io.Copy(out, in)
+		var n int64
+		err := errNoKernelCopy
+		if strategy == copyUring {
+			n, err = uringCopy(ctx, out, in, st.Size(), agg)
+		} else if h == nil {
+			strategy, n, err = kernelCopy(ctx, out, in, st.Size(), agg)
+		}
+		if errors.Is(err, errNoKernelCopy) {
+			var w io.Writer = out
+			if h != nil {
+				w = io.MultiWriter(out, h)
+			}
+			strategy = copyKernel
+			n, err = copyChunked(ctx, w, in, agg)
+		}
+		if err == nil && n < st.Size() {
+			err = io.ErrUnexpectedEOF
+		}
 		if err != nil {
-			return err
+			return strategy, err
 		}
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("cancelled")
+			return strategy, fmt.Errorf("cancelled")
 		default:
 		}
-		if agg != nil {
-			agg.Add(n)
-		}
-		_ = os.Chtimes(dst, time.Now(), st.ModTime())
-		dur := time.Since(started).Seconds()
+		_ = os.Chtimes(dst, clk.Now(), st.ModTime())
+		dur := since(started).Seconds()
 		spd := float64(0)
 		if dur > 0 {
 			spd = float64(n) / dur
 		}
 		if !noProgress {
-			final := fmt.Sprintf("%s done: %s in %0.2fs (%s/s)", name, humanSize(n), dur, humanSize(int64(spd)))
+			final := fmt.Sprintf("%s done: %s in %0.2fs (%s/s, %s)", name, humanSize(n), dur, humanSize(int64(spd)), strategy)
 			if logsCh != nil {
 				select {
 				case logsCh <- final:
@@ -936,25 +2830,39 @@ func copyFileWithProgress(ctx context.Context, src, dst string, agg *progressAgg
 				mu.Unlock()
 			}
 		}
-		return nil
+		return strategy, nil
 	}
 	// Reuse a large buffer to reduce syscalls and improve throughput
 	bufPtr := bufPoolGet()
 	defer bufPoolPut(bufPtr)
 	buf := *bufPtr
 	var done int64
-	started := time.Now()
-	lastPrint := time.Time{}
+	// On failure, drop the preallocated tail so the .part holds exactly
+	// the bytes copied and can be resumed.
+	keepPartial := func(err error) (copyStrategy, error) {
+		_ = out.Truncate(offset + done)
+		return strategy, err
+	}
+	started := clk.Now()
+	lastPrint, lastEvent := time.Time{}, time.Time{}
 	name := filepath.Base(src)
 	for {
 		nr, er := in.Read(buf)
 		if nr > 0 {
+			if throttle(ctx, nr) != nil {
+				return keepPartial(fmt.Errorf("cancelled"))
+			}
+			ws := clk.Now()
 			nw, ew := out.Write(buf[:nr])
+			observeWrite(since(ws))
 			if ew != nil {
-				return ew
+				return keepPartial(ew)
 			}
 			if nw < nr {
-				return io.ErrShortWrite
+				return keepPartial(io.ErrShortWrite)
+			}
+			if h != nil {
+				h.Write(buf[:nw])
 			}
 			done += int64(nw)
 			if agg != nil {
@@ -962,23 +2870,27 @@ func copyFileWithProgress(ctx context.Context, src, dst string, agg *progressAgg
 			}
 			select {
 			case <-ctx.Done():
-				return fmt.Errorf("cancelled")
+				return keepPartial(fmt.Errorf("cancelled"))
 			default:
 			}
 			// Throttled per-file progress (1s)
-			now := time.Now()
+			now := clk.Now()
+			if progressEvents != nil && now.Sub(lastEvent) >= 500*time.Millisecond {
+				progressEvents.Emit(progressEvent{Event: "file_progress", Path: src, Size: st.Size(), Bytes: offset + done})
+				lastEvent = now
+			}
 			if !noProgress && now.Sub(lastPrint) >= time.Second {
-				elapsed := now.Sub(started).Seconds()
+				elapsed := (now.Sub(started) - copyPause.pausedSince(started)).Seconds()
 				speed := float64(0)
 				if elapsed > 0 {
 					speed = float64(done) / elapsed
 				}
-				remaining := st.Size() - done
+				remaining := st.Size() - offset - done
 				eta := "--:--:--"
 				if speed > 1 {
 					eta = formatETA(float64(remaining) / speed)
 				}
-				line := fmt.Sprintf("%s %5.1f%% | %s/s | ETA %s", name, percent(done, st.Size()), humanSize(int64(speed)), eta)
+				line := fmt.Sprintf("%s %5.1f%% | %s/s | ETA %s", name, percent(offset+done, st.Size()), humanSize(int64(speed)), eta)
 				if logsCh != nil {
 					select {
 					case logsCh <- line:
@@ -996,12 +2908,12 @@ func copyFileWithProgress(ctx context.Context, src, dst string, agg *progressAgg
 			if er == io.EOF {
 				break
 			}
-			return er
+			return keepPartial(er)
 		}
 	}
 	// Finalize times
-	_ = os.Chtimes(dst, time.Now(), st.ModTime())
-	dur := time.Since(started).Seconds()
+	_ = os.Chtimes(dst, clk.Now(), st.ModTime())
+	dur := since(started).Seconds()
 	spd := float64(0)
 	if dur > 0 {
 		spd = float64(done) / dur
@@ -1019,7 +2931,7 @@ func copyFileWithProgress(ctx context.Context, src, dst string, agg *progressAgg
 			mu.Unlock()
 		}
 	}
-	return nil
+	return strategy, nil
 }
 
 func percent(done, total int64) float64 {
@@ -1064,18 +2976,19 @@ func printTotalLine(line string) {
 
 func formatTotalLine(agg *progressAgg) string {
 	done := agg.Done()
-	elapsed := time.Since(agg.start).Seconds()
+	elapsed := activeSince(agg.start).Seconds()
 	speed := float64(0)
 	if elapsed > 0 {
 		speed = float64(done) / elapsed
 	}
-	remaining := agg.total - done
+	total := agg.Total()
+	remaining := total - done
 	eta := "--:--:--"
 	if speed > 1 {
 		eta = formatETA(float64(remaining) / speed)
 	}
 	return fmt.Sprintf("[TOTAL] %s / %s (%.1f%%) | %s/s | ETA %s",
-		humanSize(done), humanSize(agg.total), percent(done, agg.total), humanSize(int64(speed)), eta)
+		humanSize(done), humanSize(total), percent(done, total), humanSize(int64(speed)), eta)
 }
 
 // ---------- Enhanced Cross-Platform TUI ----------
@@ -1102,6 +3015,8 @@ type teaProgram struct {
 	styles     uiStyles
 	quitting   bool
 	cancelFunc context.CancelFunc
+	confirm    *confirmMsg
+	review     *reviewMsg
 }
 
 type uiStyles struct {
@@ -1116,7 +3031,7 @@ type uiStyles struct {
 
 func NewTUI(cancelFunc context.CancelFunc) *TUI {
 	p := &teaProgram{
-		start:      time.Now(),
+		start:      clk.Now(),
 		logs:       make([]string, 0),
 		cancelFunc: cancelFunc,
 	}
@@ -1142,11 +3057,11 @@ func NewTUI(cancelFunc context.CancelFunc) *TUI {
 		cancelCh: make(chan struct{}, 1),
 	}
 
-	// Start Bubble Tea program in background and retain handle
+	// Start Bubble Tea program in background and retain handle. The handle
+	// is set before starting so a quick Confirm or Review finds it.
+	program := tea.NewProgram(p, tea.WithAltScreen(), tea.WithMouseCellMotion(), tea.WithOutput(termOut))
+	tui.prog = program
 	go func() {
-		m := p
-		program := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
-		tui.prog = program
 		_ = program.Start()
 	}()
 
@@ -1155,6 +3070,7 @@ func NewTUI(cancelFunc context.CancelFunc) *TUI {
 		for {
 			select {
 			case l := <-tui.logsCh:
+				activeLog.Line(l)
 				p.logs = append(p.logs, l)
 				if len(p.logs) > 1000 {
 					p.logs = p.logs[len(p.logs)-1000:]
@@ -1175,6 +3091,20 @@ func NewTUI(cancelFunc context.CancelFunc) *TUI {
 type logUpdateMsg struct{}
 type progressUpdateMsg struct{}
 
+// confirmMsg asks the model to show a pre-copy confirmation screen; the
+// user's answer is delivered on reply.
+type confirmMsg struct {
+	text  string
+	reply chan bool
+}
+
+// reviewMsg asks the model to show the selection review screen; reply gets
+// true when the user starts the copy.
+type reviewMsg struct {
+	tree  *reviewTree
+	reply chan bool
+}
+
 // Bubbletea Model implementation with keyboard handling
 func (m *teaProgram) Init() tea.Cmd {
 	return tea.Batch(
@@ -1191,9 +3121,43 @@ func tickCmd() tea.Cmd {
 
 func (m *teaProgram) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case confirmMsg:
+		m.confirm = &msg
+	case reviewMsg:
+		m.review = &msg
 	case tea.KeyMsg:
+		if m.review != nil && msg.String() != "ctrl+c" {
+			if done, ok := m.review.tree.key(msg.String(), m.review.tree.rows(m.height)); done {
+				m.review.reply <- ok
+				m.review = nil
+			}
+			return m, nil
+		}
+		if m.confirm != nil {
+			switch msg.String() {
+			case "y", "Y", "enter":
+				m.confirm.reply <- true
+				m.confirm = nil
+				return m, nil
+			case "n", "N", "esc":
+				m.confirm.reply <- false
+				m.confirm = nil
+				return m, nil
+			}
+		}
 		switch msg.String() {
+		case "p":
+			copyPause.Toggle()
+			return m, nil
 		case "ctrl+c", "q":
+			if m.confirm != nil {
+				m.confirm.reply <- false
+				m.confirm = nil
+			}
+			if m.review != nil {
+				m.review.reply <- false
+				m.review = nil
+			}
 			if !m.quitting {
 				m.quitting = true
 				// Trigger context cancellation
@@ -1224,6 +3188,22 @@ func (m *teaProgram) View() string {
 		return m.styles.info.Render("\n  Stopping gracefully... Please wait.\n\n")
 	}
 
+	if m.review != nil {
+		return m.review.tree.view(m.width, m.height, m.styles)
+	}
+
+	if m.confirm != nil {
+		box := m.styles.box.Render(m.styles.info.Render(m.confirm.text))
+		return lipgloss.JoinVertical(lipgloss.Left,
+			"",
+			m.styles.header.Render("🔄 USB Backuper - Review changes"),
+			box,
+			"",
+			m.styles.help.Render("Press 'y' to continue or 'n' to abort"),
+			"",
+		)
+	}
+
 	// Calculate dimensions
 	contentWidth := m.width - 4
 	if contentWidth < 40 {
@@ -1235,14 +3215,14 @@ func (m *teaProgram) View() string {
 
 	// Progress section
 	done := atomic.LoadInt64(&m.done)
-	total := m.total
+	total := atomic.LoadInt64(&m.total)
 	percent := 0.0
 	if total > 0 {
 		percent = float64(done) * 100.0 / float64(total)
 	}
 
 	// Calculate speed
-	elapsed := time.Since(m.start).Seconds()
+	elapsed := activeSince(m.start).Seconds()
 	speed := float64(0)
 	if elapsed > 0.1 {
 		speed = float64(done) / elapsed
@@ -1319,7 +3299,10 @@ func (m *teaProgram) View() string {
 	logBox := m.styles.box.Width(contentWidth).Render(logTitle + "\n" + logContent)
 
 	// Help text
-	help := m.styles.help.Render("Press 'q' or Ctrl+C to stop gracefully")
+	help := m.styles.help.Render("Press 'p' to pause/resume, 'q' or Ctrl+C to stop gracefully")
+	if copyPause.Paused() {
+		header = m.styles.header.Render("⏸  USB Backuper - Paused (press 'p' to resume)")
+	}
 
 	return lipgloss.JoinVertical(lipgloss.Left,
 		"",
@@ -1345,7 +3328,7 @@ func (t *TUI) DrawTop(agg *progressAgg) {
 		return
 	}
 	atomic.StoreInt64(&t.model.done, agg.Done())
-	t.model.total = agg.total
+	atomic.StoreInt64(&t.model.total, agg.Total())
 	// Trigger re-render
 	if t.prog != nil {
 		t.prog.Send(progressUpdateMsg{})
@@ -1362,6 +3345,28 @@ func (t *TUI) AppendLog(line string) {
 	}
 }
 
+// Confirm shows text on a pre-copy screen and blocks until the user answers.
+// The second result is false when the TUI is not running.
+func (t *TUI) Confirm(text string) (bool, bool) {
+	if t == nil || t.prog == nil {
+		return false, false
+	}
+	reply := make(chan bool, 1)
+	t.prog.Send(confirmMsg{text: text, reply: reply})
+	return <-reply, true
+}
+
+// Review shows the selection review screen and blocks until the user starts
+// the copy (true) or aborts.
+func (t *TUI) Review(tree *reviewTree) bool {
+	if t == nil || t.prog == nil {
+		return false
+	}
+	reply := make(chan bool, 1)
+	t.prog.Send(reviewMsg{tree: tree, reply: reply})
+	return <-reply
+}
+
 func (t *TUI) DrawLogs() {
 	// no-op; Bubble Tea renders logs
 }
@@ -1379,7 +3384,7 @@ func (t *TUI) Close() {
 			t.prog.Quit()
 		}
 		// leave alt screen
-		fmt.Print("\x1b[?25h\x1b[2J\x1b[H\x1b[?1049l")
+		fmt.Fprint(termOut, "\x1b[?25h\x1b[2J\x1b[H\x1b[?1049l")
 	})
 }
 
@@ -1506,4 +3511,12 @@ func mustNoErr(err error) {
 		fail(err)
 	}
 }
-func fail(err error) { fmt.Fprintln(os.Stderr, err); os.Exit(1) }
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	if f := onFatal; f != nil {
+		onFatal = nil
+		f(err)
+	}
+	activeLog.Close()
+	os.Exit(1)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const manifestName = "backup-manifest.jsonl"
+
+// metaDirName is the destination subfolder holding the manifest and other
+// bookkeeping (--meta-dir); empty keeps them next to the copied files.
+var metaDirName string
+
+// metaDirMarker, in a backup folder, names the meta folder the backup was
+// made with, so later runs and commands find its bookkeeping without
+// --meta-dir.
+const metaDirMarker = ".backup-meta-dir"
+
+// metaDirOf returns the meta folder of the backup in dir: the one recorded
+// in its marker, else --meta-dir.
+func metaDirOf(dir string) string {
+	if b, err := os.ReadFile(filepath.Join(dir, metaDirMarker)); err == nil {
+		if name := filepath.Clean(strings.TrimSpace(string(b))); validMetaDir(name) {
+			return name
+		}
+	}
+	return metaDirName
+}
+
+// validMetaDir reports whether name can be a meta folder: a relative path
+// that stays inside the backup folder.
+func validMetaDir(name string) bool {
+	return name != "" && name != "." && !filepath.IsAbs(name) && !strings.Contains(name, "..")
+}
+
+// recordMetaDir writes the marker for --meta-dir into a backup folder. A
+// folder that already records a different meta folder keeps it.
+func recordMetaDir(dir string) error {
+	if metaDirName == "" {
+		return nil
+	}
+	if cur := metaDirOf(dir); cur != metaDirName {
+		slog.Warn("backup folder keeps its bookkeeping elsewhere; ignoring --meta-dir", "dir", dir, "meta_dir", cur)
+		return nil
+	}
+	return os.WriteFile(filepath.Join(dir, metaDirMarker), []byte(metaDirName+"\n"), 0o644)
+}
+
+// metaPath returns where bookkeeping file name lives for a backup in dir.
+func metaPath(dir, name string) string {
+	return filepath.Join(dir, metaDirOf(dir), name)
+}
+
+// manifestIn returns the manifest of the backup in dir, checking its meta
+// folder first and then the backup root.
+func manifestIn(dir string) (string, bool) {
+	for _, p := range []string{metaPath(dir, manifestName), filepath.Join(dir, manifestName)} {
+		if _, err := os.Stat(p); err == nil {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// readManifest calls fn for every well-formed record in a JSONL manifest.
+// Malformed lines (e.g. a torn final write) are skipped.
+func readManifest(path string, fn func(ManifestRec)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var rec ManifestRec
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			continue
+		}
+		rec.Src = filepath.FromSlash(rec.Src)
+		rec.Dst = filepath.FromSlash(rec.Dst)
+		fn(rec)
+	}
+	return sc.Err()
+}
+
+// findManifests returns the manifests of every backup on the USB: one in the
+// root itself (dest-subdir unset) and one per top-level backup directory.
+func findManifests(usbRoot string) []string {
+	var out []string
+	if p, ok := manifestIn(usbRoot); ok {
+		out = append(out, p)
+	}
+	entries, err := os.ReadDir(usbRoot)
+	if err != nil {
+		return out
+	}
+	rootMeta := metaDirOf(usbRoot)
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == rootMeta || strings.HasPrefix(e.Name(), pruneTrashPrefix) {
+			continue
+		}
+		if p, ok := manifestIn(filepath.Join(usbRoot, e.Name())); ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// manifestBackupDir returns the backup folder a manifest belongs to: the
+// folder holding it, or that folder's parent when it is the meta folder.
+func manifestBackupDir(m string) string {
+	dir := filepath.Dir(m)
+	parent := filepath.Dir(dir)
+	if meta := metaDirOf(parent); meta != "" && filepath.Join(parent, meta) == dir {
+		return parent
+	}
+	return dir
+}
+
+// lastBackupTimes maps each source path to the time it was last copied
+// successfully by any backup on the USB.
+func lastBackupTimes(usbRoot string) map[string]time.Time {
+	var last map[string]time.Time
+	if withCatalog(usbRoot, func(c *catalog) (err error) {
+		last, err = c.lastBackupTimes()
+		return err
+	}) {
+		return last
+	}
+	last = map[string]time.Time{}
+	for _, m := range findManifests(usbRoot) {
+		_ = readManifest(m, func(rec ManifestRec) {
+			if rec.Status != "copied" {
+				return
+			}
+			ts := time.Unix(0, int64(rec.Ts*1e9))
+			if ts.After(last[rec.Src]) {
+				last[rec.Src] = ts
+			}
+		})
+	}
+	return last
+}
+
+// lastBackedUp maps each source path to its most recent record, by
+// timestamp, across every backup on the USB whose copy is on the drive
+// (copied, or skipped because an equal-size copy already existed).
+func lastBackedUp(usbRoot string) map[string]ManifestRec {
+	var last map[string]ManifestRec
+	if withCatalog(usbRoot, func(c *catalog) (err error) {
+		last, err = c.lastBackedUp()
+		return err
+	}) {
+		return last
+	}
+	last = map[string]ManifestRec{}
+	for _, m := range findManifests(usbRoot) {
+		_ = readManifest(m, func(rec ManifestRec) {
+			if rec.Status != "copied" && rec.Status != "skipped" {
+				return
+			}
+			if prev, ok := last[rec.Src]; !ok || rec.Ts > prev.Ts {
+				last[rec.Src] = rec
+			}
+		})
+	}
+	return last
+}
+
+// manifestReserveSize estimates the space a manifest for n files needs. That
+// much is set aside up front so bookkeeping survives a destination that fills
+// up during the copy.
+func manifestReserveSize(n int) int64 {
+	size := int64(n)*512 + 64<<10
+	if size < 1<<20 {
+		size = 1 << 20
+	}
+	if size > 64<<20 {
+		size = 64 << 20
+	}
+	return size
+}
+
+// manifestWriter buffers manifest lines and, unlike bufio.Writer, keeps
+// unwritten data after a failed write. A placeholder file holds space for
+// the manifest; when a write fails (typically ENOSPC) the placeholder is
+// deleted and the write retried once.
+type manifestWriter struct {
+	f        *os.File
+	buf      []byte
+	reserve  string
+	released bool
+}
+
+func newManifestWriter(f *os.File, reserve string, size int64) *manifestWriter {
+	w := &manifestWriter{f: f}
+	if err := writeZeros(reserve, size); err != nil {
+		_ = os.Remove(reserve)
+		slog.Warn("could not reserve space for the manifest", "error", err)
+		return w
+	}
+	w.reserve = reserve
+	return w
+}
+
+// writeZeros allocates a file of the given size by writing real blocks; a
+// sparse Truncate would not hold any space.
+func writeZeros(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zero := make([]byte, 64<<10)
+	for size > 0 {
+		n := int64(len(zero))
+		if size < n {
+			n = size
+		}
+		if _, err := f.Write(zero[:n]); err != nil {
+			f.Close()
+			return err
+		}
+		size -= n
+	}
+	return f.Close()
+}
+
+func (w *manifestWriter) Write(b []byte) (int, error) {
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= 64<<10 {
+		return len(b), w.Flush()
+	}
+	return len(b), nil
+}
+
+func (w *manifestWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *manifestWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	n, err := w.f.Write(w.buf)
+	w.buf = w.buf[n:]
+	if err != nil && w.reserve != "" && !w.released {
+		w.released = true
+		_ = os.Remove(w.reserve)
+		slog.Warn("destination is full; released the manifest reserve so the manifest stays complete")
+		n, err = w.f.Write(w.buf)
+		w.buf = w.buf[n:]
+	}
+	return err
+}
+
+// Close flushes pending lines and frees the reserve. It reports whether the
+// reserve had to be used.
+func (w *manifestWriter) Close() (bool, error) {
+	err := w.Flush()
+	if w.reserve != "" && !w.released {
+		_ = os.Remove(w.reserve)
+	}
+	return w.released, err
+}
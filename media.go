@@ -0,0 +1,50 @@
+package main
+
+import "runtime"
+
+// mediaType is a coarse classification of the destination device, used to
+// pick a sensible default parallelism.
+type mediaType int
+
+const (
+	mediaUnknown mediaType = iota
+	mediaRemovable
+	mediaHDD
+	mediaSSD
+	mediaNVMe
+	mediaNetwork
+)
+
+func (m mediaType) String() string {
+	switch m {
+	case mediaRemovable:
+		return "removable/USB"
+	case mediaHDD:
+		return "rotational HDD"
+	case mediaSSD:
+		return "SSD"
+	case mediaNVMe:
+		return "NVMe"
+	case mediaNetwork:
+		return "network share"
+	}
+	return "unknown"
+}
+
+// autoWorkers picks a worker count for the destination media. Slow or
+// seek-bound media thrash with many concurrent writers, so they get few.
+func autoWorkers(m mediaType) int {
+	n := runtime.NumCPU()
+	switch m {
+	case mediaRemovable, mediaHDD:
+		n = 2
+	case mediaSSD, mediaNetwork:
+		if n > 8 {
+			n = 8
+		}
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
@@ -0,0 +1,74 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Filesystem magic numbers of CIFS/SMB mounts, which x/sys/unix lacks.
+const (
+	cifsMagic = 0xff534d42
+	smb2Magic = 0xfe534d42
+)
+
+// detectMedia classifies the block device holding path using sysfs.
+// Network filesystems have no block device and are recognised by type.
+func detectMedia(path string) mediaType {
+	var fs unix.Statfs_t
+	if unix.Statfs(path, &fs) == nil {
+		switch uint32(fs.Type) {
+		case cifsMagic, smb2Magic, unix.SMB_SUPER_MAGIC, unix.NFS_SUPER_MAGIC:
+			return mediaNetwork
+		}
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return mediaUnknown
+	}
+	dev := uint64(st.Dev)
+	sys, err := filepath.EvalSymlinks(fmt.Sprintf("/sys/dev/block/%d:%d", unix.Major(dev), unix.Minor(dev)))
+	if err != nil {
+		return mediaUnknown
+	}
+	// Partitions carry their queue/removable attributes on the parent disk.
+	if _, err := os.Stat(filepath.Join(sys, "partition")); err == nil {
+		sys = filepath.Dir(sys)
+	}
+	if readSysfsFlag(filepath.Join(sys, "removable")) || strings.Contains(sys, "/usb") {
+		return mediaRemovable
+	}
+	if strings.HasPrefix(filepath.Base(sys), "nvme") {
+		return mediaNVMe
+	}
+	if readSysfsFlag(filepath.Join(sys, "queue", "rotational")) {
+		return mediaHDD
+	}
+	if _, err := os.Stat(filepath.Join(sys, "queue", "rotational")); err == nil {
+		return mediaSSD
+	}
+	return mediaUnknown
+}
+
+func readSysfsFlag(path string) bool {
+	b, err := os.ReadFile(path)
+	return err == nil && strings.TrimSpace(string(b)) == "1"
+}
+
+// detectMaxFileSize returns the largest file the filesystem holding path can
+// store, or 0 when it has no limit worth splitting for.
+func detectMaxFileSize(path string) int64 {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0
+	}
+	if st.Type == unix.MSDOS_SUPER_MAGIC {
+		return fat32MaxFileSize
+	}
+	return 0
+}
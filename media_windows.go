@@ -0,0 +1,114 @@
+//go:build windows
+
+package main
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	ioctlStorageQueryProperty        = 0x2D1400
+	storageDeviceProperty            = 0
+	storageDeviceSeekPenaltyProperty = 7
+	busTypeUsb                       = 7
+	busTypeNvme                      = 17
+)
+
+// storagePropertyQuery mirrors STORAGE_PROPERTY_QUERY.
+type storagePropertyQuery struct {
+	PropertyID uint32
+	QueryType  uint32
+	Additional [1]byte
+}
+
+// detectMedia classifies the volume holding path using the drive type and,
+// for fixed drives, the storage bus and seek penalty reported by the device.
+func detectMedia(path string) mediaType {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return mediaUnknown
+	}
+	vol := filepath.VolumeName(abs)
+	if vol == "" {
+		return mediaUnknown
+	}
+	root, err := windows.UTF16PtrFromString(vol + `\`)
+	if err != nil {
+		return mediaUnknown
+	}
+	switch windows.GetDriveType(root) {
+	case windows.DRIVE_REMOVABLE:
+		return mediaRemovable
+	case windows.DRIVE_REMOTE:
+		return mediaNetwork
+	case windows.DRIVE_FIXED:
+	default:
+		return mediaUnknown
+	}
+	dev, err := windows.UTF16PtrFromString(`\\.\` + vol)
+	if err != nil {
+		return mediaUnknown
+	}
+	h, err := windows.CreateFile(dev, 0, windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return mediaUnknown
+	}
+	defer windows.CloseHandle(h)
+
+	// STORAGE_DEVICE_DESCRIPTOR: BusType is the uint32 at offset 28.
+	desc := make([]byte, 1024)
+	if queryStorageProperty(h, storageDeviceProperty, desc) >= 32 {
+		switch binary.LittleEndian.Uint32(desc[28:]) {
+		case busTypeUsb:
+			return mediaRemovable
+		case busTypeNvme:
+			return mediaNVMe
+		}
+	}
+	// DEVICE_SEEK_PENALTY_DESCRIPTOR: IncursSeekPenalty is the byte at offset 8.
+	seek := make([]byte, 12)
+	if queryStorageProperty(h, storageDeviceSeekPenaltyProperty, seek) >= 9 {
+		if seek[8] != 0 {
+			return mediaHDD
+		}
+		return mediaSSD
+	}
+	return mediaUnknown
+}
+
+// queryStorageProperty issues IOCTL_STORAGE_QUERY_PROPERTY and returns the
+// number of bytes written to out (0 on failure).
+func queryStorageProperty(h windows.Handle, id uint32, out []byte) uint32 {
+	q := storagePropertyQuery{PropertyID: id}
+	var n uint32
+	err := windows.DeviceIoControl(h, ioctlStorageQueryProperty,
+		(*byte)(unsafe.Pointer(&q)), uint32(unsafe.Sizeof(q)),
+		&out[0], uint32(len(out)), &n, nil)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// detectMaxFileSize returns the largest file the volume holding path can
+// store, or 0 when it has no limit worth splitting for.
+func detectMaxFileSize(path string) int64 {
+	vol := filepath.VolumeName(path) + `\`
+	root, err := windows.UTF16PtrFromString(vol)
+	if err != nil {
+		return 0
+	}
+	fsName := make([]uint16, windows.MAX_PATH+1)
+	if err := windows.GetVolumeInformation(root, nil, 0, nil, nil, nil, &fsName[0], uint32(len(fsName))); err != nil {
+		return 0
+	}
+	switch windows.UTF16ToString(fsName) {
+	case "FAT32", "FAT":
+		return fat32MaxFileSize
+	}
+	return 0
+}
@@ -0,0 +1,36 @@
+package main
+
+// preserveMetadata carries permissions, ownership and extended attributes
+// of copied files over to the destination (--preserve-metadata). Copies
+// otherwise only keep the modification time.
+var preserveMetadata bool
+
+// preserveOn applies src's metadata to the stored copy at dst (or to each
+// of its parts when it was split) and returns what was preserved, for the
+// manifest. Only what succeeded on every stored file is reported.
+func preserveOn(src, dst string, parts int) []string {
+	targets := []string{dst}
+	if parts > 0 {
+		targets = storedParts(dst)
+	}
+	var kept []string
+	for i, t := range targets {
+		got := copyMetadata(src, t)
+		if i == 0 {
+			kept = got
+			continue
+		}
+		kept = intersect(kept, got)
+	}
+	return kept
+}
+
+func intersect(a, b []string) []string {
+	var out []string
+	for _, s := range a {
+		if containsString(b, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
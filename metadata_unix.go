@@ -0,0 +1,70 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyMetadata copies mode bits, ownership (only when running as root) and
+// extended attributes from src to dst. Ownership goes first because chown
+// clears setuid/setgid bits. Filesystems without the feature (FAT, exFAT)
+// simply leave it out of the result.
+func copyMetadata(src, dst string) []string {
+	st, err := os.Lstat(src)
+	if err != nil {
+		return nil
+	}
+	var kept []string
+	if sys, ok := st.Sys().(*syscall.Stat_t); ok && os.Geteuid() == 0 {
+		if os.Lchown(dst, int(sys.Uid), int(sys.Gid)) == nil {
+			kept = append(kept, "owner")
+		}
+	}
+	if os.Chmod(dst, st.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)) == nil {
+		kept = append(kept, "mode")
+	}
+	if n, ok := copyXattrs(src, dst); ok && n > 0 {
+		kept = append(kept, "xattrs")
+	}
+	return kept
+}
+
+// copyXattrs copies every extended attribute of src to dst and reports how
+// many there were and whether all of them were set.
+func copyXattrs(src, dst string) (int, bool) {
+	size, err := unix.Llistxattr(src, nil)
+	if err != nil || size == 0 {
+		return 0, err == nil
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(src, buf)
+	if err != nil {
+		return 0, false
+	}
+	n, ok := 0, true
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		n++
+		vsize, err := unix.Lgetxattr(src, string(name), nil)
+		if err != nil {
+			ok = false
+			continue
+		}
+		val := make([]byte, vsize)
+		if vsize, err = unix.Lgetxattr(src, string(name), val); err != nil {
+			ok = false
+			continue
+		}
+		if unix.Lsetxattr(dst, string(name), val[:vsize], 0) != nil {
+			ok = false
+		}
+	}
+	return n, ok
+}
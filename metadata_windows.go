@@ -0,0 +1,34 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// preservedAttributes are the file attributes copyMetadata carries over.
+// Read-only is left out: it would make later updates of the copy fail.
+const preservedAttributes = windows.FILE_ATTRIBUTE_HIDDEN | windows.FILE_ATTRIBUTE_SYSTEM | windows.FILE_ATTRIBUTE_ARCHIVE
+
+// copyMetadata copies the hidden, system and archive attributes from src to
+// dst. NTFS ACLs and alternate data streams are not carried over.
+func copyMetadata(src, dst string) []string {
+	sp, err := windows.UTF16PtrFromString(src)
+	if err != nil {
+		return nil
+	}
+	dp, err := windows.UTF16PtrFromString(dst)
+	if err != nil {
+		return nil
+	}
+	sa, err := windows.GetFileAttributes(sp)
+	if err != nil {
+		return nil
+	}
+	da, err := windows.GetFileAttributes(dp)
+	if err != nil {
+		return nil
+	}
+	if windows.SetFileAttributes(dp, da&^preservedAttributes|sa&preservedAttributes) != nil {
+		return nil
+	}
+	return []string{"attributes"}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// --metrics-addr serves Prometheus metrics at /metrics while --watch or
+// --schedule keeps the process running. The metrics are derived from the
+// same events as --progress=json: in watch mode they are observed in
+// process, and the scheduler reads them from each run's event stream.
+
+// throughputWindow is the span current throughput is averaged over.
+const throughputWindow = 30 * time.Second
+
+type backupMetrics struct {
+	copiedBytes prometheus.Counter
+	copied      prometheus.Counter
+	failed      prometheus.Counter
+	queue       prometheus.Gauge
+	lastRun     prometheus.Gauge
+	lastSuccess prometheus.Gauge
+	lastErrors  prometheus.Gauge
+	running     prometheus.Gauge
+
+	mu      sync.Mutex
+	seen    map[string]int64 // bytes of files in flight already counted
+	samples []byteSample
+}
+
+type byteSample struct {
+	at time.Time
+	n  int64
+}
+
+func newBackupMetrics(reg prometheus.Registerer) *backupMetrics {
+	m := &backupMetrics{seen: map[string]int64{}}
+	counter := func(name, help string) prometheus.Counter {
+		c := prometheus.NewCounter(prometheus.CounterOpts{Name: name, Help: help})
+		reg.MustRegister(c)
+		return c
+	}
+	gauge := func(name, help string) prometheus.Gauge {
+		g := prometheus.NewGauge(prometheus.GaugeOpts{Name: name, Help: help})
+		reg.MustRegister(g)
+		return g
+	}
+	m.copiedBytes = counter("backuper_copied_bytes_total", "Bytes of files copied.")
+	m.copied = counter("backuper_files_copied_total", "Files copied.")
+	m.failed = counter("backuper_files_failed_total", "Files that failed to copy.")
+	m.queue = gauge("backuper_queue_files", "Files waiting to be copied in the current pass.")
+	m.lastRun = gauge("backuper_last_run_timestamp_seconds", "Unix time the last copy pass finished.")
+	m.lastSuccess = gauge("backuper_last_success_timestamp_seconds", "Unix time the last copy pass finished without errors.")
+	m.lastErrors = gauge("backuper_last_run_errors", "Files that failed in the last copy pass.")
+	m.running = gauge("backuper_running", "1 while a copy pass is in progress.")
+	reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "backuper_throughput_bytes_per_second",
+		Help: "Copy throughput averaged over the last 30 seconds.",
+	}, m.throughput))
+	return m
+}
+
+// Observe updates the metrics from one progress event.
+func (m *backupMetrics) Observe(ev progressEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := clk.Now()
+	switch ev.Event {
+	case "copy_start":
+		m.queue.Set(float64(ev.Files))
+		m.running.Set(1)
+	case "file_start":
+		m.seen[ev.Path] = ev.Bytes
+	case "file_progress":
+		m.addBytes(now, ev.Bytes-m.seen[ev.Path])
+		m.seen[ev.Path] = ev.Bytes
+	case "file_done":
+		m.queue.Sub(1)
+		switch ev.Status {
+		case "copied":
+			m.copied.Inc()
+			m.copiedBytes.Add(float64(ev.Size))
+			m.addBytes(now, ev.Size-m.seen[ev.Path])
+		case "error":
+			m.failed.Inc()
+		}
+		delete(m.seen, ev.Path)
+	case "copy_done":
+		m.queue.Set(0)
+		m.running.Set(0)
+		m.lastRun.Set(float64(now.Unix()))
+		m.lastErrors.Set(float64(ev.Errors))
+		if ev.Errors == 0 {
+			m.lastSuccess.Set(float64(now.Unix()))
+		}
+	}
+}
+
+func (m *backupMetrics) addBytes(at time.Time, n int64) {
+	if n > 0 {
+		m.samples = append(m.samples, byteSample{at, n})
+	}
+}
+
+func (m *backupMetrics) throughput() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := clk.Now().Add(-throughputWindow)
+	i := 0
+	for i < len(m.samples) && m.samples[i].at.Before(cutoff) {
+		i++
+	}
+	m.samples = m.samples[i:]
+	var n int64
+	for _, s := range m.samples {
+		n += s.n
+	}
+	return float64(n) / throughputWindow.Seconds()
+}
+
+// runEnded clears the in-progress gauges after a run that may have exited
+// without finishing its copy pass.
+func (m *backupMetrics) runEnded() {
+	m.queue.Set(0)
+	m.running.Set(0)
+}
+
+// observeEvents feeds a --progress=json stream into the metrics until r
+// ends.
+func (m *backupMetrics) observeEvents(r io.Reader) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var ev progressEvent
+		if json.Unmarshal(sc.Bytes(), &ev) == nil {
+			m.Observe(ev)
+		}
+	}
+}
+
+// serveMetrics starts the /metrics endpoint on addr and returns the
+// metrics to feed.
+func serveMetrics(addr string) (*backupMetrics, error) {
+	reg := prometheus.NewRegistry()
+	m := newBackupMetrics(reg)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("metrics server stopped", "error", err)
+		}
+	}()
+	slog.Info("Serving metrics", "url", "http://"+ln.Addr().String()+"/metrics")
+	return m, nil
+}
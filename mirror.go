@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --mirror makes the backup folder match the selection: after the copy,
+// files in it that no selected source maps to are deleted. Bookkeeping files
+// written by the tool itself are never touched.
+
+// bookkeepingNames are files the tool keeps in a backup folder.
+var bookkeepingNames = map[string]bool{
+	manifestName:              true,
+	manifestName + ".reserve": true,
+	runMetaName:               true,
+	dirHashName:               true,
+	encKeyringName:            true,
+	spanCatalogName:           true,
+	reportHTMLName:            true,
+	reportMDName:              true,
+}
+
+// mirrorKeep returns the set of paths a mirrored folder may hold for the
+// planned destinations: the files themselves plus their split parts and
+// dedup pointer files.
+func mirrorKeep(plans [][2]string, links []string, sources []string, destDir string) map[string]bool {
+	keep := make(map[string]bool, len(plans)+len(links))
+	for _, p := range plans {
+		keep[p[1]] = true
+	}
+	for _, l := range links {
+		keep[filepath.Join(destDir, relativeDestPath(l, sources))] = true
+	}
+	return keep
+}
+
+func keptByMirror(path string, keep map[string]bool) bool {
+	if keep[path] || keep[strings.TrimSuffix(path, refExt)] {
+		return true
+	}
+	// <dst>.NNN split parts
+	if ext := filepath.Ext(path); len(ext) == 4 && strings.Trim(ext[1:], "0123456789") == "" {
+		return keep[strings.TrimSuffix(path, ext)]
+	}
+	return false
+}
+
+// findExtraneous lists the files under destDir that --mirror would delete,
+// with their total size.
+func findExtraneous(destDir string, keep map[string]bool) ([]string, int64) {
+	var out []string
+	var total int64
+	meta := filepath.Clean(metaPath(destDir, ""))
+	_ = filepath.WalkDir(destDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != destDir && (p == meta || d.Name() == storeDirName || d.Name() == deltaSigDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Dir(p) == destDir && (bookkeepingNames[d.Name()] || d.Name() == metaDirMarker) {
+			return nil
+		}
+		if strings.HasSuffix(p, ".part") || keptByMirror(p, keep) {
+			return nil
+		}
+		out = append(out, p)
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return out, total
+}
+
+// deleteExtraneous removes the listed files, then any directories left
+// empty by that (unless empty directories are being replicated). It returns
+// manifest records for what was deleted.
+func deleteExtraneous(paths []string, destDir string) []ManifestRec {
+	var recs []ManifestRec
+	dirs := map[string]bool{}
+	for _, p := range paths {
+		rec := ManifestRec{Dst: p, Status: "deleted", Message: "mirror", Ts: float64(clk.Now().UnixNano()) / 1e9}
+		if st, err := os.Lstat(p); err == nil {
+			rec.Size, rec.MTime = st.Size(), st.ModTime().Unix()
+		}
+		if err := os.Remove(p); err != nil {
+			rec.Status, rec.Message = "error", err.Error()
+		} else {
+			dirs[filepath.Dir(p)] = true
+		}
+		recs = append(recs, rec)
+	}
+	if !includeEmptyDirs {
+		for d := range dirs {
+			for d != destDir && prefixOf(d, destDir) {
+				if os.Remove(d) != nil {
+					break
+				}
+				d = filepath.Dir(d)
+			}
+		}
+	}
+	return recs
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestMirrorDeletesOnlyUnselected(t *testing.T) {
+	dest := t.TempDir()
+	write := func(rel string) string {
+		p := filepath.Join(dest, filepath.FromSlash(rel))
+		mkdirAll(t, filepath.Dir(p))
+		if err := os.WriteFile(p, []byte(rel), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	// The backup keeps its bookkeeping in .meta, recorded by the marker.
+	if err := os.WriteFile(filepath.Join(dest, metaDirMarker), []byte(".meta\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	survivors := []string{
+		filepath.Join(dest, metaDirMarker),
+		write(".meta/" + manifestName),
+		write(".meta/" + runMetaName),
+		write(runMetaName), // written before --meta-dir was used
+		write(storeDirName + "/ab/abcdef"),
+		write(deltaSigDir + "/docs/a.txt.sig"),
+		write("docs/a.txt"),
+		write("docs/big.bin.001"),
+		write("docs/big.bin.002"),
+		write("docs/photo.jpg" + refExt),
+		write("docs/copying.txt.part"),
+	}
+	stale := []string{write("docs/old.txt"), write("gone/sub/stale.txt")}
+	plans := [][2]string{
+		{"/src/docs/a.txt", filepath.Join(dest, "docs", "a.txt")},
+		{"/src/docs/big.bin", filepath.Join(dest, "docs", "big.bin")},
+		{"/src/docs/photo.jpg", filepath.Join(dest, "docs", "photo.jpg")},
+	}
+
+	extraneous, _ := findExtraneous(dest, mirrorKeep(plans, nil, []string{"/src"}, dest))
+	sort.Strings(extraneous)
+	sort.Strings(stale)
+	if len(extraneous) != len(stale) || extraneous[0] != stale[0] || extraneous[1] != stale[1] {
+		t.Fatalf("extraneous = %v, want %v", extraneous, stale)
+	}
+
+	// Unattended, the run refuses instead of deleting.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	ok, err := confirmChanges(nil, changeSummary{Deleted: len(extraneous)})
+	os.Stdin = stdin
+	if ok || err == nil {
+		t.Fatalf("confirmChanges without a terminal = %v, %v; want a refusal", ok, err)
+	}
+	for _, p := range stale {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s deleted before confirmation: %v", p, err)
+		}
+	}
+
+	for _, rec := range deleteExtraneous(extraneous, dest) {
+		if rec.Status != "deleted" {
+			t.Errorf("%s: %s %s", rec.Dst, rec.Status, rec.Message)
+		}
+	}
+	for _, p := range stale {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s survived the mirror: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "gone")); !os.IsNotExist(err) {
+		t.Errorf("emptied folder left behind: %v", err)
+	}
+	for _, p := range survivors {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("%s removed by the mirror: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// --notify raises a desktop notification when a run starts, finishes and
+// fails, and for watch batches with errors, so watch and scheduled backups
+// can run without a terminal in view. Notifications are best-effort: a
+// desktop without a notification service only gets a debug message.
+
+var desktopNotify bool
+
+// notifyTimeout bounds the helper process so a stuck notification daemon
+// cannot hold up a run.
+const notifyTimeout = 10 * time.Second
+
+func notify(title, body string) {
+	if !desktopNotify {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	if err := sendNotification(ctx, title, body); err != nil {
+		slog.Debug("desktop notification failed", "error", err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"os/exec"
+)
+
+// sendNotification uses notify-send (libnotify), present on most desktops.
+func sendNotification(ctx context.Context, title, body string) error {
+	return exec.CommandContext(ctx, "notify-send", "--app-name=USB Backuper", title, body).Run()
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// toastScript shows a toast through the WinRT notification API. Title and
+// body arrive as environment variables so no quoting is needed.
+const toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$n = $t.GetElementsByTagName('text')
+$n.Item(0).AppendChild($t.CreateTextNode($env:BACKUPER_TITLE)) > $null
+$n.Item(1).AppendChild($t.CreateTextNode($env:BACKUPER_BODY)) > $null
+$app = '{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe'
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier($app).Show([Windows.UI.Notifications.ToastNotification]::new($t))`
+
+// sendNotification shows a Windows toast via PowerShell.
+func sendNotification(ctx context.Context, title, body string) error {
+	cmd := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", "-")
+	cmd.Stdin = strings.NewReader(toastScript)
+	cmd.Env = append(cmd.Environ(), "BACKUPER_TITLE="+title, "BACKUPER_BODY="+body)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	return cmd.Run()
+}
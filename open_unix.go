@@ -32,3 +32,18 @@ func openFileSequentialWrite(path string, perm fs.FileMode) (*os.File, error) {
 	_ = unix.Fadvise(fd, 0, 0, unix.FADV_SEQUENTIAL)
 	return f, nil
 }
+
+// sameFilesystem reports whether two existing paths live on the same device.
+func sameFilesystem(a, b string) bool {
+	var sa, sb unix.Stat_t
+	if unix.Stat(a, &sa) != nil || unix.Stat(b, &sb) != nil {
+		return false
+	}
+	return sa.Dev == sb.Dev
+}
+
+// dropCache evicts a file's pages from the page cache, so reading it again
+// measures the device. The file must have been synced.
+func dropCache(f *os.File) {
+	_ = unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
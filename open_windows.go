@@ -5,6 +5,7 @@ package main
 import (
     "io/fs"
     "os"
+    "strings"
     "golang.org/x/sys/windows"
 )
 
@@ -73,3 +74,26 @@ func filepathDir(p string) string {
     }
     return string(s[:idx])
 }
+
+// sameFilesystem reports whether two paths resolve to the same volume mount point.
+func sameFilesystem(a, b string) bool {
+    va, ok1 := volumePath(a)
+    vb, ok2 := volumePath(b)
+    return ok1 && ok2 && strings.EqualFold(windows.UTF16ToString(va), windows.UTF16ToString(vb))
+}
+
+func volumePath(p string) ([]uint16, bool) {
+    pp, err := windows.UTF16PtrFromString(p)
+    if err != nil {
+        return nil, false
+    }
+    buf := make([]uint16, windows.MAX_PATH+1)
+    if err := windows.GetVolumePathName(pp, &buf[0], uint32(len(buf))); err != nil {
+        return nil, false
+    }
+    return buf, true
+}
+
+// dropCache is a no-op: Windows offers no way to evict one file from the
+// cache, so bench's read test may be served from memory.
+func dropCache(f *os.File) {}
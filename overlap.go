@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path/filepath"
+)
+
+// canonicalPath resolves symlinks and makes p absolute, falling back to the
+// plain absolute path when p cannot be resolved.
+// Paths that don't exist yet are resolved through their deepest existing
+// ancestor, so a destination about to be created still compares correctly.
+func canonicalPath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	rest := ""
+	for cur := abs; ; {
+		if real, err := filepath.EvalSymlinks(cur); err == nil {
+			return filepath.Join(real, rest)
+		}
+		parent := filepath.Dir(cur)
+		if parent == cur {
+			return abs
+		}
+		rest = filepath.Join(filepath.Base(cur), rest)
+		cur = parent
+	}
+}
+
+// overlapExcludes returns every spelling under which a guarded directory (the
+// USB root, the destination) is reachable from the sources: the guarded paths
+// themselves, their resolved forms and, for each source whose resolved tree
+// contains one, the same directory spelled relative to that source. Scanning
+// skips all of them so the backup never copies its own output.
+func overlapExcludes(sources []string, guarded []string) (excl []string, overlaps [][2]string) {
+	add := func(p string) {
+		if !containsString(excl, p) {
+			excl = append(excl, p)
+		}
+	}
+	for _, g := range guarded {
+		abs, _ := filepath.Abs(g)
+		add(abs)
+		add(canonicalPath(g))
+	}
+	for _, src := range sources {
+		absSrc, err := filepath.Abs(expandPath(src))
+		if err != nil {
+			continue
+		}
+		realSrc := canonicalPath(absSrc)
+		for _, g := range guarded {
+			realG := canonicalPath(g)
+			if !prefixOf(realG, realSrc) {
+				continue
+			}
+			rel, err := filepath.Rel(realSrc, realG)
+			if err != nil {
+				continue
+			}
+			spelled := filepath.Join(absSrc, rel)
+			add(spelled)
+			nested := false
+			for _, o := range overlaps {
+				if o[0] == src && prefixOf(spelled, o[1]) {
+					nested = true
+				}
+			}
+			if !nested {
+				overlaps = append(overlaps, [2]string{src, spelled})
+			}
+		}
+	}
+	return excl, overlaps
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOverlapExcludes(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup builds the tree under dir and returns the sources, the
+		// guarded directory and the spelling expected to be reported as
+		// overlapping ("" for none).
+		setup func(t *testing.T, dir string) (sources []string, guarded, want string)
+	}{
+		{"nested root", func(t *testing.T, dir string) ([]string, string, string) {
+			src := filepath.Join(dir, "home")
+			usb := filepath.Join(src, "usb")
+			mkdirAll(t, usb)
+			return []string{src}, usb, usb
+		}},
+		{"symlinked root", func(t *testing.T, dir string) ([]string, string, string) {
+			real := filepath.Join(dir, "data")
+			usb := filepath.Join(real, "usb")
+			mkdirAll(t, usb)
+			link := filepath.Join(dir, "link")
+			if err := os.Symlink(real, link); err != nil {
+				t.Skipf("symlinks unavailable: %v", err)
+			}
+			// The source is spelled through the link; the destination is
+			// excluded under that spelling too.
+			return []string{link}, usb, filepath.Join(link, "usb")
+		}},
+		{"symlinked destination", func(t *testing.T, dir string) ([]string, string, string) {
+			src := filepath.Join(dir, "home")
+			mkdirAll(t, filepath.Join(src, "usb"))
+			link := filepath.Join(dir, "media")
+			if err := os.Symlink(filepath.Join(src, "usb"), link); err != nil {
+				t.Skipf("symlinks unavailable: %v", err)
+			}
+			return []string{src}, link, filepath.Join(src, "usb")
+		}},
+		{"case-folded root", func(t *testing.T, dir string) ([]string, string, string) {
+			usb := filepath.Join(dir, "Data", "usb")
+			mkdirAll(t, usb)
+			folded := filepath.Join(dir, "data")
+			if isCaseInsensitiveFS(dir) {
+				// Same directory under another spelling.
+				return []string{folded}, usb, filepath.Join(folded, "usb")
+			}
+			// A different directory that only differs by case.
+			mkdirAll(t, folded)
+			return []string{folded}, usb, ""
+		}},
+		{"sibling", func(t *testing.T, dir string) ([]string, string, string) {
+			src := filepath.Join(dir, "home")
+			usb := filepath.Join(dir, "homeusb")
+			mkdirAll(t, src)
+			mkdirAll(t, usb)
+			return []string{src}, usb, ""
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources, guarded, want := tt.setup(t, t.TempDir())
+			excl, overlaps := overlapExcludes(sources, []string{guarded})
+			if want == "" {
+				if len(overlaps) != 0 {
+					t.Fatalf("overlaps = %v, want none", overlaps)
+				}
+				return
+			}
+			if len(overlaps) != 1 || overlaps[0][0] != sources[0] || !strings.EqualFold(overlaps[0][1], want) {
+				t.Fatalf("overlaps = %v, want [[%s %s]]", overlaps, sources[0], want)
+			}
+			if !anyPrefixOf(filepath.Join(overlaps[0][1], "f.txt"), excl) {
+				t.Errorf("excludes %v do not cover %s", excl, want)
+			}
+		})
+	}
+}
+
+func TestCanonicalPathSymlinkedRoot(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "media")
+	mkdirAll(t, real)
+	link := filepath.Join(dir, "run-media")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	// A destination not created yet, under the root spelled the other way.
+	dest := filepath.Join(real, "usb", "backup_1")
+	if !prefixOf(canonicalPath(dest), canonicalPath(link)) {
+		t.Errorf("%s not seen inside %s", dest, link)
+	}
+	if prefixOf(canonicalPath(filepath.Join(dir, "other")), canonicalPath(link)) {
+		t.Errorf("%s wrongly seen inside %s", filepath.Join(dir, "other"), link)
+	}
+}
+
+func mkdirAll(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// copyPause is toggled by the TUI's 'p' key. While paused, workers take no
+// new files and in-flight copies block at their next buffer.
+var copyPause = &pauseGate{}
+
+// pauseGate blocks callers while paused and remembers when it was, so speed
+// and ETA can leave paused time out.
+type pauseGate struct {
+	mu        sync.Mutex
+	resume    chan struct{} // closed on resume; nil while running
+	intervals [][2]time.Time
+}
+
+// Toggle pauses or resumes and reports whether it is now paused.
+func (g *pauseGate) Toggle() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := clk.Now()
+	if g.resume != nil {
+		close(g.resume)
+		g.resume = nil
+		g.intervals[len(g.intervals)-1][1] = now
+		return false
+	}
+	g.resume = make(chan struct{})
+	g.intervals = append(g.intervals, [2]time.Time{now, {}})
+	return true
+}
+
+func (g *pauseGate) Paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resume != nil
+}
+
+// Wait blocks while paused; it returns ctx's error if cancelled meanwhile.
+func (g *pauseGate) Wait(ctx context.Context) error {
+	g.mu.Lock()
+	ch := g.resume
+	g.mu.Unlock()
+	if ch == nil {
+		return nil
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pausedSince returns how much of the time since t was spent paused.
+func (g *pauseGate) pausedSince(t time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := clk.Now()
+	var d time.Duration
+	for _, iv := range g.intervals {
+		from, to := iv[0], iv[1]
+		if to.IsZero() {
+			to = now
+		}
+		if from.Before(t) {
+			from = t
+		}
+		if to.After(from) {
+			d += to.Sub(from)
+		}
+	}
+	return d
+}
+
+// activeSince is the time since t minus pauses, for speed and ETA.
+func activeSince(t time.Time) time.Duration {
+	return since(t) - copyPause.pausedSince(t)
+}
+
+// throttle is called before each buffer is written: it waits out a pause,
+// then the bandwidth limit.
+func throttle(ctx context.Context, n int) error {
+	if err := copyPause.Wait(ctx); err != nil {
+		return err
+	}
+	return copyLimiter.Wait(ctx, n)
+}
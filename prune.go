@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pruneTrashPrefix marks a backup directory that prune is deleting. The
+// directory is renamed first so an interrupted prune never leaves a half
+// deleted backup that still looks complete; leftovers are removed by the
+// next prune.
+const pruneTrashPrefix = ".prune-"
+
+type backupRun struct {
+	Dir  string
+	Name string
+	When time.Time
+	Keep []string // policies that keep it
+	// Parents are the backups an --incremental run relies on for the
+	// files it did not copy again.
+	Parents []string
+}
+
+type retention struct {
+	Last, Daily, Weekly, Monthly int
+}
+
+func (r retention) empty() bool {
+	return r.Last <= 0 && r.Daily <= 0 && r.Weekly <= 0 && r.Monthly <= 0
+}
+
+// runPrune implements `backuper prune`: delete whole backup directories on
+// the USB that no retention policy keeps.
+func runPrune(args []string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	var keep retention
+	fs.IntVar(&keep.Last, "keep-last", 0, "Keep the N most recent backups")
+	fs.IntVar(&keep.Daily, "keep-daily", 0, "Keep the most recent backup of each of the last N days that have one")
+	fs.IntVar(&keep.Weekly, "keep-weekly", 0, "Keep the most recent backup of each of the last N weeks that have one")
+	fs.IntVar(&keep.Monthly, "keep-monthly", 0, "Keep the most recent backup of each of the last N months that have one")
+	dryRun := fs.Bool("dry-run", false, "Show what would be deleted without deleting anything")
+	assumeYes := fs.Bool("yes", false, "Do not ask for confirmation before deleting")
+	_ = fs.Parse(args)
+	g.apply()
+
+	if keep.empty() {
+		fail(fmt.Errorf("prune needs at least one of --keep-last, --keep-daily, --keep-weekly, --keep-monthly"))
+	}
+	root, err := usbRoot()
+	mustNoErr(err)
+	removeTrash(root)
+
+	runs := backupRuns(root)
+	applyRetention(runs, keep)
+	var drop []backupRun
+	for _, r := range runs {
+		if len(r.Keep) > 0 {
+			fmt.Printf("keep    %-40s %s  (%s)\n", r.Name, r.When.Local().Format("2006-01-02 15:04"), strings.Join(r.Keep, ", "))
+		} else {
+			fmt.Printf("remove  %-40s %s\n", r.Name, r.When.Local().Format("2006-01-02 15:04"))
+			drop = append(drop, r)
+		}
+	}
+	if len(drop) == 0 {
+		fmt.Println("Nothing to prune.")
+		return
+	}
+	if *dryRun {
+		fmt.Printf("Dry run: %d of %d backups would be deleted.\n", len(drop), len(runs))
+		return
+	}
+	if !*assumeYes && !confirmPrune(len(drop)) {
+		fmt.Println("Prune cancelled.")
+		return
+	}
+	failed := 0
+	for _, r := range drop {
+		if err := removeBackup(root, r); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", r.Name, err)
+			failed++
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, storeDirName)); err == nil {
+		fmt.Fprintf(os.Stderr, "note: %s is shared by all --dedup backups and was left untouched\n", storeDirName)
+	}
+	fmt.Printf("Pruned %d backups, %d errors\n", len(drop)-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// backupRuns lists the backup directories directly under the USB root,
+// newest first. Only directories with a manifest count, so prune never
+// touches anything it did not create; a backup written into the root
+// itself cannot be pruned.
+func backupRuns(root string) []backupRun {
+	var runs []backupRun
+	for _, m := range findManifests(root) {
+		dir := manifestBackupDir(m)
+		if filepath.Clean(dir) == filepath.Clean(root) {
+			continue
+		}
+		r := backupRun{Dir: dir, Name: filepath.Base(dir), When: backupTime(dir)}
+		if m, err := readRunMeta(dir); err == nil {
+			for _, p := range m.Parents {
+				r.Parents = append(r.Parents, filepath.Join(root, p))
+			}
+		}
+		runs = append(runs, r)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].When.After(runs[j].When) })
+	return runs
+}
+
+// backupTime is when the backup in dir was started: from its run metadata,
+// else from an auto-generated backup_YYYYMMDD_HHMMSS name, else the
+// directory's mtime.
+func backupTime(dir string) time.Time {
+	if m, err := readRunMeta(dir); err == nil && !m.Started.IsZero() {
+		return m.Started
+	}
+	name := filepath.Base(dir)
+	if strings.HasPrefix(name, "backup_") && len(name) >= len("backup_20060102_150405") {
+		if t, err := time.ParseInLocation("20060102_150405", name[len("backup_"):len("backup_20060102_150405")], time.Local); err == nil {
+			return t
+		}
+	}
+	if st, err := os.Stat(dir); err == nil {
+		return st.ModTime()
+	}
+	return time.Time{}
+}
+
+// applyRetention marks the runs (sorted newest first) each policy keeps.
+// The bucket policies keep the newest run of each of the N most recent
+// days/weeks/months that have a backup. Every run a kept incremental
+// backup is based on is kept along with it.
+func applyRetention(runs []backupRun, keep retention) {
+	for i := range runs {
+		if i < keep.Last {
+			runs[i].Keep = append(runs[i].Keep, "last")
+		}
+	}
+	bucket := func(policy string, n int, key func(time.Time) string) {
+		seen := map[string]bool{}
+		for i := range runs {
+			if len(seen) >= n {
+				return
+			}
+			k := key(runs[i].When.Local())
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			runs[i].Keep = append(runs[i].Keep, policy)
+		}
+	}
+	bucket("daily", keep.Daily, func(t time.Time) string { return t.Format("2006-01-02") })
+	bucket("weekly", keep.Weekly, func(t time.Time) string {
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w)
+	})
+	bucket("monthly", keep.Monthly, func(t time.Time) string { return t.Format("2006-01") })
+
+	byDir := map[string]int{}
+	for i, r := range runs {
+		byDir[filepath.Clean(r.Dir)] = i
+	}
+	done := map[int]bool{}
+	var need func(i int)
+	need = func(i int) {
+		if done[i] {
+			return
+		}
+		done[i] = true
+		for _, p := range runs[i].Parents {
+			if j, ok := byDir[filepath.Clean(p)]; ok {
+				runs[j].Keep = append(runs[j].Keep, "base of "+runs[i].Name)
+				need(j)
+			}
+		}
+	}
+	for i := range runs {
+		if len(runs[i].Keep) > 0 {
+			need(i)
+		}
+	}
+}
+
+func removeBackup(root string, r backupRun) error {
+	trash := filepath.Join(root, pruneTrashPrefix+r.Name)
+	if err := os.Rename(r.Dir, trash); err != nil {
+		return err
+	}
+	return os.RemoveAll(trash)
+}
+
+// removeTrash finishes deletions an earlier prune left behind.
+func removeTrash(root string) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), pruneTrashPrefix) {
+			if err := os.RemoveAll(filepath.Join(root, e.Name())); err != nil {
+				slog.Warn("could not remove", "file", e.Name(), "error", err)
+			}
+		}
+	}
+}
+
+func confirmPrune(n int) bool {
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		fmt.Fprintln(os.Stderr, "refusing to delete backups without confirmation; re-run with --yes")
+		return false
+	}
+	fmt.Printf("Delete %d backups? [y/N] ", n)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPruneKeepsIncrementalBase(t *testing.T) {
+	root := t.TempDir()
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeTestBackup(t, root, "old", day, nil, map[string]string{"a.txt": "old"})
+	base := writeTestBackup(t, root, "base", day.Add(24*time.Hour), nil, map[string]string{"a.txt": "a", "b.txt": "b"})
+	inc1 := writeTestBackup(t, root, "inc1", day.Add(48*time.Hour), nil, map[string]string{"a.txt": "a2"})
+	inc2 := writeTestBackup(t, root, "inc2", day.Add(72*time.Hour), nil, map[string]string{"c.txt": "c"})
+
+	// inc1 skipped b.txt, stored in base; inc2 skipped a.txt (in inc1) and
+	// b.txt (still in base).
+	b := ManifestRec{Src: "/src/b.txt", Dst: filepath.Join(base, "b.txt"), Status: "copied"}
+	a2 := ManifestRec{Src: "/src/a.txt", Dst: filepath.Join(inc1, "a.txt"), Status: "copied"}
+	setTestParents(t, root, inc1, []ManifestRec{b})
+	setTestParents(t, root, inc2, []ManifestRec{a2, b})
+	if m, _ := readRunMeta(inc2); len(m.Parents) != 2 || m.Parents[0] != "base" || m.Parents[1] != "inc1" {
+		t.Fatalf("inc2 parents = %v, want [base inc1]", m.Parents)
+	}
+
+	runs := backupRuns(root)
+	applyRetention(runs, retention{Last: 1})
+	kept := map[string]bool{}
+	for _, r := range runs {
+		kept[r.Name] = len(r.Keep) > 0
+	}
+	want := map[string]bool{"inc2": true, "inc1": true, "base": true, "old": false}
+	for name, k := range want {
+		if kept[name] != k {
+			t.Errorf("%s kept = %v, want %v (runs %+v)", name, kept[name], k, runs)
+		}
+	}
+
+	for _, r := range runs {
+		if r.Name == "base" && (len(r.Keep) == 0 || r.Keep[0] != "base of inc2") {
+			t.Errorf("base keep = %v, want it kept as the base of inc2", r.Keep)
+		}
+	}
+}
+
+// writeTestBackup creates a backup folder under root holding files, with a
+// manifest recording them as copied and run metadata started at when.
+func writeTestBackup(t *testing.T, root, name string, when time.Time, parents []string, files map[string]string) string {
+	t.Helper()
+	dir := filepath.Join(root, name)
+	mkdirAll(t, dir)
+	f, err := os.Create(filepath.Join(dir, manifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for rel, content := range files {
+		dst := filepath.Join(dir, filepath.FromSlash(rel))
+		mkdirAll(t, filepath.Dir(dst))
+		if err := os.WriteFile(dst, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		rec := ManifestRec{Src: "/src/" + rel, Dst: dst, Size: int64(len(content)), Status: "copied", Ts: float64(when.Unix())}
+		if err := enc.Encode(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeRunMeta(dir, runMeta{Started: when, Parents: parents}); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// setTestParents records the runs holding skipped as the parents of dir,
+// as an --incremental backup does.
+func setTestParents(t *testing.T, root, dir string, skipped []ManifestRec) {
+	t.Helper()
+	m, err := readRunMeta(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Parents = parentRuns(root, dir, skipped)
+	if err := writeRunMeta(dir, m); err != nil {
+		t.Fatal(err)
+	}
+}
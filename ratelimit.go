@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// copyLimiter caps the total copy bandwidth across all workers (--limit-rate);
+// nil means unlimited.
+var copyLimiter *rateLimiter
+
+// rateLimiter is a token bucket holding up to one second of traffic. A
+// request larger than the bucket takes it into debt and waits the debt off,
+// so copy buffers of any size are paced correctly.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(bytesPerSec int64) *rateLimiter {
+	return &rateLimiter{rate: float64(bytesPerSec), tokens: float64(bytesPerSec), last: time.Now()}
+}
+
+// Wait blocks until n bytes may be transferred or ctx is done. It is a
+// no-op on a nil limiter.
+func (l *rateLimiter) Wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if wait == 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --rclone remote:path backs up to anything rclone can reach (Google
+// Drive, OneDrive, SFTP, WebDAV, ...) by running the rclone binary for each
+// transfer; scanning, tiering, selection and the manifest stay here. Files
+// are streamed to `rclone rcat`, so nothing is staged twice. The remote
+// must already be set up with `rclone config`. Selection fits the free
+// space `rclone about` reports, or --rclone-quota when given.
+
+// rcloneDirNotFound is rclone's exit code when a listed directory is missing.
+const rcloneDirNotFound = 3
+
+type rcloneStore struct {
+	bin     string
+	remote  string // remote:path without a trailing slash
+	retries int
+}
+
+// newRcloneTarget checks that bin can reach remote and prepares the
+// staging folder. Listing and downloads are tried retries more times after
+// a failure; uploads rely on rclone's low-level retries, as a stream cannot
+// be replayed.
+func newRcloneTarget(ctx context.Context, bin, remote string, retries int) (*remoteTarget, error) {
+	if !strings.Contains(remote, ":") {
+		return nil, fmt.Errorf("invalid --rclone %q (want remote:path, as set up with rclone config)", remote)
+	}
+	path, err := exec.LookPath(bin)
+	if err != nil {
+		return nil, fmt.Errorf("rclone not found (install it or set --rclone-bin): %w", err)
+	}
+	if !strings.HasSuffix(remote, ":") {
+		remote = strings.TrimRight(remote, "/")
+	}
+	s := &rcloneStore{bin: path, remote: remote, retries: retries}
+	if _, err := s.run(ctx, nil, "lsf", "--max-depth", "1", s.remote); err != nil && exitCode(err) != rcloneDirNotFound {
+		return nil, err
+	}
+	return newRemoteTarget(s, "rclone", sanitizeLabel(remote))
+}
+
+func (s *rcloneStore) String() string { return s.remote }
+
+// path returns the rclone path of rel.
+func (s *rcloneStore) path(rel string) string {
+	if strings.HasSuffix(s.remote, ":") {
+		return s.remote + rel
+	}
+	return s.remote + "/" + rel
+}
+
+// run runs rclone with args, feeding it stdin, and returns its output. The
+// error carries the last line rclone logged.
+func (s *rcloneStore) run(ctx context.Context, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, s.bin, args...)
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.LastIndexByte(msg, '\n'); i >= 0 {
+			msg = msg[i+1:]
+		}
+		if msg == "" {
+			return nil, fmt.Errorf("rclone %s: %w", args[0], err)
+		}
+		return nil, fmt.Errorf("rclone %s: %w: %s", args[0], err, msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+func exitCode(err error) int {
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitCode()
+	}
+	return -1
+}
+
+func (s *rcloneStore) list(ctx context.Context, dir string, fn func(string, int64, time.Time)) error {
+	out, err := s.run(ctx, nil, "lsjson", "-R", "--files-only", "--no-mimetype", "--retries", strconv.Itoa(s.retries+1), s.path(dir))
+	if exitCode(err) == rcloneDirNotFound {
+		return nil // first run into this folder
+	} else if err != nil {
+		return err
+	}
+	var items []struct {
+		Path    string
+		Size    int64
+		ModTime time.Time
+	}
+	if err := json.Unmarshal(out, &items); err != nil {
+		return fmt.Errorf("rclone lsjson: %w", err)
+	}
+	for _, it := range items {
+		fn(dir+"/"+it.Path, it.Size, it.ModTime)
+	}
+	return nil
+}
+
+func (s *rcloneStore) get(ctx context.Context, rel, local string) error {
+	_, err := s.run(ctx, nil, "copyto", "--retries", strconv.Itoa(s.retries+1), s.path(rel), local)
+	return err
+}
+
+func (s *rcloneStore) put(ctx context.Context, rel string, r io.Reader, size int64) error {
+	_, err := s.run(ctx, r, "rcat", "--size", strconv.FormatInt(size, 10), s.path(rel))
+	return err
+}
+
+// free returns the free space rclone reports for the remote, or false when
+// the backend does not say.
+func (s *rcloneStore) free(ctx context.Context) (int64, bool) {
+	root := s.remote
+	if i := strings.IndexByte(root, ':'); i >= 0 {
+		root = root[:i+1]
+	}
+	out, err := s.run(ctx, nil, "about", "--json", root)
+	if err != nil {
+		return 0, false
+	}
+	var about struct {
+		Free *int64 `json:"free"`
+	}
+	if json.Unmarshal(out, &about) != nil || about.Free == nil {
+		return 0, false
+	}
+	return *about.Free, true
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+// BenchmarkReadOrder reads a tree in selection order and in --read-order
+// path order. Point TMPDIR
+// at a spinning disk, with a cold cache, to see the seek savings.
+func BenchmarkReadOrder(b *testing.B) {
+	files := benchTree(b, 2000, 64<<10)
+	// Selection order bears no relation to the directory layout; a fixed
+	// permutation stands in for it.
+	selection := make([][2]string, len(files))
+	for i := range files {
+		selection[i] = [2]string{files[i*7919%len(files)].Path, ""}
+	}
+	byPath := append([][2]string(nil), selection...)
+	sortByPath(byPath)
+
+	for _, order := range []struct {
+		name  string
+		pairs [][2]string
+	}{{"selection", selection}, {"path", byPath}} {
+		b.Run(order.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, p := range order.pairs {
+					f, err := os.Open(p[0])
+					if err != nil {
+						b.Fatal(err)
+					}
+					_, err = io.Copy(io.Discard, f)
+					f.Close()
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Remote destinations (--s3, --rclone) are not mounted filesystems. The
+// backup still runs against a local staging folder that stands in for the
+// USB root: logs, the manifest, run metadata and the report are written
+// there as usual, while each selected file is uploaded to the remote under
+// the same relative path it would have on a USB. The bookkeeping files are
+// uploaded next to the files when the run ends, and fetched back by the
+// next run into the same folder so unchanged files are skipped.
+
+// remoteOut is the remote being backed up to; nil for drives.
+var remoteOut *remoteTarget
+
+// remoteWorkers is the default number of files uploaded at once.
+const remoteWorkers = 4
+
+// remoteStore moves files to and from one kind of remote. Paths are
+// slash-separated and relative to the remote's base.
+type remoteStore interface {
+	String() string
+	// list calls fn for each file below dir.
+	list(ctx context.Context, dir string, fn func(rel string, size int64, mtime time.Time)) error
+	get(ctx context.Context, rel, local string) error
+	put(ctx context.Context, rel string, r io.Reader, size int64) error
+}
+
+type remoteTarget struct {
+	store remoteStore
+	root  string // local staging folder standing in for the USB root
+
+	// objects holds the size and time of the files under the backup folder
+	// by relative path: those listed when the run started plus uploads.
+	mu      sync.Mutex
+	objects map[string]splitInfo
+}
+
+// newRemoteTarget stages store's backups under the user's cache folder, in
+// a folder named after key.
+func newRemoteTarget(store remoteStore, kind string, key ...string) (*remoteTarget, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Join(append([]string{cache, "backuper", kind}, key...)...)
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &remoteTarget{store: store, root: root, objects: map[string]splitInfo{}}, nil
+}
+
+// rel maps a path in the staging folder to its path on the remote.
+func (t *remoteTarget) rel(local string) string {
+	rel, err := filepath.Rel(t.root, local)
+	if err != nil {
+		rel = filepath.Base(local)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// load lists the files already in the backup folder destDir and fetches
+// its bookkeeping files into the staging folder.
+func (t *remoteTarget) load(ctx context.Context, destDir string) error {
+	dir := t.rel(destDir)
+	err := t.store.list(ctx, dir, func(rel string, size int64, mtime time.Time) {
+		t.objects[rel] = splitInfo{name: path.Base(rel), size: size, mtime: mtime}
+	})
+	if err != nil {
+		return fmt.Errorf("%s: listing %s: %w", t.store, dir, err)
+	}
+	for name := range bookkeepingNames {
+		local := metaPath(destDir, name)
+		obj, ok := t.objects[t.rel(local)]
+		if !ok {
+			continue
+		}
+		if st, err := os.Stat(local); err == nil && !st.ModTime().Before(obj.mtime) {
+			continue // the staged copy is current, e.g. after an upload failed
+		}
+		if err := t.store.get(ctx, t.rel(local), local); err != nil {
+			return fmt.Errorf("%s: fetching %s: %w", t.store, name, err)
+		}
+	}
+	if len(t.objects) > 0 {
+		slog.Info("Existing remote files", "count", len(t.objects), "dir", dir)
+	}
+	return nil
+}
+
+// Stat returns the remote file stored for dst.
+func (t *remoteTarget) Stat(dst string) (os.FileInfo, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if st, ok := t.objects[t.rel(dst)]; ok {
+		return st, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: dst, Err: os.ErrNotExist}
+}
+
+// Upload stores src as the remote file for dst.
+func (t *remoteTarget) Upload(ctx context.Context, src, dst string, agg *progressAgg, logsCh chan string, plain bool) (string, string, copyInfo) {
+	var info copyInfo
+	in, err := os.Open(src)
+	if err != nil {
+		return "error", err.Error(), info.failed(err)
+	}
+	defer in.Close()
+	st, err := in.Stat()
+	if err != nil {
+		return "error", err.Error(), info.failed(err)
+	}
+	rel := t.rel(dst)
+	progressEvents.Emit(progressEvent{Event: "file_start", Path: src, Dst: dst, Size: st.Size()})
+	fileLog(logsCh, plain, slog.LevelInfo, "Start", "file", filepath.Base(src), "bytes", st.Size(), "remote", rel)
+	var h hash.Hash
+	var r io.Reader = &ctxReader{ctx: ctx, r: in, agg: agg}
+	if recordChecksums {
+		h, _ = newChecksumHash(checksumAlgo)
+		r = io.TeeReader(r, h)
+	}
+	started := clk.Now()
+	if err := t.store.put(ctx, rel, r, st.Size()); err != nil {
+		return "error", fmt.Sprintf("%s: %v", t.store, err), info.failed(err)
+	}
+	if h != nil {
+		info.Checksum = formatChecksum(checksumAlgo, h)
+	}
+	t.mu.Lock()
+	t.objects[rel] = splitInfo{name: path.Base(rel), size: st.Size(), mtime: clk.Now()}
+	t.mu.Unlock()
+	fileLog(logsCh, plain, slog.LevelInfo, "Done", "file", filepath.Base(src), "bytes", st.Size(), "duration", since(started))
+	return "copied", "ok", info
+}
+
+// saveMeta uploads the bookkeeping files of destDir, so the manifest and
+// report live on the remote next to the files they describe.
+func (t *remoteTarget) saveMeta(destDir string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	for name := range bookkeepingNames {
+		local := metaPath(destDir, name)
+		if strings.HasSuffix(name, ".reserve") {
+			continue
+		}
+		f, err := os.Open(local)
+		if err != nil {
+			continue
+		}
+		st, err := f.Stat()
+		if err == nil {
+			err = t.store.put(ctx, t.rel(local), f, st.Size())
+		}
+		f.Close()
+		if err != nil {
+			slog.Warn("failed to upload", "file", name, "remote", t.store, "error", err)
+		}
+	}
+	slog.Info("Uploaded manifest", "remote", t.store, "path", t.rel(metaPath(destDir, manifestName)))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	"time"
+)
+
+// After each run a short report is saved next to the manifest so someone
+// who never touches the command line can open it from the USB and see that
+// the backup worked: what was copied per tier, what failed, how fast and
+// how much room is left.
+
+const (
+	reportHTMLName = "backup-report.html"
+	reportMDName   = "backup-report.md"
+)
+
+// runReport is everything the report shows.
+type runReport struct {
+	Summary  runSummary
+	Label    string
+	Host     string
+	Started  time.Time
+	Finished time.Time
+	Sources  []string
+	Free     int64
+	Failed   []ManifestRec // this run's failed files
+}
+
+// reportFormats parses --report: html, md, both or off.
+func reportFormats(mode string) ([]string, error) {
+	switch strings.ToLower(mode) {
+	case "html":
+		return []string{"html"}, nil
+	case "md", "markdown":
+		return []string{"md"}, nil
+	case "both":
+		return []string{"html", "md"}, nil
+	case "off", "none", "":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("invalid --report %q (want html|md|both|off)", mode)
+}
+
+// runFailures returns the error records written to manifestPath since start.
+func runFailures(manifestPath string, start time.Time) []ManifestRec {
+	var out []ManifestRec
+	since := float64(start.UnixNano()) / 1e9
+	_ = readManifest(manifestPath, func(rec ManifestRec) {
+		if rec.Status == "error" && rec.Ts >= since {
+			out = append(out, rec)
+		}
+	})
+	return out
+}
+
+// Verdict is the one-line answer to "did it work?".
+func (r runReport) Verdict() string {
+	s := r.Summary
+	switch s.ExitReason {
+	case "completed":
+		return "Backup completed successfully"
+	case "completed-with-errors":
+		return fmt.Sprintf("Backup finished, but %d file(s) could not be copied", s.Errors)
+	case "cancelled":
+		return "Backup was stopped before it finished"
+	case "aborted":
+		return "Backup was aborted before copying"
+	}
+	return "Backup ended: " + s.ExitReason
+}
+
+// OK reports whether the run finished without errors.
+func (r runReport) OK() bool { return r.Summary.ExitReason == "completed" }
+
+func (r runReport) Duration() string {
+	return formatETA(r.Summary.DurationSec)
+}
+
+// Speed is the average copy rate over the whole run.
+func (r runReport) Speed() string {
+	if r.Summary.DurationSec <= 0 {
+		return "-"
+	}
+	return humanSize(int64(float64(r.Summary.CopiedBytes)/r.Summary.DurationSec)) + "/s"
+}
+
+// NotSelected counts scanned files left out because they did not fit or
+// ranked too low.
+func (r runReport) NotSelected() int { return r.Summary.Scanned - r.Summary.Selected }
+
+func (r runReport) NotSelectedBytes() int64 {
+	return r.Summary.ScannedBytes - r.Summary.SelectedBytes
+}
+
+// writeReports saves the report in each format under dir's meta folder.
+func writeReports(dir string, formats []string, r runReport) error {
+	for _, f := range formats {
+		var body string
+		name := reportMDName
+		if f == "html" {
+			var b strings.Builder
+			if err := reportTemplate.Execute(&b, r); err != nil {
+				return err
+			}
+			body, name = b.String(), reportHTMLName
+		} else {
+			body = markdownReport(r)
+		}
+		if err := os.WriteFile(metaPath(dir, name), []byte(body), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func markdownReport(r runReport) string {
+	s := r.Summary
+	var b strings.Builder
+	p := func(format string, a ...any) { fmt.Fprintf(&b, format+"\n", a...) }
+	p("# Backup report")
+	p("")
+	mark := "✅"
+	if !r.OK() {
+		mark = "⚠️"
+	}
+	p("**%s %s**", mark, r.Verdict())
+	p("")
+	if r.Label != "" {
+		p("- Label: %s", r.Label)
+	}
+	p("- Computer: %s", r.Host)
+	p("- Started: %s", r.Started.Format("2006-01-02 15:04:05"))
+	p("- Finished: %s (took %s)", r.Finished.Format("2006-01-02 15:04:05"), r.Duration())
+	p("- Backed up from: %s", strings.Join(r.Sources, ", "))
+	p("- Saved to: %s", s.Destination)
+	p("")
+	p("## Totals")
+	p("")
+	p("| | Files | Size |")
+	p("|---|---:|---:|")
+	p("| Copied this run | %d | %s |", s.Copied, humanSize(s.CopiedBytes))
+	p("| Already on the USB | %d | |", s.Skipped)
+	p("| Failed | %d | |", s.Errors)
+	p("| Left out (did not fit) | %d | %s |", r.NotSelected(), humanSize(r.NotSelectedBytes()))
+	p("")
+	p("Average speed: %s. Free space left on the USB: %s.", r.Speed(), humanSize(r.Free))
+	p("")
+	if len(s.Tiers) > 0 {
+		p("## By importance")
+		p("")
+		p("| Tier | Files | Size |")
+		p("|---|---:|---:|")
+		for _, t := range s.Tiers {
+			p("| %s | %d | %s |", t.Name, t.Files, humanSize(t.Bytes))
+		}
+		p("")
+	}
+	if len(r.Failed) > 0 {
+		p("## Files that could not be copied")
+		p("")
+		for _, rec := range r.Failed {
+			p("- `%s`: %s", rec.Src, rec.Message)
+		}
+		p("")
+	}
+	return b.String()
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"size": humanSize,
+	"when": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Backup report</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 48em; margin: 2em auto; padding: 0 1em; color: #222; }
+.verdict { font-size: 1.4em; padding: .6em 1em; border-radius: 6px; }
+.ok { background: #e3f7e6; color: #185c25; }
+.bad { background: #fdecea; color: #8a1c12; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { padding: .3em .8em; border-bottom: 1px solid #ddd; text-align: left; }
+td.n { text-align: right; }
+dt { font-weight: bold; float: left; clear: left; width: 10em; }
+dd { margin-left: 11em; }
+</style>
+</head>
+<body>
+<h1>Backup report</h1>
+<p class="verdict {{if .OK}}ok{{else}}bad{{end}}">{{if .OK}}&#x2705;{{else}}&#x26A0;&#xFE0F;{{end}} {{.Verdict}}</p>
+<dl>
+{{- if .Label}}<dt>Label</dt><dd>{{.Label}}</dd>{{end}}
+<dt>Computer</dt><dd>{{.Host}}</dd>
+<dt>Started</dt><dd>{{when .Started}}</dd>
+<dt>Finished</dt><dd>{{when .Finished}} (took {{.Duration}})</dd>
+<dt>Backed up from</dt><dd>{{join .Sources ", "}}</dd>
+<dt>Saved to</dt><dd>{{.Summary.Destination}}</dd>
+</dl>
+<h2>Totals</h2>
+<table>
+<tr><th></th><th>Files</th><th>Size</th></tr>
+<tr><td>Copied this run</td><td class="n">{{.Summary.Copied}}</td><td class="n">{{size .Summary.CopiedBytes}}</td></tr>
+<tr><td>Already on the USB</td><td class="n">{{.Summary.Skipped}}</td><td></td></tr>
+<tr><td>Failed</td><td class="n">{{.Summary.Errors}}</td><td></td></tr>
+<tr><td>Left out (did not fit)</td><td class="n">{{.NotSelected}}</td><td class="n">{{size .NotSelectedBytes}}</td></tr>
+</table>
+<p>Average speed: {{.Speed}}. Free space left on the USB: {{size .Free}}.</p>
+{{- if .Summary.Tiers}}
+<h2>By importance</h2>
+<table>
+<tr><th>Tier</th><th>Files</th><th>Size</th></tr>
+{{- range .Summary.Tiers}}
+<tr><td>{{.Name}}</td><td class="n">{{.Files}}</td><td class="n">{{size .Bytes}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .Failed}}
+<h2>Files that could not be copied</h2>
+<ul>
+{{- range .Failed}}
+<li><code>{{.Src}}</code>: {{.Message}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
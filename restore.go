@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runRestore implements `backuper restore`: copy a backup folder back out to
+// a target directory using the manifest, recreating the directory layout and
+// the original modification times.
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	from := fs.String("from", "", "Backup folder to restore (relative to the USB root, or absolute)")
+	to := fs.String("to", "", "Directory to restore into")
+	dryRun := fs.Bool("dry-run", false, "List what would be restored without writing anything")
+	passFile := fs.String("passphrase-file", "", "Read the passphrase for encrypted backups from this file")
+	keyringDir := fs.String("keyring", "", "Keyring directory holding the key files encrypted backups were sealed with")
+	_ = fs.Parse(args)
+	g.apply()
+	noProgress = true
+
+	if *to == "" {
+		fail(fmt.Errorf("restore needs --to"))
+	}
+	root, err := usbRoot()
+	mustNoErr(err)
+	backupDir, err := resolveBackupDir(root, *from)
+	mustNoErr(err)
+	target, err := filepath.Abs(expandPath(*to))
+	mustNoErr(err)
+	if prefixOf(canonicalPath(target), canonicalPath(backupDir)) {
+		fail(fmt.Errorf("restore target %s is inside the backup %s", target, backupDir))
+	}
+	if _, ok := manifestIn(backupDir); !ok {
+		fail(fmt.Errorf("no manifest found in %s", backupDir))
+	}
+	chain, err := backupChain(root, backupDir)
+	mustNoErr(err)
+	if len(chain) > 1 {
+		fmt.Printf("%s is incremental; restoring it on top of %d earlier backup(s)\n", filepath.Base(backupDir), len(chain)-1)
+	}
+	latest, err := chainRecords(chain)
+	mustNoErr(err)
+	recs := make([]ManifestRec, 0, len(latest))
+	// Hard links and duplicates are made once the files they point to are
+	// restored.
+	var links []ManifestRec
+	var total int64
+	for _, rec := range latest {
+		if rec.Status == "hardlink" || rec.Status == "alias" {
+			links = append(links, rec)
+			continue
+		}
+		recs = append(recs, rec)
+		total += rec.Size
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Dst < recs[j].Dst })
+	sort.Slice(links, func(i, j int) bool { return links[i].Dst < links[j].Dst })
+
+	if cat, err := readSpanCatalog(metaPath(backupDir, spanCatalogName)); err == nil && len(cat.Drives) > 0 {
+		reportSpan(cat)
+	}
+
+	if *dryRun {
+		for _, rec := range recs {
+			if rel, err := filepath.Rel(chainDir(chain, rec.Dst), rec.Dst); err == nil {
+				fmt.Printf("%s -> %s\n", rec.Dst, filepath.Join(target, rel))
+			}
+		}
+		for _, rec := range links {
+			if rel, err := filepath.Rel(chainDir(chain, rec.Dst), rec.Dst); err == nil {
+				kind := "hard link"
+				if rec.Status == "alias" {
+					kind = "duplicate"
+				}
+				fmt.Printf("%s -> %s (%s of %s)\n", rec.Dst, filepath.Join(target, rel), kind, rec.Message)
+			}
+		}
+		fmt.Printf("Dry run: %d files (%s) and %d hard links or duplicates would be restored to %s\n", len(recs), humanSize(total), len(links), target)
+		return
+	}
+
+	// Each backup of the chain keeps its own keyring and archives.
+	byDir := map[string][]ManifestRec{}
+	for _, rec := range recs {
+		d := chainDir(chain, rec.Dst)
+		byDir[d] = append(byDir[d], rec)
+	}
+	var keys map[string]*fileKey
+	if *keyringDir != "" {
+		keys, err = keyDirKeys(expandPath(*keyringDir))
+		mustNoErr(err)
+		if missing := missingKeys(recs, keys); len(missing) > 0 {
+			fail(fmt.Errorf("files were sealed with key(s) %s, which the keyring %s does not hold", strings.Join(missing, ", "), *keyringDir))
+		}
+	}
+	for _, dir := range chain {
+		for _, rec := range byDir[dir] {
+			if rec.Encrypted != "" && *keyringDir == "" {
+				k, err := unlockKeyring(metaPath(dir, encKeyringName), *passFile)
+				mustNoErr(err)
+				if keys == nil {
+					keys = map[string]*fileKey{}
+				}
+				for id, key := range k {
+					keys[id] = key
+				}
+				break
+			}
+		}
+		mustNoErr(prepareArchives(dir, byDir[dir], *passFile))
+	}
+
+	mustNoErr(os.MkdirAll(target, 0o755))
+	dirs := 0
+	for _, dir := range chain {
+		// A backup written into the USB root holds the other folders.
+		if dir == backupDir || filepath.Clean(dir) != filepath.Clean(root) {
+			dirs += restoreDirs(dir, target)
+		}
+	}
+
+	w := g.workers
+	if w <= 0 {
+		w = autoWorkers(detectMedia(target))
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	fmt.Printf("Restoring %d files (%s) from %s to %s with %d worker(s)...\n", len(recs), humanSize(total), backupDir, target, w)
+	agg := &progressAgg{total: total, start: clk.Now()}
+	jobs := make(chan ManifestRec)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	counts := map[string]int{}
+	for i := 0; i < w; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range jobs {
+				status, msg := restoreOne(ctx, rec, chainDir(chain, rec.Dst), target, keys, agg, &mu)
+				mu.Lock()
+				counts[status]++
+				fmt.Printf("[%s] %s", status, rec.Dst)
+				if status != "restored" {
+					fmt.Printf(": %s", msg)
+				}
+				fmt.Println()
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, rec := range recs {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- rec
+	}
+	close(jobs)
+	wg.Wait()
+	for _, rec := range links {
+		if ctx.Err() != nil {
+			break
+		}
+		status, msg := restoreLink(ctx, rec, chainDir(chain, rec.Dst), target, agg, &mu)
+		counts[status]++
+		fmt.Printf("[%s] %s", status, rec.Dst)
+		if status != "restored" {
+			fmt.Printf(": %s", msg)
+		}
+		fmt.Println()
+	}
+
+	elapsed := since(agg.start).Seconds()
+	fmt.Printf("Restore complete in %.2fs: restored=%d, skipped=%d, errors=%d, dirs=%d\n",
+		elapsed, counts["restored"], counts["skipped"], counts["error"], dirs)
+	if ctx.Err() != nil {
+		fmt.Println("Result: INCOMPLETE (interrupted)")
+		os.Exit(1)
+	}
+	if counts["error"] > 0 {
+		os.Exit(1)
+	}
+}
+
+// chainRecords lays the manifests of chain (oldest first) over each other
+// and returns the latest record per file, as in verify, keyed by its path
+// inside the backup. Dst, and the first name of a link, point into the
+// folder that holds the file.
+func chainRecords(chain []string) (map[string]ManifestRec, error) {
+	latest := map[string]ManifestRec{}
+	for _, dir := range chain {
+		manifest, ok := manifestIn(dir)
+		if !ok {
+			return nil, fmt.Errorf("no manifest found in %s", dir)
+		}
+		err := readManifest(manifest, func(rec ManifestRec) {
+			switch rec.Status {
+			case "copied", "skipped", "symlink", "hardlink", "alias":
+			default:
+				return
+			}
+			rec.Dst = rebaseDst(rec.Dst, dir)
+			rel, err := filepath.Rel(dir, rec.Dst)
+			if err != nil {
+				return
+			}
+			if rec.Status == "hardlink" || rec.Status == "alias" {
+				rec.Message = rebaseDst(rec.Message, dir)
+			}
+			// The same file may be stored compressed in one run and
+			// plainly in the next.
+			for _, ext := range []string{refExt, encExt, zstdExt} {
+				rel = strings.TrimSuffix(rel, ext)
+			}
+			latest[filepath.ToSlash(rel)] = rec
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return latest, nil
+}
+
+// restoreLink recreates a hard link recorded by --hardlinks, pointing it at
+// the restored copy of its first name, or copies that file where the target
+// cannot link. A duplicate recorded by --skip-duplicates is always copied,
+// as it was a file of its own.
+func restoreLink(ctx context.Context, rec ManifestRec, backupDir, target string, agg *progressAgg, mu *sync.Mutex) (string, string) {
+	rel, err := filepath.Rel(backupDir, rec.Dst)
+	prel, perr := filepath.Rel(backupDir, rec.Message)
+	if err != nil || perr != nil || strings.HasPrefix(rel, "..") || strings.HasPrefix(prel, "..") {
+		return "error", "destination outside the backup folder"
+	}
+	out, primary := filepath.Join(target, rel), filepath.Join(target, prel)
+	if _, err := os.Lstat(out); err == nil {
+		return "skipped", "exists"
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return "error", err.Error()
+	}
+	if rec.Status == "hardlink" {
+		if err := os.Link(primary, out); err == nil {
+			return "restored", ""
+		}
+	}
+	status, msg, _ := copyOneWithProgress(ctx, primary, out, agg, mu, nil, true)
+	if status == "copied" && rec.Status == "alias" {
+		if rec.MTime != 0 {
+			mt := time.Unix(rec.MTime, 0)
+			_ = os.Chtimes(out, mt, mt)
+		}
+		return "restored", ""
+	}
+	if status == "copied" {
+		return "restored", "copied (cannot link)"
+	}
+	return status, msg
+}
+
+// restoreOne copies a single backed-up file (or recreates a recorded
+// symlink) below target and puts its recorded mtime back.
+func restoreOne(ctx context.Context, rec ManifestRec, backupDir, target string, keys map[string]*fileKey, agg *progressAgg, mu *sync.Mutex) (string, string) {
+	rel, err := filepath.Rel(backupDir, rec.Dst)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "error", "destination outside the backup folder"
+	}
+	out := filepath.Join(target, rel)
+	if rec.Status == "symlink" {
+		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+			return "error", err.Error()
+		}
+		if _, err := os.Lstat(out); err == nil {
+			return "skipped", "exists"
+		}
+		if err := os.Symlink(rec.Message, out); err != nil {
+			return "error", err.Error()
+		}
+		return "restored", ""
+	}
+	if rec.Archive != "" {
+		status, msg := restoreArchived(ctx, rec, backupDir, out, agg)
+		if status == "restored" && rec.MTime != 0 {
+			mt := time.Unix(rec.MTime, 0)
+			_ = os.Chtimes(out, mt, mt)
+		}
+		return status, msg
+	}
+	stored := rec.Dst
+	if rec.Dedup == "ref" {
+		obj, _, err := resolveRef(rec.Dst)
+		if err != nil {
+			agg.AddTotal(-rec.Size)
+			return "error", err.Error()
+		}
+		stored, out = obj, strings.TrimSuffix(out, refExt)
+	}
+	if _, err := statDest(stored); err != nil {
+		agg.AddTotal(-rec.Size)
+		return "error", "missing from backup"
+	}
+	var status, msg string
+	if rec.Compression == "zstd" || rec.Encrypted != "" || rec.Parts > 0 {
+		if rec.Encrypted != "" {
+			out = strings.TrimSuffix(out, encExt)
+		}
+		if rec.Compression == "zstd" {
+			out = strings.TrimSuffix(out, zstdExt)
+		}
+		status, msg = restoreTransformed(ctx, rec, out, keys, agg)
+	} else {
+		status, msg, _ = copyOneWithProgress(ctx, stored, out, agg, mu, nil, true)
+	}
+	switch status {
+	case "copied":
+		status = "restored"
+	case "skipped":
+		agg.AddTotal(-rec.Size)
+		return status, msg
+	default:
+		return status, msg
+	}
+	// The copy carries over the backup file's mtime; the manifest wins if
+	// the backup copy was touched since.
+	if rec.MTime != 0 {
+		if st, err := os.Stat(out); err == nil && st.ModTime().Unix() != rec.MTime {
+			mt := time.Unix(rec.MTime, 0)
+			_ = os.Chtimes(out, mt, mt)
+		}
+	}
+	return status, msg
+}
+
+// restoreTransformed joins, decrypts and/or decompresses a stored file to out,
+// going through a .part file like the copy path. An existing file of the
+// original size is left alone.
+func restoreTransformed(ctx context.Context, rec ManifestRec, out string, keys map[string]*fileKey, agg *progressAgg) (string, string) {
+	if st, err := os.Stat(out); err == nil && st.Size() == rec.Size {
+		return "skipped", "exists-same-size"
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return "error", err.Error()
+	}
+	tmp := out + ".part"
+	if rec.Encrypted == "" {
+		keys = nil
+	}
+	if err := untransformFile(ctx, rec.Dst, rec.Parts, tmp, rec.Compression == "zstd", keys, agg); err != nil {
+		_ = os.Remove(tmp)
+		return "error", err.Error()
+	}
+	if st, err := statDest(rec.Dst); err == nil {
+		_ = os.Chtimes(tmp, clk.Now(), st.ModTime())
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		_ = os.Remove(tmp)
+		return "error", err.Error()
+	}
+	return "copied", "ok"
+}
+
+// restoreDirs recreates every directory of the backup below target, so
+// folders that held no files (--include-empty-dirs) come back too. The
+// metadata folder is left out. It returns the number of directories created.
+func restoreDirs(backupDir, target string) int {
+	meta := metaPath(backupDir, "")
+	n := 0
+	_ = filepath.WalkDir(backupDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || p == backupDir {
+			return nil
+		}
+		if p == filepath.Clean(meta) {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(backupDir, p)
+		if err != nil {
+			return nil
+		}
+		out := filepath.Join(target, rel)
+		if _, err := os.Stat(out); os.IsNotExist(err) {
+			if os.MkdirAll(out, 0o755) == nil {
+				n++
+			}
+		}
+		return nil
+	})
+	return n
+}
+
+// reportSpan tells the user which other drives of a spanned backup hold
+// files this drive does not. A drive's catalog covers itself and the drives
+// before it; the last drive's catalog is complete.
+func reportSpan(cat spanCatalog) {
+	this := cat.Drives[len(cat.Drives)-1].Index
+	elsewhere := map[int]int{}
+	for _, d := range cat.Files {
+		if d != this {
+			elsewhere[d]++
+		}
+	}
+	fmt.Printf("Spanned backup %q: this is drive %d\n", cat.Set, this)
+	for _, d := range cat.Drives {
+		if n := elsewhere[d.Index]; n > 0 {
+			fmt.Printf("  drive %d holds %d more files (%s); restore it separately\n", d.Index, n, humanSize(d.Bytes))
+		}
+	}
+	fmt.Println("  later drives, if any, hold the rest; the last drive's catalog lists every file")
+}
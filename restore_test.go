@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRestoreIncrementalChain(t *testing.T) {
+	root := t.TempDir()
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeTestBackup(t, root, "base", day, nil, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	writeTestBackup(t, root, "inc1", day.Add(time.Hour), []string{"base"}, map[string]string{"a.txt": "a2"})
+	inc2 := writeTestBackup(t, root, "inc2", day.Add(2*time.Hour), []string{"inc1"}, map[string]string{"c.txt": "c"})
+
+	chain, err := backupChain(root, inc2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, d := range chain {
+		names = append(names, filepath.Base(d))
+	}
+	if strings.Join(names, ",") != "base,inc1,inc2" {
+		t.Fatalf("chain = %v, want base,inc1,inc2", names)
+	}
+	latest, err := chainRecords(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(t.TempDir(), "out")
+	agg := &progressAgg{start: clk.Now()}
+	var mu sync.Mutex
+	for _, rec := range latest {
+		if status, msg := restoreOne(context.Background(), rec, chainDir(chain, rec.Dst), target, nil, agg, &mu); status != "restored" {
+			t.Fatalf("restore %s: %s %s", rec.Dst, status, msg)
+		}
+	}
+	want := map[string]string{"a.txt": "a2", "sub/b.txt": "b", "c.txt": "c"}
+	if len(latest) != len(want) {
+		t.Errorf("%d records, want %d: %v", len(latest), len(want), latest)
+	}
+	for rel, content := range want {
+		got, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(rel)))
+		if err != nil || string(got) != content {
+			t.Errorf("%s = %q, %v; want %q", rel, got, err, content)
+		}
+	}
+
+	// Without its base the chain is refused rather than restored partially.
+	if err := os.RemoveAll(filepath.Join(root, "base")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backupChain(root, inc2); err == nil || !strings.Contains(err.Error(), "base") {
+		t.Errorf("backupChain without base: %v, want an error naming it", err)
+	}
+}
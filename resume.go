@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"hash"
+	"io"
+	"os"
+)
+
+// resumeTailSize is how much of the end of a kept .part file is compared
+// with the source before appending to it.
+const resumeTailSize = 1 << 20
+
+// resumable reports whether a copy of src would be a plain byte-for-byte
+// copy into a single .part file, the only kind that can be continued.
+func resumable(src string, size int64) bool {
+	return encryptKey == nil && dedupStore == nil && !shouldCompress(src) && !needsSplit(size)
+}
+
+// resumeOffset returns how many bytes of part can be kept when copying src:
+// the .part must be shorter than the source, not older than it, and its
+// last resumeTailSize bytes must match the source at the same offset.
+// Otherwise it returns 0 and the copy starts over.
+func resumeOffset(src, part string) int64 {
+	sst, err := os.Stat(src)
+	if err != nil {
+		return 0
+	}
+	pst, err := os.Stat(part)
+	if err != nil || !pst.Mode().IsRegular() || pst.Size() == 0 || pst.Size() >= sst.Size() || pst.ModTime().Before(sst.ModTime()) {
+		return 0
+	}
+	n := pst.Size()
+	tail := int64(resumeTailSize)
+	if tail > n {
+		tail = n
+	}
+	a, err := readAt(src, n-tail, tail)
+	if err != nil {
+		return 0
+	}
+	b, err := readAt(part, n-tail, tail)
+	if err != nil || !bytes.Equal(a, b) {
+		return 0
+	}
+	return n
+}
+
+func readAt(path string, off, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, n)
+	_, err = f.ReadAt(buf, off)
+	return buf, err
+}
+
+// openResume prepares a resumed copy: in is positioned at off, the .part
+// is opened for appending at off, and h (when set) is fed the source's
+// first off bytes so the checksum still covers the whole file.
+func openResume(in *os.File, part string, off int64, h hash.Hash) (*os.File, error) {
+	if h != nil {
+		f, err := os.Open(in.Name())
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.CopyN(h, f, off)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := in.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+	out, err := os.OpenFile(part, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := out.Truncate(off); err == nil {
+		_, err = out.Seek(off, io.SeekStart)
+	}
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	return out, nil
+}
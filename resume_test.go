@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResumePartialCopy(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	dst := filepath.Join(dir, "usb", "src.bin")
+	mkdirAll(t, filepath.Dir(dst))
+	data := bytes.Repeat([]byte("resumable data "), 3000)
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(src, old, old); err != nil {
+		t.Fatal(err)
+	}
+	part := dst + ".part"
+	writePart := func(b []byte) {
+		t.Helper()
+		if err := os.WriteFile(part, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only a matching prefix written after the source changed is kept.
+	writePart(data[:1200])
+	if off := resumeOffset(src, part); off != 1200 {
+		t.Errorf("matching .part: offset %d, want 1200", off)
+	}
+	writePart(bytes.Repeat([]byte{'?'}, 1200))
+	if off := resumeOffset(src, part); off != 0 {
+		t.Errorf("differing .part: offset %d, want 0", off)
+	}
+	writePart(data)
+	if off := resumeOffset(src, part); off != 0 {
+		t.Errorf("complete .part: offset %d, want 0", off)
+	}
+	writePart(data[:1200])
+	older := old.Add(-time.Hour)
+	if err := os.Chtimes(part, older, older); err != nil {
+		t.Fatal(err)
+	}
+	if off := resumeOffset(src, part); off != 0 {
+		t.Errorf(".part older than the source: offset %d, want 0", off)
+	}
+
+	// The copy picks up the kept prefix and ends up complete.
+	writePart(data[:1200])
+	noProgress = true
+	copied, errs, _ := copyAll(context.Background(), [][2]string{{src, dst}}, filepath.Join(dir, "usb", manifestName), 1, nil)
+	if copied != 1 || errs != 0 {
+		t.Fatalf("copyAll = %d copied, %d errors; want 1, 0", copied, errs)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("resumed copy: %d bytes, %v; want the source's %d", len(got), err, len(data))
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Errorf(".part left behind: %v", err)
+	}
+}
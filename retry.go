@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// copyRetries and retryBaseDelay configure how often a copy that failed
+// with a transient error is tried again (--retries, --retry-delay).
+var (
+	copyRetries    int
+	retryBaseDelay = time.Second
+)
+
+const maxRetryDelay = 30 * time.Second
+
+// A network share that drops can take a while to reconnect, so copies to
+// one default to more retries spaced further apart (about three minutes
+// in all) unless --retries or --retry-delay say otherwise.
+const (
+	networkRetries    = 8
+	networkRetryDelay = 5 * time.Second
+)
+
+// retryBackoff is the wait before retry n (1-based): the base delay doubled
+// for each earlier retry, capped at maxRetryDelay.
+func retryBackoff(n int) time.Duration {
+	d := retryBaseDelay
+	for i := 1; i < n && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
+
+// sleepCtx waits for d and reports false if ctx ended first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
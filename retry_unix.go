@@ -0,0 +1,24 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// isTransient reports whether err is the kind of failure a flaky USB device
+// or a dropped network share produces and that may succeed when tried
+// again. ESTALE comes from a share that reconnected under open handles, so
+// the retry opens the files afresh.
+func isTransient(err error) bool {
+	for _, e := range []unix.Errno{unix.EIO, unix.ENODEV, unix.ENXIO, unix.ETIMEDOUT, unix.EAGAIN, unix.EBUSY,
+		unix.ESTALE, unix.ECONNRESET, unix.ECONNABORTED, unix.EHOSTDOWN, unix.EHOSTUNREACH, unix.ENETDOWN,
+		unix.ENETRESET, unix.ENETUNREACH} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
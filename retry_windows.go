@@ -0,0 +1,26 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isTransient reports whether err is the kind of failure a flaky USB device
+// or a dropped network share produces and that may succeed when tried
+// again. A share that reconnects invalidates open handles, so the retry
+// opens the files afresh.
+func isTransient(err error) bool {
+	for _, e := range []windows.Errno{windows.ERROR_CRC, windows.ERROR_GEN_FAILURE, windows.ERROR_NOT_READY,
+		windows.ERROR_DEV_NOT_EXIST, windows.ERROR_SEM_TIMEOUT, windows.ERROR_IO_DEVICE, windows.ERROR_DEVICE_NOT_CONNECTED,
+		windows.ERROR_NETNAME_DELETED, windows.ERROR_UNEXP_NET_ERR, windows.ERROR_BAD_NETPATH, windows.ERROR_NETWORK_BUSY,
+		windows.ERROR_BAD_NET_RESP, windows.ERROR_VC_DISCONNECTED, windows.ERROR_NETWORK_UNREACHABLE,
+		windows.ERROR_HOST_UNREACHABLE, windows.ERROR_CONNECTION_ABORTED, windows.ERROR_INVALID_HANDLE} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --review shows the planned selection as a tree in the TUI before anything
+// is copied. Directories expand and collapse, space toggles a file or a
+// whole directory, and the header keeps per-tier and total figures against
+// the space budget. Enter starts the copy with whatever is ticked.
+
+// reviewNode is a source, directory or scanned file in the review tree.
+// Directory counters cover everything beneath them.
+type reviewNode struct {
+	name     string
+	file     *FileInfoRec
+	on       bool // files only
+	parent   *reviewNode
+	children []*reviewNode
+	expanded bool
+
+	selN, totN         int
+	selBytes, totBytes int64
+}
+
+// reviewTree is the state of the review screen.
+type reviewTree struct {
+	roots  []*reviewNode
+	files  []FileInfoRec
+	leaves map[string]*reviewNode
+	picked []FileInfoRec // the planner's selection, in its order
+	budget int64
+	cursor int
+	top    int
+	tiers  map[string]*tierSummary
+	order  []string // tier names, highest priority first
+	note   string
+}
+
+// newReviewTree builds the tree of all scanned files under their sources,
+// ticking the ones in selected.
+func newReviewTree(files, selected []FileInfoRec, sources []string, budget int64) *reviewTree {
+	on := make(map[string]bool, len(selected))
+	for _, f := range selected {
+		on[f.Path] = true
+	}
+	t := &reviewTree{files: files, picked: selected, budget: budget, leaves: map[string]*reviewNode{}, tiers: map[string]*tierSummary{}}
+	rootOf := map[string]*reviewNode{}
+	dirs := map[string]*reviewNode{}
+	for i := range t.files {
+		f := &t.files[i]
+		base := sourceOf(f.Path, sources)
+		root := rootOf[base]
+		if root == nil {
+			root = &reviewNode{name: base, expanded: true}
+			rootOf[base] = root
+			t.roots = append(t.roots, root)
+		}
+		rel, err := filepath.Rel(base, f.Path)
+		if err != nil {
+			rel = filepath.Base(f.Path)
+		}
+		parts := strings.Split(rel, string(filepath.Separator))
+		n, key := root, base
+		for _, p := range parts[:len(parts)-1] {
+			key = filepath.Join(key, p)
+			c := dirs[key]
+			if c == nil {
+				c = &reviewNode{name: p, parent: n}
+				n.children = append(n.children, c)
+				dirs[key] = c
+			}
+			n = c
+		}
+		leaf := &reviewNode{name: parts[len(parts)-1], file: f, parent: n, totN: 1, totBytes: f.Size}
+		n.children = append(n.children, leaf)
+		t.leaves[f.Path] = leaf
+		ts := t.tiers[f.Tier]
+		if ts == nil {
+			ts = &tierSummary{Name: f.Tier, Priority: f.Priority}
+			t.tiers[f.Tier] = ts
+		}
+		for a := n; a != nil; a = a.parent {
+			a.totN++
+			a.totBytes += f.Size
+		}
+		if on[f.Path] {
+			t.set(leaf, true)
+		}
+	}
+	for _, r := range t.roots {
+		sortReviewNodes(r)
+	}
+	sort.Slice(t.roots, func(i, j int) bool { return t.roots[i].name < t.roots[j].name })
+	for name := range t.tiers {
+		t.order = append(t.order, name)
+	}
+	sort.Slice(t.order, func(i, j int) bool {
+		a, b := t.tiers[t.order[i]], t.tiers[t.order[j]]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return a.Name < b.Name
+	})
+	return t
+}
+
+// sourceOf returns the source folder path lies in, or its parent directory.
+func sourceOf(path string, sources []string) string {
+	best := ""
+	for _, s := range sources {
+		abs, err := filepath.Abs(expandPath(s))
+		if err == nil && prefixOf(path, abs) && len(abs) > len(best) {
+			best = abs
+		}
+	}
+	if best == "" {
+		return filepath.Dir(path)
+	}
+	return best
+}
+
+func sortReviewNodes(n *reviewNode) {
+	sort.Slice(n.children, func(i, j int) bool {
+		a, b := n.children[i], n.children[j]
+		if (a.file == nil) != (b.file == nil) {
+			return a.file == nil
+		}
+		return a.name < b.name
+	})
+	for _, c := range n.children {
+		sortReviewNodes(c)
+	}
+}
+
+// set ticks or unticks a file and updates its ancestors and tier totals.
+func (t *reviewTree) set(leaf *reviewNode, on bool) {
+	if leaf.on == on {
+		return
+	}
+	leaf.on = on
+	dn, db := 1, leaf.file.Size
+	if !on {
+		dn, db = -1, -db
+	}
+	for a := leaf; a != nil; a = a.parent {
+		a.selN += dn
+		a.selBytes += db
+	}
+	ts := t.tiers[leaf.file.Tier]
+	ts.Files += dn
+	ts.Bytes += db
+}
+
+// toggle flips a file, or ticks every file under a directory unless all
+// already are, in which case it clears them.
+func (t *reviewTree) toggle(n *reviewNode) {
+	on := n.selN < n.totN
+	var walk func(*reviewNode)
+	walk = func(c *reviewNode) {
+		if c.file != nil {
+			t.set(c, on)
+			return
+		}
+		for _, k := range c.children {
+			walk(k)
+		}
+	}
+	walk(n)
+}
+
+// Selected returns the ticked files: the planner's picks that are still
+// ticked in their original order, then files added during review by
+// priority, so copying still starts with what matters most.
+func (t *reviewTree) Selected() ([]FileInfoRec, int64) {
+	var out []FileInfoRec
+	var used int64
+	planned := make(map[string]bool, len(t.picked))
+	for _, f := range t.picked {
+		planned[f.Path] = true
+		if t.leaves[f.Path].on {
+			out = append(out, f)
+			used += f.Size
+		}
+	}
+	var added []FileInfoRec
+	for _, f := range t.files {
+		if !planned[f.Path] && t.leaves[f.Path].on {
+			added = append(added, f)
+			used += f.Size
+		}
+	}
+	sort.SliceStable(added, func(i, j int) bool { return added[i].Priority > added[j].Priority })
+	return append(out, added...), used
+}
+
+func (t *reviewTree) used() int64 {
+	var n int64
+	for _, r := range t.roots {
+		n += r.selBytes
+	}
+	return n
+}
+
+type reviewLine struct {
+	node  *reviewNode
+	depth int
+}
+
+func (t *reviewTree) visible() []reviewLine {
+	var out []reviewLine
+	var walk func(*reviewNode, int)
+	walk = func(n *reviewNode, depth int) {
+		out = append(out, reviewLine{n, depth})
+		if n.file == nil && n.expanded {
+			for _, c := range n.children {
+				walk(c, depth+1)
+			}
+		}
+	}
+	for _, r := range t.roots {
+		walk(r, 0)
+	}
+	return out
+}
+
+// key handles one key press. It returns done once the user starts the copy
+// (ok) or aborts.
+func (t *reviewTree) key(k string, rows int) (done, ok bool) {
+	lines := t.visible()
+	if t.cursor >= len(lines) {
+		t.cursor = len(lines) - 1
+	}
+	if len(lines) == 0 {
+		return k == "enter" || k == "esc" || k == "q", k == "enter"
+	}
+	cur := lines[t.cursor].node
+	t.note = ""
+	switch k {
+	case "up", "k":
+		if t.cursor > 0 {
+			t.cursor--
+		}
+	case "down", "j":
+		if t.cursor < len(lines)-1 {
+			t.cursor++
+		}
+	case "pgup":
+		t.cursor = max(0, t.cursor-rows)
+	case "pgdown":
+		t.cursor = min(len(lines)-1, t.cursor+rows)
+	case "home", "g":
+		t.cursor = 0
+	case "end", "G":
+		t.cursor = len(lines) - 1
+	case "right", "l":
+		if cur.file == nil {
+			cur.expanded = true
+		}
+	case "left", "h":
+		if cur.file == nil && cur.expanded {
+			cur.expanded = false
+		} else if cur.parent != nil {
+			for i, l := range lines {
+				if l.node == cur.parent {
+					t.cursor = i
+				}
+			}
+		}
+	case " ", "x":
+		t.toggle(cur)
+	case "enter":
+		if cur.file == nil && !cur.expanded {
+			cur.expanded = true
+			return false, false
+		}
+		fallthrough
+	case "s":
+		if used := t.used(); used > t.budget {
+			t.note = fmt.Sprintf("Selection (%s) exceeds the available %s; untick something first", humanSize(used), humanSize(t.budget))
+			return false, false
+		}
+		return true, true
+	case "esc", "q":
+		return true, false
+	}
+	if t.cursor < t.top {
+		t.top = t.cursor
+	}
+	if t.cursor >= t.top+rows {
+		t.top = t.cursor - rows + 1
+	}
+	return false, false
+}
+
+func (t *reviewTree) view(width, height int, st uiStyles) string {
+	contentWidth := width - 4
+	if contentWidth < 40 {
+		contentWidth = 40
+	}
+	used := t.used()
+	budgetLine := fmt.Sprintf("Selected %s of %s available", humanSize(used), humanSize(t.budget))
+	if used > t.budget {
+		budgetLine = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF5555")).Render(budgetLine + " (over)")
+	}
+	var tierLines []string
+	for _, name := range t.order {
+		ts := t.tiers[name]
+		tierLines = append(tierLines, fmt.Sprintf("%-20s %6d files %12s", truncate(name, 20), ts.Files, humanSize(ts.Bytes)))
+	}
+	summary := st.box.Width(contentWidth).Render(st.info.Render(budgetLine) + "\n" + st.dim.Render(strings.Join(tierLines, "\n")))
+
+	rows := t.rows(height)
+	lines := t.visible()
+	if t.cursor >= t.top+rows {
+		t.top = t.cursor - rows + 1
+	}
+	var b strings.Builder
+	for i := t.top; i < len(lines) && i < t.top+rows; i++ {
+		l := lines[i]
+		n := l.node
+		mark := "[ ]"
+		switch {
+		case n.selN == n.totN:
+			mark = "[x]"
+		case n.selN > 0:
+			mark = "[~]"
+		}
+		name := n.name
+		var info string
+		if n.file == nil {
+			arrow := "▸ "
+			if n.expanded {
+				arrow = "▾ "
+			}
+			name = arrow + name + string(filepath.Separator)
+			info = fmt.Sprintf("%d/%d files  %s / %s", n.selN, n.totN, humanSize(n.selBytes), humanSize(n.totBytes))
+		} else {
+			name = "  " + name
+			info = fmt.Sprintf("%s  %s", humanSize(n.file.Size), n.file.Tier)
+		}
+		line := fmt.Sprintf("%s%s %s", strings.Repeat("  ", l.depth), mark, name)
+		room := contentWidth - 4 - len(info) - 2
+		line = truncate(line, max(room, 10))
+		line += strings.Repeat(" ", max(room-lipgloss.Width(line), 0)) + "  " + info
+		if i == t.cursor {
+			line = lipgloss.NewStyle().Reverse(true).Render(line)
+		} else if n.selN == 0 {
+			line = st.dim.Render(line)
+		} else {
+			line = st.info.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+	treeBox := st.box.Width(contentWidth).Render(strings.TrimRight(b.String(), "\n"))
+	help := st.help.Render("↑/↓ move  ←/→ collapse/expand  space toggle  enter start copy  esc abort")
+	parts := []string{"", st.header.Render("🔄 USB Backuper - Review selection"), summary, treeBox}
+	if t.note != "" {
+		parts = append(parts, lipgloss.NewStyle().Foreground(lipgloss.Color("#FF5555")).Render(t.note))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, append(parts, help)...)
+}
+
+// rows is how many tree lines fit under the header and tier summary.
+func (t *reviewTree) rows(height int) int {
+	return max(height-len(t.order)-12, 5)
+}
+
+// truncate shortens s to n display columns.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n <= 1 {
+		return string(r[:n])
+	}
+	return string(r[:n-1]) + "…"
+}
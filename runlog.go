@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// --log-file keeps a copy of everything a run prints, including warnings
+// and the lines shown in the TUI, with a timestamp per line. The file
+// rotates by size: backuper.log becomes backuper.log.1 and so on, keeping
+// logKeep old files.
+
+const (
+	logDirName  = "logs"
+	logFileName = "backuper.log"
+	logKeep     = 5
+	// recentKeep is how many lines are kept in memory for --listen.
+	recentKeep = 500
+)
+
+// termOut is the terminal the TUI draws on; log capture replaces os.Stdout
+// with a pipe, and screen updates should not land in the log.
+var termOut = os.Stdout
+
+// activeLog is the log of the current run, if any.
+var activeLog *runLog
+
+// runLog is a size-rotated, timestamped log file fed by the captured
+// stdout and stderr. Its latest lines are also kept in memory; with
+// --log-file off and --listen it has no file at all.
+type runLog struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	f       *os.File
+	size    int64
+	restore func()
+	wg      sync.WaitGroup
+	recent  []string
+}
+
+func openRunLog(path string, maxSize int64) (*runLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	l := &runLog{path: path, maxSize: maxSize}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *runLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size = f, st.Size()
+	return nil
+}
+
+// rotate shifts log.N to log.N+1, dropping the oldest, and starts afresh.
+func (l *runLog) rotate() {
+	_ = l.f.Close()
+	_ = os.Remove(fmt.Sprintf("%s.%d", l.path, logKeep))
+	for i := logKeep - 1; i >= 1; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	_ = os.Rename(l.path, l.path+".1")
+	if err := l.open(); err != nil {
+		l.f = nil
+	}
+}
+
+// Line appends one timestamped line. Nil-safe.
+func (l *runLog) Line(s string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	line := clk.Now().Format("2006-01-02 15:04:05.000 ") + s
+	if len(l.recent) >= recentKeep {
+		l.recent = append(l.recent[:0], l.recent[len(l.recent)-recentKeep+1:]...)
+	}
+	l.recent = append(l.recent, line)
+	if l.f == nil {
+		return
+	}
+	b := []byte(line + "\n")
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(b)) > l.maxSize {
+		l.rotate()
+		if l.f == nil {
+			return
+		}
+	}
+	n, _ := l.f.Write(b)
+	l.size += int64(n)
+}
+
+// Recent returns up to the last n lines. Nil-safe.
+func (l *runLog) Recent(n int) []string {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n <= 0 || n > len(l.recent) {
+		n = len(l.recent)
+	}
+	return append([]string(nil), l.recent[len(l.recent)-n:]...)
+}
+
+// Capture tees the process's stdout and stderr into the log while still
+// showing them on the terminal.
+func (l *runLog) Capture() error {
+	origOut, origErr := os.Stdout, os.Stderr
+	rOut, wOut, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	rErr, wErr, err := os.Pipe()
+	if err != nil {
+		rOut.Close()
+		wOut.Close()
+		return err
+	}
+	l.wg.Add(2)
+	go l.tee(rOut, origOut, "")
+	go l.tee(rErr, origErr, "[stderr] ")
+	termOut = origOut
+	os.Stdout, os.Stderr = wOut, wErr
+	l.restore = func() {
+		os.Stdout, os.Stderr = origOut, origErr
+		wOut.Close()
+		wErr.Close()
+	}
+	return nil
+}
+
+func (l *runLog) tee(r io.Reader, out io.Writer, prefix string) {
+	defer l.wg.Done()
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			_, _ = io.WriteString(out, line)
+			if trimmed := trimEOL(line); trimmed != "" {
+				l.Line(prefix + trimmed)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func trimEOL(s string) string {
+	for len(s) > 0 && (s[len(s)-1] == '\n' || s[len(s)-1] == '\r') {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// Close stops capturing, flushes what is still in the pipes and closes
+// the file. Nil-safe and idempotent.
+func (l *runLog) Close() {
+	if l == nil {
+		return
+	}
+	if l.restore != nil {
+		l.restore()
+		l.restore = nil
+		done := make(chan struct{})
+		go func() { l.wg.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		_ = l.f.Close()
+		l.f = nil
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const runMetaName = "backup-meta.json"
+
+// runMeta describes one backup run and is stored next to its manifest so
+// tools working across backups on a drive can identify and filter runs.
+type runMeta struct {
+	Label     string    `json:"label,omitempty"`
+	Started   time.Time `json:"started"`
+	Host      string    `json:"host,omitempty"`
+	Sources   []string  `json:"sources"`
+	Objective string    `json:"objective"`
+	// EncryptionKey is the ID of the key new files were sealed with.
+	EncryptionKey string `json:"encryption_key,omitempty"`
+	// Parents are the backup folders, relative to the USB root, that hold
+	// the files an --incremental run skipped as unchanged. The run cannot
+	// be restored without them.
+	Parents []string `json:"parents,omitempty"`
+}
+
+func writeRunMeta(dir string, m runMeta) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath(dir, runMetaName), b, 0o644)
+}
+
+// readRunMeta loads the metadata of the backup in dir, looking in the
+// configured meta folder first.
+func readRunMeta(dir string) (runMeta, error) {
+	var m runMeta
+	b, err := os.ReadFile(metaPath(dir, runMetaName))
+	if err != nil {
+		b, err = os.ReadFile(filepath.Join(dir, runMetaName))
+		if err != nil {
+			return m, err
+		}
+	}
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+// parentRuns names the backup folders other than destDir, relative to
+// usbRoot, that hold the stored copies recs point to.
+func parentRuns(usbRoot, destDir string, recs []ManifestRec) []string {
+	var dirs []string
+	for _, m := range findManifests(usbRoot) {
+		if d := manifestBackupDir(m); filepath.Clean(d) != filepath.Clean(usbRoot) {
+			dirs = append(dirs, d)
+		}
+	}
+	_, inRoot := manifestIn(usbRoot)
+	seen := map[string]bool{}
+	var out []string
+	for _, rec := range recs {
+		dir := usbRoot
+		if !inRoot {
+			dir = ""
+		}
+		for _, d := range dirs {
+			// The drive may have been mounted elsewhere when rec was written.
+			if prefixOf(rec.Dst, d) || strings.Contains(filepath.ToSlash(rec.Dst), "/"+filepath.Base(d)+"/") {
+				dir = d
+				break
+			}
+		}
+		if dir == "" || filepath.Clean(dir) == filepath.Clean(destDir) || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		if rel, err := filepath.Rel(usbRoot, dir); err == nil {
+			out = append(out, rel)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// backupChain lists dir and every backup it depends on, oldest first, so
+// their manifests can be laid over each other. A missing parent is an
+// error: the run is incomplete without it.
+func backupChain(usbRoot, dir string) ([]string, error) {
+	seen := map[string]bool{filepath.Clean(dir): true}
+	var parents []string
+	var walk func(d string) error
+	walk = func(d string) error {
+		m, err := readRunMeta(d)
+		if err != nil {
+			return nil
+		}
+		for _, p := range m.Parents {
+			pd := filepath.Clean(filepath.Join(usbRoot, p))
+			if seen[pd] {
+				continue
+			}
+			seen[pd] = true
+			if _, ok := manifestIn(pd); !ok {
+				return fmt.Errorf("%s is an incremental backup based on %s, which is missing", filepath.Base(d), p)
+			}
+			parents = append(parents, pd)
+			if err := walk(pd); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(dir); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(parents, func(i, j int) bool { return backupTime(parents[i]).Before(backupTime(parents[j])) })
+	return append(parents, filepath.Clean(dir)), nil
+}
+
+// chainDir is the folder of chain holding dst, the innermost one when a
+// backup written into the USB root is part of the chain.
+func chainDir(chain []string, dst string) string {
+	best := chain[len(chain)-1]
+	for _, d := range chain {
+		if prefixOf(dst, d) && (!prefixOf(dst, best) || len(d) > len(best)) {
+			best = d
+		}
+	}
+	return best
+}
+
+// sanitizeLabel makes a label safe to embed in a directory name: anything
+// other than letters, digits, '.', '_' and '-' becomes '-'.
+func sanitizeLabel(label string) string {
+	s := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '-'
+	}, strings.TrimSpace(label))
+	return strings.Trim(s, ".-")
+}
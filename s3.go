@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// --s3 s3://bucket/prefix backs up to an S3-compatible object store (AWS,
+// MinIO, Backblaze B2, ...) instead of a drive, for when no USB drive is
+// around. Selection works as usual against --s3-quota; each selected file
+// becomes one object under the prefix, laid out like a backup folder on a
+// USB. Larger files go up as multipart uploads; every request, including
+// each part, is retried per --retries. Credentials come from
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, ~/.aws/credentials or the
+// instance role.
+
+const (
+	s3DefaultEndpoint = "https://s3.amazonaws.com"
+	// s3PartSize is the multipart chunk size. Files up to this size are
+	// sent in one request.
+	s3PartSize = 16 << 20
+)
+
+type s3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string // key prefix without a trailing slash; may be empty
+}
+
+// parseS3URL splits s3://bucket/prefix.
+func parseS3URL(s string) (bucket, prefix string, err error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid --s3 %q (want s3://bucket/prefix)", s)
+	}
+	return u.Host, strings.Trim(u.Path, "/"), nil
+}
+
+// newS3Target connects to the bucket behind s3URL and prepares its staging
+// folder. Each request is tried retries more times after a failure.
+func newS3Target(ctx context.Context, s3URL, endpoint, region string, retries int) (*remoteTarget, error) {
+	bucket, prefix, err := parseS3URL(s3URL)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == "" {
+		endpoint = s3DefaultEndpoint
+	}
+	ep, err := url.Parse(endpoint)
+	if err != nil || (ep.Scheme != "https" && ep.Scheme != "http") || ep.Host == "" {
+		return nil, fmt.Errorf("invalid --s3-endpoint %q (want https://host[:port])", endpoint)
+	}
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+	})
+	minio.MaxRetry = retries + 1
+	client, err := minio.New(ep.Host, &minio.Options{Creds: creds, Secure: ep.Scheme == "https", Region: region})
+	if err != nil {
+		return nil, err
+	}
+	ok, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("s3: bucket %s does not exist", bucket)
+	}
+	s := &s3Store{client: client, bucket: bucket, prefix: prefix}
+	return newRemoteTarget(s, "s3", sanitizeLabel(ep.Host), bucket, filepath.FromSlash(prefix))
+}
+
+func (s *s3Store) String() string { return "s3://" + path.Join(s.bucket, s.prefix) }
+
+func (s *s3Store) key(rel string) string { return path.Join(s.prefix, rel) }
+
+func (s *s3Store) list(ctx context.Context, dir string, fn func(string, int64, time.Time)) error {
+	prefix := s.key(dir) + "/"
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		fn(path.Join(dir, strings.TrimPrefix(obj.Key, prefix)), obj.Size, obj.LastModified)
+	}
+	return nil
+}
+
+func (s *s3Store) get(ctx context.Context, rel, local string) error {
+	return s.client.FGetObject(ctx, s.bucket, s.key(rel), local, minio.GetObjectOptions{})
+}
+
+func (s *s3Store) put(ctx context.Context, rel string, r io.Reader, size int64) error {
+	if size <= s3PartSize {
+		// A request body must be seekable to be retried; multipart
+		// uploads buffer each part themselves.
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, s.key(rel), r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    s3PartSize,
+	})
+	return err
+}
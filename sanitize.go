@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+)
+
+// windowsReserved are device names FAT/NTFS refuse as file or folder names,
+// with or without an extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizePathName makes each component of a relative path valid on FAT,
+// exFAT and NTFS as well as unix filesystems. Illegal characters become '_',
+// trailing dots and spaces are dropped and reserved device names get a '_'
+// suffix. Both '/' and '\' are treated as separators. The result is
+// deterministic so the same input always maps to the same folder.
+func sanitizePathName(p string) string {
+	parts := strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' })
+	for i, part := range parts {
+		part = strings.Map(func(r rune) rune {
+			if r < 0x20 || strings.ContainsRune(`<>:"|?*`, r) {
+				return '_'
+			}
+			return r
+		}, part)
+		part = strings.TrimRight(part, ". ")
+		if part == "" {
+			part = "_"
+		}
+		stem := part
+		if i := strings.IndexByte(stem, '.'); i >= 0 {
+			stem = stem[:i]
+		}
+		if windowsReserved[strings.ToUpper(stem)] {
+			part += "_"
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// scanCheckpoint is the on-disk state of an interrupted scan: the sources that
+// were fully walked, the directory frontier of the source in progress and every
+// file found so far.
+type scanCheckpoint struct {
+	Sources  []string      `json:"sources"`
+	Excludes []string      `json:"excludes"`
+	Done     []string      `json:"done"`
+	Current  string        `json:"current"`
+	Stack    []string      `json:"stack"`
+	Files    []FileInfoRec `json:"files"`
+}
+
+// scanCheckpointer persists scan progress in the background so a killed scan
+// can pick up where it stopped. Snapshots are handed to a single writer
+// goroutine; if it is still busy the snapshot is dropped rather than stalling
+// the walk.
+type scanCheckpointer struct {
+	path     string
+	interval time.Duration
+	last     time.Time
+	pending  chan scanCheckpoint
+	wg       sync.WaitGroup
+	resumed  *scanCheckpoint
+}
+
+func newScanCheckpointer(path string, sources, excludes []string) *scanCheckpointer {
+	c := &scanCheckpointer{
+		path:     path,
+		interval: 10 * time.Second,
+		last:     clk.Now(),
+		pending:  make(chan scanCheckpoint, 1),
+	}
+	if prev, err := loadScanCheckpoint(path); err == nil {
+		if reflect.DeepEqual(prev.Sources, sources) && reflect.DeepEqual(prev.Excludes, excludes) {
+			c.resumed = prev
+		} else {
+			slog.Warn("ignoring scan checkpoint for different sources/excludes")
+		}
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for cp := range c.pending {
+			if err := writeScanCheckpoint(c.path, cp); err != nil {
+				slog.Warn("failed to write scan checkpoint", "error", err)
+			}
+		}
+	}()
+	return c
+}
+
+func loadScanCheckpoint(path string) (*scanCheckpoint, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp scanCheckpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func writeScanCheckpoint(path string, cp scanCheckpoint) error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".part"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Maybe queues a snapshot if the interval elapsed. It must be called between
+// directories so that stack and files are consistent with each other.
+func (c *scanCheckpointer) Maybe(cp func() scanCheckpoint) {
+	if c == nil || since(c.last) < c.interval {
+		return
+	}
+	c.last = clk.Now()
+	select {
+	case c.pending <- cp():
+	default:
+	}
+}
+
+// Finish stops the writer. A completed scan removes the checkpoint; an
+// interrupted one leaves the last snapshot in place for the next run.
+func (c *scanCheckpointer) Finish(completed bool) {
+	if c == nil {
+		return
+	}
+	close(c.pending)
+	c.wg.Wait()
+	if completed {
+		_ = os.Remove(c.path)
+	}
+}
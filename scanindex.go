@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// With --scan-index the scanner keeps, per source, the listing of every
+// directory it walked. On the next run a directory whose mtime is unchanged
+// is not read or stat'ed again: its files come from the index. A directory's
+// mtime only changes when entries are added, removed or renamed, so a file
+// rewritten in place keeps its indexed size and mtime until its directory
+// changes or the index expires (scanIndexMaxAge) and a full scan rebuilds it.
+// Priorities are not stored; they are recomputed from the current profile.
+
+const (
+	scanIndexDir    = ".scan-index"
+	scanIndexMaxAge = 7 * 24 * time.Hour
+	// Directories modified this close to the scan may change again within
+	// the same mtime tick, so they are not trusted on the next run.
+	scanIndexRacy = 2 * time.Second
+)
+
+// scanEntry is one directory entry as the scanner needs it.
+type scanEntry struct {
+	Name  string `json:"n"`
+	Kind  byte   `json:"k"` // 'd' directory, 'f' regular file, 'l' symlink
+	Size  int64  `json:"s,omitempty"`
+	MTime int64  `json:"m,omitempty"`
+}
+
+type indexedDir struct {
+	MTime   int64       `json:"mtime"`
+	Entries []scanEntry `json:"entries"`
+}
+
+type scanIndexFile struct {
+	Source  string                 `json:"source"`
+	Created int64                  `json:"created"`
+	Dirs    map[string]*indexedDir `json:"dirs"`
+}
+
+// scanIndex holds the previous and the new index of the source being walked.
+type scanIndex struct {
+	dir          string
+	start        time.Time
+	prev, next   *scanIndexFile
+	reused, read int
+}
+
+func newScanIndex(dir string) *scanIndex {
+	return &scanIndex{dir: dir, start: clk.Now()}
+}
+
+func (x *scanIndex) path(src string) string {
+	sum := sha256.Sum256([]byte(src))
+	return filepath.Join(x.dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// Begin loads the index of src and starts a new one.
+func (x *scanIndex) Begin(src string) {
+	if x == nil {
+		return
+	}
+	x.prev = nil
+	var f scanIndexFile
+	if b, err := os.ReadFile(x.path(src)); err == nil && json.Unmarshal(b, &f) == nil &&
+		f.Source == src && x.start.Sub(time.Unix(0, f.Created)) < scanIndexMaxAge {
+		x.prev = &f
+	}
+	created := x.start.UnixNano()
+	if x.prev != nil {
+		created = x.prev.Created
+	}
+	x.next = &scanIndexFile{Source: src, Created: created, Dirs: map[string]*indexedDir{}}
+}
+
+// List returns the entries of dir, from the index when its mtime is
+// unchanged and from the filesystem otherwise.
+func (x *scanIndex) List(dir string) ([]scanEntry, error) {
+	if x == nil {
+		return readScanDir(dir)
+	}
+	st, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	mt := st.ModTime().UnixNano()
+	if x.prev != nil {
+		if d, ok := x.prev.Dirs[dir]; ok && d.MTime == mt && mt != 0 {
+			x.next.Dirs[dir] = d
+			x.reused++
+			return d.Entries, nil
+		}
+	}
+	entries, err := readScanDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	x.read++
+	if x.start.Sub(st.ModTime()) < scanIndexRacy {
+		mt = 0
+	}
+	x.next.Dirs[dir] = &indexedDir{MTime: mt, Entries: entries}
+	return entries, nil
+}
+
+// End writes the new index of the source just walked.
+func (x *scanIndex) End() {
+	if x == nil || x.next == nil {
+		return
+	}
+	b, err := json.Marshal(x.next)
+	if err == nil {
+		err = os.MkdirAll(x.dir, 0o755)
+	}
+	if err == nil {
+		p := x.path(x.next.Source)
+		if err = os.WriteFile(p+".part", b, 0o644); err == nil {
+			err = os.Rename(p+".part", p)
+		}
+	}
+	if err != nil {
+		slog.Warn("failed to write scan index", "error", err)
+	}
+	x.next = nil
+}
+
+// readScanDir lists dir, stat'ing regular files. Entries that cannot be
+// stat'ed and special files are left out.
+func readScanDir(dir string) ([]scanEntry, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]scanEntry, 0, len(des))
+	for _, e := range des {
+		switch {
+		case e.IsDir():
+			out = append(out, scanEntry{Name: e.Name(), Kind: 'd'})
+		case e.Type()&fs.ModeSymlink != 0:
+			out = append(out, scanEntry{Name: e.Name(), Kind: 'l'})
+		case e.Type().IsRegular():
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			out = append(out, scanEntry{Name: e.Name(), Kind: 'f', Size: info.Size(), MTime: info.ModTime().UnixNano()})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const scheduleLogName = "schedule.log"
+
+// runSchedule implements --schedule: it stays running and starts a backup
+// with the remaining arguments at every time the cron expression matches.
+// Each run is a child process so a failed run cannot take the scheduler
+// down. Runs are skipped while the USB is not present.
+func runSchedule(ctx context.Context, spec string, args []string, metrics *backupMetrics) {
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		fail(fmt.Errorf("invalid --schedule %q: %w", spec, err))
+	}
+	exe, err := os.Executable()
+	mustNoErr(err)
+	// Nobody is there to answer the overwrite prompt of an incremental or
+	// mirrored run, so such a run stops with an error unless --yes was
+	// given to the scheduler and passed on here.
+	args = append([]string{"backup", "-no-progress"}, stripFlag(stripFlag(args, "schedule"), "metrics-addr")...)
+	if metrics != nil {
+		// Runs report to the scheduler's metrics through their event stream.
+		args = append(stripFlag(stripFlag(args, "progress"), "progress-fd"), "-progress", "json")
+	}
+	fmt.Printf("Scheduler started (%s); press Ctrl+C to stop\n", spec)
+	for {
+		next := sched.Next(clk.Now())
+		fmt.Printf("Next run: %s\n", next.Format("2006-01-02 15:04"))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		root, err := usbRoot()
+		if err != nil || !drivePresent(root) {
+			scheduleLog("", "skipped: destination drive %s is not present", root)
+			continue
+		}
+		scheduleLog(root, "run started")
+		start := clk.Now()
+		cmd := exec.CommandContext(ctx, exe, args...)
+		cmd.Stderr = os.Stderr
+		if metrics != nil {
+			events, perr := cmd.StdoutPipe()
+			mustNoErr(perr)
+			if err = cmd.Start(); err == nil {
+				metrics.observeEvents(events)
+				err = cmd.Wait()
+			}
+			metrics.runEnded()
+		} else {
+			cmd.Stdout = os.Stdout
+			err = cmd.Run()
+		}
+		switch {
+		case ctx.Err() != nil:
+			scheduleLog(root, "run cancelled after %s", since(start).Round(time.Second))
+			return
+		case err != nil:
+			scheduleLog(root, "run failed after %s: %v", since(start).Round(time.Second), err)
+		default:
+			scheduleLog(root, "run finished in %s", since(start).Round(time.Second))
+		}
+	}
+}
+
+// drivePresent reports whether root looks like a mounted drive: it must be
+// a directory with something in it, since an unmounted mount point usually
+// remains as an empty folder.
+func drivePresent(root string) bool {
+	entries, err := os.ReadDir(root)
+	return err == nil && len(entries) > 0
+}
+
+// scheduleLog prints a timestamped scheduler line and, when root is set,
+// appends it to schedule.log on the USB.
+func scheduleLog(root, format string, a ...any) {
+	line := clk.Now().Format("2006-01-02 15:04:05") + " " + fmt.Sprintf(format, a...)
+	fmt.Println(line)
+	if root == "" {
+		return
+	}
+	_ = os.MkdirAll(metaPath(root, ""), 0o755)
+	f, err := os.OpenFile(filepath.Join(metaPath(root, ""), scheduleLogName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		slog.Warn("cannot write schedule log", "error", err)
+		return
+	}
+	defer f.Close()
+	_, _ = f.WriteString(line + nativeEOL())
+}
+
+// stripFlag removes every occurrence of flag name (with its value) from
+// args, in any of the -name v, --name v, -name=v or --name=v forms.
+func stripFlag(args []string, name string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		a := strings.TrimLeft(args[i], "-")
+		if !strings.HasPrefix(args[i], "-") || (a != name && !strings.HasPrefix(a, name+"=")) {
+			out = append(out, args[i])
+			continue
+		}
+		if a == name {
+			i++ // skip the separate value
+		}
+	}
+	return out
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A profile may replace the plain tier priority with a scoring expression
+// evaluated for every file, e.g.
+//
+//	"score": "priority + 20*is_under(\"~/Projects\") - size_gb*5"
+//
+// The result, rounded, becomes the file's priority for selection. The
+// expression sees these values:
+//
+//	priority                        the matching tier's priority (plus --recent-dir-boost)
+//	size, size_kb, size_mb, size_gb the file's size
+//	age_days                        days since the file was last modified
+//
+// and these functions, where true is 1 and false 0:
+//
+//	is_under("~/Projects")  the file is in that folder (case-insensitive)
+//	matches("**/*.psd")     the path matches a tier-style glob
+//	has_ext("pdf", "docx")  the file has one of these extensions
+//	tier_is("Videos")       the file falls in that tier ("builtin:video" for
+//	                        the built-in category of a file no tier matches)
+//	min(a, b), max(a, b), if(cond, a, b)
+//
+// Operators are + - * /, comparisons (< <= > >= == !=), && || and !, with
+// the usual precedence; parentheses group.
+
+// scoreRule is the profile's compiled scoring expression; nil means tier
+// priorities are used as they are. It is set when the profile is loaded.
+var scoreRule *scoreExpr
+
+type scoreExpr struct {
+	src  string
+	eval scoreFn
+}
+
+// scoreEnv is what an expression is evaluated against: one file.
+type scoreEnv struct {
+	path     string // lower-cased
+	tier     string
+	priority int
+	size     int64
+	mtime    time.Time
+	now      time.Time
+}
+
+type scoreFn func(*scoreEnv) float64
+
+// Priority evaluates the expression for one file.
+func (e *scoreExpr) Priority(path, tier string, priority int, size int64, mtime time.Time) int {
+	v := e.eval(&scoreEnv{path: strings.ToLower(path), tier: tier, priority: priority, size: size, mtime: mtime, now: clk.Now()})
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return priority
+	}
+	return int(math.Round(v))
+}
+
+// compileScore parses a scoring expression. A leading "score =" as in the
+// documentation is allowed.
+func compileScore(src string) (*scoreExpr, error) {
+	body := strings.TrimSpace(src)
+	if rest, ok := strings.CutPrefix(body, "score"); ok {
+		if rest = strings.TrimSpace(rest); strings.HasPrefix(rest, "=") && !strings.HasPrefix(rest, "==") {
+			body = rest[1:]
+		}
+	}
+	p := &scoreParser{src: body}
+	if err := p.lex(); err != nil {
+		return nil, fmt.Errorf("score %q: %w", src, err)
+	}
+	fn, err := p.parseOr()
+	if err == nil && p.pos < len(p.toks) {
+		err = fmt.Errorf("unexpected %q", p.toks[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("score %q: %w", src, err)
+	}
+	return &scoreExpr{src: src, eval: fn}, nil
+}
+
+type scoreTok struct {
+	kind byte // 'n' number, 's' string, 'i' identifier, 'o' operator or punctuation
+	text string
+	num  float64
+}
+
+type scoreParser struct {
+	src  string
+	toks []scoreTok
+	pos  int
+}
+
+func (p *scoreParser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return fmt.Errorf("bad number %q", s[i:j])
+			}
+			p.toks = append(p.toks, scoreTok{kind: 'n', text: s[i:j], num: n})
+			i = j
+		case c == '"' || c == '\'':
+			j := strings.IndexByte(s[i+1:], s[i])
+			if j < 0 {
+				return fmt.Errorf("unterminated string")
+			}
+			p.toks = append(p.toks, scoreTok{kind: 's', text: s[i+1 : i+1+j]})
+			i += j + 2
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			p.toks = append(p.toks, scoreTok{kind: 'i', text: s[i:j]})
+			i = j
+		default:
+			op := s[i : i+1]
+			if i+1 < len(s) {
+				switch two := s[i : i+2]; two {
+				case "<=", ">=", "==", "!=", "&&", "||":
+					op = two
+				}
+			}
+			if len(op) == 1 && !strings.Contains("+-*/()<>!,", op) {
+				return fmt.Errorf("unexpected %q", op)
+			}
+			p.toks = append(p.toks, scoreTok{kind: 'o', text: op})
+			i += len(op)
+		}
+	}
+	return nil
+}
+
+// accept consumes the operator tok if it is next.
+func (p *scoreParser) accept(op string) bool {
+	if p.pos < len(p.toks) && p.toks[p.pos].kind == 'o' && p.toks[p.pos].text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *scoreParser) parseOr() (scoreFn, error) {
+	l, err := p.parseAnd()
+	for err == nil && p.accept("||") {
+		var r scoreFn
+		if r, err = p.parseAnd(); err == nil {
+			a, b := l, r
+			l = func(e *scoreEnv) float64 { return truth(a(e) != 0 || b(e) != 0) }
+		}
+	}
+	return l, err
+}
+
+func (p *scoreParser) parseAnd() (scoreFn, error) {
+	l, err := p.parseCmp()
+	for err == nil && p.accept("&&") {
+		var r scoreFn
+		if r, err = p.parseCmp(); err == nil {
+			a, b := l, r
+			l = func(e *scoreEnv) float64 { return truth(a(e) != 0 && b(e) != 0) }
+		}
+	}
+	return l, err
+}
+
+func (p *scoreParser) parseCmp() (scoreFn, error) {
+	l, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"<=", ">=", "==", "!=", "<", ">"} {
+		if !p.accept(op) {
+			continue
+		}
+		r, err := p.parseAdd()
+		if err != nil {
+			return nil, err
+		}
+		a, b := l, r
+		switch op {
+		case "<=":
+			return func(e *scoreEnv) float64 { return truth(a(e) <= b(e)) }, nil
+		case ">=":
+			return func(e *scoreEnv) float64 { return truth(a(e) >= b(e)) }, nil
+		case "==":
+			return func(e *scoreEnv) float64 { return truth(a(e) == b(e)) }, nil
+		case "!=":
+			return func(e *scoreEnv) float64 { return truth(a(e) != b(e)) }, nil
+		case "<":
+			return func(e *scoreEnv) float64 { return truth(a(e) < b(e)) }, nil
+		default:
+			return func(e *scoreEnv) float64 { return truth(a(e) > b(e)) }, nil
+		}
+	}
+	return l, nil
+}
+
+func (p *scoreParser) parseAdd() (scoreFn, error) {
+	l, err := p.parseMul()
+	for err == nil {
+		var r scoreFn
+		a := l
+		switch {
+		case p.accept("+"):
+			if r, err = p.parseMul(); err == nil {
+				l = func(e *scoreEnv) float64 { return a(e) + r(e) }
+			}
+		case p.accept("-"):
+			if r, err = p.parseMul(); err == nil {
+				l = func(e *scoreEnv) float64 { return a(e) - r(e) }
+			}
+		default:
+			return l, nil
+		}
+	}
+	return nil, err
+}
+
+func (p *scoreParser) parseMul() (scoreFn, error) {
+	l, err := p.parseUnary()
+	for err == nil {
+		var r scoreFn
+		a := l
+		switch {
+		case p.accept("*"):
+			if r, err = p.parseUnary(); err == nil {
+				l = func(e *scoreEnv) float64 { return a(e) * r(e) }
+			}
+		case p.accept("/"):
+			if r, err = p.parseUnary(); err == nil {
+				l = func(e *scoreEnv) float64 {
+					if d := r(e); d != 0 {
+						return a(e) / d
+					}
+					return 0
+				}
+			}
+		default:
+			return l, nil
+		}
+	}
+	return nil, err
+}
+
+func (p *scoreParser) parseUnary() (scoreFn, error) {
+	switch {
+	case p.accept("-"):
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *scoreEnv) float64 { return -x(e) }, nil
+	case p.accept("!"):
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *scoreEnv) float64 { return truth(x(e) == 0) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *scoreParser) parsePrimary() (scoreFn, error) {
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("unexpected end")
+	}
+	t := p.toks[p.pos]
+	p.pos++
+	switch {
+	case t.kind == 'n':
+		return func(*scoreEnv) float64 { return t.num }, nil
+	case t.kind == 'o' && t.text == "(":
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		return x, nil
+	case t.kind == 'i' && p.accept("("):
+		return p.parseCall(t.text)
+	case t.kind == 'i':
+		if v, ok := scoreVars[t.text]; ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("unknown name %q", t.text)
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+var scoreVars = map[string]scoreFn{
+	"priority": func(e *scoreEnv) float64 { return float64(e.priority) },
+	"size":     func(e *scoreEnv) float64 { return float64(e.size) },
+	"size_kb":  func(e *scoreEnv) float64 { return float64(e.size) / (1 << 10) },
+	"size_mb":  func(e *scoreEnv) float64 { return float64(e.size) / (1 << 20) },
+	"size_gb":  func(e *scoreEnv) float64 { return float64(e.size) / (1 << 30) },
+	"age_days": func(e *scoreEnv) float64 { return e.now.Sub(e.mtime).Hours() / 24 },
+}
+
+// parseCall parses the arguments of function name, after its "(".
+func (p *scoreParser) parseCall(name string) (scoreFn, error) {
+	var strs []string
+	var nums []scoreFn
+	for !p.accept(")") {
+		if len(strs)+len(nums) > 0 && !p.accept(",") {
+			return nil, fmt.Errorf("expected , or ) in %s()", name)
+		}
+		if p.pos < len(p.toks) && p.toks[p.pos].kind == 's' {
+			strs = append(strs, p.toks[p.pos].text)
+			p.pos++
+			continue
+		}
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		nums = append(nums, x)
+	}
+	wantStrings := func(min int) error {
+		if len(nums) > 0 || len(strs) < min {
+			return fmt.Errorf("%s() takes quoted strings", name)
+		}
+		return nil
+	}
+	wantNums := func(n int) error {
+		if len(strs) > 0 || len(nums) != n {
+			return fmt.Errorf("%s() takes %d numbers", name, n)
+		}
+		return nil
+	}
+	switch name {
+	case "is_under":
+		if err := wantStrings(1); err != nil {
+			return nil, err
+		}
+		var dirs []string
+		for _, d := range strs {
+			if abs, err := filepath.Abs(expandPath(d)); err == nil {
+				d = abs
+			}
+			dirs = append(dirs, strings.ToLower(d))
+		}
+		return func(e *scoreEnv) float64 {
+			for _, d := range dirs {
+				if prefixOf(e.path, d) {
+					return 1
+				}
+			}
+			return 0
+		}, nil
+	case "matches":
+		if err := wantStrings(1); err != nil {
+			return nil, err
+		}
+		for i := range strs {
+			strs[i] = strings.ToLower(strs[i])
+		}
+		return func(e *scoreEnv) float64 {
+			for _, pat := range strs {
+				if globMatch(pat, e.path) {
+					return 1
+				}
+			}
+			return 0
+		}, nil
+	case "has_ext":
+		if err := wantStrings(1); err != nil {
+			return nil, err
+		}
+		exts := map[string]bool{}
+		for _, x := range strs {
+			exts["."+strings.TrimPrefix(strings.ToLower(x), ".")] = true
+		}
+		return func(e *scoreEnv) float64 { return truth(exts[filepath.Ext(e.path)]) }, nil
+	case "tier_is":
+		if err := wantStrings(1); err != nil {
+			return nil, err
+		}
+		return func(e *scoreEnv) float64 {
+			for _, t := range strs {
+				if strings.EqualFold(t, e.tier) {
+					return 1
+				}
+			}
+			return 0
+		}, nil
+	case "min", "max":
+		if err := wantNums(2); err != nil {
+			return nil, err
+		}
+		a, b := nums[0], nums[1]
+		if name == "min" {
+			return func(e *scoreEnv) float64 { return math.Min(a(e), b(e)) }, nil
+		}
+		return func(e *scoreEnv) float64 { return math.Max(a(e), b(e)) }, nil
+	case "if":
+		if err := wantNums(3); err != nil {
+			return nil, err
+		}
+		c, a, b := nums[0], nums[1], nums[2]
+		return func(e *scoreEnv) float64 {
+			if c(e) != 0 {
+				return a(e)
+			}
+			return b(e)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown function %s()", name)
+}
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
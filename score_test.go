@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScoreExpression(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	withClock(t, now)
+	path := "/home/me/Projects/site/Logo.PSD"
+	cases := map[string]int{
+		`priority`: 50,
+		`score = priority + 20*is_under("/home/me/projects")`: 70,
+		`priority - size_gb*5`:                                40,
+		`matches("**/*.psd") + has_ext("pdf", ".psd")`:        2,
+		`tier_is("Design") * 3 + tier_is("builtin:video")`:    3,
+		`if(age_days > 30, 1, 2)`:                             1,
+		`max(min(priority, 10), 4) / 2`:                       5,
+		`!(1 < 2) || 2 >= 2 && 1 != 1`:                        0,
+		`(priority + 1) * 2 == 102`:                           1,
+		`1 / 0`:                                               0, // division by zero counts as zero
+	}
+	for src, want := range cases {
+		e, err := compileScore(src)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if got := e.Priority(path, "Design", 50, 2<<30, now.AddDate(0, 0, -40)); got != want {
+			t.Errorf("%s = %d, want %d", src, got, want)
+		}
+	}
+
+	for _, src := range []string{`priority +`, `size_tb`, `is_under(1)`, `min(1)`, `nope("x")`, `1 2`, `"unterminated`} {
+		if _, err := compileScore(src); err == nil {
+			t.Errorf("%s compiled without error", src)
+		}
+	}
+}
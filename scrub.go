@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// `backuper scrub` guards old backups against bit rot. Like verify it reads
+// every file back and checks it against its manifest, but across all the
+// backups on the drive and a slice at a time: each run takes the files
+// read longest ago (never-scrubbed ones first) until --max-time or
+// --max-bytes is used up, and remembers when each file was last read in
+// .scrub-state.json at the USB root. Scheduled daily with a budget of, say,
+// 20 minutes, it cycles through the whole drive without ever keeping it
+// busy for long.
+//
+// With --repair a missing or corrupted file is copied again from its
+// source, but only when the source still has the size and modification
+// time it had at backup time (and, when a checksum was recorded, the same
+// content), so a repair never swaps in a newer version.
+
+const scrubStateName = ".scrub-state.json"
+
+// scrubState maps each scrubbed file (relative to the USB root, with
+// forward slashes) to when it last read back intact.
+type scrubState struct {
+	Checked map[string]time.Time `json:"checked"`
+}
+
+func loadScrubState(path string) scrubState {
+	st := scrubState{Checked: map[string]time.Time{}}
+	if b, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(b, &st)
+	}
+	if st.Checked == nil {
+		st.Checked = map[string]time.Time{}
+	}
+	return st
+}
+
+func (st scrubState) save(path string) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".part"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// scrubItem is one file to scrub: its record and the backup holding it.
+type scrubItem struct {
+	rec ManifestRec
+	dir string
+	key string
+}
+
+type scrubResult struct {
+	item     scrubItem
+	res      verifyResult
+	repaired bool
+	repair   error
+}
+
+func runScrub(args []string) {
+	fs := flag.NewFlagSet("scrub", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	dir := fs.String("dir", "", "Only scrub this backup folder (relative to the USB root, or absolute); default: every backup on the USB")
+	maxTime := fs.Duration("max-time", 0, "Stop starting new files after this long (0 = no limit); the next run continues where this one stopped")
+	maxBytes := fs.String("max-bytes", "", "Stop after reading about this much (e.g. 50G); the next run continues where this one stopped")
+	repair := fs.Bool("repair", false, "Copy missing or corrupted files again from their sources when those are unchanged since the backup")
+	passFile := fs.String("passphrase-file", "", "Read the password for encrypted zip archives from this file")
+	_ = fs.Parse(args)
+	g.apply()
+
+	root, err := usbRoot()
+	mustNoErr(err)
+	var budget int64
+	if *maxBytes != "" {
+		if budget, err = parseSize(*maxBytes); err != nil || budget <= 0 {
+			fail(fmt.Errorf("invalid --max-bytes %q", *maxBytes))
+		}
+	}
+	var dirs []string
+	if *dir != "" {
+		d, err := resolveBackupDir(root, *dir)
+		mustNoErr(err)
+		dirs = append(dirs, d)
+	} else {
+		for _, m := range findManifests(root) {
+			dirs = append(dirs, manifestBackupDir(m))
+		}
+	}
+	if len(dirs) == 0 {
+		fmt.Printf("No backups found in %s\n", root)
+		return
+	}
+
+	statePath := metaPath(root, scrubStateName)
+	state := loadScrubState(statePath)
+	var items []scrubItem
+	for _, d := range dirs {
+		recs, err := backupRecords(d)
+		mustNoErr(err)
+		mustNoErr(prepareArchives(d, recs, *passFile))
+		for _, rec := range recs {
+			key := rec.Dst
+			if rel, err := filepath.Rel(root, rec.Dst); err == nil {
+				key = filepath.ToSlash(rel)
+			}
+			items = append(items, scrubItem{rec: rec, dir: d, key: key})
+		}
+	}
+	totalFiles := len(items)
+	// Longest unread first; never-read files have the zero time.
+	sort.SliceStable(items, func(i, j int) bool {
+		return state.Checked[items[i].key].Before(state.Checked[items[j].key])
+	})
+	// Forget files of pruned backups.
+	live := make(map[string]bool, len(items))
+	for _, it := range items {
+		live[it.key] = true
+	}
+	for k := range state.Checked {
+		if !live[k] {
+			delete(state.Checked, k)
+		}
+	}
+
+	w := g.workers
+	if w <= 0 {
+		w = autoWorkers(detectMedia(root))
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	if *maxTime > 0 {
+		var stop context.CancelFunc
+		ctx, stop = context.WithTimeout(ctx, *maxTime)
+		defer stop()
+	}
+
+	fmt.Printf("Scrubbing %d files in %d backup(s) on %s with %d reader(s)...\n", totalFiles, len(dirs), root, w)
+	agg := &progressAgg{start: clk.Now()}
+	jobs := make(chan scrubItem)
+	results := make(chan scrubResult)
+	var wg sync.WaitGroup
+	for i := 0; i < w; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range jobs {
+				r := scrubResult{item: it, res: verifyOne(it.rec, it.dir, agg)}
+				if r.res.Problem != "" && *repair {
+					r.repair = repairFromSource(context.Background(), it.rec)
+					r.repaired = r.repair == nil
+				}
+				results <- r
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		var queued int64
+		for _, it := range items {
+			if budget > 0 && queued >= budget {
+				return
+			}
+			agg.AddTotal(it.rec.Size)
+			queued += it.rec.Size
+			select {
+			case jobs <- it:
+			case <-ctx.Done():
+				agg.AddTotal(-it.rec.Size)
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var bad []scrubResult
+	checked, repaired := 0, 0
+	for done := false; !done; {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				done = true
+				break
+			}
+			checked++
+			if r.res.Problem == "" || r.repaired {
+				state.Checked[r.item.key] = clk.Now()
+			}
+			if r.repaired {
+				repaired++
+			}
+			if r.res.Problem != "" {
+				bad = append(bad, r)
+			}
+		case <-ticker.C:
+			printTotalLine(formatTotalLine(agg))
+		}
+	}
+	if isTTY() {
+		fmt.Println()
+	}
+	if err := state.save(statePath); err != nil {
+		slog.Warn("failed to save scrub state", "error", err)
+	}
+
+	sort.Slice(bad, func(i, j int) bool { return bad[i].item.key < bad[j].item.key })
+	unrepaired := 0
+	for _, r := range bad {
+		switch {
+		case r.repaired:
+			fmt.Printf("REPAIRED %s: %s (copied again from %s)\n", r.item.key, r.res.Problem, r.item.rec.Src)
+		case r.repair != nil:
+			fmt.Printf("FAIL %s: %s; not repaired: %v\n", r.item.key, r.res.Problem, r.repair)
+			unrepaired++
+		default:
+			fmt.Printf("FAIL %s: %s\n", r.item.key, r.res.Problem)
+			unrepaired++
+		}
+	}
+	never := 0
+	var oldest time.Time
+	for _, it := range items {
+		t, ok := state.Checked[it.key]
+		if !ok {
+			never++
+		} else if oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	elapsed := since(agg.start).Seconds()
+	speed := float64(0)
+	if elapsed > 0 {
+		speed = float64(agg.Done()) / elapsed
+	}
+	fmt.Printf("Scrubbed %d/%d files, %s in %.2fs (%s/s): %d problem(s), %d repaired\n",
+		checked, totalFiles, humanSize(agg.Done()), elapsed, humanSize(int64(speed)), len(bad), repaired)
+	if never > 0 {
+		fmt.Printf("%d file(s) not yet read back intact; run scrub again to continue\n", never)
+	} else if !oldest.IsZero() {
+		fmt.Printf("Every file has been scrubbed; the oldest check was %s\n", oldest.Local().Format("2006-01-02 15:04"))
+	}
+	if unrepaired > 0 {
+		fmt.Println("Result: FAIL")
+		os.Exit(1)
+	}
+	fmt.Println("Result: PASS")
+}
+
+// repairFromSource copies rec's source over its backup copy again, when the
+// source is unchanged since the backup. Only files stored as plain copies
+// can be repaired this way.
+func repairFromSource(ctx context.Context, rec ManifestRec) error {
+	switch {
+	case rec.Archive != "":
+		return fmt.Errorf("stored in an archive")
+	case rec.Dedup != "":
+		return fmt.Errorf("stored in the --dedup store")
+	case rec.Compression != "" || rec.Encrypted != "":
+		return fmt.Errorf("stored compressed or encrypted")
+	case rec.Parts > 0:
+		return fmt.Errorf("stored in parts")
+	}
+	st, err := os.Stat(rec.Src)
+	if err != nil {
+		return fmt.Errorf("source unavailable: %w", err)
+	}
+	if st.Size() != rec.Size || (rec.MTime != 0 && st.ModTime().Unix() != rec.MTime) {
+		return fmt.Errorf("source changed since the backup")
+	}
+	algo, want, hasSum := splitChecksum(rec.Checksum)
+	if !hasSum {
+		algo = checksumAlgo
+	}
+	h, _ := newChecksumHash(algo)
+	if err := os.MkdirAll(filepath.Dir(rec.Dst), 0o755); err != nil {
+		return err
+	}
+	tmp := rec.Dst + ".part"
+	var mu sync.Mutex
+	if _, err := copyFileWithProgress(ctx, rec.Src, tmp, &progressAgg{start: clk.Now()}, &mu, nil, true, h, 0); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if hasSum && hex.EncodeToString(h.Sum(nil)) != want {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("source content differs from the recorded checksum")
+	}
+	if err := os.Rename(tmp, rec.Dst); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
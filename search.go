@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// runSearch implements `backuper search <query>`: find backed-up files by
+// source path across every backup in the catalog and show which backup,
+// and which folder on the drive, holds each. The query is matched as
+// case-insensitive substrings by default (every word must appear), or as
+// a glob (--glob) or regular expression (--regex).
+func runSearch(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	useGlob := fs.Bool("glob", false, "Match the query as a glob pattern like tier patterns, e.g. '**/invoices/*2023*.pdf'")
+	useRegex := fs.Bool("regex", false, "Match the query as a regular expression (case-insensitive unless it says otherwise)")
+	run := fs.String("run", "", "Only search this backup (folder name as listed, or latest/previous)")
+	limit := fs.Int("limit", 0, "Stop after this many matches (0 = all)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: backuper search [flags] <query>\n\n")
+		fs.PrintDefaults()
+	}
+	query := strings.Join(parseInterspersed(fs, args), " ")
+	g.apply()
+
+	if strings.TrimSpace(query) == "" {
+		fs.Usage()
+		fail(fmt.Errorf("search needs a query"))
+	}
+	if *useGlob && *useRegex {
+		fail(fmt.Errorf("--glob and --regex cannot be combined"))
+	}
+	var match func(string) bool
+	switch {
+	case *useGlob:
+		match = func(p string) bool { return globMatch(query, p) }
+	case *useRegex:
+		re, err := regexp.Compile("(?i)" + query)
+		if err != nil {
+			fail(fmt.Errorf("invalid --regex: %w", err))
+		}
+		match = re.MatchString
+	default:
+		words := strings.Fields(strings.ToLower(query))
+		match = func(p string) bool {
+			p = strings.ToLower(p)
+			for _, w := range words {
+				if !strings.Contains(p, w) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	root, err := usbRoot()
+	mustNoErr(err)
+	runs := catalogRuns(root)
+	if len(runs) == 0 {
+		fmt.Printf("No backups found in %s\n", root)
+		return
+	}
+	var dir string
+	if *run != "" {
+		dir, err = resolveRun(runs, *run)
+		mustNoErr(err)
+	}
+	n := 0
+	var total int64
+	for _, f := range catalogFiles(root, dir) {
+		if !match(f.Rec.Src) {
+			continue
+		}
+		// Show where the copy sits on this drive, whatever it was mounted
+		// as when the backup ran.
+		backupDir := filepath.Join(root, filepath.FromSlash(f.Run))
+		where := filepath.Dir(rebaseDst(f.Rec.Dst, backupDir))
+		if rel, err := filepath.Rel(root, where); err == nil {
+			where = rel
+		}
+		if f.Rec.Archive != "" {
+			where = filepath.Join(f.Run, filepath.FromSlash(f.Rec.Archive))
+		}
+		fmt.Printf("%-30s %10s  %s\n%30s in %s\n", f.Run, humanSize(f.Rec.Size), f.Rec.Src, "", where)
+		n++
+		total += f.Rec.Size
+		if *limit > 0 && n >= *limit {
+			fmt.Printf("(stopped after %d matches; see --limit)\n", n)
+			break
+		}
+	}
+	fmt.Printf("%d match(es), %s, on %s\n", n, humanSize(total), root)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestZeroByteFileSelectedAndRecorded(t *testing.T) {
+	dir := t.TempDir()
+	big := filepath.Join(dir, "src", "big.bin")
+	empty := filepath.Join(dir, "src", "empty.txt")
+	mkdirAll(t, filepath.Dir(big))
+	if err := os.WriteFile(big, make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files := []FileInfoRec{
+		{Path: big, Size: 100, Priority: 10},
+		{Path: empty, Size: 0, Priority: 1},
+	}
+
+	// Selected whatever the objective, both when everything fits and when
+	// the space is already used up by other files.
+	for _, objective := range []string{"count", "space", "priority", "value"} {
+		for _, capacity := range []int64{100, 50, 0} {
+			selected, _, _ := selectFiles(append([]FileInfoRec(nil), files...), capacity, objective, nil, nil)
+			found := false
+			for _, f := range selected {
+				found = found || f.Path == empty
+			}
+			if !found {
+				t.Errorf("objective %s, capacity %d: empty file not selected (got %v)", objective, capacity, selected)
+			}
+		}
+	}
+
+	noProgress = true
+	manifest := filepath.Join(dir, "usb", manifestName)
+	dst := filepath.Join(dir, "usb", "empty.txt")
+	mkdirAll(t, filepath.Dir(dst))
+	copied, errs, _ := copyAll(context.Background(), [][2]string{{empty, dst}}, manifest, 1, nil)
+	if copied != 1 || errs != 0 {
+		t.Fatalf("copyAll = %d copied, %d errors; want 1, 0", copied, errs)
+	}
+	if st, err := os.Stat(dst); err != nil || st.Size() != 0 {
+		t.Fatalf("destination: %v, %v", st, err)
+	}
+	var recs []ManifestRec
+	if err := readManifest(manifest, func(rec ManifestRec) { recs = append(recs, rec) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].Src != empty || recs[0].Status != "copied" || recs[0].Size != 0 {
+		t.Fatalf("manifest = %+v, want one copied record of %s", recs, empty)
+	}
+}
+
+func TestSelectAllIfFitsMatchesSelectFiles(t *testing.T) {
+	var files []FileInfoRec
+	var total int64
+	for i := 0; i < 200; i++ {
+		f := FileInfoRec{Path: fmt.Sprintf("/src/%c/file%03d.dat", 'a'+i%26, i), Size: int64(i * 37 % 1000), Priority: []int{100, 90, 50, 10, -5}[i%5]}
+		files = append(files, f)
+		total += f.Size
+	}
+	files = append(files, FileInfoRec{Path: "/src/empty", Size: 0, Priority: 10})
+
+	for _, capacity := range []int64{total, total * 10} {
+		fast, fastUsed, ok := selectAllIfFits(append([]FileInfoRec(nil), files...), capacity, nil)
+		if !ok {
+			t.Fatalf("capacity %d: selectAllIfFits did not take everything", capacity)
+		}
+		for _, objective := range []string{"count", "space", "priority", "value"} {
+			// A cap on a tier no file is in leaves the result alone but
+			// sends selectFiles down its per-tier path.
+			caps := map[string]tierCap{"none": {Files: 1}}
+			slow, slowUsed, _ := selectFiles(append([]FileInfoRec(nil), files...), capacity, objective, caps, nil)
+			if fastUsed != slowUsed || len(fast) != len(slow) {
+				t.Fatalf("capacity %d, objective %s: fast path %d files/%d bytes, per-tier %d files/%d bytes", capacity, objective, len(fast), fastUsed, len(slow), slowUsed)
+			}
+			want := map[string]bool{}
+			for _, f := range slow {
+				want[f.Path] = true
+			}
+			for i, f := range fast {
+				if !want[f.Path] {
+					t.Fatalf("capacity %d, objective %s: %s only selected by the fast path", capacity, objective, f.Path)
+				}
+				if i > 0 && fast[i-1].Priority < f.Priority {
+					t.Fatalf("fast path out of priority order at %d", i)
+				}
+			}
+		}
+	}
+	if _, _, ok := selectAllIfFits(files, total-1, nil); ok {
+		t.Error("selectAllIfFits took everything with one byte too little space")
+	}
+}
+
+func TestTierNamedLikeBuiltinCategory(t *testing.T) {
+	// A profile tier called "image" caps only its own files, not the images
+	// that fall back to the built-in category.
+	tiers := []Tier{{Name: "image", Priority: 50, Patterns: []string{"*.png"}, MaxFiles: 1}}
+	var files []FileInfoRec
+	for _, p := range []string{"/src/a.png", "/src/b.png", "/src/c.jpg", "/src/d.jpg"} {
+		tier, pr := classifyFile(p, tiers)
+		files = append(files, FileInfoRec{Path: p, Size: 10, Priority: pr, Tier: tier})
+	}
+	if files[2].Tier != builtinTierPrefix+"image" {
+		t.Fatalf("fallback tier = %q, want %q", files[2].Tier, builtinTierPrefix+"image")
+	}
+	selected, _, capped := selectFiles(files, 1<<20, "priority", tierCaps(tiers, 1<<20), nil)
+	var png, jpg int
+	for _, f := range selected {
+		if filepath.Ext(f.Path) == ".png" {
+			png++
+		} else {
+			jpg++
+		}
+	}
+	if png != 1 || jpg != 2 {
+		t.Errorf("selected %d png and %d jpg, want 1 and 2: %v", png, jpg, selected)
+	}
+	if len(capped) != 1 || capped[0] != "image" {
+		t.Errorf("capped = %v, want [image]", capped)
+	}
+}
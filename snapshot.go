@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// --vss (Windows) and --snapshot (Linux, LVM or btrfs) take a snapshot of
+// each source filesystem when the scan starts and read files from it, so
+// files held open by other programs (Outlook PSTs, browser profiles, SQLite
+// databases) are copied whole and consistent with each other instead of
+// failing or tearing. Scanning and the manifest still use the live paths;
+// only the reads are redirected. Taking snapshots needs administrator or
+// root rights. The snapshots are removed when the copy finishes.
+
+// sourceSnapshot maps the root of a live filesystem to the place the same
+// files appear in its snapshot. Both end in a path separator.
+type sourceSnapshot struct {
+	live   string
+	snap   string
+	remove func() error
+}
+
+// snapshots are the snapshots taken for this run.
+var snapshots []sourceSnapshot
+
+// snapshotSize is the room an LVM snapshot gets for changes made to the
+// origin while the backup runs: lvcreate --extents (20%ORIGIN) or --size
+// (10G).
+var snapshotSize = "20%ORIGIN"
+
+// snapshotSources snapshots each filesystem holding one of the sources.
+// The returned func removes the snapshots again; it is also run if the
+// process exits through fail.
+func snapshotSources(sources []string) (func(), error) {
+	release := func() {
+		for _, s := range snapshots {
+			if err := s.remove(); err != nil {
+				slog.Warn("failed to remove snapshot", "filesystem", s.live, "snapshot", s.snap, "error", err)
+			}
+		}
+		snapshots = nil
+	}
+	seen := map[string]bool{}
+	for _, src := range sources {
+		abs, err := filepath.Abs(expandPath(src))
+		if err != nil {
+			continue
+		}
+		root := snapshotRoot(abs)
+		if root == "" || seen[root] {
+			continue
+		}
+		seen[root] = true
+		s, err := takeSnapshot(root)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		s.live = withSeparator(s.live)
+		s.snap = withSeparator(s.snap)
+		snapshots = append(snapshots, s)
+		slog.Info("Snapshot", "filesystem", s.live, "snapshot", s.snap)
+	}
+	prev := onFatal
+	onFatal = func(err error) {
+		release()
+		if prev != nil {
+			prev(err)
+		}
+	}
+	return func() {
+		onFatal = prev
+		release()
+	}, nil
+}
+
+func withSeparator(p string) string {
+	return strings.TrimRight(p, `\/`) + string(os.PathSeparator)
+}
+
+// snapshotDirs returns where the snapshots appear, so a scan of a source
+// that contains one skips it.
+func snapshotDirs() []string {
+	var out []string
+	for _, s := range snapshots {
+		out = append(out, strings.TrimSuffix(s.snap, string(os.PathSeparator)))
+	}
+	return out
+}
+
+// snapshotPath returns the path to read p from: its copy in a snapshot, or
+// p itself when its filesystem has none.
+func snapshotPath(p string) string {
+	for _, s := range snapshots {
+		if strings.HasPrefix(p, s.live) {
+			return s.snap + p[len(s.live):]
+		}
+	}
+	return p
+}
+
+// livePath undoes snapshotPath, so progress events name the source files.
+func livePath(p string) string {
+	for _, s := range snapshots {
+		if strings.HasPrefix(p, s.snap) {
+			return s.live + p[len(s.snap):]
+		}
+	}
+	return p
+}
@@ -0,0 +1,117 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// snapshotRoot returns the mount point of the filesystem holding path.
+func snapshotRoot(path string) string {
+	return findMount(path).point
+}
+
+// takeSnapshot snapshots the filesystem mounted at mp: a read-only btrfs
+// snapshot inside it, or an LVM snapshot of its logical volume mounted
+// read-only in a temporary folder.
+func takeSnapshot(mp string) (sourceSnapshot, error) {
+	m := findMount(mp)
+	if m.fstype == "btrfs" {
+		return btrfsSnapshot(m)
+	}
+	if strings.HasPrefix(m.source, "/dev/") {
+		if lv, err := lvmVolume(m.source); err == nil {
+			return lvmSnapshot(m, lv)
+		}
+	}
+	return sourceSnapshot{}, fmt.Errorf("--snapshot: %s is %s on %s, neither btrfs nor an LVM volume", mp, m.fstype, m.source)
+}
+
+// runSnapshotCmd runs a snapshot tool; its error carries what the tool
+// printed.
+func runSnapshotCmd(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return stdout.String(), nil
+}
+
+// btrfsSnapshot snapshots the subvolume mounted at m.point into a hidden
+// folder next to its files. Nested subvolumes are not part of the
+// snapshot and read as empty folders.
+func btrfsSnapshot(m mountEntry) (sourceSnapshot, error) {
+	dir := filepath.Join(m.point, fmt.Sprintf(".backuper-snapshot-%d", os.Getpid()))
+	if _, err := runSnapshotCmd("btrfs", "subvolume", "snapshot", "-r", m.point, dir); err != nil {
+		return sourceSnapshot{}, fmt.Errorf("--snapshot of %s (needs root): %w", m.point, err)
+	}
+	remove := func() error {
+		_, err := runSnapshotCmd("btrfs", "subvolume", "delete", dir)
+		return err
+	}
+	return sourceSnapshot{live: m.point, snap: dir, remove: remove}, nil
+}
+
+// lvmVolume returns the vg/lv name of a device, or an error when it is not
+// an LVM logical volume.
+func lvmVolume(dev string) (string, error) {
+	out, err := runSnapshotCmd("lvs", "--noheadings", "--separator", "/", "-o", "vg_name,lv_name", dev)
+	if err != nil {
+		return "", err
+	}
+	lv := strings.TrimSpace(out)
+	if !strings.Contains(lv, "/") {
+		return "", fmt.Errorf("%s is not a logical volume", dev)
+	}
+	return lv, nil
+}
+
+// lvmSnapshot creates a snapshot of the logical volume lv, mounted at
+// m.point, and mounts it read-only in a temporary folder.
+func lvmSnapshot(m mountEntry, lv string) (sourceSnapshot, error) {
+	name := fmt.Sprintf("backuper-snapshot-%d", os.Getpid())
+	sizeFlag := "--size"
+	if strings.Contains(snapshotSize, "%") {
+		sizeFlag = "--extents"
+	}
+	if _, err := runSnapshotCmd("lvcreate", "--snapshot", "--name", name, sizeFlag, snapshotSize, lv); err != nil {
+		return sourceSnapshot{}, fmt.Errorf("--snapshot of %s (needs root): %w", m.point, err)
+	}
+	snapLV := filepath.Dir(lv) + "/" + name
+	lvremove := func() error {
+		_, err := runSnapshotCmd("lvremove", "--force", snapLV)
+		return err
+	}
+	dir, err := os.MkdirTemp("", name+"-")
+	if err != nil {
+		_ = lvremove()
+		return sourceSnapshot{}, err
+	}
+	opts := "ro"
+	if m.fstype == "xfs" {
+		opts += ",nouuid" // the snapshot shares the origin's UUID
+	}
+	if _, err := runSnapshotCmd("mount", "-t", m.fstype, "-o", opts, "/dev/"+snapLV, dir); err != nil {
+		_ = os.Remove(dir)
+		_ = lvremove()
+		return sourceSnapshot{}, fmt.Errorf("--snapshot: mounting %s: %w", snapLV, err)
+	}
+	remove := func() error {
+		if _, err := runSnapshotCmd("umount", dir); err != nil {
+			return err
+		}
+		_ = os.Remove(dir)
+		return lvremove()
+	}
+	return sourceSnapshot{live: m.point, snap: dir, remove: remove}, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// With --sniff, files without an extension, or with one the built-in table
+// doesn't know, are classified by their first bytes: the detected type
+// supplies an extension and the file is then matched against the tiers as
+// if it carried it, so an extension-less PDF lands in the documents tier
+// instead of the catch-all.
+
+var sniffContent bool
+
+// sniffLen is how much of a file is read; http.DetectContentType looks at
+// no more than this either.
+const sniffLen = 512
+
+// magicExt maps file signatures at offset 0 to an extension.
+var magicExt = []struct {
+	magic []byte
+	ext   string
+}{
+	{[]byte("%PDF-"), ".pdf"},
+	{[]byte("{\\rtf"), ".rtf"},
+	{[]byte("\x89PNG\r\n\x1a\n"), ".png"},
+	{[]byte("\xff\xd8\xff"), ".jpg"},
+	{[]byte("GIF8"), ".gif"},
+	{[]byte("II*\x00"), ".tiff"},
+	{[]byte("MM\x00*"), ".tiff"},
+	{[]byte("8BPS"), ".psd"},
+	{[]byte("PK\x03\x04"), ".zip"},
+	{[]byte("7z\xbc\xaf\x27\x1c"), ".7z"},
+	{[]byte("Rar!\x1a\x07"), ".rar"},
+	{[]byte("\x1f\x8b"), ".gz"},
+	{[]byte("BZh"), ".bz2"},
+	{[]byte("\xfd7zXZ\x00"), ".xz"},
+	{[]byte("\x28\xb5\x2f\xfd"), ".zst"},
+	{[]byte("ID3"), ".mp3"},
+	{[]byte("fLaC"), ".flac"},
+	{[]byte("OggS"), ".ogg"},
+	{[]byte("\x1a\x45\xdf\xa3"), ".mkv"},
+	{[]byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), ".doc"},
+}
+
+// contentPath returns the path to classify: path itself, or with --sniff
+// and an unknown extension, path plus the extension its content implies.
+func contentPath(path string) string {
+	if !sniffContent || builtinCategory(path) != "other" {
+		return path
+	}
+	return path + sniffExt(path)
+}
+
+// sniffExt guesses an extension from the start of the file, or "".
+func sniffExt(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	buf := make([]byte, sniffLen)
+	n, _ := f.Read(buf)
+	return detectExt(buf[:n])
+}
+
+func detectExt(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	for _, m := range magicExt {
+		if bytes.HasPrefix(b, m.magic) {
+			return m.ext
+		}
+	}
+	if len(b) >= 12 && string(b[:4]) == "RIFF" {
+		switch string(b[8:12]) {
+		case "WAVE":
+			return ".wav"
+		case "WEBP":
+			return ".webp"
+		case "AVI ":
+			return ".avi"
+		}
+	}
+	if len(b) >= 12 && string(b[4:8]) == "ftyp" {
+		switch brand := string(b[8:12]); {
+		case strings.HasPrefix(brand, "hei"), strings.HasPrefix(brand, "mif1"):
+			return ".heic"
+		case strings.HasPrefix(brand, "M4A"):
+			return ".m4a"
+		case strings.HasPrefix(brand, "qt"):
+			return ".mov"
+		default:
+			return ".mp4"
+		}
+	}
+	if bytes.HasPrefix(b, []byte("#!")) {
+		return shebangExt(b)
+	}
+	ct := http.DetectContentType(b)
+	switch {
+	case strings.HasPrefix(ct, "text/html"):
+		return ".html"
+	case strings.HasPrefix(ct, "text/xml"):
+		return ".xml"
+	case strings.HasPrefix(ct, "text/plain"):
+		if t := bytes.TrimLeft(b, " \t\r\n\xef\xbb\xbf"); len(t) > 0 && (t[0] == '{' || t[0] == '[') {
+			return ".json"
+		}
+		return ".txt"
+	}
+	return ""
+}
+
+// shebangExt maps a script's interpreter line to its usual extension.
+func shebangExt(b []byte) string {
+	line, _, _ := bytes.Cut(b, []byte("\n"))
+	fields := strings.Fields(strings.TrimPrefix(string(line), "#!"))
+	if len(fields) == 0 {
+		return ".sh"
+	}
+	interp := filepath.Base(fields[0])
+	if interp == "env" && len(fields) > 1 {
+		interp = fields[1]
+	}
+	switch {
+	case strings.HasPrefix(interp, "python"):
+		return ".py"
+	case strings.HasPrefix(interp, "ruby"):
+		return ".rb"
+	case strings.HasPrefix(interp, "node"):
+		return ".js"
+	case strings.HasPrefix(interp, "php"):
+		return ".php"
+	case strings.HasPrefix(interp, "Rscript"):
+		return ".r"
+	case strings.HasPrefix(interp, "pwsh"):
+		return ".ps1"
+	}
+	return ".sh"
+}
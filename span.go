@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// With --span a selection larger than one drive is spread over several:
+// each drive is filled in selection order, then the run pauses and asks for
+// the next drive's mount path. Every drive gets the same backup folder name
+// and a span catalog recording which drive holds which file; the catalog on
+// the last drive is complete.
+
+const spanCatalogName = "span-catalog.json"
+
+type spanCatalog struct {
+	Set    string         `json:"set"`
+	Drives []spanDrive    `json:"drives"`
+	Files  map[string]int `json:"files"` // destination path relative to the backup folder -> drive index
+}
+
+type spanDrive struct {
+	Index int    `json:"index"`
+	Root  string `json:"root"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// copySpanned copies pairs across as many drives as needed and returns the
+// same totals as copyAll.
+func copySpanned(ctx context.Context, pairs [][2]string, usbRoot, destDir string, reserve int64, workers int, tui *TUI) (int, int, int64) {
+	rel, err := filepath.Rel(usbRoot, destDir)
+	if err != nil {
+		rel = "."
+	}
+	cat := spanCatalog{Set: filepath.Base(destDir), Files: map[string]int{}}
+	root, dest := usbRoot, destDir
+	var copied, errorsN int
+	var bytes int64
+	rem := pairs
+	for drive := 1; len(rem) > 0 && ctx.Err() == nil; drive++ {
+		free := usableFreeSpace(root, reserve) - manifestReserveSize(len(rem))
+		batch, rest, size := fillDrive(rem, dest, destDir, free)
+		if len(batch) == 0 {
+			slog.Warn("drive has no room for any of the remaining files", "drive", drive, "files", len(rem))
+		} else {
+			fmt.Printf("Drive %d (%s): copying %d files (%s)\n", drive, root, len(batch), humanSize(size))
+			c, e, b := copyAll(ctx, batch, metaPath(dest, manifestName), workers, tui)
+			tui = nil // copyAll closed it; later drives get a fresh one
+			copied, errorsN, bytes = copied+c, errorsN+e, bytes+b
+			for _, p := range batch {
+				if r, err := filepath.Rel(dest, p[1]); err == nil {
+					cat.Files[filepath.ToSlash(r)] = drive
+				}
+			}
+		}
+		cat.Drives = append(cat.Drives, spanDrive{Index: drive, Root: root, Files: len(batch), Bytes: size})
+		if err := writeSpanCatalog(metaPath(dest, spanCatalogName), cat); err != nil {
+			slog.Warn("failed to write span catalog", "error", err)
+		}
+		rem = rest
+		if len(rem) == 0 || ctx.Err() != nil {
+			break
+		}
+		next, ok := promptNextDrive(drive, rem)
+		if !ok {
+			fmt.Printf("Stopped spanning: %d files were not copied\n", len(rem))
+			break
+		}
+		root, dest = next, filepath.Join(next, rel)
+		if err := os.MkdirAll(metaPath(dest, ""), 0o755); err != nil {
+			fail(err)
+		}
+	}
+	return copied, errorsN, bytes
+}
+
+// fillDrive takes pairs in order while they fit in free bytes, re-rooting
+// destinations from the first drive's folder onto dest. Files that do not
+// fit are kept, in order, for the next drive.
+func fillDrive(pairs [][2]string, dest, firstDest string, free int64) (batch, rest [][2]string, used int64) {
+	for _, p := range pairs {
+		st, err := os.Stat(p[0])
+		size := safeSize(st)
+		if err == nil && used+size > free {
+			rest = append(rest, p)
+			continue
+		}
+		dst := p[1]
+		if r, err := filepath.Rel(firstDest, p[1]); err == nil {
+			dst = filepath.Join(dest, r)
+		}
+		batch = append(batch, [2]string{p[0], dst})
+		used += size
+	}
+	return batch, rest, used
+}
+
+// promptNextDrive asks on the terminal for the mount path of the next drive.
+func promptNextDrive(drive int, rem [][2]string) (string, bool) {
+	var size int64
+	for _, p := range rem {
+		if st, err := os.Stat(p[0]); err == nil {
+			size += st.Size()
+		}
+	}
+	fmt.Printf("Drive %d is full; %d files (%s) remain.\n", drive, len(rem), humanSize(size))
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		fmt.Fprintln(os.Stderr, "cannot prompt for the next drive: stdin is not a terminal")
+		return "", false
+	}
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("Insert drive %d and enter its mount path (empty to stop): ", drive+1)
+		line, err := in.ReadString('\n')
+		path := strings.TrimSpace(line)
+		if path == "" || err != nil {
+			return "", false
+		}
+		path = expandPath(path)
+		if st, err := os.Stat(path); err != nil || !st.IsDir() {
+			fmt.Printf("%s is not a mounted directory\n", path)
+			continue
+		}
+		return path, true
+	}
+}
+
+func writeSpanCatalog(path string, cat spanCatalog) error {
+	b, err := json.MarshalIndent(cat, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".part"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readSpanCatalog(path string) (spanCatalog, error) {
+	var cat spanCatalog
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cat, err
+	}
+	return cat, json.Unmarshal(b, &cat)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Destinations with a per-file size limit (FAT32 tops out at 4 GiB - 1)
+// get oversized files as numbered parts <name>.001, <name>.002, ... The
+// manifest records the part count and restore joins them back together.
+
+// maxFileSize is the largest file the destination can hold; 0 means no limit.
+var maxFileSize int64
+
+const fat32MaxFileSize = 1<<32 - 1
+
+// needsSplit reports whether a stored file of about size bytes must be split.
+// Encryption adds a little per chunk, so its output is estimated first.
+func needsSplit(size int64) bool {
+	if maxFileSize <= 0 {
+		return false
+	}
+	if encryptKey != nil {
+		size += size/encChunkSize*16 + 64
+	}
+	return size > maxFileSize
+}
+
+func partName(base string, i int) string {
+	return fmt.Sprintf("%s.%03d", base, i)
+}
+
+// storedParts lists the existing consecutive parts of a split file.
+func storedParts(dst string) []string {
+	var parts []string
+	for i := 1; ; i++ {
+		p := partName(dst, i)
+		if _, err := os.Stat(p); err != nil {
+			return parts
+		}
+		parts = append(parts, p)
+	}
+}
+
+// splitWriter writes a stream into parts of at most limit bytes each.
+type splitWriter struct {
+	base  string
+	limit int64
+	perm  fs.FileMode
+	cur   *os.File
+	n     int64
+	paths []string
+}
+
+func (s *splitWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if s.cur == nil || s.n == s.limit {
+			if s.cur != nil {
+				if err := s.cur.Close(); err != nil {
+					return written, err
+				}
+			}
+			path := partName(s.base, len(s.paths)+1)
+			f, err := openFileSequentialWrite(path, s.perm)
+			if err != nil {
+				return written, err
+			}
+			s.cur, s.n, s.paths = f, 0, append(s.paths, path)
+		}
+		chunk := p
+		if room := s.limit - s.n; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		n, err := s.cur.Write(chunk)
+		written += n
+		s.n += int64(n)
+		p = p[n:]
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (s *splitWriter) Close() error {
+	if s.cur == nil {
+		return nil
+	}
+	return s.cur.Close()
+}
+
+// finishSplit moves the parts written under tmp into place as dst's parts,
+// removing any unsplit copy and stale parts from an earlier run.
+func finishSplit(tmp, dst string, mtime time.Time) (int, error) {
+	tmps := storedParts(tmp)
+	old := storedParts(dst)
+	_ = os.Remove(dst)
+	for i, p := range tmps {
+		final := partName(dst, i+1)
+		if err := os.Rename(p, final); err != nil {
+			return 0, err
+		}
+		_ = os.Chtimes(final, clk.Now(), mtime)
+	}
+	for i := len(tmps); i < len(old); i++ {
+		_ = os.Remove(old[i])
+	}
+	return len(tmps), nil
+}
+
+func removeParts(base string) {
+	for _, p := range storedParts(base) {
+		_ = os.Remove(p)
+	}
+}
+
+// splitInfo presents a split file as one file for the skip checks.
+type splitInfo struct {
+	name  string
+	size  int64
+	mtime time.Time
+}
+
+func (s splitInfo) Name() string       { return s.name }
+func (s splitInfo) Size() int64        { return s.size }
+func (s splitInfo) Mode() fs.FileMode  { return 0o644 }
+func (s splitInfo) ModTime() time.Time { return s.mtime }
+func (s splitInfo) IsDir() bool        { return false }
+func (s splitInfo) Sys() any           { return nil }
+
+// statDest stats a destination file, or its parts when it was split.
+func statDest(dst string) (os.FileInfo, error) {
+	if remoteOut != nil {
+		return remoteOut.Stat(dst)
+	}
+	st, err := os.Stat(dst)
+	if err == nil {
+		return st, nil
+	}
+	parts := storedParts(dst)
+	if len(parts) == 0 {
+		return nil, err
+	}
+	info := splitInfo{name: filepath.Base(dst)}
+	for i, p := range parts {
+		pst, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			info.mtime = pst.ModTime()
+		}
+		info.size += pst.Size()
+	}
+	return info, nil
+}
+
+// openStored opens a backed-up file for reading, joining its parts when the
+// manifest says it was split.
+func openStored(path string, parts int) (io.ReadCloser, error) {
+	if parts == 0 {
+		return openFileSequentialRead(path)
+	}
+	files := make([]*os.File, 0, parts)
+	readers := make([]io.Reader, 0, parts)
+	for i := 1; i <= parts; i++ {
+		f, err := openFileSequentialRead(partName(path, i))
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+	return &multiFile{Reader: io.MultiReader(readers...), files: files}, nil
+}
+
+type multiFile struct {
+	io.Reader
+	files []*os.File
+}
+
+func (m *multiFile) Close() error {
+	var first error
+	for _, f := range m.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
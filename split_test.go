@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitLargeFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src", "big.bin")
+	dst := filepath.Join(dir, "usb", "big.bin")
+	mkdirAll(t, filepath.Dir(src))
+	mkdirAll(t, filepath.Dir(dst))
+	data := make([]byte, 2500)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	maxFileSize = 1000
+	t.Cleanup(func() { maxFileSize = 0 })
+	noProgress = true
+
+	manifest := filepath.Join(dir, "usb", manifestName)
+	copied, errs, _ := copyAll(context.Background(), [][2]string{{src, dst}}, manifest, 1, nil)
+	if copied != 1 || errs != 0 {
+		t.Fatalf("copyAll = %d copied, %d errors; want 1, 0", copied, errs)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("unsplit copy left at %s: %v", dst, err)
+	}
+	for i, want := range []int64{1000, 1000, 500} {
+		if st, err := os.Stat(partName(dst, i+1)); err != nil || st.Size() != want {
+			t.Errorf("part %d: %v, %v; want %d bytes", i+1, st, err, want)
+		}
+	}
+	var rec ManifestRec
+	if err := readManifest(manifest, func(r ManifestRec) { rec = r }); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Parts != 3 || rec.Size != int64(len(data)) {
+		t.Fatalf("manifest record = %+v, want 3 parts of %d bytes", rec, len(data))
+	}
+
+	// Skip checks see the parts as one file, and restore joins them.
+	if st, err := statDest(dst); err != nil || st.Size() != int64(len(data)) {
+		t.Errorf("statDest = %v, %v; want %d bytes", st, err, len(data))
+	}
+	r, err := openStored(dst, rec.Parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	joined, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(joined, data) {
+		t.Errorf("joined parts differ from the source (%d bytes, %v)", len(joined), err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --listen serves a small JSON API for watching and steering a run from
+// elsewhere, e.g. over an SSH tunnel to a headless machine:
+//
+//	GET  /status  phase, file and byte counts, files in flight, speed
+//	GET  /log     recent log lines (?n= limits them, default 100)
+//	POST /pause, /resume, /cancel
+//
+// There is no authentication, so keep it on a loopback address.
+
+// apiStatus is the body of GET /status.
+type apiStatus struct {
+	// Phase is scanning, copying, watching or done.
+	Phase        string      `json:"phase"`
+	Started      time.Time   `json:"started"`
+	Destination  string      `json:"destination"`
+	Scanned      int64       `json:"scanned"`
+	ScannedBytes int64       `json:"scanned_bytes"`
+	FilesTotal   int64       `json:"files_total"`
+	FilesDone    int64       `json:"files_done"`
+	FilesFailed  int64       `json:"files_failed"`
+	BytesTotal   int64       `json:"bytes_total"`
+	BytesDone    int64       `json:"bytes_done"`
+	Speed        float64     `json:"speed_bytes_per_second"`
+	Paused       bool        `json:"paused"`
+	Cancelled    bool        `json:"cancelled"`
+	Current      []apiFile   `json:"current"`
+	Summary      *runSummary `json:"summary,omitempty"`
+}
+
+type apiFile struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Bytes int64  `json:"bytes"`
+}
+
+// statusServer tracks the run from progress events.
+type statusServer struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	st     apiStatus
+	active map[string]*apiFile
+}
+
+// serveStatus starts the API on addr for the run controlled by cancel.
+func serveStatus(ctx context.Context, addr, destDir string, cancel context.CancelFunc) (*statusServer, error) {
+	s := &statusServer{ctx: ctx, cancel: cancel, active: map[string]*apiFile{}}
+	s.st.Phase, s.st.Started, s.st.Destination = "scanning", clk.Now(), destDir
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/log", s.handleLog)
+	mux.HandleFunc("/pause", s.control(func() { s.setPaused(true) }))
+	mux.HandleFunc("/resume", s.control(func() { s.setPaused(false) }))
+	mux.HandleFunc("/cancel", s.control(cancel))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Warn("status API stopped", "error", err)
+		}
+	}()
+	slog.Info("Status API", "url", "http://"+ln.Addr().String()+"/status")
+	return s, nil
+}
+
+// Observe updates the status from one progress event.
+func (s *statusServer) Observe(ev progressEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch ev.Event {
+	case "scan_progress":
+		s.st.Scanned = ev.Files
+		if ev.Status == "done" {
+			s.st.ScannedBytes = ev.Bytes
+		}
+	case "copy_start":
+		s.st.Phase = "copying"
+		s.st.FilesTotal += ev.Files
+		s.st.BytesTotal += ev.Bytes
+	case "file_start":
+		s.active[ev.Path] = &apiFile{Path: ev.Path, Size: ev.Size, Bytes: ev.Bytes}
+	case "file_progress":
+		if f := s.active[ev.Path]; f != nil {
+			f.Bytes = ev.Bytes
+		}
+	case "file_done":
+		delete(s.active, ev.Path)
+		s.st.FilesDone++
+		if ev.Status == "error" {
+			s.st.FilesFailed++
+		}
+		s.st.BytesDone += ev.Bytes
+	case "copy_done":
+		s.st.Phase = "watching"
+	case "run_summary":
+		s.st.Phase = "done"
+		s.st.Summary = ev.Summary
+	}
+}
+
+// setPaused pauses or resumes the copy.
+func (s *statusServer) setPaused(on bool) {
+	if copyPause.Paused() != on {
+		copyPause.Toggle()
+	}
+}
+
+func (s *statusServer) snapshot() apiStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.st
+	st.Current = make([]apiFile, 0, len(s.active))
+	var inFlight int64
+	for _, f := range s.active {
+		st.Current = append(st.Current, *f)
+		inFlight += f.Bytes
+	}
+	sort.Slice(st.Current, func(i, j int) bool { return st.Current[i].Path < st.Current[j].Path })
+	if secs := activeSince(st.Started).Seconds(); secs > 0 {
+		st.Speed = float64(st.BytesDone+inFlight) / secs
+	}
+	st.Paused = copyPause.Paused()
+	st.Cancelled = s.ctx.Err() != nil
+	return st
+}
+
+func (s *statusServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.snapshot())
+}
+
+func (s *statusServer) handleLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n := 100
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			http.Error(w, "invalid n", http.StatusBadRequest)
+			return
+		}
+	}
+	lines := activeLog.Recent(n)
+	if lines == nil {
+		lines = []string{}
+	}
+	writeJSON(w, map[string][]string{"lines": lines})
+}
+
+// control wraps a POST-only action and answers with the new status.
+func (s *statusServer) control(action func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		action()
+		writeJSON(w, s.snapshot())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+)
+
+// runSummary is the machine-readable result of a run written by --summary-json.
+type runSummary struct {
+	Destination   string        `json:"destination"`
+	Objective     string        `json:"objective"`
+	Scanned       int           `json:"scanned"`
+	ScannedBytes  int64         `json:"scanned_bytes"`
+	Selected      int           `json:"selected"`
+	SelectedBytes int64         `json:"selected_bytes"`
+	Copied        int           `json:"copied"`
+	CopiedBytes   int64         `json:"copied_bytes"`
+	Skipped       int           `json:"skipped"`
+	Errors        int           `json:"errors"`
+	DurationSec   float64       `json:"duration_sec"`
+	Tiers         []tierSummary `json:"tiers"`
+	ExitReason    string        `json:"exit_reason"`
+}
+
+type tierSummary struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// summarizeTiers groups selected files by tier, highest priority first.
+// Tiers sharing a priority stay apart.
+func summarizeTiers(selected []FileInfoRec, tiers []Tier) []tierSummary {
+	byTier := map[string]*tierSummary{}
+	for _, f := range selected {
+		t := byTier[f.Tier]
+		if t == nil {
+			t = &tierSummary{Name: f.Tier, Priority: tierPriority(f.Tier, tiers)}
+			byTier[f.Tier] = t
+		}
+		t.Files++
+		t.Bytes += f.Size
+	}
+	out := make([]tierSummary, 0, len(byTier))
+	for _, t := range byTier {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Priority != out[j].Priority {
+			return out[i].Priority > out[j].Priority
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// tierPriority is the configured priority of the profile tier or built-in
+// category name, before any score expression or boost.
+func tierPriority(name string, tiers []Tier) int {
+	for _, t := range tiers {
+		if t.Name == name {
+			return t.Priority
+		}
+	}
+	if c, ok := strings.CutPrefix(name, builtinTierPrefix); ok {
+		return fallbackPriority(c, tiers)
+	}
+	return 0
+}
+
+// writeSummaryJSON writes s as a single JSON line to path, or stdout for "-".
+func writeSummaryJSON(path string, s runSummary) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	b = append(b, manifestEOL...)
+	if path == "-" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestSummarizeTiersByName(t *testing.T) {
+	tiers := []Tier{
+		{Name: "ssh_keys", Priority: 100, Patterns: []string{"*/.ssh/*"}},
+		{Name: "Documents", Priority: 100, Patterns: []string{"*.pdf"}},
+	}
+	var selected []FileInfoRec
+	for _, p := range []string{"/home/u/.ssh/id_ed25519", "/home/u/a.pdf", "/home/u/b.pdf", "/home/u/c.go", "/home/u/d.mp4"} {
+		tier, pr := classifyFile(p, tiers)
+		selected = append(selected, FileInfoRec{Path: p, Size: 10, Priority: pr, Tier: tier})
+	}
+	got := summarizeTiers(selected, tiers)
+	want := []tierSummary{
+		{Name: "Documents", Priority: 100, Files: 2, Bytes: 20},
+		{Name: "ssh_keys", Priority: 100, Files: 1, Bytes: 10},
+		{Name: builtinTierPrefix + "code", Priority: fallbackPriority("code", tiers), Files: 1, Bytes: 10},
+		{Name: builtinTierPrefix + "video", Priority: fallbackPriority("video", tiers), Files: 1, Bytes: 10},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("summarizeTiers = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("tier %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
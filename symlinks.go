@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// With --symlinks=preserve the scanner collects symlinks instead of
+// skipping them, and they are recreated as links on the destination after the
+// file copy. Relative targets are kept verbatim; absolute targets pointing
+// inside the link's own source are rewritten as relative links so they still
+// resolve within the backup; absolute targets elsewhere are skipped. Where the
+// destination cannot hold links (FAT, or Windows without the privilege) the
+// link is only recorded in the manifest, from which restore recreates it.
+//
+// With --symlinks=follow links are treated as what they point to: linked
+// files are copied and linked directories are scanned, unless that would
+// loop (see followLinkedDir).
+
+var preserveSymlinks bool
+var followSymlinks bool
+var skipDanglingSymlinks bool
+var scanSymlinks []string
+
+// followLinkedDir reports whether the directory link found in dir should be
+// scanned: not when it leads back to dir or one of its ancestors (a cycle),
+// to a directory already followed, or into an auto-excluded path.
+func followLinkedDir(link, dir string, followed map[string]bool, autoExclude []string) bool {
+	target := canonicalPath(link)
+	if followed[target] || prefixOf(canonicalPath(dir), target) || anyPrefixOf(target, autoExclude) {
+		return false
+	}
+	followed[target] = true
+	return true
+}
+
+// recreateSymlinks creates the scanned links under destDir and returns the
+// manifest records describing what happened to each.
+func recreateSymlinks(links []string, sources []string, destDir string) []ManifestRec {
+	var recs []ManifestRec
+	for _, link := range links {
+		dst := filepath.Join(destDir, relativeDestPath(link, sources))
+		rec := ManifestRec{Src: link, Dst: dst, Status: "symlink", Ts: float64(clk.Now().UnixNano()) / 1e9}
+		target, err := os.Readlink(link)
+		if err != nil {
+			rec.Status, rec.Message = "error", err.Error()
+			recs = append(recs, rec)
+			continue
+		}
+		if _, err := os.Stat(link); err != nil && skipDanglingSymlinks {
+			rec.Status, rec.Message = "skipped", "dangling symlink"
+			recs = append(recs, rec)
+			continue
+		}
+		if filepath.IsAbs(target) {
+			base := ""
+			for _, s := range sources {
+				if b, _ := filepath.Abs(expandPath(s)); prefixOf(target, b) && prefixOf(link, b) && len(b) > len(base) {
+					base = b
+				}
+			}
+			if base == "" {
+				rec.Status, rec.Message = "skipped", "absolute symlink target outside sources: "+target
+				recs = append(recs, rec)
+				continue
+			}
+			rel, err := filepath.Rel(filepath.Dir(link), target)
+			if err != nil {
+				rec.Status, rec.Message = "error", err.Error()
+				recs = append(recs, rec)
+				continue
+			}
+			target = rel
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+			rec.Status, rec.Message = "error", err.Error()
+			recs = append(recs, rec)
+			continue
+		}
+		if st, err := os.Lstat(dst); err == nil && st.Mode()&os.ModeSymlink != 0 {
+			_ = os.Remove(dst)
+		}
+		rec.Message = target
+		if err := os.Symlink(target, dst); err != nil {
+			if errors.Is(err, os.ErrPermission) || errors.Is(err, errors.ErrUnsupported) {
+				rec.Recorded = true
+			} else {
+				rec.Status, rec.Message = "error", err.Error()
+			}
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+// appendManifest adds records to an existing manifest after the copy phase.
+func appendManifest(path string, recs []ManifestRec) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		if portablePaths {
+			rec.Src, rec.Dst = filepath.ToSlash(rec.Src), filepath.ToSlash(rec.Dst)
+		}
+		b, err := json.Marshal(rec)
+		if err != nil {
+			continue
+		}
+		if _, err := fmt.Fprintf(f, "%s%s", b, manifestEOL); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// treeNode is a directory or file in the rendered destination tree. Directory
+// sizes and counts include everything beneath them.
+type treeNode struct {
+	name     string
+	dir      bool
+	size     int64
+	files    int
+	children map[string]*treeNode
+}
+
+// maxTreeFiles caps how many files are listed per directory; the rest are
+// summarised on one line.
+const maxTreeFiles = 20
+
+// buildDestTree walks a backup directory, skipping bookkeeping files.
+func buildDestTree(root string) (*treeNode, error) {
+	top := &treeNode{name: filepath.Base(root), dir: true, children: map[string]*treeNode{}}
+	meta := filepath.Clean(metaPath(root, ""))
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		if d.IsDir() && (p == meta || rel == deltaSigDir) {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || rel == manifestName || rel == runMetaName || rel == metaDirMarker || strings.HasSuffix(p, ".part") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		parts := strings.Split(rel, string(filepath.Separator))
+		n := top
+		for _, part := range parts[:len(parts)-1] {
+			n.size += info.Size()
+			n.files++
+			c := n.children[part]
+			if c == nil {
+				c = &treeNode{name: part, dir: true, children: map[string]*treeNode{}}
+				n.children[part] = c
+			}
+			n = c
+		}
+		n.size += info.Size()
+		n.files++
+		n.children[parts[len(parts)-1]] = &treeNode{name: parts[len(parts)-1], size: info.Size(), files: 1}
+		return nil
+	})
+	return top, err
+}
+
+// renderTree prints n in `tree` style down to maxDepth levels (0 = unlimited).
+// Directories below the limit are shown only as totals.
+func renderTree(w io.Writer, n *treeNode, maxDepth int) {
+	fmt.Fprintf(w, "%s/ (%d files, %s)\n", n.name, n.files, humanSize(n.size))
+	renderTreeChildren(w, n, "", 1, maxDepth)
+}
+
+func renderTreeChildren(w io.Writer, n *treeNode, prefix string, depth, maxDepth int) {
+	var dirs, files []*treeNode
+	for _, c := range n.children {
+		if c.dir {
+			dirs = append(dirs, c)
+		} else {
+			files = append(files, c)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].name < dirs[j].name })
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	hidden := 0
+	if len(files) > maxTreeFiles {
+		hidden = len(files) - maxTreeFiles
+		files = files[:maxTreeFiles]
+	}
+	entries := append(dirs, files...)
+	for i, c := range entries {
+		last := i == len(entries)-1 && hidden == 0
+		branch, indent := "├── ", "│   "
+		if last {
+			branch, indent = "└── ", "    "
+		}
+		if c.dir {
+			fmt.Fprintf(w, "%s%s%s/ (%d files, %s)\n", prefix, branch, c.name, c.files, humanSize(c.size))
+			if maxDepth <= 0 || depth < maxDepth {
+				renderTreeChildren(w, c, prefix+indent, depth+1, maxDepth)
+			}
+		} else {
+			fmt.Fprintf(w, "%s%s%s (%s)\n", prefix, branch, c.name, humanSize(c.size))
+		}
+	}
+	if hidden > 0 {
+		fmt.Fprintf(w, "%s└── … %d more files\n", prefix, hidden)
+	}
+}
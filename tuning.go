@@ -0,0 +1,145 @@
+package main
+
+import (
+	"log/slog"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Unless --fast-ssd or --boost fixes them, the copy buffer size and the
+// small/large file thresholds are tuned to the destination: the first
+// tuneSampleBytes (or tuneSampleTime) of each copy pass are timed, and from
+// the throughput and write latency measured there the rest of the pass
+// uses
+//
+//   - a buffer of about tuneBufferTime's worth of data, 1-32 MiB;
+//   - the --fast-ssd thresholds when throughput reaches tuneFastThroughput;
+//   - a larger single-write threshold when each write takes long, as on
+//     network shares, to save round trips.
+//
+// Each drive of a --span run is tuned on its own.
+
+const (
+	tuneSampleBytes    = 256 << 20
+	tuneSampleTime     = 5 * time.Second
+	tuneMinBytes       = 16 << 20 // below this the sample says nothing
+	tuneBufferTime     = 100 * time.Millisecond
+	tuneMinBuffer      = 1 << 20
+	tuneMaxBuffer      = 32 << 20
+	tuneFastThroughput = 400 << 20
+	tuneSlowWrite      = 20 * time.Millisecond
+)
+
+// copyTuning is what the copy paths read: the buffer size and thresholds
+// in effect.
+type copyTuning struct {
+	buf   int
+	small int64
+	large int64
+	fast  bool
+}
+
+// adaptiveBuffers is cleared by --adaptive-buffers=false, --fast-ssd and
+// --boost.
+var adaptiveBuffers = true
+
+var (
+	tuned   atomic.Pointer[copyTuning]
+	tunerMu sync.Mutex
+	tuner   copyTuner
+)
+
+// currentTuning returns the tuned settings, or the configured ones before
+// (or without) tuning.
+func currentTuning() copyTuning {
+	if t := tuned.Load(); t != nil {
+		return *t
+	}
+	return copyTuning{buf: defaultCopyBuffer, small: int64(smallFileThreshold), large: largeFileDirectThreshold, fast: fastSSDMode}
+}
+
+type copyTuner struct {
+	dest     string
+	agg      *progressAgg
+	start    time.Time
+	base     int64 // agg.Done() at start
+	writes   int64
+	writeDur time.Duration
+	decided  bool
+}
+
+// beginTuning starts measuring a copy pass to dest whose bytes are counted
+// by agg. A pass to the destination tuned last keeps its settings.
+func beginTuning(dest string, agg *progressAgg) {
+	if !adaptiveBuffers {
+		return
+	}
+	tunerMu.Lock()
+	defer tunerMu.Unlock()
+	t := &tuner
+	if t.dest == dest && t.decided {
+		return
+	}
+	tuned.Store(nil)
+	*t = copyTuner{dest: dest, agg: agg, start: clk.Now(), base: agg.Done()}
+}
+
+// observeWrite records one write to the destination taking d, and settles
+// the tuning once the sample is large enough.
+func observeWrite(d time.Duration) {
+	if !adaptiveBuffers {
+		return
+	}
+	tunerMu.Lock()
+	defer tunerMu.Unlock()
+	t := &tuner
+	if t.decided || t.agg == nil {
+		return
+	}
+	t.writes++
+	t.writeDur += d
+	bytes, elapsed := t.agg.Done()-t.base, activeSince(t.start)
+	if bytes < tuneSampleBytes && (elapsed < tuneSampleTime || bytes < tuneMinBytes) {
+		return
+	}
+	t.decided = true
+	rate := float64(bytes) / elapsed.Seconds()
+	latency := t.writeDur / time.Duration(t.writes)
+	c := tuneFor(rate, latency)
+	tuned.Store(&c)
+	slog.Info("Tuned copy", "throughput", humanSize(int64(rate))+"/s", "write_latency", latency.Round(time.Microsecond),
+		"buffer", humanSize(int64(c.buf)), "small_file", humanSize(c.small), "fast", c.fast)
+}
+
+// tuneFor returns the settings for a destination writing rate bytes per
+// second with the given latency per write.
+func tuneFor(rate float64, latency time.Duration) copyTuning {
+	c := currentTuning()
+	c.buf = tuneBuffer(rate)
+	if rate >= tuneFastThroughput {
+		c.fast, c.small, c.large = true, max(c.small, 512<<10), min(c.large, 16<<20)
+	}
+	if latency >= tuneSlowWrite {
+		c.small = max(c.small, 1<<20)
+	}
+	return c
+}
+
+// tuneBuffer returns the power of two closest to tuneBufferTime of data at
+// rate bytes per second, within tuneMinBuffer and tuneMaxBuffer.
+func tuneBuffer(rate float64) int {
+	n := int64(rate * tuneBufferTime.Seconds())
+	if n <= tuneMinBuffer {
+		return tuneMinBuffer
+	}
+	if n >= tuneMaxBuffer {
+		return tuneMaxBuffer
+	}
+	lo := int64(1) << (63 - bits.LeadingZeros64(uint64(n)))
+	if n-lo > 2*lo-n {
+		return int(2 * lo)
+	}
+	return int(lo)
+}
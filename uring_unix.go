@@ -0,0 +1,347 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// A minimal io_uring: one ring per copy worker, with a fixed set of
+// registered buffers. Each buffer carries one chunk of the file through a
+// READ_FIXED and then a WRITE_FIXED at the same offset, so up to depth
+// chunks are in flight and the kernel sees one io_uring_enter per batch
+// instead of a read and a write syscall per chunk.
+
+const (
+	uringChunk = 1 << 20
+
+	uringOpReadFixed  = 4
+	uringOpWriteFixed = 5
+
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+
+	uringEnterGetEvents   = 1
+	uringRegisterBuffers  = 0
+	uringFeatSingleMmap   = 1
+	uringSQESize          = 64
+	uringCQESize          = 16
+	uringUserDataOpShift  = 32
+	uringUserDataSlotMask = 1<<32 - 1
+)
+
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	rwFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	addr3       uint64
+	_           uint64
+}
+
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// uringParams mirrors struct io_uring_params.
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  uringSQOffsets
+	cqOff                                                                  uringCQOffsets
+}
+
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uring struct {
+	fd       int
+	sqRing   []byte
+	cqRing   []byte
+	sqeMem   []byte
+	bufMem   []byte
+	bufs     [][]byte
+	sqHead   *uint32
+	sqTail   *uint32
+	sqMask   uint32
+	sqArray  unsafe.Pointer
+	cqHead   *uint32
+	cqTail   *uint32
+	cqMask   uint32
+	cqes     unsafe.Pointer
+	queued   uint32 // SQEs written but not yet submitted
+	inFlight int
+	inFd     int
+	outFd    int
+}
+
+// uringDepth is the number of chunks each worker keeps in flight with
+// --io-uring; 0 when the engine is off.
+var uringDepth int
+
+var (
+	uringMu   sync.Mutex
+	uringFree []*uring
+)
+
+// probeUring sets up one ring of the given depth, so a kernel without
+// io_uring (or one that forbids it) is found before the copy starts.
+func probeUring(depth int) error {
+	r, err := newUring(depth)
+	if err != nil {
+		return err
+	}
+	uringDepth = depth
+	putUring(r)
+	return nil
+}
+
+func getUring() (*uring, error) {
+	uringMu.Lock()
+	if n := len(uringFree); n > 0 {
+		r := uringFree[n-1]
+		uringFree = uringFree[:n-1]
+		uringMu.Unlock()
+		return r, nil
+	}
+	uringMu.Unlock()
+	return newUring(uringDepth)
+}
+
+func putUring(r *uring) {
+	uringMu.Lock()
+	uringFree = append(uringFree, r)
+	uringMu.Unlock()
+}
+
+func newUring(depth int) (*uring, error) {
+	var p uringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(depth), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("io_uring_setup: %w", errno)
+	}
+	r := &uring{fd: int(fd)}
+	fail := func(err error) (*uring, error) {
+		r.close()
+		return nil, err
+	}
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uringCQESize)
+	if p.features&uringFeatSingleMmap != 0 {
+		sqSize = max(sqSize, cqSize)
+	}
+	var err error
+	if r.sqRing, err = unix.Mmap(r.fd, uringOffSQRing, sqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		return fail(fmt.Errorf("io_uring mmap: %w", err))
+	}
+	r.cqRing = r.sqRing
+	if p.features&uringFeatSingleMmap == 0 {
+		if r.cqRing, err = unix.Mmap(r.fd, uringOffCQRing, cqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+			return fail(fmt.Errorf("io_uring mmap: %w", err))
+		}
+	}
+	if r.sqeMem, err = unix.Mmap(r.fd, uringOffSQEs, int(p.sqEntries)*uringSQESize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		return fail(fmt.Errorf("io_uring mmap: %w", err))
+	}
+	sq, cq := unsafe.Pointer(&r.sqRing[0]), unsafe.Pointer(&r.cqRing[0])
+	r.sqHead = (*uint32)(unsafe.Add(sq, p.sqOff.head))
+	r.sqTail = (*uint32)(unsafe.Add(sq, p.sqOff.tail))
+	r.sqMask = *(*uint32)(unsafe.Add(sq, p.sqOff.ringMask))
+	r.sqArray = unsafe.Add(sq, p.sqOff.array)
+	r.cqHead = (*uint32)(unsafe.Add(cq, p.cqOff.head))
+	r.cqTail = (*uint32)(unsafe.Add(cq, p.cqOff.tail))
+	r.cqMask = *(*uint32)(unsafe.Add(cq, p.cqOff.ringMask))
+	r.cqes = unsafe.Add(cq, p.cqOff.cqes)
+
+	// The buffers live outside the Go heap and are registered once, so
+	// the kernel does not map them again for every request.
+	if r.bufMem, err = unix.Mmap(-1, 0, depth*uringChunk, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS); err != nil {
+		return fail(fmt.Errorf("io_uring buffers: %w", err))
+	}
+	iovecs := make([]unix.Iovec, depth)
+	for i := range iovecs {
+		b := r.bufMem[i*uringChunk : (i+1)*uringChunk]
+		r.bufs = append(r.bufs, b)
+		iovecs[i].Base = &b[0]
+		iovecs[i].SetLen(len(b))
+	}
+	if _, _, errno := unix.Syscall6(unix.SYS_IO_URING_REGISTER, uintptr(r.fd), uringRegisterBuffers, uintptr(unsafe.Pointer(&iovecs[0])), uintptr(depth), 0, 0); errno != 0 {
+		return fail(fmt.Errorf("io_uring_register: %w", errno))
+	}
+	return r, nil
+}
+
+func (r *uring) close() {
+	if r.cqRing != nil && r.sqRing != nil && &r.cqRing[0] != &r.sqRing[0] {
+		_ = unix.Munmap(r.cqRing)
+	}
+	for _, m := range [][]byte{r.bufMem, r.sqeMem, r.sqRing} {
+		if m != nil {
+			_ = unix.Munmap(m)
+		}
+	}
+	_ = unix.Close(r.fd)
+}
+
+// queue adds one fixed-buffer read of r.inFd or write of r.outFd for slot
+// to the submission queue.
+func (r *uring) queue(op uint8, slot int, buf []byte, off int64) {
+	fd := r.inFd
+	if op == uringOpWriteFixed {
+		fd = r.outFd
+	}
+	tail := *r.sqTail
+	idx := tail & r.sqMask
+	sqe := (*uringSQE)(unsafe.Add(unsafe.Pointer(&r.sqeMem[0]), uintptr(idx)*uringSQESize))
+	*sqe = uringSQE{
+		opcode:   op,
+		fd:       int32(fd),
+		off:      uint64(off),
+		addr:     uint64(uintptr(unsafe.Pointer(&buf[0]))),
+		len:      uint32(len(buf)),
+		userData: uint64(op)<<uringUserDataOpShift | uint64(slot),
+		bufIndex: uint16(slot),
+	}
+	*(*uint32)(unsafe.Add(r.sqArray, uintptr(idx)*4)) = idx
+	atomic.StoreUint32(r.sqTail, tail+1)
+	r.queued++
+	r.inFlight++
+}
+
+// wait submits the queued requests and waits for at least one completion,
+// calling fn for each one that has arrived.
+func (r *uring) wait(fn func(op uint8, slot int, res int32)) error {
+	for {
+		_, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(r.queued), 1, uringEnterGetEvents, 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return fmt.Errorf("io_uring_enter: %w", errno)
+		}
+		r.queued = 0
+		break
+	}
+	head := *r.cqHead
+	tail := atomic.LoadUint32(r.cqTail)
+	for ; head != tail; head++ {
+		cqe := (*uringCQE)(unsafe.Add(r.cqes, uintptr(head&r.cqMask)*uringCQESize))
+		r.inFlight--
+		fn(uint8(cqe.userData>>uringUserDataOpShift), int(cqe.userData&uringUserDataSlotMask), cqe.res)
+	}
+	atomic.StoreUint32(r.cqHead, head)
+	return nil
+}
+
+// uringCopy copies size bytes from in to out through a pooled ring,
+// keeping up to uringDepth chunks in flight. It returns errNoKernelCopy
+// when no ring can be had.
+func uringCopy(ctx context.Context, out, in *os.File, size int64, agg *progressAgg) (int64, error) {
+	r, err := getUring()
+	if err != nil {
+		return 0, errNoKernelCopy
+	}
+	type slot struct {
+		off  int64 // file offset of the chunk
+		want int   // chunk length
+		done int   // bytes read or written so far in the current step
+	}
+	slots := make([]slot, len(r.bufs))
+	r.inFd, r.outFd = int(in.Fd()), int(out.Fd())
+	var next, copied int64
+	var firstErr error
+	eof := false
+	readNext := func(i int) {
+		if firstErr != nil || eof || next >= size {
+			return
+		}
+		n := int(min(size-next, uringChunk))
+		if err := throttle(ctx, n); err != nil || ctx.Err() != nil {
+			firstErr = fmt.Errorf("cancelled")
+			return
+		}
+		slots[i] = slot{off: next, want: n}
+		next += int64(n)
+		r.queue(uringOpReadFixed, i, r.bufs[i][:n], slots[i].off)
+	}
+	for i := range slots {
+		readNext(i)
+	}
+	for r.inFlight > 0 {
+		err := r.wait(func(op uint8, i int, res int32) {
+			s := &slots[i]
+			if res < 0 {
+				if errno := unix.Errno(-res); errno == unix.EINTR || errno == unix.EAGAIN {
+					r.queue(op, i, r.bufs[i][s.done:s.want], s.off+int64(s.done))
+				} else if firstErr == nil {
+					firstErr = errno
+				}
+				return
+			}
+			if firstErr != nil {
+				return
+			}
+			s.done += int(res)
+			switch {
+			case op == uringOpReadFixed && res == 0:
+				// The source shrank since it was opened: keep what was read.
+				eof, s.want = true, s.done
+				if s.want > 0 {
+					s.done = 0
+					r.queue(uringOpWriteFixed, i, r.bufs[i][:s.want], s.off)
+				}
+			case s.done < s.want:
+				r.queue(op, i, r.bufs[i][s.done:s.want], s.off+int64(s.done))
+			case op == uringOpReadFixed:
+				s.done = 0
+				r.queue(uringOpWriteFixed, i, r.bufs[i][:s.want], s.off)
+			default:
+				copied += int64(s.want)
+				if agg != nil {
+					agg.Add(int64(s.want))
+				}
+				readNext(i)
+			}
+		})
+		if err != nil {
+			// The ring is in an unknown state; drop it rather than reuse it.
+			r.close()
+			return copied, err
+		}
+	}
+	putUring(r)
+	if firstErr != nil {
+		return copied, firstErr
+	}
+	if copied < size {
+		if err := out.Truncate(copied); err != nil {
+			return copied, err
+		}
+	}
+	return copied, nil
+}
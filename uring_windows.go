@@ -0,0 +1,20 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// uringDepth stays 0: io_uring is Linux only.
+var uringDepth int
+
+func probeUring(depth int) error {
+	return errors.New("io_uring is only available on Linux")
+}
+
+func uringCopy(ctx context.Context, out, in *os.File, size int64, agg *progressAgg) (int64, error) {
+	return 0, errNoKernelCopy
+}
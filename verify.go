@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// verifyResult is the outcome for one file in a verify pass.
+type verifyResult struct {
+	Path      string
+	Problem   string // empty when the file verified
+	Corrupted bool   // content differs from the checksum recorded at backup time
+}
+
+// runVerify implements `backuper verify`: read every file the manifest says
+// was backed up, once, and check it is present, readable and intact.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	dir := fs.String("dir", "", "Backup folder to verify (relative to the USB root, or absolute)")
+	passFile := fs.String("passphrase-file", "", "Read the password for encrypted zip archives from this file")
+	_ = fs.Parse(args)
+	g.apply()
+
+	root, err := usbRoot()
+	mustNoErr(err)
+	backupDir, err := resolveBackupDir(root, *dir)
+	mustNoErr(err)
+	recs, err := backupRecords(backupDir)
+	mustNoErr(err)
+	var total int64
+	for _, rec := range recs {
+		total += rec.Size
+	}
+	mustNoErr(prepareArchives(backupDir, recs, *passFile))
+
+	w := g.workers
+	if w <= 0 {
+		w = autoWorkers(detectMedia(backupDir))
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	fmt.Printf("Verifying %d files (%s) in %s with %d reader(s)...\n", len(recs), humanSize(total), backupDir, w)
+	agg := &progressAgg{total: total, start: clk.Now()}
+	jobs := make(chan ManifestRec)
+	results := make(chan verifyResult)
+	var wg sync.WaitGroup
+	for i := 0; i < w; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range jobs {
+				results <- verifyOne(rec, backupDir, agg)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, rec := range recs {
+			select {
+			case jobs <- rec:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var bad []verifyResult
+	checked, withSums := 0, 0
+	for _, rec := range recs {
+		if rec.Checksum != "" {
+			withSums++
+		}
+	}
+	for done := false; !done; {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				done = true
+				break
+			}
+			checked++
+			if r.Problem != "" {
+				bad = append(bad, r)
+			}
+		case <-ticker.C:
+			printTotalLine(formatTotalLine(agg))
+		}
+	}
+	if isTTY() {
+		fmt.Println()
+	}
+
+	elapsed := since(agg.start).Seconds()
+	speed := float64(0)
+	if elapsed > 0 {
+		speed = float64(agg.Done()) / elapsed
+	}
+	sort.Slice(bad, func(i, j int) bool { return bad[i].Path < bad[j].Path })
+	var corrupted []string
+	for _, r := range bad {
+		fmt.Printf("FAIL %s: %s\n", r.Path, r.Problem)
+		if r.Corrupted {
+			corrupted = append(corrupted, r.Path)
+		}
+	}
+	if withSums == 0 {
+		fmt.Println("Note: no checksums in the manifest (back up with --checksums); only presence, readability and size were checked")
+	} else if len(corrupted) > 0 {
+		fmt.Printf("Corrupted files (%d of %d with checksums):\n", len(corrupted), withSums)
+		for _, p := range corrupted {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	fmt.Printf("Verified %d/%d files, %s in %.2fs (%s/s): %d problem(s)\n",
+		checked, len(recs), humanSize(agg.Done()), elapsed, humanSize(int64(speed)), len(bad))
+	switch {
+	case ctx.Err() != nil:
+		fmt.Println("Result: INCOMPLETE (interrupted)")
+		os.Exit(1)
+	case len(bad) > 0:
+		fmt.Println("Result: FAIL")
+		os.Exit(1)
+	}
+	fmt.Println("Result: PASS")
+}
+
+// backupRecords returns the files the backup in dir holds according to its
+// manifest, sorted by destination path, with destinations re-anchored on
+// dir. The latest successful record per destination wins.
+func backupRecords(dir string) ([]ManifestRec, error) {
+	manifest, ok := manifestIn(dir)
+	if !ok {
+		return nil, fmt.Errorf("no manifest found in %s", dir)
+	}
+	latest := map[string]ManifestRec{}
+	err := readManifest(manifest, func(rec ManifestRec) {
+		if rec.Status == "copied" || rec.Status == "skipped" {
+			latest[rebaseDst(rec.Dst, dir)] = rec
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	recs := make([]ManifestRec, 0, len(latest))
+	for dst, rec := range latest {
+		rec.Dst = dst
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Dst < recs[j].Dst })
+	return recs, nil
+}
+
+// verifyOne reads the whole file through the hasher so every block is
+// actually fetched from the device, then checks it against the record.
+func verifyOne(rec ManifestRec, backupDir string, agg *progressAgg) verifyResult {
+	if rec.Archive != "" {
+		return verifyArchived(rec, backupDir, agg)
+	}
+	path := rec.Dst
+	if rec.Dedup == "ref" {
+		obj, _, err := resolveRef(rec.Dst)
+		if err != nil {
+			agg.AddTotal(-rec.Size)
+			return verifyResult{Path: rec.Dst, Problem: "broken store pointer: " + err.Error()}
+		}
+		path = obj
+	}
+	st, err := statDest(path)
+	if err != nil {
+		agg.AddTotal(-rec.Size)
+		return verifyResult{Path: rec.Dst, Problem: "missing"}
+	}
+	algo, want, hasSum := splitChecksum(rec.Checksum)
+	if !hasSum {
+		algo = "sha256"
+	}
+	sum, err := hashStored(path, rec.Parts, algo)
+	if err != nil {
+		agg.AddTotal(-rec.Size)
+		return verifyResult{Path: rec.Dst, Problem: "read error: " + err.Error()}
+	}
+	wantSize := rec.Size
+	if rec.StoredSize != 0 {
+		wantSize = rec.StoredSize // compressed: the file on disk is the stored form
+	}
+	agg.Add(st.Size())
+	agg.AddTotal(st.Size() - rec.Size)
+	if wantSize != 0 && st.Size() != wantSize {
+		return verifyResult{Path: rec.Dst, Problem: fmt.Sprintf("size %d, manifest says %d", st.Size(), wantSize)}
+	}
+	if hasSum && want != sum {
+		return verifyResult{Path: rec.Dst, Problem: "checksum mismatch", Corrupted: true}
+	}
+	return verifyResult{Path: rec.Dst}
+}
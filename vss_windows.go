@@ -0,0 +1,75 @@
+//go:build windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// shadowCreateScript creates a client-accessible shadow copy of the volume
+// in $env:BACKUPER_VOLUME and prints its ID and device path.
+const shadowCreateScript = `$r = Invoke-CimMethod -ClassName Win32_ShadowCopy -MethodName Create -Arguments @{Volume = $env:BACKUPER_VOLUME; Context = 'ClientAccessible'}
+if ($r.ReturnValue -ne 0) { [Console]::Error.WriteLine("Win32_ShadowCopy.Create returned $($r.ReturnValue)"); exit 1 }
+$s = Get-CimInstance Win32_ShadowCopy -Filter "ID='$($r.ShadowID)'"
+$r.ShadowID
+$s.DeviceObject`
+
+const shadowDeleteScript = `Get-CimInstance Win32_ShadowCopy -Filter "ID='$env:BACKUPER_SHADOW'" | Remove-CimInstance`
+
+func runShadowScript(script string, env ...string) (string, error) {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", "-")
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Env = append(cmd.Environ(), env...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// snapshotRoot returns the volume (C:\) holding path; network shares
+// have no shadow copies.
+func snapshotRoot(path string) string {
+	if vol := filepath.VolumeName(path); vol != "" && !strings.HasPrefix(vol, `\\`) {
+		return vol + `\`
+	}
+	return ""
+}
+
+// takeSnapshot creates a Volume Shadow Copy of volume.
+func takeSnapshot(volume string) (sourceSnapshot, error) {
+	id, device, err := createShadowCopy(volume)
+	if err != nil {
+		return sourceSnapshot{}, err
+	}
+	return sourceSnapshot{live: volume, snap: device, remove: func() error { return deleteShadowCopy(id) }}, nil
+}
+
+// createShadowCopy snapshots volume (C:\) and returns the shadow copy's ID
+// and device path.
+func createShadowCopy(volume string) (id, device string, err error) {
+	out, err := runShadowScript(shadowCreateScript, "BACKUPER_VOLUME="+volume)
+	if err != nil {
+		return "", "", fmt.Errorf("shadow copy of %s (needs administrator rights): %w", volume, err)
+	}
+	lines := strings.Fields(out)
+	if len(lines) != 2 {
+		return "", "", fmt.Errorf("shadow copy of %s: unexpected output %q", volume, out)
+	}
+	return lines[0], lines[1], nil
+}
+
+func deleteShadowCopy(id string) error {
+	_, err := runShadowScript(shadowDeleteScript, "BACKUPER_SHADOW="+id)
+	return err
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchFilter decides which changed files watch mode copies: the scan's
+// exclusions apply, and only tiers the initial selection reached are kept
+// so a drive that could not hold low-priority files is not filled with them.
+type watchFilter struct {
+	tiers       []Tier
+	excludes    []string
+	autoExclude []string
+	minPriority int
+	ignore      *ignorer
+}
+
+func (f watchFilter) skipDir(path string) bool {
+	if _, skip := excludedDirNames[filepath.Base(path)]; skip {
+		return true
+	}
+	return matchAny(path, f.excludes) || anyPrefixOf(path, f.autoExclude) || f.ignore.Ignored(path, true)
+}
+
+func (f watchFilter) keepFile(path string) bool {
+	if matchAny(strings.ToLower(path), lowerAll(f.excludes)) || anyPrefixOf(path, f.autoExclude) || f.ignore.Ignored(path, false) {
+		return false
+	}
+	tier, pr := classifyFile(contentPath(path), f.tiers)
+	if scoreRule != nil {
+		if st, err := os.Stat(path); err == nil {
+			pr = scoreRule.Priority(contentPath(path), tier, pr, st.Size(), st.ModTime())
+		}
+	}
+	return pr >= f.minPriority
+}
+
+// watchSources implements --watch: after the initial pass it follows
+// filesystem notifications on the sources and copies files once they have
+// been quiet for debounce. It returns when ctx is cancelled.
+func watchSources(ctx context.Context, sources []string, destDir, manifestPath string, workers int, debounce time.Duration, reserve int64, f watchFilter) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	pending := map[string]time.Time{}
+	// addTree watches dir and everything below it; with queue set, files
+	// already inside (a directory moved or extracted in) are queued too.
+	addTree := func(dir string, queue bool) {
+		_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if p != dir && f.skipDir(p) {
+					return filepath.SkipDir
+				}
+				if err := w.Add(p); err != nil {
+					slog.Warn("cannot watch", "dir", p, "error", err)
+				}
+				return nil
+			}
+			if queue && d.Type().IsRegular() {
+				pending[p] = clk.Now()
+			}
+			return nil
+		})
+	}
+	for _, src := range sources {
+		abs, err := filepath.Abs(expandPath(src))
+		if err != nil || anyPrefixOf(abs, f.autoExclude) {
+			continue
+		}
+		if st, err := os.Stat(abs); err == nil && st.IsDir() {
+			f.ignore.AddRoot(abs)
+			addTree(abs, false)
+		}
+	}
+	fmt.Printf("Watching %d source(s) for changes (debounce %s); press Ctrl+C to stop\n", len(sources), debounce)
+
+	ticker := time.NewTicker(debounce / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("watch", "error", err)
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) {
+				continue
+			}
+			st, err := os.Lstat(ev.Name)
+			if err != nil {
+				continue
+			}
+			if st.IsDir() {
+				if ev.Has(fsnotify.Create) && !f.skipDir(ev.Name) {
+					addTree(ev.Name, true)
+				}
+				continue
+			}
+			if containsString(f.ignore.Names(), filepath.Base(ev.Name)) {
+				f.ignore.Forget()
+			}
+			if st.Mode().IsRegular() {
+				pending[ev.Name] = clk.Now()
+			}
+		case <-ticker.C:
+			var pairs [][2]string
+			for p, t := range pending {
+				if since(t) < debounce {
+					continue
+				}
+				delete(pending, p)
+				if pair, ok := watchPair(p, sources, destDir, f); ok {
+					pairs = append(pairs, pair)
+				}
+			}
+			if len(pairs) == 0 {
+				continue
+			}
+			pairs = fitFree(pairs, usableFreeSpace(destDir, reserve)-manifestReserveSize(len(pairs)))
+			copied, errorsN, bytes := copyAll(ctx, pairs, manifestPath, workers, nil)
+			fmt.Printf("Watch: copied %d changed files (%s), errors=%d\n", copied, humanSize(bytes), errorsN)
+			if errorsN > 0 {
+				notify("Backup errors", fmt.Sprintf("%d of %d changed files could not be copied to %s", errorsN, len(pairs), destDir))
+			}
+		}
+	}
+}
+
+// watchPair maps a changed source file to its destination, or reports false
+// when it is filtered out or the backup already holds this version.
+func watchPair(src string, sources []string, destDir string, f watchFilter) ([2]string, bool) {
+	sst, err := os.Stat(src)
+	if err != nil || !sst.Mode().IsRegular() || !f.keepFile(src) || !scanLimits.keep(sst.Size(), sst.ModTime()) {
+		return [2]string{}, false
+	}
+	dst := storedPath(src, filepath.Join(destDir, relativeDestPath(src, sources)))
+	if st, err := statDest(dst); err == nil && upToDate(nil, src, dst, sst, st) {
+		return [2]string{}, false
+	}
+	return [2]string{src, dst}, true
+}
+
+// fitFree drops files once budget is used up, warning about each.
+func fitFree(pairs [][2]string, budget int64) [][2]string {
+	out := pairs[:0]
+	for _, p := range pairs {
+		st, err := os.Stat(p[0])
+		if err != nil {
+			continue
+		}
+		if st.Size() > budget {
+			slog.Warn("not enough space", "file", p[0], "bytes", st.Size())
+			continue
+		}
+		budget -= st.Size()
+		out = append(out, p)
+	}
+	return out
+}